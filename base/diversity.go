@@ -0,0 +1,127 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"github.com/chewxy/math32"
+	"github.com/scylladb/go-set/strset"
+	"strings"
+)
+
+// Diversify re-ranks the first n items by maximal marginal relevance (MMR). Items should be sorted by scores in
+// descending order. Each position in the first n positions is filled by the item maximizing
+//
+//	lambda * relevance - (1 - lambda) * max similarity to items placed before
+//
+// where relevance is the score scaled into [0, 1] and similarity is the Jaccard index of labels and categories.
+// Besides, at most caps[prefix] items sharing a label starting with the prefix are placed in the first n positions.
+// Remaining items follow in the original order. It returns the new order of items as indices.
+func Diversify(scores []float32, labels, categories [][]string, lambda float32, n int, caps map[string]int) []int {
+	// scale scores into [0, 1]
+	relevance := make([]float32, len(scores))
+	if len(scores) > 0 {
+		minScore, maxScore := scores[0], scores[0]
+		for _, score := range scores {
+			minScore = math32.Min(minScore, score)
+			maxScore = math32.Max(maxScore, score)
+		}
+		for i, score := range scores {
+			if maxScore > minScore {
+				relevance[i] = (score - minScore) / (maxScore - minScore)
+			} else {
+				relevance[i] = 1
+			}
+		}
+	}
+	// features of items
+	features := make([]*strset.Set, len(scores))
+	for i := range features {
+		features[i] = strset.New()
+		if i < len(labels) {
+			for _, label := range labels[i] {
+				features[i].Add("label/" + label)
+			}
+		}
+		if i < len(categories) {
+			for _, category := range categories[i] {
+				features[i].Add("category/" + category)
+			}
+		}
+	}
+
+	order := make([]int, 0, len(scores))
+	placed := make([]bool, len(scores))
+	capped := make([]bool, len(scores))
+	maxSimilarity := make([]float32, len(scores))
+	counts := make(map[string]int)
+	for len(order) < n && len(order) < len(scores) {
+		best, bestScore := -1, math32.Inf(-1)
+		for i := range scores {
+			if placed[i] || capped[i] {
+				continue
+			}
+			// counts never decrease, so capped items are skipped thereafter
+			if i < len(labels) && exceedCaps(labels[i], counts, caps) {
+				capped[i] = true
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		order = append(order, best)
+		placed[best] = true
+		if best < len(labels) {
+			for _, label := range labels[best] {
+				counts[label]++
+			}
+		}
+		for i := range scores {
+			if !placed[i] && !capped[i] {
+				maxSimilarity[i] = math32.Max(maxSimilarity[i], jaccard(features[i], features[best]))
+			}
+		}
+	}
+	for i := range scores {
+		if !placed[i] {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// exceedCaps checks whether placing an item with these labels exceeds caps.
+func exceedCaps(labels []string, counts map[string]int, caps map[string]int) bool {
+	for _, label := range labels {
+		for prefix, limit := range caps {
+			if strings.HasPrefix(label, prefix) && counts[label] >= limit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jaccard(a, b *strset.Set) float32 {
+	union := strset.Union(a, b).Size()
+	if union == 0 {
+		return 0
+	}
+	return float32(strset.Intersection(a, b).Size()) / float32(union)
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiversify(t *testing.T) {
+	assert.Empty(t, Diversify(nil, nil, nil, 0.5, 10, nil))
+	// relevance only
+	assert.Equal(t, []int{0, 1, 2}, Diversify([]float32{3, 2, 1},
+		[][]string{{"a"}, {"a"}, {"a"}}, nil, 1, 10, nil))
+	// similar items are placed later
+	assert.Equal(t, []int{0, 2, 1}, Diversify([]float32{1, 0.9, 0.8},
+		[][]string{{"a"}, {"a"}, {"b"}}, nil, 0.5, 10, nil))
+	assert.Equal(t, []int{0, 2, 1}, Diversify([]float32{1, 0.9, 0.8},
+		nil, [][]string{{"a"}, {"a"}, {"b"}}, 0.5, 10, nil))
+	// only the first n items are re-ranked
+	assert.Equal(t, []int{0, 1, 2}, Diversify([]float32{1, 0.9, 0.8},
+		[][]string{{"a"}, {"a"}, {"b"}}, nil, 0.5, 1, nil))
+	// at most 2 items per author in the first 3 positions
+	caps := map[string]int{"author:": 2}
+	labels := [][]string{{"author:x"}, {"author:x", "tag"}, {"author:x"}, {"author:y"}}
+	assert.Equal(t, []int{0, 1, 3, 2}, Diversify([]float32{4, 3, 2, 1}, labels, nil, 1, 3, caps))
+	assert.Equal(t, []int{0, 1, 2, 3}, Diversify([]float32{4, 3, 2, 1}, labels, nil, 1, 2, caps))
+	assert.Equal(t, []int{0, 1, 2, 3}, Diversify([]float32{4, 3, 2, 1}, labels, nil, 1, 3, map[string]int{"tag": 2}))
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into lower-case tokens. Tokens are runs of letters or digits, except that each Han character
+// is a token since words are not separated by spaces in Chinese.
+func Tokenize(text string) []string {
+	var tokens []string
+	var builder strings.Builder
+	flush := func() {
+		if builder.Len() > 0 {
+			tokens = append(tokens, builder.String())
+			builder.Reset()
+		}
+	}
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			flush()
+			tokens = append(tokens, string(r))
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(unicode.ToLower(r))
+		} else {
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
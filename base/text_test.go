@@ -0,0 +1,26 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Empty(t, Tokenize(""))
+	assert.Equal(t, []string{"hello", "world", "2022"}, Tokenize("Hello, World! (2022)"))
+	assert.Equal(t, []string{"gorse", "推", "荐", "系", "统"}, Tokenize("Gorse推荐系统"))
+}
@@ -24,8 +24,10 @@ import (
 	"go.uber.org/zap"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
+	"syscall"
 )
 
 var logger *zap.Logger
@@ -219,3 +221,14 @@ func ParseFloat32(val string) float32 {
 	}
 	return float32(f)
 }
+
+// ShutdownOnSignal calls shutdown and exits after SIGINT or SIGTERM is received.
+func ShutdownOnSignal(shutdown func()) {
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		shutdown()
+		os.Exit(0)
+	}()
+}
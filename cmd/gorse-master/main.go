@@ -54,6 +54,8 @@ var masterCommand = &cobra.Command{
 		}
 		cachePath, _ := cmd.PersistentFlags().GetString("cache-path")
 		l := master.NewMaster(conf, cachePath)
+		// close cache store on termination
+		base.ShutdownOnSignal(l.Shutdown)
 		l.Serve()
 	},
 }
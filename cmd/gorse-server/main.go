@@ -52,6 +52,8 @@ var serverCommand = &cobra.Command{
 		httpHost, _ := cmd.PersistentFlags().GetString("http-host")
 		cachePath, _ := cmd.PersistentFlags().GetString("cache-path")
 		s := server.NewServer(masterHost, masterPort, httpHost, httpPort, cachePath)
+		// close cache store on termination
+		base.ShutdownOnSignal(s.Shutdown)
 		s.Serve()
 	},
 }
@@ -53,6 +53,8 @@ var workerCommand = &cobra.Command{
 		// create worker
 		cachePath, _ := cmd.PersistentFlags().GetString("cache-path")
 		w := worker.NewWorker(masterHost, masterPort, httpHost, httpPort, workingJobs, cachePath)
+		// close cache store on termination
+		base.ShutdownOnSignal(w.Shutdown)
 		w.Serve()
 	},
 }
@@ -15,17 +15,22 @@
 package config
 
 import (
+	"fmt"
 	"github.com/juju/errors"
+	"github.com/scylladb/go-set/strset"
 	"github.com/spf13/viper"
 	"github.com/zhenghaoz/gorse/base"
 	"go.uber.org/zap"
+	"hash/fnv"
 	"sync"
 )
 
 const (
-	NeighborTypeAuto    = "auto"
-	NeighborTypeSimilar = "similar"
-	NeighborTypeRelated = "related"
+	NeighborTypeAuto      = "auto"
+	NeighborTypeSimilar   = "similar"
+	NeighborTypeRelated   = "related"
+	NeighborTypeEmbedding = "embedding"
+	NeighborTypeContent   = "content"
 )
 
 // Config is the configuration for the engine.
@@ -68,6 +73,8 @@ type DatabaseConfig struct {
 	ReadFeedbackTypes    []string `mapstructure:"read_feedback_types"`     // feedback type for read event
 	PositiveFeedbackTTL  uint     `mapstructure:"positive_feedback_ttl"`   // time-to-live of positive feedbacks
 	ItemTTL              uint     `mapstructure:"item_ttl"`                // item-to-live of items
+	UserAttributes       []string `mapstructure:"user_attributes"`         // typed user attributes used as features
+	ImpressionTTL        uint     `mapstructure:"impression_ttl"`          // time-to-live of impressions
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
@@ -77,6 +84,7 @@ func (config *DatabaseConfig) LoadDefaultIfNil() *DatabaseConfig {
 			AutoInsertUser: true,
 			AutoInsertItem: true,
 			CacheSize:      100,
+			ImpressionTTL:  30,
 		}
 	}
 	return config
@@ -87,6 +95,7 @@ func (config *DatabaseConfig) validate() {
 	validatePositive("cache_size", config.CacheSize)
 	validateNotEmpty("positive_feedback_types", config.PositiveFeedbackType)
 	validateNotEmpty("read_feedback_types", config.ReadFeedbackTypes)
+	validateSubset("user_attributes", config.UserAttributes, []string{"gender"})
 }
 
 // MasterConfig is the configuration for the master.
@@ -99,18 +108,22 @@ type MasterConfig struct {
 	MetaTimeout       int    `mapstructure:"meta_timeout"`        // cluster meta timeout (second)
 	DashboardUserName string `mapstructure:"dashboard_user_name"` // dashboard user name
 	DashboardPassword string `mapstructure:"dashboard_password"`  // dashboard password
+	ModelDir          string `mapstructure:"model_dir"`           // directory of model registry
+	ModelHistory      int    `mapstructure:"model_history"`       // number of model versions kept in model registry
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
 func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
 	if config == nil {
 		return &MasterConfig{
-			Port:        8086,
-			Host:        "127.0.0.1",
-			HttpPort:    8088,
-			HttpHost:    "127.0.0.1",
-			NumJobs:     1,
-			MetaTimeout: 60,
+			Port:         8086,
+			Host:         "127.0.0.1",
+			HttpPort:     8088,
+			HttpHost:     "127.0.0.1",
+			NumJobs:      1,
+			MetaTimeout:  60,
+			ModelDir:     "models",
+			ModelHistory: 10,
 		}
 	}
 	return config
@@ -120,17 +133,30 @@ func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
 func (config *MasterConfig) validate() {
 	validatePositive("n_jobs", config.NumJobs)
 	validatePositive("meta_timeout", config.MetaTimeout)
+	validateNotNegative("model_history", config.ModelHistory)
 }
 
 // RecommendConfig is the configuration of recommendation setup.
 type RecommendConfig struct {
 	PopularWindow                int                `mapstructure:"popular_window"`
 	FitPeriod                    int                `mapstructure:"fit_period"`
+	EnableWarmStart              bool               `mapstructure:"enable_warm_start"`
+	WarmStartEpochs              int                `mapstructure:"warm_start_epochs"`
+	FullRetrainPeriod            int                `mapstructure:"full_retrain_period"`
+	EnablePromotionGate          bool               `mapstructure:"enable_promotion_gate"`
+	ValidationWindow             int                `mapstructure:"validation_window"`
+	PromotionMinImprovement      float32            `mapstructure:"promotion_min_improvement"`
+	SplitStrategy                string             `mapstructure:"split_strategy"`
+	SplitNumLatest               int                `mapstructure:"split_num_latest"`
+	SplitCutoffWindow            int                `mapstructure:"split_cutoff_window"`
 	SearchPeriod                 int                `mapstructure:"search_period"`
 	SearchEpoch                  int                `mapstructure:"search_epoch"`
 	SearchTrials                 int                `mapstructure:"search_trials"`
+	SearchStrategy               string             `mapstructure:"search_strategy"`
 	CheckRecommendPeriod         int                `mapstructure:"check_recommend_period"`
 	RefreshRecommendPeriod       int                `mapstructure:"refresh_recommend_period"`
+	EnableRefreshQueue           bool               `mapstructure:"enable_refresh_queue"`
+	RefreshQueuePeriod           int                `mapstructure:"refresh_queue_period"`
 	FallbackRecommend            []string           `mapstructure:"fallback_recommend"`
 	NumFeedbackFallbackItemBased int                `mapstructure:"num_feedback_fallback_item_based"`
 	ExploreRecommend             map[string]float64 `mapstructure:"explore_recommend"`
@@ -146,17 +172,141 @@ type RecommendConfig struct {
 	EnablePopularRecommend       bool               `mapstructure:"enable_popular_recommend"`
 	EnableUserBasedRecommend     bool               `mapstructure:"enable_user_based_recommend"`
 	EnableItemBasedRecommend     bool               `mapstructure:"enable_item_based_recommend"`
+	EnableSubscribeRecommend     bool               `mapstructure:"enable_subscribe_recommend"`
+	SubscribeBoost               float32            `mapstructure:"subscribe_boost"`
 	EnableColRecommend           bool               `mapstructure:"enable_collaborative_recommend"`
 	EnableColIndex               bool               `mapstructure:"enable_collaborative_index"`
 	ColIndexRecall               float32            `mapstructure:"collaborative_index_recall"`
 	ColIndexFitEpoch             int                `mapstructure:"collaborative_index_fit_epoch"`
+	EnableItemAudience           bool               `mapstructure:"enable_item_audience"`
+	EnableItemAudienceIndex      bool               `mapstructure:"enable_item_audience_index"`
+	ItemAudienceIndexRecall      float32            `mapstructure:"item_audience_index_recall"`
+	ItemAudienceIndexFitEpoch    int                `mapstructure:"item_audience_index_fit_epoch"`
 	EnableClickThroughPrediction bool               `mapstructure:"enable_click_through_prediction"`
+	EnableRankAPI                bool               `mapstructure:"enable_rank_api"`
 	EnableReplacement            bool               `mapstructure:"enable_replacement"`
 	PositiveReplacementDecay     float32            `mapstructure:"positive_replacement_decay"`
 	ReadReplacementDecay         float32            `mapstructure:"read_replacement_decay"`
+	EnableDiversity              bool               `mapstructure:"enable_diversity"`
+	DiversityLambda              float32            `mapstructure:"diversity_lambda"`
+	DiversityWindow              int                `mapstructure:"diversity_window"`
+	DiversityCaps                map[string]int     `mapstructure:"diversity_caps"`
+	Experiments                  []ExperimentConfig `mapstructure:"experiments"`
 	exploreRecommendLock         sync.RWMutex
 }
 
+// ExperimentConfig is the configuration of an A/B experiment on recommendation strategies. Users are assigned to arms
+// deterministically by hashing user ids.
+type ExperimentConfig struct {
+	Name string          `mapstructure:"name"`
+	Arms []ExperimentArm `mapstructure:"arms"`
+}
+
+// ExperimentArm is an arm of an experiment. Recommend options in an arm override recommend options for users assigned
+// to the arm, while unset options are not overridden.
+type ExperimentArm struct {
+	Name                         string             `mapstructure:"name"`
+	Weight                       int                `mapstructure:"weight"`
+	FallbackRecommend            []string           `mapstructure:"fallback_recommend"`
+	ExploreRecommend             map[string]float64 `mapstructure:"explore_recommend"`
+	EnableClickThroughPrediction *bool              `mapstructure:"enable_click_through_prediction"`
+}
+
+// Assign a user to an arm of the experiment.
+func (experiment *ExperimentConfig) Assign(userId string) *ExperimentArm {
+	totalWeight := 0
+	for _, arm := range experiment.Arms {
+		totalWeight += arm.Weight
+	}
+	if totalWeight == 0 {
+		return nil
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(experiment.Name + "/" + userId))
+	bucket := int(hash.Sum32() % uint32(totalWeight))
+	for i := range experiment.Arms {
+		if bucket < experiment.Arms[i].Weight {
+			return &experiment.Arms[i]
+		}
+		bucket -= experiment.Arms[i].Weight
+	}
+	return nil
+}
+
+// RecommendStrategy is recommend options for a user after arms of experiments are applied.
+type RecommendStrategy struct {
+	FallbackRecommend            []string
+	ExploreRecommend             map[string]float64
+	EnableClickThroughPrediction bool
+	// Arms are names of assigned arms indexed by names of experiments.
+	Arms map[string]string
+}
+
+// HasFallbackRecommend returns true if a fallback recommender is used by default or by any arm of experiments.
+func (config *RecommendConfig) HasFallbackRecommend(recommender string) bool {
+	recommenders := strset.New(config.FallbackRecommend...)
+	for _, experiment := range config.Experiments {
+		for _, arm := range experiment.Arms {
+			recommenders.Add(arm.FallbackRecommend...)
+		}
+	}
+	return recommenders.Has(recommender)
+}
+
+// HasClickThroughPrediction returns true if click-through rate prediction is enabled by default or by any arm of
+// experiments.
+func (config *RecommendConfig) HasClickThroughPrediction() bool {
+	if config.EnableClickThroughPrediction {
+		return true
+	}
+	for _, experiment := range config.Experiments {
+		for _, arm := range experiment.Arms {
+			if arm.EnableClickThroughPrediction != nil && *arm.EnableClickThroughPrediction {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequireRankingModel returns true if the ranking model is used by servers, that is, the rank API is enabled or
+// online collaborative filtering recommendation is used by default or by any arm of experiments.
+func (config *RecommendConfig) RequireRankingModel() bool {
+	return config.EnableRankAPI || config.HasFallbackRecommend("collaborative_online")
+}
+
+// GetRecommendStrategy returns recommend options for a user. Arms of experiments are applied in order.
+func (config *RecommendConfig) GetRecommendStrategy(userId string) *RecommendStrategy {
+	config.exploreRecommendLock.RLock()
+	defer config.exploreRecommendLock.RUnlock()
+	strategy := &RecommendStrategy{
+		FallbackRecommend:            config.FallbackRecommend,
+		ExploreRecommend:             make(map[string]float64, len(config.ExploreRecommend)),
+		EnableClickThroughPrediction: config.EnableClickThroughPrediction,
+		Arms:                         make(map[string]string),
+	}
+	for key, value := range config.ExploreRecommend {
+		strategy.ExploreRecommend[key] = value
+	}
+	for i := range config.Experiments {
+		arm := config.Experiments[i].Assign(userId)
+		if arm == nil {
+			continue
+		}
+		strategy.Arms[config.Experiments[i].Name] = arm.Name
+		if arm.FallbackRecommend != nil {
+			strategy.FallbackRecommend = arm.FallbackRecommend
+		}
+		if arm.ExploreRecommend != nil {
+			strategy.ExploreRecommend = arm.ExploreRecommend
+		}
+		if arm.EnableClickThroughPrediction != nil {
+			strategy.EnableClickThroughPrediction = *arm.EnableClickThroughPrediction
+		}
+	}
+	return strategy
+}
+
 func (config *RecommendConfig) Lock() {
 	config.exploreRecommendLock.Lock()
 }
@@ -181,11 +331,23 @@ func (config *RecommendConfig) LoadDefaultIfNil() *RecommendConfig {
 		return &RecommendConfig{
 			PopularWindow:                180,
 			FitPeriod:                    60,
+			EnableWarmStart:              false,
+			WarmStartEpochs:              10,
+			FullRetrainPeriod:            10,
+			EnablePromotionGate:          false,
+			ValidationWindow:             1,
+			PromotionMinImprovement:      0,
+			SplitStrategy:                "random",
+			SplitNumLatest:               1,
+			SplitCutoffWindow:            1,
 			SearchPeriod:                 180,
 			SearchEpoch:                  100,
 			SearchTrials:                 10,
+			SearchStrategy:               "random",
 			CheckRecommendPeriod:         1,
 			RefreshRecommendPeriod:       5,
+			EnableRefreshQueue:           false,
+			RefreshQueuePeriod:           10,
 			FallbackRecommend:            []string{"latest"},
 			NumFeedbackFallbackItemBased: 10,
 			ItemNeighborType:             "auto",
@@ -200,14 +362,24 @@ func (config *RecommendConfig) LoadDefaultIfNil() *RecommendConfig {
 			EnablePopularRecommend:       false,
 			EnableUserBasedRecommend:     false,
 			EnableItemBasedRecommend:     false,
+			EnableSubscribeRecommend:     false,
+			SubscribeBoost:               0,
 			EnableColRecommend:           true,
 			EnableColIndex:               false,
 			ColIndexRecall:               0.9,
 			ColIndexFitEpoch:             3,
+			EnableItemAudience:           false,
+			EnableItemAudienceIndex:      false,
+			ItemAudienceIndexRecall:      0.9,
+			ItemAudienceIndexFitEpoch:    3,
 			EnableClickThroughPrediction: false,
+			EnableRankAPI:                false,
 			EnableReplacement:            false,
 			PositiveReplacementDecay:     0.8,
 			ReadReplacementDecay:         0.6,
+			EnableDiversity:              false,
+			DiversityLambda:              0.7,
+			DiversityWindow:              10,
 		}
 	}
 	return config
@@ -217,26 +389,101 @@ func (config *RecommendConfig) LoadDefaultIfNil() *RecommendConfig {
 func (config *RecommendConfig) validate() {
 	validateNotNegative("popular_window", config.PopularWindow)
 	validatePositive("fit_period", config.FitPeriod)
+	validatePositive("warm_start_epochs", config.WarmStartEpochs)
+	validatePositive("full_retrain_period", config.FullRetrainPeriod)
+	if config.EnableWarmStart && config.FullRetrainPeriod < 2 {
+		panic(fmt.Sprintf("value of `full_retrain_period` in config must be at least 2 if warm start is enabled, but the current value is %d",
+			config.FullRetrainPeriod))
+	}
+	validatePositive("validation_window", config.ValidationWindow)
+	validateBetween("promotion_min_improvement", config.PromotionMinImprovement, 0, 1)
+	validatePositive("split_num_latest", config.SplitNumLatest)
+	validatePositive("split_cutoff_window", config.SplitCutoffWindow)
 	validatePositive("search_period", config.SearchPeriod)
 	validatePositive("search_epoch", config.SearchEpoch)
 	validatePositive("search_trials", config.SearchTrials)
 	validatePositive("refresh_recommend_period", config.RefreshRecommendPeriod)
-	validateSubset("fallback_recommend", config.FallbackRecommend, []string{"item_based", "popular", "latest"})
-	validateIn("item_neighbor_type", config.ItemNeighborType, []string{"similar", "related", "auto"})
-	validateIn("user_neighbor_type", config.UserNeighborType, []string{"similar", "related", "auto"})
+	validatePositive("refresh_queue_period", config.RefreshQueuePeriod)
+	validateSubset("fallback_recommend", config.FallbackRecommend, []string{"item_based", "popular", "latest", "subscribe", "collaborative_online"})
+	validateIn("search_strategy", config.SearchStrategy, []string{"random", "bayesian"})
+	validateIn("split_strategy", config.SplitStrategy, []string{"random", "leave_latest_out", "cutoff_time"})
+	validateIn("item_neighbor_type", config.ItemNeighborType, []string{"similar", "related", "auto", "embedding", "content"})
+	validateIn("user_neighbor_type", config.UserNeighborType, []string{"similar", "related", "auto", "embedding"})
+	validateBetween("diversity_lambda", config.DiversityLambda, 0, 1)
+	validatePositive("diversity_window", config.DiversityWindow)
+	for prefix, limit := range config.DiversityCaps {
+		validatePositive("diversity_caps."+prefix, limit)
+	}
+	experimentNames := strset.New()
+	for _, experiment := range config.Experiments {
+		if experiment.Name == "" || experimentNames.Has(experiment.Name) {
+			panic(fmt.Sprintf("name of experiment in config must be unique and not empty, but the current value is %s", experiment.Name))
+		}
+		experimentNames.Add(experiment.Name)
+		totalWeight := 0
+		for _, arm := range experiment.Arms {
+			validateNotNegative("weight", arm.Weight)
+			validateSubset("fallback_recommend", arm.FallbackRecommend, []string{"item_based", "popular", "latest", "subscribe", "collaborative_online"})
+			totalWeight += arm.Weight
+		}
+		validatePositive("weight", totalWeight)
+	}
 }
 
 // ServerConfig is the configuration for the server.
 type ServerConfig struct {
 	APIKey   string `mapstructure:"api_key"`   // default number of returned items
 	DefaultN int    `mapstructure:"default_n"` // secret key for RESTful APIs (SSL required)
+	// MaxBatchRecommend is the maximum number of users in a batch recommendation request.
+	MaxBatchRecommend int `mapstructure:"max_batch_recommend"`
+	// EnableImpressionLog logs items returned by recommendation requests as impressions.
+	EnableImpressionLog bool `mapstructure:"enable_impression_log"`
+	// APIKeys are named secret keys with scopes and rate limits. The legacy APIKey grants all scopes without limits.
+	APIKeys []APIKey `mapstructure:"api_keys"`
+}
+
+const (
+	ScopeRead   = "read"   // read items, users, feedback and recommendations
+	ScopeWrite  = "write"  // insert or modify items, users and feedback
+	ScopeDelete = "delete" // delete items, users and feedback
+)
+
+// APIKey is a named secret key for RESTful APIs. Requests with the key are allowed in its scopes and limited by a
+// token bucket, which is refilled by RateLimit tokens per second and holds Burst tokens at most.
+type APIKey struct {
+	Name      string   `mapstructure:"name"`
+	Key       string   `mapstructure:"key"`
+	Scopes    []string `mapstructure:"scopes"`
+	RateLimit int      `mapstructure:"rate_limit"` // requests per second, 0 means unlimited
+	Burst     int      `mapstructure:"burst"`      // maximum burst of requests, 0 means the same as the rate limit
+}
+
+// HasScope checks whether the API key is allowed in the scope.
+func (key *APIKey) HasScope(scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// validate APIKey.
+func (key *APIKey) validate() {
+	if key.Name == "" || key.Key == "" {
+		panic(fmt.Sprintf("name and key of API key in config must not be empty, but the current name is %s", key.Name))
+	}
+	validateSubset("scopes", key.Scopes, []string{ScopeRead, ScopeWrite, ScopeDelete})
+	validateNotNegative("rate_limit", key.RateLimit)
+	validateNotNegative("burst", key.Burst)
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
 func (config *ServerConfig) LoadDefaultIfNil() *ServerConfig {
 	if config == nil {
 		return &ServerConfig{
-			DefaultN: 10,
+			DefaultN:          10,
+			MaxBatchRecommend: 100,
 		}
 	}
 	return config
@@ -245,6 +492,19 @@ func (config *ServerConfig) LoadDefaultIfNil() *ServerConfig {
 // validate ServerConfig.
 func (config *ServerConfig) validate() {
 	validatePositive("default_n", config.DefaultN)
+	validatePositive("max_batch_recommend", config.MaxBatchRecommend)
+	keyNames, secrets := strset.New(), strset.New(config.APIKey)
+	for _, key := range config.APIKeys {
+		key.validate()
+		if keyNames.Has(key.Name) {
+			panic(fmt.Sprintf("name of API key in config must be unique, but the current value is %s", key.Name))
+		}
+		if secrets.Has(key.Key) {
+			panic(fmt.Sprintf("key of API key in config must be unique, but the key of %s is duplicated", key.Name))
+		}
+		keyNames.Add(key.Name)
+		secrets.Add(key.Key)
+	}
 }
 
 func init() {
@@ -253,6 +513,7 @@ func init() {
 	viper.SetDefault("database.auto_insert_user", defaultDBConfig.AutoInsertUser)
 	viper.SetDefault("database.auto_insert_item", defaultDBConfig.AutoInsertItem)
 	viper.SetDefault("database.cache_size", defaultDBConfig.CacheSize)
+	viper.SetDefault("database.impression_ttl", defaultDBConfig.ImpressionTTL)
 	// Default master config
 	defaultMasterConfig := *(*MasterConfig)(nil).LoadDefaultIfNil()
 	viper.SetDefault("master.port", defaultMasterConfig.Port)
@@ -261,19 +522,35 @@ func init() {
 	viper.SetDefault("master.http_host", defaultMasterConfig.HttpHost)
 	viper.SetDefault("master.n_jobs", defaultMasterConfig.NumJobs)
 	viper.SetDefault("master.meta_timeout", defaultMasterConfig.MetaTimeout)
+	viper.SetDefault("master.model_dir", defaultMasterConfig.ModelDir)
+	viper.SetDefault("master.model_history", defaultMasterConfig.ModelHistory)
 	// Default server config
 	defaultServerConfig := *(*ServerConfig)(nil).LoadDefaultIfNil()
 	viper.SetDefault("server.api_key", defaultServerConfig.APIKey)
 	viper.SetDefault("server.default_n", defaultServerConfig.DefaultN)
+	viper.SetDefault("server.max_batch_recommend", defaultServerConfig.MaxBatchRecommend)
+	viper.SetDefault("server.enable_impression_log", defaultServerConfig.EnableImpressionLog)
 	// Default recommend config
 	defaultRecommendConfig := *(*RecommendConfig)(nil).LoadDefaultIfNil()
 	viper.SetDefault("recommend.popular_window", defaultRecommendConfig.PopularWindow)
 	viper.SetDefault("recommend.fit_period", defaultRecommendConfig.FitPeriod)
+	viper.SetDefault("recommend.enable_warm_start", defaultRecommendConfig.EnableWarmStart)
+	viper.SetDefault("recommend.warm_start_epochs", defaultRecommendConfig.WarmStartEpochs)
+	viper.SetDefault("recommend.full_retrain_period", defaultRecommendConfig.FullRetrainPeriod)
+	viper.SetDefault("recommend.enable_promotion_gate", defaultRecommendConfig.EnablePromotionGate)
+	viper.SetDefault("recommend.validation_window", defaultRecommendConfig.ValidationWindow)
+	viper.SetDefault("recommend.promotion_min_improvement", defaultRecommendConfig.PromotionMinImprovement)
+	viper.SetDefault("recommend.split_strategy", defaultRecommendConfig.SplitStrategy)
+	viper.SetDefault("recommend.split_num_latest", defaultRecommendConfig.SplitNumLatest)
+	viper.SetDefault("recommend.split_cutoff_window", defaultRecommendConfig.SplitCutoffWindow)
 	viper.SetDefault("recommend.search_period", defaultRecommendConfig.SearchPeriod)
 	viper.SetDefault("recommend.search_epoch", defaultRecommendConfig.SearchEpoch)
 	viper.SetDefault("recommend.search_trials", defaultRecommendConfig.SearchTrials)
+	viper.SetDefault("recommend.search_strategy", defaultRecommendConfig.SearchStrategy)
 	viper.SetDefault("recommend.check_recommend_period", defaultRecommendConfig.CheckRecommendPeriod)
 	viper.SetDefault("recommend.refresh_recommend_period", defaultRecommendConfig.RefreshRecommendPeriod)
+	viper.SetDefault("recommend.enable_refresh_queue", defaultRecommendConfig.EnableRefreshQueue)
+	viper.SetDefault("recommend.refresh_queue_period", defaultRecommendConfig.RefreshQueuePeriod)
 	viper.SetDefault("recommend.fallback_recommend", defaultRecommendConfig.FallbackRecommend)
 	viper.SetDefault("recommend.num_feedback_fallback_item_based", defaultRecommendConfig.NumFeedbackFallbackItemBased)
 	viper.SetDefault("recommend.item_neighbor_type", defaultRecommendConfig.ItemNeighborType)
@@ -288,14 +565,24 @@ func init() {
 	viper.SetDefault("recommend.enable_popular_recommend", defaultRecommendConfig.EnablePopularRecommend)
 	viper.SetDefault("recommend.enable_user_based_recommend", defaultRecommendConfig.EnableUserBasedRecommend)
 	viper.SetDefault("recommend.enable_item_based_recommend", defaultRecommendConfig.EnableItemBasedRecommend)
+	viper.SetDefault("recommend.enable_subscribe_recommend", defaultRecommendConfig.EnableSubscribeRecommend)
+	viper.SetDefault("recommend.subscribe_boost", defaultRecommendConfig.SubscribeBoost)
 	viper.SetDefault("recommend.enable_collaborative_recommend", defaultRecommendConfig.EnableColRecommend)
 	viper.SetDefault("recommend.enable_collaborative_index", defaultRecommendConfig.EnableColIndex)
 	viper.SetDefault("recommend.collaborative_index_recall", defaultRecommendConfig.ColIndexRecall)
 	viper.SetDefault("recommend.collaborative_index_fit_epoch", defaultRecommendConfig.ColIndexFitEpoch)
+	viper.SetDefault("recommend.enable_item_audience", defaultRecommendConfig.EnableItemAudience)
+	viper.SetDefault("recommend.enable_item_audience_index", defaultRecommendConfig.EnableItemAudienceIndex)
+	viper.SetDefault("recommend.item_audience_index_recall", defaultRecommendConfig.ItemAudienceIndexRecall)
+	viper.SetDefault("recommend.item_audience_index_fit_epoch", defaultRecommendConfig.ItemAudienceIndexFitEpoch)
 	viper.SetDefault("recommend.enable_click_through_prediction", defaultRecommendConfig.EnableClickThroughPrediction)
+	viper.SetDefault("recommend.enable_rank_api", defaultRecommendConfig.EnableRankAPI)
 	viper.SetDefault("recommend.enable_positive_replacement", defaultRecommendConfig.EnableReplacement)
 	viper.SetDefault("recommend.positive_replacement_decay", defaultRecommendConfig.PositiveReplacementDecay)
 	viper.SetDefault("recommend.read_replacement_decay", defaultRecommendConfig.ReadReplacementDecay)
+	viper.SetDefault("recommend.enable_diversity", defaultRecommendConfig.EnableDiversity)
+	viper.SetDefault("recommend.diversity_lambda", defaultRecommendConfig.DiversityLambda)
+	viper.SetDefault("recommend.diversity_window", defaultRecommendConfig.DiversityWindow)
 }
 
 type configBinding struct {
@@ -17,6 +17,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -35,6 +36,8 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, []string{"read"}, config.Database.ReadFeedbackTypes)
 	assert.Equal(t, uint(0), config.Database.PositiveFeedbackTTL)
 	assert.Equal(t, uint(0), config.Database.ItemTTL)
+	assert.Equal(t, []string{"gender"}, config.Database.UserAttributes)
+	assert.Equal(t, uint(30), config.Database.ImpressionTTL)
 
 	// master configuration
 	assert.Equal(t, 8086, config.Master.Port)
@@ -45,19 +48,39 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, 10, config.Master.MetaTimeout)
 	assert.Equal(t, "admin", config.Master.DashboardUserName)
 	assert.Equal(t, "password", config.Master.DashboardPassword)
+	assert.Equal(t, "models", config.Master.ModelDir)
+	assert.Equal(t, 5, config.Master.ModelHistory)
 
 	// server configuration
 	assert.Equal(t, 10, config.Server.DefaultN)
 	assert.Equal(t, "", config.Server.APIKey)
+	assert.Equal(t, 100, config.Server.MaxBatchRecommend)
+	assert.True(t, config.Server.EnableImpressionLog)
+	assert.Equal(t, []APIKey{
+		{Name: "frontend", Key: "<frontend_api_key>", Scopes: []string{"read"}, RateLimit: 100, Burst: 200},
+		{Name: "backend", Key: "<backend_api_key>", Scopes: []string{"read", "write", "delete"}},
+	}, config.Server.APIKeys)
 
 	// recommend configuration
 	assert.Equal(t, 30, config.Recommend.PopularWindow)
 	assert.Equal(t, 360, config.Recommend.FitPeriod)
+	assert.True(t, config.Recommend.EnableWarmStart)
+	assert.Equal(t, 5, config.Recommend.WarmStartEpochs)
+	assert.Equal(t, 4, config.Recommend.FullRetrainPeriod)
+	assert.True(t, config.Recommend.EnablePromotionGate)
+	assert.Equal(t, 3, config.Recommend.ValidationWindow)
+	assert.Equal(t, float32(0.01), config.Recommend.PromotionMinImprovement)
+	assert.Equal(t, "leave_latest_out", config.Recommend.SplitStrategy)
+	assert.Equal(t, 2, config.Recommend.SplitNumLatest)
+	assert.Equal(t, 7, config.Recommend.SplitCutoffWindow)
 	assert.Equal(t, 60, config.Recommend.SearchPeriod)
 	assert.Equal(t, 100, config.Recommend.SearchEpoch)
 	assert.Equal(t, 10, config.Recommend.SearchTrials)
+	assert.Equal(t, "bayesian", config.Recommend.SearchStrategy)
 	assert.Equal(t, 1, config.Recommend.CheckRecommendPeriod)
 	assert.Equal(t, 1, config.Recommend.RefreshRecommendPeriod)
+	assert.True(t, config.Recommend.EnableRefreshQueue)
+	assert.Equal(t, 5, config.Recommend.RefreshQueuePeriod)
 	assert.Equal(t, []string{"item_based", "latest"}, config.Recommend.FallbackRecommend)
 	assert.Equal(t, map[string]float64{"popular": 0.1, "latest": 0.2}, config.Recommend.ExploreRecommend)
 	assert.Equal(t, 10, config.Recommend.NumFeedbackFallbackItemBased)
@@ -81,14 +104,116 @@ func TestLoadConfig(t *testing.T) {
 	assert.False(t, config.Recommend.EnableColIndex)
 	assert.Equal(t, float32(0.9), config.Recommend.ColIndexRecall)
 	assert.Equal(t, 3, config.Recommend.ColIndexFitEpoch)
+	assert.True(t, config.Recommend.EnableItemAudience)
+	assert.False(t, config.Recommend.EnableItemAudienceIndex)
+	assert.Equal(t, float32(0.9), config.Recommend.ItemAudienceIndexRecall)
+	assert.Equal(t, 3, config.Recommend.ItemAudienceIndexFitEpoch)
 	assert.False(t, config.Recommend.EnableItemBasedRecommend)
 	assert.True(t, config.Recommend.EnableUserBasedRecommend)
+	assert.False(t, config.Recommend.EnableSubscribeRecommend)
+	assert.Equal(t, float32(0), config.Recommend.SubscribeBoost)
 	assert.False(t, config.Recommend.EnablePopularRecommend)
 	assert.True(t, config.Recommend.EnableLatestRecommend)
 	assert.True(t, config.Recommend.EnableClickThroughPrediction)
+	assert.True(t, config.Recommend.EnableRankAPI)
 	assert.False(t, config.Recommend.EnableReplacement)
 	assert.Equal(t, float32(0.8), config.Recommend.PositiveReplacementDecay)
 	assert.Equal(t, float32(0.6), config.Recommend.ReadReplacementDecay)
+	assert.True(t, config.Recommend.EnableDiversity)
+	assert.Equal(t, float32(0.7), config.Recommend.DiversityLambda)
+	assert.Equal(t, 10, config.Recommend.DiversityWindow)
+	assert.Equal(t, map[string]int{"author:": 2}, config.Recommend.DiversityCaps)
+	enableClickThroughPrediction := false
+	assert.Equal(t, []ExperimentConfig{{
+		Name: "fallback",
+		Arms: []ExperimentArm{
+			{Name: "control", Weight: 1},
+			{Name: "popular", Weight: 1, FallbackRecommend: []string{"popular", "latest"}, EnableClickThroughPrediction: &enableClickThroughPrediction},
+		},
+	}}, config.Recommend.Experiments)
+}
+
+func TestAPIKey_HasScope(t *testing.T) {
+	key := APIKey{Name: "frontend", Key: "secret", Scopes: []string{ScopeRead}}
+	assert.True(t, key.HasScope(ScopeRead))
+	assert.False(t, key.HasScope(ScopeWrite))
+	assert.False(t, key.HasScope(ScopeDelete))
+}
+
+func TestRecommendConfig_Validate(t *testing.T) {
+	config := (*RecommendConfig)(nil).LoadDefaultIfNil()
+	config.EnableWarmStart = true
+	config.FullRetrainPeriod = 2
+	assert.NotPanics(t, config.validate)
+	config.FullRetrainPeriod = 1
+	assert.Panics(t, config.validate)
+	config.EnableWarmStart = false
+	assert.NotPanics(t, config.validate)
+}
+
+func TestRecommendConfig_GetRecommendStrategy(t *testing.T) {
+	enableClickThroughPrediction := false
+	config := (*Config)(nil).LoadDefaultIfNil()
+	config.Recommend.EnableClickThroughPrediction = true
+	config.Recommend.Experiments = []ExperimentConfig{
+		{Name: "a", Arms: []ExperimentArm{
+			{Name: "control", Weight: 1},
+			{Name: "popular", Weight: 1, FallbackRecommend: []string{"popular"}},
+		}},
+		{Name: "b", Arms: []ExperimentArm{
+			{Name: "disabled", Weight: 0},
+			{Name: "no_ctr", Weight: 1, EnableClickThroughPrediction: &enableClickThroughPrediction},
+		}},
+	}
+	arms := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		userId := strconv.Itoa(i)
+		strategy := config.Recommend.GetRecommendStrategy(userId)
+		// assignment is deterministic
+		assert.Equal(t, strategy, config.Recommend.GetRecommendStrategy(userId))
+		assert.Equal(t, "no_ctr", strategy.Arms["b"])
+		assert.False(t, strategy.EnableClickThroughPrediction)
+		arms[strategy.Arms["a"]]++
+		if strategy.Arms["a"] == "popular" {
+			assert.Equal(t, []string{"popular"}, strategy.FallbackRecommend)
+		} else {
+			assert.Equal(t, []string{"latest"}, strategy.FallbackRecommend)
+		}
+	}
+	assert.InDelta(t, 500, arms["control"], 100)
+	assert.InDelta(t, 500, arms["popular"], 100)
+}
+
+func TestRecommendConfig_HasFallbackRecommend(t *testing.T) {
+	config := (*Config)(nil).LoadDefaultIfNil()
+	assert.True(t, config.Recommend.HasFallbackRecommend("latest"))
+	assert.False(t, config.Recommend.HasFallbackRecommend("collaborative_online"))
+	assert.False(t, config.Recommend.RequireRankingModel())
+	config.Recommend.Experiments = []ExperimentConfig{
+		{Name: "a", Arms: []ExperimentArm{
+			{Name: "control", Weight: 1},
+			{Name: "online", Weight: 1, FallbackRecommend: []string{"collaborative_online"}},
+		}},
+	}
+	assert.True(t, config.Recommend.HasFallbackRecommend("collaborative_online"))
+	assert.True(t, config.Recommend.RequireRankingModel())
+	// rank API requires the ranking model
+	config = (*Config)(nil).LoadDefaultIfNil()
+	config.Recommend.EnableRankAPI = true
+	assert.True(t, config.Recommend.RequireRankingModel())
+}
+
+func TestRecommendConfig_HasClickThroughPrediction(t *testing.T) {
+	enableClickThroughPrediction := true
+	config := (*Config)(nil).LoadDefaultIfNil()
+	assert.False(t, config.Recommend.HasClickThroughPrediction())
+	config.Recommend.Experiments = []ExperimentConfig{
+		{Name: "a", Arms: []ExperimentArm{
+			{Name: "control", Weight: 1},
+			{Name: "ctr", Weight: 1, EnableClickThroughPrediction: &enableClickThroughPrediction},
+		}},
+	}
+	assert.True(t, config.Recommend.HasClickThroughPrediction())
 }
 
 func TestSetDefault(t *testing.T) {
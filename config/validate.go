@@ -39,6 +39,13 @@ func validatePositive(name string, val int) {
 	}
 }
 
+func validateBetween(name string, val, lower, upper float32) {
+	if val < lower || val > upper {
+		panic(fmt.Sprintf("value of `%s` in config must be between %v and %v, but the current value is %v",
+			name, lower, upper, val))
+	}
+}
+
 func validateIn(name, val string, expectedValues []string) {
 	expectedValueSet := strset.New(expectedValues...)
 	if !expectedValueSet.Has(val) {
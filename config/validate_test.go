@@ -35,6 +35,12 @@ func TestValidatePositive(t *testing.T) {
 	assert.NotPanics(t, func() { validatePositive("", 1) })
 }
 
+func TestValidateBetween(t *testing.T) {
+	assert.Panics(t, func() { validateBetween("", -0.1, 0, 1) })
+	assert.Panics(t, func() { validateBetween("", 1.1, 0, 1) })
+	assert.NotPanics(t, func() { validateBetween("", 0.5, 0, 1) })
+}
+
 func TestValidateIn(t *testing.T) {
 	assert.Panics(t, func() { validateIn("", "d", []string{"a", "b", "c"}) })
 	assert.NotPanics(t, func() { validateIn("", "a", []string{"a", "b", "c"}) })
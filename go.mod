@@ -12,7 +12,7 @@ require (
 	github.com/emicklei/go-restful/v3 v3.5.2
 	github.com/go-redis/redis/v8 v8.11.0
 	github.com/go-sql-driver/mysql v1.6.0
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/google/uuid v1.3.0
 	github.com/gorilla/securecookie v1.1.1
 	github.com/gorse-io/dashboard v0.0.0-20220222014325-2ec7a544dff4
 	github.com/haxii/go-swagger-ui v3.19.4+incompatible
@@ -23,6 +23,7 @@ require (
 	github.com/lafikl/consistent v0.0.0-20210222184039-5e8acd7e59f2
 	github.com/lib/pq v1.10.2
 	github.com/mailru/go-clickhouse v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.14
 	github.com/orcaman/concurrent-map v1.0.0
 	github.com/prometheus/client_golang v1.10.0
 	github.com/rakyll/statik v0.1.7
@@ -44,4 +45,4 @@ require (
 	modernc.org/sortutil v1.1.0
 )
 
-replace github.com/gorse-io/dashboard => github.com/oufangwei/dashboard v0.0.0-20220222014325-2ec7a544dff4
\ No newline at end of file
+replace github.com/gorse-io/dashboard => github.com/oufangwei/dashboard v0.0.0-20220222014325-2ec7a544dff4
@@ -51,14 +51,20 @@ type Master struct {
 	nodesInfoMutex sync.RWMutex
 
 	// ranking dataset
-	rankingTrainSet  *ranking.DataSet
-	rankingTestSet   *ranking.DataSet
-	rankingDataMutex sync.RWMutex
+	rankingTrainSet *ranking.DataSet
+	rankingTestSet  *ranking.DataSet
+	// training set and validation set of the promotion gate, nil if promotion gate is disabled
+	rankingGateTrainSet *ranking.DataSet
+	rankingValidSet     *ranking.DataSet
+	rankingDataMutex    sync.RWMutex
 
 	// click dataset
-	clickTrainSet  *click.Dataset
-	clickTestSet   *click.Dataset
-	clickDataMutex sync.RWMutex
+	clickTrainSet *click.Dataset
+	clickTestSet  *click.Dataset
+	// training set and validation set of the promotion gate, nil if promotion gate is disabled
+	clickGateTrainSet *click.Dataset
+	clickValidSet     *click.Dataset
+	clickDataMutex    sync.RWMutex
 
 	// ranking model
 	rankingModel         ranking.Model
@@ -67,6 +73,7 @@ type Master struct {
 	rankingScore         ranking.Score
 	rankingModelMutex    sync.RWMutex
 	rankingModelSearcher *ranking.ModelSearcher
+	rankingWarmStarts    int // number of warm starts since the last full retrain
 
 	// click model
 	clickModel         click.FactorizationMachine
@@ -75,7 +82,11 @@ type Master struct {
 	clickModelMutex    sync.RWMutex
 	clickModelSearcher *click.ModelSearcher
 
-	localCache *LocalCache
+	localCache    *LocalCache
+	modelRegistry *ModelRegistry // nil if model registry is disabled
+
+	// API keys managed in the dashboard
+	apiKeysMutex sync.Mutex
 
 	// events
 	fitTicker    *time.Ticker
@@ -88,7 +99,7 @@ func NewMaster(cfg *config.Config, cacheFile string) *Master {
 	// create task monitor
 	taskMonitor := NewTaskMonitor()
 	for _, taskName := range []string{TaskLoadDataset, TaskFindItemNeighbors, TaskFindUserNeighbors,
-		TaskFitRankingModel, TaskFitClickModel, TaskAnalyze, TaskSearchRankingModel, TaskSearchClickModel} {
+		TaskFitRankingModel, TaskFindItemAudience, TaskFitClickModel, TaskAnalyze, TaskSearchRankingModel, TaskSearchClickModel} {
 		taskMonitor.Pending(taskName)
 	}
 	return &Master{
@@ -106,13 +117,15 @@ func NewMaster(cfg *config.Config, cacheFile string) *Master {
 		rankingModelSearcher: ranking.NewModelSearcher(
 			cfg.Recommend.SearchEpoch,
 			cfg.Recommend.SearchTrials,
-			cfg.Master.NumJobs),
+			cfg.Master.NumJobs,
+			cfg.Recommend.SearchStrategy),
 		// default click model
 		clickModel: click.NewFM(click.FMClassification, nil),
 		clickModelSearcher: click.NewModelSearcher(
 			cfg.Recommend.SearchEpoch,
 			cfg.Recommend.SearchTrials,
 			cfg.Master.NumJobs,
+			cfg.Recommend.SearchStrategy,
 		),
 		RestServer: server.RestServer{
 			GorseConfig: cfg,
@@ -156,6 +169,18 @@ func (m *Master) Serve() {
 		m.clickModelVersion = m.localCache.ClickModelVersion
 	}
 
+	// open model registry
+	if m.GorseConfig.Master.ModelHistory > 0 {
+		m.modelRegistry, err = OpenModelRegistry(m.GorseConfig.Master.ModelDir, m.GorseConfig.Master.ModelHistory)
+		if err != nil {
+			base.Logger().Fatal("failed to open model registry", zap.Error(err),
+				zap.String("model_dir", m.GorseConfig.Master.ModelDir))
+		}
+		if err = m.loadPinnedModels(); err != nil {
+			base.Logger().Error("failed to load pinned models", zap.Error(err))
+		}
+	}
+
 	// create cluster meta cache
 	m.ttlCache = ttlcache.NewCache()
 	m.ttlCache.SetExpirationCallback(m.nodeDown)
@@ -209,6 +234,15 @@ func (m *Master) Serve() {
 	}
 }
 
+// Shutdown closes the cache store so that the in-memory cache store writes its snapshot.
+func (m *Master) Shutdown() {
+	if m.CacheClient != nil {
+		if err := m.CacheClient.Close(); err != nil {
+			base.Logger().Error("failed to close cache store", zap.Error(err))
+		}
+	}
+}
+
 func (m *Master) RunPrivilegedTasksLoop() {
 	defer base.CheckPanic()
 	var (
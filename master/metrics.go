@@ -45,6 +45,11 @@ var (
 		Subsystem: "master",
 		Name:      "find_item_neighbors_seconds",
 	})
+	FindItemAudienceSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "master",
+		Name:      "find_item_audience_seconds",
+	})
 
 	MatchingTop10NDCG = promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace: "gorse",
@@ -0,0 +1,388 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/click"
+	"github.com/zhenghaoz/gorse/model/ranking"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	ModelTypeRanking = "ranking"
+	ModelTypeClick   = "click"
+
+	modelRegistryIndexFile = "index.bin"
+)
+
+// RankingModelVersion is meta information of a ranking model in the model registry.
+type RankingModelVersion struct {
+	Version int64 `json:",string"`
+	Name    string
+	Params  model.Params
+	Score   ranking.Score
+	FitTime time.Time
+}
+
+// ClickModelVersion is meta information of a click model in the model registry.
+type ClickModelVersion struct {
+	Version int64 `json:",string"`
+	Params  model.Params
+	Score   click.Score
+	FitTime time.Time
+}
+
+// ModelRegistryIndex is meta information of models in the model registry. Models are in ascending order of fit time.
+// The version of a pinned model is zero if no model is pinned.
+type ModelRegistryIndex struct {
+	RankingModels      []RankingModelVersion
+	ClickModels        []ClickModelVersion
+	PinnedRankingModel int64 `json:",string"`
+	PinnedClickModel   int64 `json:",string"`
+}
+
+// ModelRegistry keeps a bounded history of ranking models and click models in a directory. Each model is saved to a
+// file named by its type and version, while meta information of models is saved to an index file. The oldest model
+// except the pinned model is removed if the number of models of a type exceeds the size.
+type ModelRegistry struct {
+	dir   string
+	size  int
+	index ModelRegistryIndex
+	mutex sync.RWMutex
+}
+
+// OpenModelRegistry opens a model registry in a directory. The directory is created if not exists.
+func OpenModelRegistry(dir string, size int) (*ModelRegistry, error) {
+	registry := &ModelRegistry{dir: dir, size: size}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Trace(err)
+	}
+	f, err := os.Open(filepath.Join(dir, modelRegistryIndexFile))
+	if os.IsNotExist(err) {
+		return registry, nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer func(f *os.File) {
+		if err = f.Close(); err != nil {
+			base.Logger().Error("fail to close file", zap.Error(err))
+		}
+	}(f)
+	if err = base.ReadGob(f, &registry.index); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return registry, nil
+}
+
+// Index returns a copy of meta information of models.
+func (r *ModelRegistry) Index() ModelRegistryIndex {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return ModelRegistryIndex{
+		RankingModels:      append([]RankingModelVersion{}, r.index.RankingModels...),
+		ClickModels:        append([]ClickModelVersion{}, r.index.ClickModels...),
+		PinnedRankingModel: r.index.PinnedRankingModel,
+		PinnedClickModel:   r.index.PinnedClickModel,
+	}
+}
+
+// AddRankingModel saves a ranking model to the registry.
+func (r *ModelRegistry) AddRankingModel(version RankingModelVersion, m ranking.Model) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.writeModel(ModelTypeRanking, version.Version, func(w io.Writer) error {
+		return ranking.MarshalModel(w, m)
+	}); err != nil {
+		return errors.Trace(err)
+	}
+	r.index.RankingModels = append(r.index.RankingModels, version)
+	for len(r.index.RankingModels) > r.size {
+		// remove the oldest model except the pinned model
+		i := 0
+		if r.index.RankingModels[i].Version == r.index.PinnedRankingModel {
+			i++
+		}
+		r.removeModel(ModelTypeRanking, r.index.RankingModels[i].Version)
+		r.index.RankingModels = append(r.index.RankingModels[:i], r.index.RankingModels[i+1:]...)
+	}
+	return r.writeIndex()
+}
+
+// AddClickModel saves a click model to the registry.
+func (r *ModelRegistry) AddClickModel(version ClickModelVersion, m click.FactorizationMachine) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.writeModel(ModelTypeClick, version.Version, func(w io.Writer) error {
+		return click.MarshalModel(w, m)
+	}); err != nil {
+		return errors.Trace(err)
+	}
+	r.index.ClickModels = append(r.index.ClickModels, version)
+	for len(r.index.ClickModels) > r.size {
+		// remove the oldest model except the pinned model
+		i := 0
+		if r.index.ClickModels[i].Version == r.index.PinnedClickModel {
+			i++
+		}
+		r.removeModel(ModelTypeClick, r.index.ClickModels[i].Version)
+		r.index.ClickModels = append(r.index.ClickModels[:i], r.index.ClickModels[i+1:]...)
+	}
+	return r.writeIndex()
+}
+
+// LoadRankingModel loads a ranking model from the registry.
+func (r *ModelRegistry) LoadRankingModel(version int64) (RankingModelVersion, ranking.Model, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, v := range r.index.RankingModels {
+		if v.Version == version {
+			var m ranking.Model
+			err := r.readModel(ModelTypeRanking, version, func(r io.Reader) (err error) {
+				m, err = ranking.UnmarshalModel(r)
+				return
+			})
+			return v, m, errors.Trace(err)
+		}
+	}
+	return RankingModelVersion{}, nil, errors.NotFoundf("ranking model %s", base.Hex(version))
+}
+
+// LoadClickModel loads a click model from the registry.
+func (r *ModelRegistry) LoadClickModel(version int64) (ClickModelVersion, click.FactorizationMachine, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, v := range r.index.ClickModels {
+		if v.Version == version {
+			var m click.FactorizationMachine
+			err := r.readModel(ModelTypeClick, version, func(r io.Reader) (err error) {
+				m, err = click.UnmarshalModel(r)
+				return
+			})
+			return v, m, errors.Trace(err)
+		}
+	}
+	return ClickModelVersion{}, nil, errors.NotFoundf("click model %s", base.Hex(version))
+}
+
+// PinRankingModel pins a ranking model in the registry. The model is unpinned if the version is zero.
+func (r *ModelRegistry) PinRankingModel(version int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.index.PinnedRankingModel = version
+	return r.writeIndex()
+}
+
+// PinClickModel pins a click model in the registry. The model is unpinned if the version is zero.
+func (r *ModelRegistry) PinClickModel(version int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.index.PinnedClickModel = version
+	return r.writeIndex()
+}
+
+func (r *ModelRegistry) modelPath(modelType string, version int64) string {
+	return filepath.Join(r.dir, fmt.Sprintf("%s-%s.model", modelType, base.Hex(version)))
+}
+
+func (r *ModelRegistry) writeModel(modelType string, version int64, marshal func(w io.Writer) error) error {
+	f, err := os.Create(r.modelPath(modelType, version))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func(f *os.File) {
+		if err = f.Close(); err != nil {
+			base.Logger().Error("fail to close file", zap.Error(err))
+		}
+	}(f)
+	return marshal(f)
+}
+
+func (r *ModelRegistry) readModel(modelType string, version int64, unmarshal func(r io.Reader) error) error {
+	f, err := os.Open(r.modelPath(modelType, version))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func(f *os.File) {
+		if err = f.Close(); err != nil {
+			base.Logger().Error("fail to close file", zap.Error(err))
+		}
+	}(f)
+	return unmarshal(f)
+}
+
+func (r *ModelRegistry) removeModel(modelType string, version int64) {
+	if err := os.Remove(r.modelPath(modelType, version)); err != nil {
+		base.Logger().Warn("failed to remove model", zap.String("type", modelType),
+			zap.String("version", base.Hex(version)), zap.Error(err))
+	}
+}
+
+func (r *ModelRegistry) writeIndex() error {
+	f, err := os.Create(filepath.Join(r.dir, modelRegistryIndexFile))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func(f *os.File) {
+		if err = f.Close(); err != nil {
+			base.Logger().Error("fail to close file", zap.Error(err))
+		}
+	}(f)
+	return errors.Trace(base.WriteGob(f, r.index))
+}
+
+// isRankingModelPinned returns true if a ranking model is pinned in the model registry.
+func (m *Master) isRankingModelPinned() bool {
+	return m.modelRegistry != nil && m.modelRegistry.Index().PinnedRankingModel != 0
+}
+
+// isClickModelPinned returns true if a click model is pinned in the model registry.
+func (m *Master) isClickModelPinned() bool {
+	return m.modelRegistry != nil && m.modelRegistry.Index().PinnedClickModel != 0
+}
+
+// loadPinnedModels serves pinned models in the model registry.
+func (m *Master) loadPinnedModels() error {
+	index := m.modelRegistry.Index()
+	if index.PinnedRankingModel != 0 {
+		if err := m.serveRankingModel(index.PinnedRankingModel); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if index.PinnedClickModel != 0 {
+		if err := m.serveClickModel(index.PinnedClickModel); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// serveRankingModel replaces the current ranking model by a ranking model in the model registry.
+func (m *Master) serveRankingModel(version int64) error {
+	v, rankingModel, err := m.modelRegistry.LoadRankingModel(version)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	m.rankingModelMutex.Lock()
+	defer m.rankingModelMutex.Unlock()
+	m.rankingModel = rankingModel
+	m.rankingModelName = v.Name
+	m.rankingModelVersion = v.Version
+	m.rankingScore = v.Score
+	base.Logger().Info("serve ranking model in registry",
+		zap.String("version", base.Hex(v.Version)),
+		zap.String("name", v.Name),
+		zap.Any("params", v.Params))
+	return nil
+}
+
+// serveClickModel replaces the current click model by a click model in the model registry.
+func (m *Master) serveClickModel(version int64) error {
+	v, clickModel, err := m.modelRegistry.LoadClickModel(version)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	m.clickModelMutex.Lock()
+	defer m.clickModelMutex.Unlock()
+	m.clickModel = clickModel
+	m.clickModelVersion = v.Version
+	m.clickScore = v.Score
+	base.Logger().Info("serve click model in registry",
+		zap.String("version", base.Hex(v.Version)),
+		zap.Any("params", v.Params))
+	return nil
+}
+
+// pinModel serves a model in the model registry and keeps serving it until unpinned. Models fitted later are saved
+// to the model registry but not served.
+func (m *Master) pinModel(modelType string, version int64) error {
+	switch modelType {
+	case ModelTypeRanking:
+		if err := m.serveRankingModel(version); err != nil {
+			return errors.Trace(err)
+		}
+		return m.modelRegistry.PinRankingModel(version)
+	case ModelTypeClick:
+		if err := m.serveClickModel(version); err != nil {
+			return errors.Trace(err)
+		}
+		return m.modelRegistry.PinClickModel(version)
+	}
+	return errors.NotValidf("model type %s", modelType)
+}
+
+// unpinModel serves the latest model in the model registry and serves models fitted later.
+func (m *Master) unpinModel(modelType string) error {
+	index := m.modelRegistry.Index()
+	switch modelType {
+	case ModelTypeRanking:
+		if n := len(index.RankingModels); n > 0 {
+			if err := m.serveRankingModel(index.RankingModels[n-1].Version); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return m.modelRegistry.PinRankingModel(0)
+	case ModelTypeClick:
+		if n := len(index.ClickModels); n > 0 {
+			if err := m.serveClickModel(index.ClickModels[n-1].Version); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return m.modelRegistry.PinClickModel(0)
+	}
+	return errors.NotValidf("model type %s", modelType)
+}
+
+// rollbackModel pins the model fitted before the current model.
+func (m *Master) rollbackModel(modelType string) error {
+	var versions []int64
+	var current int64
+	index := m.modelRegistry.Index()
+	switch modelType {
+	case ModelTypeRanking:
+		for _, v := range index.RankingModels {
+			versions = append(versions, v.Version)
+		}
+		m.rankingModelMutex.RLock()
+		current = m.rankingModelVersion
+		m.rankingModelMutex.RUnlock()
+	case ModelTypeClick:
+		for _, v := range index.ClickModels {
+			versions = append(versions, v.Version)
+		}
+		m.clickModelMutex.RLock()
+		current = m.clickModelVersion
+		m.clickModelMutex.RUnlock()
+	default:
+		return errors.NotValidf("model type %s", modelType)
+	}
+	for i, version := range versions {
+		if version == current {
+			if i == 0 {
+				return errors.NotFoundf("%s model before %s", modelType, base.Hex(current))
+			}
+			return m.pinModel(modelType, versions[i-1])
+		}
+	}
+	return errors.NotFoundf("%s model %s", modelType, base.Hex(current))
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package master
+
+import (
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/click"
+	"github.com/zhenghaoz/gorse/model/ranking"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newRankingModelVersion(t *testing.T, version int64) (RankingModelVersion, ranking.Model) {
+	trainSet, testSet := newRankingDataset()
+	bpr := ranking.NewBPR(model.Params{model.NEpochs: 0, model.NFactors: int(version)})
+	bpr.Fit(trainSet, testSet, nil)
+	assert.False(t, bpr.Invalid())
+	return RankingModelVersion{Version: version, Name: "bpr", Params: bpr.GetParams()}, bpr
+}
+
+func TestModelRegistry(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "TestModelRegistry_Master")
+	assert.NoError(t, os.RemoveAll(dir))
+	defer os.RemoveAll(dir)
+	registry, err := OpenModelRegistry(dir, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, registry.Index().RankingModels)
+
+	// add ranking models
+	for version := int64(1); version <= 3; version++ {
+		err = registry.AddRankingModel(newRankingModelVersion(t, version))
+		assert.NoError(t, err)
+	}
+	index := registry.Index()
+	assert.Equal(t, 2, len(index.RankingModels))
+	assert.Equal(t, int64(2), index.RankingModels[0].Version)
+	assert.Equal(t, int64(3), index.RankingModels[1].Version)
+	_, _, err = registry.LoadRankingModel(1)
+	assert.True(t, errors.IsNotFound(err))
+	assert.NoFileExists(t, registry.modelPath(ModelTypeRanking, 1))
+	version, rankingModel, err := registry.LoadRankingModel(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), version.Version)
+	assert.Equal(t, model.Params{model.NEpochs: 0, model.NFactors: 2}, rankingModel.GetParams())
+
+	// pinned model is kept
+	err = registry.PinRankingModel(2)
+	assert.NoError(t, err)
+	err = registry.AddRankingModel(newRankingModelVersion(t, 4))
+	assert.NoError(t, err)
+	index = registry.Index()
+	assert.Equal(t, int64(2), index.PinnedRankingModel)
+	assert.Equal(t, int64(2), index.RankingModels[0].Version)
+	assert.Equal(t, int64(4), index.RankingModels[1].Version)
+
+	// add click models
+	train, test := newClickDataset()
+	fm := click.NewFM(click.FMClassification, model.Params{model.NEpochs: 0})
+	fm.Fit(train, test, nil)
+	err = registry.AddClickModel(ClickModelVersion{Version: 5, Params: fm.GetParams()}, fm)
+	assert.NoError(t, err)
+	_, clickModel, err := registry.LoadClickModel(5)
+	assert.NoError(t, err)
+	assert.False(t, clickModel.Invalid())
+
+	// reopen registry
+	registry, err = OpenModelRegistry(dir, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, index.RankingModels[0].Version, registry.Index().RankingModels[0].Version)
+	assert.Equal(t, index.RankingModels[1].Version, registry.Index().RankingModels[1].Version)
+	assert.Equal(t, int64(2), registry.Index().PinnedRankingModel)
+	assert.Equal(t, int64(5), registry.Index().ClickModels[0].Version)
+}
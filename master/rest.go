@@ -16,14 +16,17 @@ package master
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"github.com/araddon/dateparse"
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
+	"github.com/google/uuid"
 	"github.com/gorilla/securecookie"
 	_ "github.com/gorse-io/dashboard"
 	"github.com/juju/errors"
 	"github.com/rakyll/statik/fs"
+	"github.com/thoas/go-funk"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model/click"
@@ -74,6 +77,64 @@ func (m *Master) CreateWebService() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"dashboard"}).
 		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
 		Writes(map[string][]data.Measurement{}))
+	ws.Route(ws.GET("/dashboard/experiments").To(m.getExperiments).
+		Doc("Get positive feedback rates of arms in experiments.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"dashboard"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Writes(map[string]map[string][]data.Measurement{}))
+	// Merchandising rules
+	ws.Route(ws.GET("/dashboard/rules").To(m.getRules).
+		Doc("Get merchandising rules.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rule"}).
+		Writes([]data.Rule{}))
+	ws.Route(ws.POST("/dashboard/rule").To(m.insertRule).
+		Doc("Insert a merchandising rule. The rule with the same id is overwritten.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rule"}).
+		Reads(data.Rule{}).
+		Writes(server.Success{}))
+	ws.Route(ws.DELETE("/dashboard/rule/{rule-id}").To(m.deleteRule).
+		Doc("Delete a merchandising rule.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rule"}).
+		Param(ws.PathParameter("rule-id", "identifier of the rule").DataType("string")).
+		Writes(server.Success{}))
+	// API keys
+	ws.Route(ws.GET("/dashboard/api_keys").To(m.getAPIKeys).
+		Doc("Get API keys managed in the dashboard. Secret keys are masked.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"api_key"}).
+		Writes([]config.APIKey{}))
+	ws.Route(ws.POST("/dashboard/api_key").To(m.insertAPIKey).
+		Doc("Insert an API key. The API key with the same name is overwritten and a secret key is generated if empty.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"api_key"}).
+		Reads(config.APIKey{}).
+		Writes(config.APIKey{}))
+	ws.Route(ws.DELETE("/dashboard/api_key/{name}").To(m.deleteAPIKey).
+		Doc("Delete an API key.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"api_key"}).
+		Param(ws.PathParameter("name", "name of the API key").DataType("string")).
+		Writes(server.Success{}))
+	// Model registry
+	ws.Route(ws.GET("/dashboard/models").To(m.getModels).
+		Doc("Get history of models in the model registry and versions of serving models.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"model"}).
+		Writes(Models{}))
+	ws.Route(ws.POST("/dashboard/model/{model-type}/pin/{version}").To(m.pinModelVersion).
+		AllowedMethodsWithoutContentType([]string{http.MethodPost}).
+		Doc("Serve a model in the model registry until unpinned.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"model"}).
+		Param(ws.PathParameter("model-type", "type of the model (ranking or click)").DataType("string")).
+		Param(ws.PathParameter("version", "version of the model in hex").DataType("string")).
+		Writes(server.Success{}))
+	ws.Route(ws.DELETE("/dashboard/model/{model-type}/pin").To(m.unpinModelVersion).
+		Doc("Unpin the model and serve the latest model.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"model"}).
+		Param(ws.PathParameter("model-type", "type of the model (ranking or click)").DataType("string")).
+		Writes(server.Success{}))
+	ws.Route(ws.POST("/dashboard/model/{model-type}/rollback").To(m.rollbackModelVersion).
+		AllowedMethodsWithoutContentType([]string{http.MethodPost}).
+		Doc("Pin the model fitted before the serving model.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"model"}).
+		Param(ws.PathParameter("model-type", "type of the model (ranking or click)").DataType("string")).
+		Writes(server.Success{}))
 	// Get a user
 	ws.Route(ws.GET("/dashboard/user/{user-id}").To(m.getUser).
 		Doc("Get a user.").
@@ -511,6 +572,284 @@ func (m *Master) getRates(request *restful.Request, response *restful.Response)
 	server.Ok(response, measurements)
 }
 
+// getExperiments gets positive feedback rates of arms indexed by names of experiments and arms.
+func (m *Master) getExperiments(request *restful.Request, response *restful.Response) {
+	// Parse parameters
+	n, err := server.ParseInt(request, "n", 100)
+	if err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	experiments := make(map[string]map[string][]data.Measurement, len(m.GorseConfig.Recommend.Experiments))
+	for _, experiment := range m.GorseConfig.Recommend.Experiments {
+		experiments[experiment.Name] = make(map[string][]data.Measurement, len(experiment.Arms))
+		for _, arm := range experiment.Arms {
+			experiments[experiment.Name][arm.Name], err = m.DataClient.GetMeasurements(cache.Key(ExperimentPositiveFeedbackRate, experiment.Name, arm.Name), n)
+			if err != nil {
+				server.InternalServerError(response, err)
+				return
+			}
+		}
+	}
+	server.Ok(response, experiments)
+}
+
+func (m *Master) getRules(_ *restful.Request, response *restful.Response) {
+	rules, err := m.DataClient.GetRules()
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	if rules == nil {
+		rules = []data.Rule{}
+	}
+	server.Ok(response, rules)
+}
+
+func (m *Master) insertRule(request *restful.Request, response *restful.Response) {
+	var rule data.Rule
+	if err := request.ReadEntity(&rule); err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	if err := validateRule(rule); err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	if err := m.DataClient.InsertRule(rule); err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	server.Ok(response, server.Success{RowAffected: 1})
+}
+
+func (m *Master) deleteRule(request *restful.Request, response *restful.Response) {
+	ruleId := request.PathParameter("rule-id")
+	deleteCount, err := m.DataClient.DeleteRule(ruleId)
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	server.Ok(response, server.Success{RowAffected: deleteCount})
+}
+
+// validateRule checks whether a merchandising rule is well-formed.
+func validateRule(rule data.Rule) error {
+	if rule.RuleId == "" {
+		return errors.New("rule id must not be empty")
+	}
+	if rule.ItemId == "" {
+		return errors.New("item id must not be empty")
+	}
+	switch rule.Type {
+	case data.RulePin:
+		if rule.Position < 0 {
+			return errors.Errorf("position of pinned item must not be negative, but the current value is %d", rule.Position)
+		}
+	case data.RuleBoost:
+		if rule.Multiplier <= 0 {
+			return errors.Errorf("multiplier of boosted item must be positive, but the current value is %v", rule.Multiplier)
+		}
+	case data.RuleBlock:
+	default:
+		return errors.Errorf("type of rule must be one of [pin,boost,block], but the current value is %s", rule.Type)
+	}
+	if !rule.StartTime.IsZero() && !rule.EndTime.IsZero() && !rule.StartTime.Before(rule.EndTime) {
+		return errors.New("start time of rule must be before end time")
+	}
+	return nil
+}
+
+// loadAPIKeys loads API keys managed in the dashboard.
+func (m *Master) loadAPIKeys() ([]config.APIKey, error) {
+	val, err := m.CacheClient.GetString(cache.GlobalMeta, cache.APIKeys)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	var keys []config.APIKey
+	if err = json.Unmarshal([]byte(val), &keys); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return keys, nil
+}
+
+// saveAPIKeys saves API keys managed in the dashboard.
+func (m *Master) saveAPIKeys(keys []config.APIKey) error {
+	val, err := json.Marshal(keys)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return m.CacheClient.SetString(cache.GlobalMeta, cache.APIKeys, string(val))
+}
+
+func (m *Master) getAPIKeys(_ *restful.Request, response *restful.Response) {
+	keys, err := m.loadAPIKeys()
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	if keys == nil {
+		keys = []config.APIKey{}
+	}
+	for i := range keys {
+		keys[i].Key = maskKey(keys[i].Key)
+	}
+	server.Ok(response, keys)
+}
+
+func (m *Master) insertAPIKey(request *restful.Request, response *restful.Response) {
+	var key config.APIKey
+	if err := request.ReadEntity(&key); err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	if key.Key == "" {
+		key.Key = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	m.apiKeysMutex.Lock()
+	defer m.apiKeysMutex.Unlock()
+	keys, err := m.loadAPIKeys()
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	if err = m.validateAPIKey(key, keys); err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	keys = append(funk.Filter(keys, func(k config.APIKey) bool { return k.Name != key.Name }).([]config.APIKey), key)
+	if err = m.saveAPIKeys(keys); err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	server.Ok(response, key)
+}
+
+func (m *Master) deleteAPIKey(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+	m.apiKeysMutex.Lock()
+	defer m.apiKeysMutex.Unlock()
+	keys, err := m.loadAPIKeys()
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	remained := funk.Filter(keys, func(k config.APIKey) bool { return k.Name != name }).([]config.APIKey)
+	if err = m.saveAPIKeys(remained); err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	server.Ok(response, server.Success{RowAffected: len(keys) - len(remained)})
+}
+
+// validateAPIKey checks whether an API key is well-formed and doesn't conflict with API keys in config. The secret
+// must differ from the legacy API key and other API keys, otherwise requests could be authorized by another key.
+func (m *Master) validateAPIKey(key config.APIKey, stored []config.APIKey) error {
+	if key.Name == "" {
+		return errors.New("name of API key must not be empty")
+	}
+	for _, scope := range key.Scopes {
+		if scope != config.ScopeRead && scope != config.ScopeWrite && scope != config.ScopeDelete {
+			return errors.Errorf("scopes of API key must be a subset of [read,write,delete], but the current value is %s", scope)
+		}
+	}
+	if key.RateLimit < 0 || key.Burst < 0 {
+		return errors.New("rate limit and burst of API key must not be negative")
+	}
+	if key.Key == m.GorseConfig.Server.APIKey {
+		return errors.New("secret of API key must differ from the legacy API key")
+	}
+	for _, k := range m.GorseConfig.Server.APIKeys {
+		if k.Name == key.Name {
+			return errors.Errorf("API key %s is defined in config", key.Name)
+		}
+		if k.Key == key.Key {
+			return errors.Errorf("secret of API key is used by API key %s in config", k.Name)
+		}
+	}
+	for _, k := range stored {
+		// the stored key with the same name is replaced
+		if k.Name != key.Name && k.Key == key.Key {
+			return errors.Errorf("secret of API key is used by API key %s", k.Name)
+		}
+	}
+	return nil
+}
+
+// maskKey masks a secret key except the last four characters.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return strings.Repeat("*", len(key))
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// Models is the history of models in the model registry and versions of serving models.
+type Models struct {
+	ModelRegistryIndex
+	RankingModelVersion int64 `json:",string"`
+	ClickModelVersion   int64 `json:",string"`
+}
+
+func (m *Master) getModels(_ *restful.Request, response *restful.Response) {
+	if m.modelRegistry == nil {
+		server.BadRequest(response, errors.New("model registry is disabled"))
+		return
+	}
+	models := Models{ModelRegistryIndex: m.modelRegistry.Index()}
+	m.rankingModelMutex.RLock()
+	models.RankingModelVersion = m.rankingModelVersion
+	m.rankingModelMutex.RUnlock()
+	m.clickModelMutex.RLock()
+	models.ClickModelVersion = m.clickModelVersion
+	m.clickModelMutex.RUnlock()
+	server.Ok(response, models)
+}
+
+func (m *Master) pinModelVersion(request *restful.Request, response *restful.Response) {
+	if m.modelRegistry == nil {
+		server.BadRequest(response, errors.New("model registry is disabled"))
+		return
+	}
+	version, err := strconv.ParseInt(request.PathParameter("version"), 16, 64)
+	if err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	writeModelRegistryResult(response, m.pinModel(request.PathParameter("model-type"), version))
+}
+
+func (m *Master) unpinModelVersion(request *restful.Request, response *restful.Response) {
+	if m.modelRegistry == nil {
+		server.BadRequest(response, errors.New("model registry is disabled"))
+		return
+	}
+	writeModelRegistryResult(response, m.unpinModel(request.PathParameter("model-type")))
+}
+
+func (m *Master) rollbackModelVersion(request *restful.Request, response *restful.Response) {
+	if m.modelRegistry == nil {
+		server.BadRequest(response, errors.New("model registry is disabled"))
+		return
+	}
+	writeModelRegistryResult(response, m.rollbackModel(request.PathParameter("model-type")))
+}
+
+func writeModelRegistryResult(response *restful.Response, err error) {
+	if errors.IsNotValid(err) {
+		server.BadRequest(response, err)
+	} else if errors.IsNotFound(err) {
+		server.PageNotFound(response, err)
+	} else if err != nil {
+		server.InternalServerError(response, err)
+	} else {
+		server.Ok(response, server.Success{RowAffected: 1})
+	}
+}
+
 type UserIterator struct {
 	Cursor string
 	Users  []User
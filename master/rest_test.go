@@ -22,6 +22,7 @@ import (
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/server"
@@ -30,6 +31,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -463,6 +466,191 @@ func TestMaster_GetRates(t *testing.T) {
 		End()
 }
 
+func TestMaster_GetExperiments(t *testing.T) {
+	s, cookie := newMockServer(t)
+	defer s.Close(t)
+	// write rates
+	s.GorseConfig.Recommend.Experiments = []config.ExperimentConfig{
+		{Name: "e", Arms: []config.ExperimentArm{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}},
+	}
+	err := s.DataClient.InsertMeasurement(data.Measurement{Name: cache.Key(ExperimentPositiveFeedbackRate, "e", "a"), Value: 1.0, Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	err = s.DataClient.InsertMeasurement(data.Measurement{Name: cache.Key(ExperimentPositiveFeedbackRate, "e", "a"), Value: 2.0, Timestamp: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	err = s.DataClient.InsertMeasurement(data.Measurement{Name: cache.Key(ExperimentPositiveFeedbackRate, "e", "b"), Value: 10.0, Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	// get rates
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/experiments").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, map[string]map[string][]data.Measurement{
+			"e": {
+				"a": {
+					{Name: cache.Key(ExperimentPositiveFeedbackRate, "e", "a"), Value: 2.0, Timestamp: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)},
+					{Name: cache.Key(ExperimentPositiveFeedbackRate, "e", "a"), Value: 1.0, Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+				},
+				"b": {
+					{Name: cache.Key(ExperimentPositiveFeedbackRate, "e", "b"), Value: 10.0, Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+				},
+			},
+		})).
+		End()
+}
+
+func TestMaster_Rules(t *testing.T) {
+	s, cookie := newMockServer(t)
+	defer s.Close(t)
+	rules := []data.Rule{
+		{RuleId: "0", Type: data.RulePin, ItemId: "1", Position: 2, UserLabels: []string{"a"},
+			StartTime: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), EndTime: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{RuleId: "1", Type: data.RuleBoost, ItemId: "2", Category: "*", Multiplier: 2},
+	}
+	// insert rules
+	for _, rule := range rules {
+		apitest.New().
+			Handler(s.handler).
+			Post("/api/dashboard/rule").
+			Header("Cookie", cookie).
+			JSON(rule).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, server.Success{RowAffected: 1})).
+			End()
+	}
+	// insert invalid rules
+	for _, rule := range []data.Rule{
+		{RuleId: "2", Type: "unknown", ItemId: "1"},
+		{RuleId: "2", Type: data.RuleBoost, ItemId: "1"},
+		{RuleId: "2", Type: data.RulePin, ItemId: "1", Position: -1},
+		{RuleId: "", Type: data.RuleBlock, ItemId: "1"},
+		{RuleId: "2", Type: data.RuleBlock, ItemId: "1",
+			StartTime: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), EndTime: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		apitest.New().
+			Handler(s.handler).
+			Post("/api/dashboard/rule").
+			Header("Cookie", cookie).
+			JSON(rule).
+			Expect(t).
+			Status(http.StatusBadRequest).
+			End()
+	}
+	// get rules
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/rules").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, rules)).
+		End()
+	// delete rule
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/dashboard/rule/0").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, server.Success{RowAffected: 1})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/rules").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, rules[1:])).
+		End()
+	// delete missing rule
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/dashboard/rule/0").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, server.Success{RowAffected: 0})).
+		End()
+}
+
+func TestMaster_APIKeys(t *testing.T) {
+	s, cookie := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.APIKey = "legacy_key"
+	s.GorseConfig.Server.APIKeys = []config.APIKey{{Name: "static", Key: "static_key"}}
+	// insert API keys
+	apiKeys := []config.APIKey{
+		{Name: "frontend", Key: "frontend_key", Scopes: []string{config.ScopeRead}, RateLimit: 100, Burst: 200},
+		{Name: "backend", Key: "backend_key", Scopes: []string{config.ScopeRead, config.ScopeWrite, config.ScopeDelete}},
+	}
+	for _, apiKey := range apiKeys {
+		apitest.New().
+			Handler(s.handler).
+			Post("/api/dashboard/api_key").
+			Header("Cookie", cookie).
+			JSON(apiKey).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, apiKey)).
+			End()
+	}
+	// insert invalid API keys
+	for _, apiKey := range []config.APIKey{
+		{Name: ""},
+		{Name: "a", Scopes: []string{"admin"}},
+		{Name: "a", RateLimit: -1},
+		{Name: "static"},
+		{Name: "a", Key: "legacy_key"},
+		{Name: "a", Key: "static_key"},
+		{Name: "a", Key: "frontend_key", Scopes: []string{config.ScopeRead, config.ScopeWrite, config.ScopeDelete}},
+	} {
+		apitest.New().
+			Handler(s.handler).
+			Post("/api/dashboard/api_key").
+			Header("Cookie", cookie).
+			JSON(apiKey).
+			Expect(t).
+			Status(http.StatusBadRequest).
+			End()
+	}
+	// update an API key with its own secret
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/dashboard/api_key").
+		Header("Cookie", cookie).
+		JSON(apiKeys[1]).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, apiKeys[1])).
+		End()
+	// get API keys
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/api_keys").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []config.APIKey{
+			{Name: "frontend", Key: "********_key", Scopes: []string{config.ScopeRead}, RateLimit: 100, Burst: 200},
+			{Name: "backend", Key: "*******_key", Scopes: []string{config.ScopeRead, config.ScopeWrite, config.ScopeDelete}},
+		})).
+		End()
+	// delete API key
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/dashboard/api_key/frontend").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, server.Success{RowAffected: 1})).
+		End()
+	keys, err := s.loadAPIKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, apiKeys[1:], keys)
+}
+
 func TestMaster_GetCategories(t *testing.T) {
 	s, cookie := newMockServer(t)
 	defer s.Close(t)
@@ -686,3 +874,94 @@ func TestServer_GetRecommends(t *testing.T) {
 		})).
 		End()
 }
+
+func TestMaster_Models(t *testing.T) {
+	s, cookie := newMockServer(t)
+	defer s.Close(t)
+	// model registry is disabled
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/models").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// add ranking models
+	dir := filepath.Join(os.TempDir(), "TestMaster_Models")
+	assert.NoError(t, os.RemoveAll(dir))
+	defer os.RemoveAll(dir)
+	var err error
+	s.modelRegistry, err = OpenModelRegistry(dir, 10)
+	assert.NoError(t, err)
+	for version := int64(1); version <= 3; version++ {
+		err = s.modelRegistry.AddRankingModel(newRankingModelVersion(t, version))
+		assert.NoError(t, err)
+	}
+	s.rankingModelVersion = 3
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/models").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, Models{ModelRegistryIndex: s.modelRegistry.Index(), RankingModelVersion: 3})).
+		End()
+	// rollback ranking model
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/dashboard/model/ranking/rollback").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, server.Success{RowAffected: 1})).
+		End()
+	assert.Equal(t, int64(2), s.rankingModelVersion)
+	assert.Equal(t, int64(2), s.modelRegistry.Index().PinnedRankingModel)
+	assert.Equal(t, 2, s.rankingModel.GetParams()[model.NFactors])
+	// pin ranking model
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/dashboard/model/ranking/pin/1").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, server.Success{RowAffected: 1})).
+		End()
+	assert.Equal(t, int64(1), s.rankingModelVersion)
+	assert.Equal(t, int64(1), s.modelRegistry.Index().PinnedRankingModel)
+	// no model before the first model
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/dashboard/model/ranking/rollback").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	// pin unknown model
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/dashboard/model/ranking/pin/ff").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	// pin unknown model type
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/dashboard/model/unknown/pin/1").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// unpin ranking model
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/dashboard/model/ranking/pin").
+		Header("Cookie", cookie).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, server.Success{RowAffected: 1})).
+		End()
+	assert.Equal(t, int64(3), s.rankingModelVersion)
+	assert.Zero(t, s.modelRegistry.Index().PinnedRankingModel)
+}
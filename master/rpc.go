@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"github.com/juju/errors"
 	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/protocol"
@@ -76,6 +77,22 @@ func (m *Master) GetMeta(ctx context.Context, nodeInfo *protocol.NodeInfo) (*pro
 	if err != nil {
 		return nil, err
 	}
+	// append API keys managed in the dashboard
+	apiKeys, err := m.loadAPIKeys()
+	if err != nil {
+		base.Logger().Error("failed to load api keys", zap.Error(err))
+		return nil, err
+	}
+	if len(apiKeys) > 0 {
+		var gorseConfig config.Config
+		if err = json.Unmarshal(s, &gorseConfig); err != nil {
+			return nil, err
+		}
+		gorseConfig.Server.APIKeys = append(gorseConfig.Server.APIKeys, apiKeys...)
+		if s, err = json.Marshal(&gorseConfig); err != nil {
+			return nil, err
+		}
+	}
 	// save ranking model version
 	m.rankingModelMutex.RLock()
 	var rankingModelVersion int64
@@ -25,6 +25,7 @@ import (
 	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/protocol"
 	"github.com/zhenghaoz/gorse/server"
+	"github.com/zhenghaoz/gorse/storage/cache"
 	"google.golang.org/grpc"
 	"net"
 	"testing"
@@ -37,7 +38,7 @@ type mockMasterRPC struct {
 	grpcServer *grpc.Server
 }
 
-func newMockMasterRPC(_ *testing.T) *mockMasterRPC {
+func newMockMasterRPC(t *testing.T) *mockMasterRPC {
 	// create click model
 	train, test := newClickDataset()
 	fm := click.NewFM(click.FMClassification, model.Params{model.NEpochs: 0})
@@ -46,6 +47,9 @@ func newMockMasterRPC(_ *testing.T) *mockMasterRPC {
 	trainSet, testSet := newRankingDataset()
 	bpr := ranking.NewBPR(model.Params{model.NEpochs: 0})
 	bpr.Fit(trainSet, testSet, nil)
+	// create cache store
+	cacheClient, err := cache.Open("memory://")
+	assert.NoError(t, err)
 	return &mockMasterRPC{
 		Master: Master{
 			taskMonitor:         NewTaskMonitor(),
@@ -56,6 +60,7 @@ func newMockMasterRPC(_ *testing.T) *mockMasterRPC {
 			clickModelVersion:   456,
 			clickModel:          fm,
 			RestServer: server.RestServer{
+				CacheClient: cacheClient,
 				GorseConfig: (*config.Config)(nil).LoadDefaultIfNil(),
 			},
 		},
@@ -80,8 +85,11 @@ func (m *mockMasterRPC) Start(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func (m *mockMasterRPC) Stop() {
+func (m *mockMasterRPC) Stop(t *testing.T) {
 	m.grpcServer.Stop()
+	// in-memory cache storage is shared by nodes with the same DSN until closed
+	err := m.CacheClient.Close()
+	assert.NoError(t, err)
 }
 
 func TestRPC(t *testing.T) {
@@ -143,11 +151,24 @@ func TestRPC(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, rpcServer.GorseConfig, &cfg)
 
+	// test get meta with API keys managed in the dashboard
+	apiKeys := []config.APIKey{{Name: "frontend", Key: "secret", Scopes: []string{config.ScopeRead}, RateLimit: 10}}
+	err = rpcServer.saveAPIKeys(apiKeys)
+	assert.NoError(t, err)
+	metaResp, err = client.GetMeta(ctx,
+		&protocol.NodeInfo{NodeType: protocol.NodeType_ServerNode, NodeName: "server1", HttpPort: 1234})
+	assert.NoError(t, err)
+	cfg = config.Config{}
+	err = json.Unmarshal([]byte(metaResp.Config), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, apiKeys, cfg.Server.APIKeys)
+	assert.Empty(t, rpcServer.GorseConfig.Server.APIKeys)
+
 	time.Sleep(time.Second * 2)
 	metaResp, err = client.GetMeta(ctx,
 		&protocol.NodeInfo{NodeType: protocol.NodeType_WorkerNode, NodeName: "worker2", HttpPort: 1234})
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"worker2"}, metaResp.Workers)
 
-	rpcServer.Stop()
+	rpcServer.Stop(t)
 }
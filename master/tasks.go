@@ -21,10 +21,12 @@ import (
 	"github.com/juju/errors"
 	"github.com/scylladb/go-set/i32set"
 	"github.com/scylladb/go-set/strset"
+	"github.com/thoas/go-funk"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/base/heap"
 	"github.com/zhenghaoz/gorse/base/search"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/storage/cache"
@@ -33,17 +35,34 @@ import (
 	"modernc.org/mathutil"
 	"modernc.org/sortutil"
 	"sort"
+	"strconv"
 	"time"
 )
 
 const (
-	PositiveFeedbackRate = "PositiveFeedbackRate"
+	PositiveFeedbackRate           = "PositiveFeedbackRate"
+	ExperimentPositiveFeedbackRate = "ExperimentPositiveFeedbackRate"
+
+	// Daily click-through rates of impressions. The format of measurement name:
+	//	All impressions              - ImpressionClickThroughRate
+	//	Impressions from recommender - SourceClickThroughRate/{source}
+	//	Impressions at position      - PositionClickThroughRate/{position}
+	ImpressionClickThroughRate = "ImpressionClickThroughRate"
+	SourceClickThroughRate     = "SourceClickThroughRate"
+	PositionClickThroughRate   = "PositionClickThroughRate"
+
+	// Scores on the validation set evaluated by the promotion gate. The format of measurement name:
+	//	NDCG of ranking models - PromotionRankingNDCG/{incumbent|candidate}
+	//	AUC of click models    - PromotionClickAUC/{incumbent|candidate}
+	PromotionRankingNDCG = "PromotionRankingNDCG"
+	PromotionClickAUC    = "PromotionClickAUC"
 
 	TaskLoadDataset        = "加载数据集"
 	TaskFindItemNeighbors  = "寻找相关的问题或活动"
 	TaskFindUserNeighbors  = "寻找相关用户"
 	TaskAnalyze            = "分析点击率"
 	TaskFitRankingModel    = "训练协同过滤模型"
+	TaskFindItemAudience   = "寻找目标用户"
 	TaskFitClickModel      = "训练点击率预测模型"
 	TaskSearchRankingModel = "搜索现有的协同过滤模型"
 	TaskSearchClickModel   = "搜索现有的点击率预测模型"
@@ -126,18 +145,61 @@ func (m *Master) runLoadDatasetTask() error {
 
 	// split ranking dataset
 	m.rankingModelMutex.Lock()
-	m.rankingTrainSet, m.rankingTestSet = rankingDataset.Split(0, 0)
+	m.rankingTrainSet, m.rankingTestSet = m.splitRankingDataset(rankingDataset)
+	m.rankingGateTrainSet, m.rankingValidSet = nil, nil
+	if m.GorseConfig.Recommend.EnablePromotionGate {
+		// feedback in the validation window is held out for the promotion gate only
+		m.rankingGateTrainSet, m.rankingValidSet = rankingDataset.SplitByTime(m.validationTimeLimit())
+		// negative samples are fixed so that models are evaluated on the same candidates
+		m.rankingValidSet.NegativeSample(m.rankingGateTrainSet, ranking.NewFitConfig().Candidates)
+	}
 	rankingDataset = nil
 	m.rankingModelMutex.Unlock()
 
 	// split click dataset
 	m.clickModelMutex.Lock()
-	m.clickTrainSet, m.clickTestSet = clickDataset.Split(0.2, 0)
+	m.clickTrainSet, m.clickTestSet = m.splitClickDataset(clickDataset)
+	m.clickGateTrainSet, m.clickValidSet = nil, nil
+	if m.GorseConfig.Recommend.EnablePromotionGate {
+		m.clickGateTrainSet, m.clickValidSet = clickDataset.SplitByTime(m.validationTimeLimit())
+		base.Logger().Info("hold out validation set for promotion gate",
+			zap.Int("n_ranking_feedback", m.rankingValidSet.Count()),
+			zap.Int("n_click_samples", m.clickValidSet.Count()))
+	}
 	clickDataset = nil
 	m.clickModelMutex.Unlock()
 	return nil
 }
 
+// validationTimeLimit returns the beginning of the validation window of the promotion gate.
+func (m *Master) validationTimeLimit() time.Time {
+	return time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.ValidationWindow)
+}
+
+// splitRankingDataset splits a ranking dataset into a training set and a test set by the split strategy.
+func (m *Master) splitRankingDataset(dataset *ranking.DataSet) (*ranking.DataSet, *ranking.DataSet) {
+	switch m.GorseConfig.Recommend.SplitStrategy {
+	case "leave_latest_out":
+		return dataset.SplitLatest(m.GorseConfig.Recommend.SplitNumLatest)
+	case "cutoff_time":
+		return dataset.SplitByTime(time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.SplitCutoffWindow))
+	default:
+		return dataset.Split(0, 0)
+	}
+}
+
+// splitClickDataset splits a click dataset into a training set and a test set by the split strategy.
+func (m *Master) splitClickDataset(dataset *click.Dataset) (*click.Dataset, *click.Dataset) {
+	switch m.GorseConfig.Recommend.SplitStrategy {
+	case "leave_latest_out":
+		return dataset.SplitLatest(m.GorseConfig.Recommend.SplitNumLatest)
+	case "cutoff_time":
+		return dataset.SplitByTime(time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.SplitCutoffWindow))
+	default:
+		return dataset.Split(0.2, 0)
+	}
+}
+
 // runFindItemNeighborsTask updates neighbors of items.
 func (m *Master) runFindItemNeighborsTask(dataset *ranking.DataSet) {
 	m.taskMonitor.Start(TaskFindItemNeighbors, dataset.ItemCount())
@@ -179,13 +241,19 @@ func (m *Master) runFindItemNeighborsTask(dataset *ranking.DataSet) {
 			userIDF[i] = math32.Log(float32(dataset.ItemCount()) / float32(len(dataset.UserFeedback[i])))
 		}
 	}
-	labeledItems := make([][]int32, dataset.NumItemLabels)
-	labelIDF := make([]float32, dataset.NumItemLabels)
+	// tokens in descriptions are treated as labels of items
+	itemLabels, numItemLabels := dataset.ItemLabels, dataset.NumItemLabels
+	if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeContent {
+		itemLabels, numItemLabels = dataset.ItemTokens, dataset.NumItemTokens
+	}
+	labeledItems := make([][]int32, numItemLabels)
+	labelIDF := make([]float32, numItemLabels)
 	if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeSimilar ||
-		m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto {
-		for i, itemLabels := range dataset.ItemLabels {
-			sort.Sort(sortutil.Int32Slice(itemLabels))
-			for _, label := range itemLabels {
+		m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto ||
+		m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeContent {
+		for i, labels := range itemLabels {
+			sort.Sort(sortutil.Int32Slice(labels))
+			for _, label := range labels {
 				labeledItems[label] = append(labeledItems[label], int32(i))
 			}
 		}
@@ -197,10 +265,12 @@ func (m *Master) runFindItemNeighborsTask(dataset *ranking.DataSet) {
 
 	start := time.Now()
 	var err error
-	if m.GorseConfig.Recommend.EnableItemNeighborIndex {
-		err = m.findItemNeighborsIVF(dataset, labelIDF, userIDF, completed)
+	if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeEmbedding {
+		err = m.findItemNeighborsEmbedding(dataset, completed)
+	} else if m.GorseConfig.Recommend.EnableItemNeighborIndex {
+		err = m.findItemNeighborsIVF(dataset, itemLabels, labelIDF, userIDF, completed)
 	} else {
-		err = m.findItemNeighborsBruteForce(dataset, labeledItems, labelIDF, userIDF, completed)
+		err = m.findItemNeighborsBruteForce(dataset, itemLabels, labeledItems, labelIDF, userIDF, completed)
 	}
 	searchTime := time.Since(start)
 
@@ -218,7 +288,7 @@ func (m *Master) runFindItemNeighborsTask(dataset *ranking.DataSet) {
 	}
 }
 
-func (m *Master) findItemNeighborsBruteForce(dataset *ranking.DataSet, labeledItems [][]int32,
+func (m *Master) findItemNeighborsBruteForce(dataset *ranking.DataSet, itemLabels, labeledItems [][]int32,
 	labelIDF, userIDF []float32, completed chan struct{}) error {
 	return base.Parallel(dataset.ItemCount(), m.GorseConfig.Master.NumJobs, func(workerId, itemId int) error {
 		defer func() {
@@ -235,8 +305,9 @@ func (m *Master) findItemNeighborsBruteForce(dataset *ranking.DataSet, labeledIt
 		}
 
 		if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeSimilar ||
-			(m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto) {
-			labels := dataset.ItemLabels[itemId]
+			m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto ||
+			m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeContent {
+			labels := itemLabels[itemId]
 			itemSet := bitset.New(uint(dataset.ItemCount()))
 			var adjacencyItems []int32
 			for _, label := range labels {
@@ -249,11 +320,11 @@ func (m *Master) findItemNeighborsBruteForce(dataset *ranking.DataSet, labeledIt
 			}
 			for _, j := range adjacencyItems {
 				if j != int32(itemId) && !dataset.HiddenItems[j] {
-					commonSum, commonCount := commonElements(dataset.ItemLabels[itemId], dataset.ItemLabels[j], labelIDF)
+					commonSum, commonCount := commonElements(itemLabels[itemId], itemLabels[j], labelIDF)
 					if commonSum > 0 {
 						score := commonSum * commonCount /
-							math32.Sqrt(weightedSum(dataset.ItemLabels[itemId], labelIDF)) /
-							math32.Sqrt(weightedSum(dataset.ItemLabels[j], labelIDF)) /
+							math32.Sqrt(weightedSum(itemLabels[itemId], labelIDF)) /
+							math32.Sqrt(weightedSum(itemLabels[j], labelIDF)) /
 							(commonCount + similarityShrink)
 						nearItemsFilters[""].Push(j, score)
 						for _, category := range dataset.ItemCategories[j] {
@@ -312,14 +383,15 @@ func (m *Master) findItemNeighborsBruteForce(dataset *ranking.DataSet, labeledIt
 	})
 }
 
-func (m *Master) findItemNeighborsIVF(dataset *ranking.DataSet, labelIDF, userIDF []float32, completed chan struct{}) error {
+func (m *Master) findItemNeighborsIVF(dataset *ranking.DataSet, itemLabels [][]int32, labelIDF, userIDF []float32, completed chan struct{}) error {
 	var similarItemNeighbors, relatedItemNeighbors search.VectorIndex
 	var itemLabelVectors, itemFeedbackVectors []search.Vector
 	if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeSimilar ||
-		m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto {
+		m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto ||
+		m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeContent {
 		itemLabelVectors = make([]search.Vector, dataset.ItemCount())
 		for i := range itemLabelVectors {
-			itemLabelVectors[i] = search.NewDictionaryVector(dataset.ItemLabels[i], labelIDF, dataset.ItemCategories[i], dataset.HiddenItems[i])
+			itemLabelVectors[i] = search.NewDictionaryVector(itemLabels[i], labelIDF, dataset.ItemCategories[i], dataset.HiddenItems[i])
 		}
 		builder := search.NewIVFBuilder(itemLabelVectors, m.GorseConfig.Database.CacheSize, 1000,
 			search.SetIVFNumJobs(m.GorseConfig.Master.NumJobs))
@@ -352,7 +424,8 @@ func (m *Master) findItemNeighborsIVF(dataset *ranking.DataSet, labelIDF, userID
 		var neighbors map[string][]int32
 		var scores map[string][]float32
 		if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeSimilar ||
-			m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto {
+			m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeAuto ||
+			m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeContent {
 			neighbors, scores = similarItemNeighbors.MultiSearch(itemLabelVectors[itemId], dataset.CategorySet.List(), m.GorseConfig.Database.CacheSize, true)
 		}
 		if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeRelated ||
@@ -420,13 +493,23 @@ func (m *Master) runFindUserNeighborsTask(dataset *ranking.DataSet) {
 			itemIDF[i] = math32.Log(float32(dataset.UserCount()) / float32(len(dataset.ItemFeedback[i])))
 		}
 	}
-	labeledUsers := make([][]int32, dataset.NumUserLabels)
-	labelIDF := make([]float32, dataset.NumUserLabels)
+	// user attributes are treated as labels placed after user labels
+	userLabels := make([][]int32, dataset.UserCount())
+	labeledUsers := make([][]int32, dataset.NumUserLabels+dataset.NumUserAttrs)
+	labelIDF := make([]float32, dataset.NumUserLabels+dataset.NumUserAttrs)
 	if m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeSimilar ||
 		m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeAuto {
-		for i, userLabels := range dataset.UserLabels {
-			sort.Sort(sortutil.Int32Slice(userLabels))
-			for _, label := range userLabels {
+		for i := range userLabels {
+			if i < len(dataset.UserLabels) {
+				userLabels[i] = append(userLabels[i], dataset.UserLabels[i]...)
+			}
+			if i < len(dataset.UserAttributes) {
+				for _, attribute := range dataset.UserAttributes[i] {
+					userLabels[i] = append(userLabels[i], dataset.NumUserLabels+attribute)
+				}
+			}
+			sort.Sort(sortutil.Int32Slice(userLabels[i]))
+			for _, label := range userLabels[i] {
 				labeledUsers[label] = append(labeledUsers[label], int32(i))
 			}
 		}
@@ -438,10 +521,12 @@ func (m *Master) runFindUserNeighborsTask(dataset *ranking.DataSet) {
 
 	start := time.Now()
 	var err error
-	if m.GorseConfig.Recommend.EnableUserNeighborIndex {
-		err = m.findUserNeighborsIVF(dataset, labelIDF, itemIDF, completed)
+	if m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeEmbedding {
+		err = m.findUserNeighborsEmbedding(dataset, completed)
+	} else if m.GorseConfig.Recommend.EnableUserNeighborIndex {
+		err = m.findUserNeighborsIVF(dataset, userLabels, labelIDF, itemIDF, completed)
 	} else {
-		err = m.findUserNeighborsBruteForce(dataset, labeledUsers, labelIDF, itemIDF, completed)
+		err = m.findUserNeighborsBruteForce(dataset, userLabels, labeledUsers, labelIDF, itemIDF, completed)
 	}
 	searchTime := time.Since(start)
 
@@ -459,7 +544,7 @@ func (m *Master) runFindUserNeighborsTask(dataset *ranking.DataSet) {
 	m.taskMonitor.Finish(TaskFindUserNeighbors)
 }
 
-func (m *Master) findUserNeighborsBruteForce(dataset *ranking.DataSet, labeledUsers [][]int32, labelIDF, itemIDF []float32, completed chan struct{}) error {
+func (m *Master) findUserNeighborsBruteForce(dataset *ranking.DataSet, userLabels, labeledUsers [][]int32, labelIDF, itemIDF []float32, completed chan struct{}) error {
 	return base.Parallel(dataset.UserCount(), m.GorseConfig.Master.NumJobs, func(workerId, userId int) error {
 		defer func() {
 			completed <- struct{}{}
@@ -472,7 +557,7 @@ func (m *Master) findUserNeighborsBruteForce(dataset *ranking.DataSet, labeledUs
 
 		if m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeSimilar ||
 			(m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeAuto) {
-			labels := dataset.UserLabels[userId]
+			labels := userLabels[userId]
 			userSet := bitset.New(uint(dataset.UserCount()))
 			var adjacencyUsers []int32
 			for _, label := range labels {
@@ -485,11 +570,11 @@ func (m *Master) findUserNeighborsBruteForce(dataset *ranking.DataSet, labeledUs
 			}
 			for _, j := range adjacencyUsers {
 				if j != int32(userId) {
-					commonSum, commonCount := commonElements(dataset.UserLabels[userId], dataset.UserLabels[j], labelIDF)
+					commonSum, commonCount := commonElements(userLabels[userId], userLabels[j], labelIDF)
 					if commonSum > 0 {
 						score := commonSum * commonCount /
-							math32.Sqrt(weightedSum(dataset.UserLabels[userId], labelIDF)) /
-							math32.Sqrt(weightedSum(dataset.UserLabels[j], labelIDF)) /
+							math32.Sqrt(weightedSum(userLabels[userId], labelIDF)) /
+							math32.Sqrt(weightedSum(userLabels[j], labelIDF)) /
 							(commonCount + similarityShrink)
 						nearUsers.Push(j, score)
 					}
@@ -539,14 +624,14 @@ func (m *Master) findUserNeighborsBruteForce(dataset *ranking.DataSet, labeledUs
 	})
 }
 
-func (m *Master) findUserNeighborsIVF(dataset *ranking.DataSet, labelIDF, itemIDF []float32, completed chan struct{}) error {
+func (m *Master) findUserNeighborsIVF(dataset *ranking.DataSet, userLabels [][]int32, labelIDF, itemIDF []float32, completed chan struct{}) error {
 	var similarUserNeighbors, relatedUserNeighbors search.VectorIndex
 	var userLabelVectors, userFeedbackVectors []search.Vector
 	if m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeSimilar ||
 		m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeAuto {
 		userLabelVectors = make([]search.Vector, dataset.UserCount())
 		for i := range userLabelVectors {
-			userLabelVectors[i] = search.NewDictionaryVector(dataset.UserLabels[i], labelIDF, nil, false)
+			userLabelVectors[i] = search.NewDictionaryVector(userLabels[i], labelIDF, nil, false)
 		}
 		builder := search.NewIVFBuilder(userLabelVectors, m.GorseConfig.Database.CacheSize, 1000,
 			search.SetIVFNumJobs(m.GorseConfig.Master.NumJobs))
@@ -602,6 +687,185 @@ func (m *Master) findUserNeighborsIVF(dataset *ranking.DataSet, labelIDF, itemID
 	})
 }
 
+// findItemNeighborsEmbedding searches neighbors of items by cosine similarity between latent factors of items in the
+// ranking model.
+func (m *Master) findItemNeighborsEmbedding(dataset *ranking.DataSet, completed chan struct{}) error {
+	rankingModel, version, err := m.getMatrixFactorization()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// neighbors of all items are stale once the ranking model changes
+	modelChanged := m.checkNeighborsModelChanged(cache.ItemNeighborsModelVersion, version)
+	vectors := embeddingVectors(dataset.ItemIndex.GetNames(), rankingModel.GetItemIndex(), rankingModel.GetItemFactor,
+		rankingModel.IsItemPredictable, dataset.ItemCategories)
+	index, indices, recall := m.buildEmbeddingIndex(vectors, dataset.HiddenItems, m.GorseConfig.Recommend.EnableItemNeighborIndex,
+		m.GorseConfig.Recommend.ItemNeighborIndexRecall, m.GorseConfig.Recommend.ItemNeighborIndexFitEpoch)
+	if m.GorseConfig.Recommend.EnableItemNeighborIndex {
+		if err = m.CacheClient.SetString(cache.GlobalMeta, cache.ItemNeighborIndexRecall, base.FormatFloat32(recall)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	err = base.Parallel(dataset.ItemCount(), m.GorseConfig.Master.NumJobs, func(workerId, itemId int) error {
+		defer func() {
+			completed <- struct{}{}
+		}()
+		if vectors[itemId] == nil ||
+			(!modelChanged && !m.checkItemNeighborCacheTimeout(dataset.ItemIndex.ToName(int32(itemId)), dataset.CategorySet.List())) {
+			return nil
+		}
+		startTime := time.Now()
+		// the item itself might be returned by the index
+		neighbors, scores := index.MultiSearch(vectors[itemId], dataset.CategorySet.List(), m.GorseConfig.Database.CacheSize+1, true)
+		for category := range neighbors {
+			itemScores := make([]cache.Scored, 0, len(neighbors[category]))
+			for i, neighbor := range neighbors[category] {
+				if indices[neighbor] != int32(itemId) && len(itemScores) < m.GorseConfig.Database.CacheSize {
+					itemScores = append(itemScores, cache.Scored{Id: dataset.ItemIndex.ToName(indices[neighbor]), Score: -scores[category][i]})
+				}
+			}
+			if err := m.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, dataset.ItemIndex.ToName(int32(itemId)), category), itemScores); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if err := m.CacheClient.SetTime(cache.LastUpdateItemNeighborsTime, dataset.ItemIndex.ToName(int32(itemId)), time.Now()); err != nil {
+			return errors.Trace(err)
+		}
+		FindItemNeighborsSeconds.Observe(time.Since(startTime).Seconds())
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(m.CacheClient.SetString(cache.GlobalMeta, cache.ItemNeighborsModelVersion, base.Hex(version)))
+}
+
+// findUserNeighborsEmbedding searches neighbors of users by cosine similarity between latent factors of users in the
+// ranking model.
+func (m *Master) findUserNeighborsEmbedding(dataset *ranking.DataSet, completed chan struct{}) error {
+	rankingModel, version, err := m.getMatrixFactorization()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// neighbors of all users are stale once the ranking model changes
+	modelChanged := m.checkNeighborsModelChanged(cache.UserNeighborsModelVersion, version)
+	vectors := embeddingVectors(dataset.UserIndex.GetNames(), rankingModel.GetUserIndex(), rankingModel.GetUserFactor,
+		rankingModel.IsUserPredictable, nil)
+	index, indices, recall := m.buildEmbeddingIndex(vectors, nil, m.GorseConfig.Recommend.EnableUserNeighborIndex,
+		m.GorseConfig.Recommend.UserNeighborIndexRecall, m.GorseConfig.Recommend.UserNeighborIndexFitEpoch)
+	if m.GorseConfig.Recommend.EnableUserNeighborIndex {
+		if err = m.CacheClient.SetString(cache.GlobalMeta, cache.UserNeighborIndexRecall, base.FormatFloat32(recall)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	err = base.Parallel(dataset.UserCount(), m.GorseConfig.Master.NumJobs, func(workerId, userId int) error {
+		defer func() {
+			completed <- struct{}{}
+		}()
+		if vectors[userId] == nil || (!modelChanged && !m.checkUserNeighborCacheTimeout(dataset.UserIndex.ToName(int32(userId)))) {
+			return nil
+		}
+		startTime := time.Now()
+		// the user itself might be returned by the index
+		neighbors, scores := index.Search(vectors[userId], m.GorseConfig.Database.CacheSize+1, true)
+		userScores := make([]cache.Scored, 0, len(neighbors))
+		for i, neighbor := range neighbors {
+			if indices[neighbor] != int32(userId) && len(userScores) < m.GorseConfig.Database.CacheSize {
+				userScores = append(userScores, cache.Scored{Id: dataset.UserIndex.ToName(indices[neighbor]), Score: -scores[i]})
+			}
+		}
+		if err := m.CacheClient.SetSorted(cache.Key(cache.UserNeighbors, dataset.UserIndex.ToName(int32(userId))), userScores); err != nil {
+			return errors.Trace(err)
+		}
+		if err := m.CacheClient.SetTime(cache.LastUpdateUserNeighborsTime, dataset.UserIndex.ToName(int32(userId)), time.Now()); err != nil {
+			return errors.Trace(err)
+		}
+		FindUserNeighborsSeconds.Observe(time.Since(startTime).Seconds())
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(m.CacheClient.SetString(cache.GlobalMeta, cache.UserNeighborsModelVersion, base.Hex(version)))
+}
+
+// getMatrixFactorization returns the current ranking model and its version if it is a valid matrix factorization
+// model.
+func (m *Master) getMatrixFactorization() (ranking.MatrixFactorization, int64, error) {
+	m.rankingModelMutex.RLock()
+	defer m.rankingModelMutex.RUnlock()
+	if rankingModel, ok := m.rankingModel.(ranking.MatrixFactorization); ok && !rankingModel.Invalid() {
+		return rankingModel, m.rankingModelVersion, nil
+	}
+	return nil, 0, errors.NotFoundf("ranking model")
+}
+
+// checkNeighborsModelChanged checks if neighbors were searched by another version of the ranking model. The version
+// of the ranking model searching neighbors is stored in global meta with the key.
+func (m *Master) checkNeighborsModelChanged(key string, version int64) bool {
+	neighborsVersion, err := m.CacheClient.GetString(cache.GlobalMeta, key)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			base.Logger().Error("failed to read meta", zap.Error(err))
+		}
+		return true
+	}
+	return neighborsVersion != base.Hex(version)
+}
+
+// embeddingVectors creates vectors of normalized latent factors for names. The vector of a name is nil if the latent
+// factor of the name has not been trained.
+func embeddingVectors(names []string, index base.Index, getFactor func(int32) []float32, isPredictable func(int32) bool,
+	terms [][]string) []search.Vector {
+	vectors := make([]search.Vector, len(names))
+	for i, name := range names {
+		factorIndex := index.ToNumber(name)
+		if factorIndex == base.NotId || !isPredictable(factorIndex) {
+			continue
+		}
+		factor := getFactor(factorIndex)
+		var norm float32
+		for _, value := range factor {
+			norm += value * value
+		}
+		if norm == 0 {
+			continue
+		}
+		norm = math32.Sqrt(norm)
+		normalized := make([]float32, len(factor))
+		for j := range factor {
+			normalized[j] = factor[j] / norm
+		}
+		var vectorTerms []string
+		if i < len(terms) {
+			vectorTerms = terms[i]
+		}
+		vectors[i] = search.NewDenseVector(normalized, vectorTerms, false)
+	}
+	return vectors
+}
+
+// buildEmbeddingIndex builds a vector index on vectors which are neither nil nor hidden. An approximate index is built
+// if enabled, otherwise a brute-force index is built. It returns the index, positions of indexed vectors in the input
+// and the recall of the index.
+func (m *Master) buildEmbeddingIndex(vectors []search.Vector, hidden []bool, enableIndex bool, recall float32, fitEpoch int) (search.VectorIndex, []int32, float32) {
+	var indexedVectors []search.Vector
+	var indices []int32
+	for i, vector := range vectors {
+		if vector != nil && (i >= len(hidden) || !hidden[i]) {
+			indexedVectors = append(indexedVectors, vector)
+			indices = append(indices, int32(i))
+		}
+	}
+	if enableIndex && len(indexedVectors) > 0 {
+		builder := search.NewHNSWBuilder(indexedVectors, m.GorseConfig.Database.CacheSize, 1000, m.GorseConfig.Master.NumJobs)
+		index, score := builder.Build(recall, fitEpoch, true)
+		return index, indices, score
+	}
+	index := search.NewBruteforce(indexedVectors)
+	index.Build()
+	return index, indices, 1
+}
+
 func commonElements(a, b []int32, weights []float32) (float32, float32) {
 	i, j, sum, count := 0, 0, float32(0), float32(0)
 	for i < len(a) && j < len(b) {
@@ -706,35 +970,46 @@ func (m *Master) runRankingRelatedTasks(
 
 	var modelChanged bool
 	bestRankingName, bestRankingModel, bestRankingScore := m.rankingModelSearcher.GetBestModel()
-	m.rankingModelMutex.Lock()
-	if bestRankingModel != nil && !bestRankingModel.Invalid() &&
+	m.rankingModelMutex.RLock()
+	incumbentModel := m.rankingModel
+	shouldPromote := bestRankingModel != nil && !bestRankingModel.Invalid() && !m.isRankingModelPinned() &&
 		(bestRankingName != m.rankingModelName || bestRankingModel.GetParams().ToString() != m.rankingModel.GetParams().ToString()) &&
-		(bestRankingScore.NDCG > m.rankingScore.NDCG) {
+		(m.GorseConfig.Recommend.EnablePromotionGate || bestRankingScore.NDCG > m.rankingScore.NDCG)
+	m.rankingModelMutex.RUnlock()
+	// the promotion gate is evaluated without holding the lock since models are fitted
+	if shouldPromote && m.passRankingPromotionGate(incumbentModel, bestRankingModel) {
 		// 1. best ranking model must have been found.
-		// 2. best ranking model must be different from current model
-		// 3. best ranking model must perform better than current model
-		m.rankingModel = bestRankingModel
-		m.rankingModelName = bestRankingName
-		m.rankingScore = bestRankingScore
-		modelChanged = true
-		base.Logger().Info("find better ranking model",
-			zap.Any("score", bestRankingScore),
-			zap.String("name", bestRankingName),
-			zap.Any("params", m.rankingModel.GetParams()))
+		// 2. current ranking model must not be pinned.
+		// 3. best ranking model must be different from current model
+		// 4. best ranking model must perform better than current model on the test set
+		// 5. best ranking model must pass the promotion gate if enabled, which replaces the test set comparison
+		m.rankingModelMutex.Lock()
+		if m.rankingModel == incumbentModel && !m.isRankingModelPinned() {
+			m.rankingModel = bestRankingModel
+			m.rankingModelName = bestRankingName
+			m.rankingScore = bestRankingScore
+			modelChanged = true
+			base.Logger().Info("find better ranking model",
+				zap.Any("score", bestRankingScore),
+				zap.String("name", bestRankingName),
+				zap.Any("params", m.rankingModel.GetParams()))
+		}
+		m.rankingModelMutex.Unlock()
 	}
+	m.rankingModelMutex.RLock()
 	rankingModel := m.rankingModel
-	m.rankingModelMutex.Unlock()
+	m.rankingModelMutex.RUnlock()
 
-	// collect neighbors of items
+	// collect neighbors of items, neighbors by embedding are searched after the ranking model is fitted
 	if numItems == 0 {
 		m.taskMonitor.Fail(TaskFindItemNeighbors, "No item found.")
-	} else if numItemsChanged || numFeedbackChanged {
+	} else if (numItemsChanged || numFeedbackChanged) && m.GorseConfig.Recommend.ItemNeighborType != config.NeighborTypeEmbedding {
 		m.runFindItemNeighborsTask(m.rankingTrainSet)
 	}
-	// collect neighbors of users
+	// collect neighbors of users, neighbors by embedding are searched after the ranking model is fitted
 	if numUsers == 0 {
 		m.taskMonitor.Fail(TaskFindUserNeighbors, "No user found.")
-	} else if numUsersChanged || numFeedbackChanged {
+	} else if (numUsersChanged || numFeedbackChanged) && m.GorseConfig.Recommend.UserNeighborType != config.NeighborTypeEmbedding {
 		m.runFindUserNeighborsTask(m.rankingTrainSet)
 	}
 
@@ -751,18 +1026,77 @@ func (m *Master) runRankingRelatedTasks(
 }
 
 func (m *Master) runFitRankingModelTask(rankingModel ranking.Model) {
+	// fit a new ranking model while the current model is serving, which is warm started from the current model
+	// except every full_retrain_period cycles, that is, the model is warm started full_retrain_period - 1 times after
+	// each full retrain
+	params := rankingModel.GetParams()
+	m.rankingModelMutex.Lock()
+	warmStart := m.GorseConfig.Recommend.EnableWarmStart && !rankingModel.Invalid() &&
+		m.rankingWarmStarts+1 < m.GorseConfig.Recommend.FullRetrainPeriod
+	if warmStart {
+		m.rankingWarmStarts++
+	} else {
+		m.rankingWarmStarts = 0
+	}
+	numWarmStarts := m.rankingWarmStarts
+	m.rankingModelMutex.Unlock()
+	if warmStart {
+		// latent factors of existing users and items are relocated by ids in fitting
+		rankingModel = ranking.Clone(rankingModel)
+		rankingModel.SetParams(params.Overwrite(model.Params{model.NEpochs: m.GorseConfig.Recommend.WarmStartEpochs}))
+	} else {
+		rankingModel = ranking.NewModel(ranking.GetModelName(rankingModel), params)
+	}
+	base.Logger().Info("start fitting ranking model",
+		zap.Bool("warm_start", warmStart),
+		zap.Int("n_warm_starts", numWarmStarts))
 	score := rankingModel.Fit(m.rankingTrainSet, m.rankingTestSet, ranking.NewFitConfig().
 		SetJobs(m.GorseConfig.Master.NumJobs).
 		SetTracker(m.taskMonitor.NewTaskTracker(TaskFitRankingModel)))
+	if warmStart {
+		rankingModel.SetParams(params)
+	}
 
-	// update ranking model
+	// update ranking model unless pinned
 	m.rankingModelMutex.Lock()
-	m.rankingModel = rankingModel
-	m.rankingModelVersion++
-	m.rankingScore = score
+	version := m.rankingModelVersion + 1
+	pinned := m.isRankingModelPinned()
+	if m.modelRegistry != nil {
+		if index := m.modelRegistry.Index(); len(index.RankingModels) > 0 {
+			version = mathutil.MaxInt64(version, index.RankingModels[len(index.RankingModels)-1].Version+1)
+		}
+	}
+	if !pinned {
+		m.rankingModel = rankingModel
+		m.rankingModelVersion = version
+		m.rankingScore = score
+	}
 	m.rankingModelMutex.Unlock()
 	base.Logger().Info("fit ranking model complete",
-		zap.String("version", fmt.Sprintf("%x", m.rankingModelVersion)))
+		zap.String("version", fmt.Sprintf("%x", version)))
+	if m.modelRegistry != nil {
+		if err := m.modelRegistry.AddRankingModel(RankingModelVersion{
+			Version: version,
+			Name:    ranking.GetModelName(rankingModel),
+			Params:  rankingModel.GetParams(),
+			Score:   score,
+			FitTime: time.Now(),
+		}, rankingModel); err != nil {
+			base.Logger().Error("failed to save ranking model to registry", zap.Error(err))
+		}
+	}
+	// search neighbors by latent factors of the serving ranking model
+	if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeEmbedding && m.rankingTrainSet.ItemCount() > 0 {
+		m.runFindItemNeighborsTask(m.rankingTrainSet)
+	}
+	if m.GorseConfig.Recommend.UserNeighborType == config.NeighborTypeEmbedding && m.rankingTrainSet.UserCount() > 0 {
+		m.runFindUserNeighborsTask(m.rankingTrainSet)
+	}
+	if pinned {
+		base.Logger().Info("ranking model is pinned",
+			zap.String("version", base.Hex(m.modelRegistry.Index().PinnedRankingModel)))
+		return
+	}
 	MatchingTop10NDCG.Set(float64(score.NDCG))
 	MatchingTop10Recall.Set(float64(score.Recall))
 	MatchingTop10Precision.Set(float64(score.Precision))
@@ -788,6 +1122,99 @@ func (m *Master) runFitRankingModelTask(rankingModel ranking.Model) {
 			zap.Float32("ranking_model_score", m.localCache.RankingModelScore.NDCG),
 			zap.Any("ranking_model_params", m.localCache.RankingModel.GetParams()))
 	}
+
+	// search audience of items
+	if m.GorseConfig.Recommend.EnableItemAudience {
+		if matrixFactorization, ok := rankingModel.(ranking.MatrixFactorization); ok {
+			m.runFindItemAudienceTask(matrixFactorization)
+		}
+	}
+}
+
+// runFindItemAudienceTask searches users most likely to like each item by latent factors of the ranking model.
+func (m *Master) runFindItemAudienceTask(rankingModel ranking.MatrixFactorization) {
+	numItems := rankingModel.GetItemIndex().Len()
+	m.taskMonitor.Start(TaskFindItemAudience, int(numItems))
+	base.Logger().Info("start searching audience of items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	start := time.Now()
+	var err error
+	if m.GorseConfig.Recommend.EnableItemAudienceIndex {
+		err = m.findItemAudienceHNSW(rankingModel)
+	} else {
+		err = m.findItemAudienceBruteForce(rankingModel)
+	}
+	if err != nil {
+		base.Logger().Error("failed to search audience of items", zap.Error(err))
+		m.taskMonitor.Fail(TaskFindItemAudience, err.Error())
+		return
+	}
+	if err = m.CacheClient.SetTime(cache.GlobalMeta, cache.LastUpdateItemAudienceTime, time.Now()); err != nil {
+		base.Logger().Error("failed to set audience of items update time", zap.Error(err))
+	}
+	base.Logger().Info("complete searching audience of items",
+		zap.String("search_time", time.Since(start).String()))
+	m.taskMonitor.Finish(TaskFindItemAudience)
+}
+
+func (m *Master) findItemAudienceBruteForce(rankingModel ranking.MatrixFactorization) error {
+	userIds := rankingModel.GetUserIndex().GetNames()
+	return base.Parallel(int(rankingModel.GetItemIndex().Len()), m.GorseConfig.Master.NumJobs, func(workerId, itemIndex int) error {
+		if !rankingModel.IsItemPredictable(int32(itemIndex)) {
+			return nil
+		}
+		startTime := time.Now()
+		filter := heap.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
+		for userIndex, userId := range userIds {
+			if rankingModel.IsUserPredictable(int32(userIndex)) {
+				filter.Push(userId, rankingModel.InternalPredict(int32(userIndex), int32(itemIndex)))
+			}
+		}
+		users, scores := filter.PopAll()
+		if err := m.CacheClient.SetSorted(cache.Key(cache.ItemAudience, rankingModel.GetItemIndex().ToName(int32(itemIndex))),
+			cache.CreateScoredItems(users, scores)); err != nil {
+			return errors.Trace(err)
+		}
+		FindItemAudienceSeconds.Observe(time.Since(startTime).Seconds())
+		return nil
+	})
+}
+
+func (m *Master) findItemAudienceHNSW(rankingModel ranking.MatrixFactorization) error {
+	// index latent factors of predictable users
+	var userIndices []int32
+	var vectors []search.Vector
+	for i := int32(0); i < rankingModel.GetUserIndex().Len(); i++ {
+		if rankingModel.IsUserPredictable(i) {
+			userIndices = append(userIndices, i)
+			vectors = append(vectors, search.NewDenseVector(rankingModel.GetUserFactor(i), nil, false))
+		}
+	}
+	if len(vectors) == 0 {
+		return nil
+	}
+	builder := search.NewHNSWBuilder(vectors, m.GorseConfig.Database.CacheSize, 1000, m.GorseConfig.Master.NumJobs)
+	index, recall := builder.Build(m.GorseConfig.Recommend.ItemAudienceIndexRecall, m.GorseConfig.Recommend.ItemAudienceIndexFitEpoch, false)
+	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.ItemAudienceIndexRecall, base.FormatFloat32(recall)); err != nil {
+		return errors.Trace(err)
+	}
+	return base.Parallel(int(rankingModel.GetItemIndex().Len()), m.GorseConfig.Master.NumJobs, func(workerId, itemIndex int) error {
+		if !rankingModel.IsItemPredictable(int32(itemIndex)) {
+			return nil
+		}
+		startTime := time.Now()
+		values, scores := index.Search(search.NewDenseVector(rankingModel.GetItemFactor(int32(itemIndex)), nil, false),
+			m.GorseConfig.Database.CacheSize, false)
+		users := make([]cache.Scored, len(values))
+		for i, value := range values {
+			users[i].Id = rankingModel.GetUserIndex().ToName(userIndices[value])
+			users[i].Score = -scores[i]
+		}
+		if err := m.CacheClient.SetSorted(cache.Key(cache.ItemAudience, rankingModel.GetItemIndex().ToName(int32(itemIndex))), users); err != nil {
+			return errors.Trace(err)
+		}
+		FindItemAudienceSeconds.Observe(time.Since(startTime).Seconds())
+		return nil
+	})
 }
 
 func (m *Master) runAnalyzeTask() error {
@@ -834,11 +1261,297 @@ func (m *Master) runAnalyzeTask() error {
 			m.taskMonitor.Update(TaskAnalyze, i+j*30)
 		}
 	}
+	if err := m.analyzeExperiments(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := m.analyzeImpressions(); err != nil {
+		return errors.Trace(err)
+	}
 	base.Logger().Info("complete analyzing click-through-rate")
 	m.taskMonitor.Finish(TaskAnalyze)
 	return nil
 }
 
+// analyzeExperiments computes daily positive feedback rates of arms in experiments. The positive feedback rate of a
+// user is the ratio of read items with positive feedback, and the positive feedback rate of an arm is the average of
+// positive feedback rates of users recommended in the arm.
+func (m *Master) analyzeExperiments() error {
+	type armKey struct {
+		experiment string
+		arm        string
+	}
+	// find dates to analyze
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	armDates := make(map[armKey][]time.Time)
+	for _, experiment := range m.GorseConfig.Recommend.Experiments {
+		for _, arm := range experiment.Arms {
+			measurements, err := m.DataClient.GetMeasurements(cache.Key(ExperimentPositiveFeedbackRate, experiment.Name, arm.Name), 30)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			existed := strset.New()
+			for _, measurement := range measurements {
+				existed.Add(measurement.Timestamp.String())
+			}
+			for i := 1; i <= 30; i++ {
+				if date := today.AddDate(0, 0, -i); !existed.Has(date.String()) {
+					armDates[armKey{experiment.Name, arm.Name}] = append(armDates[armKey{experiment.Name, arm.Name}], date)
+				}
+			}
+		}
+	}
+	if len(armDates) == 0 {
+		return nil
+	}
+	// load users in arms, users not exposed to recommendation in the analysis window are removed
+	armUsers := make(map[armKey][]string)
+	users := strset.New()
+	timeLimit := today.AddDate(0, 0, -30)
+	for key := range armDates {
+		armKey := cache.Key(cache.ExperimentUsers, key.experiment, key.arm)
+		if err := m.CacheClient.RemSortedByScore(armKey, math32.Inf(-1), float32(timeLimit.Unix())); err != nil {
+			return errors.Trace(err)
+		}
+		scores, err := m.CacheClient.GetSorted(armKey, 0, -1)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		armUsers[key] = cache.RemoveScores(scores)
+		users.Add(armUsers[key]...)
+	}
+	// load read and positive items of users by date
+	type userDate struct {
+		userId string
+		date   time.Time
+	}
+	readItems := make(map[userDate]*strset.Set)
+	positiveItems := make(map[userDate]*strset.Set)
+	feedbackTypes := append(append([]string{}, m.GorseConfig.Database.PositiveFeedbackType...), m.GorseConfig.Database.ReadFeedbackTypes...)
+	feedbackChan, errChan := m.DataClient.GetFeedbackStream(batchSize, &timeLimit, feedbackTypes...)
+	for feedback := range feedbackChan {
+		for _, f := range feedback {
+			if !users.Has(f.UserId) {
+				continue
+			}
+			key := userDate{f.UserId, f.Timestamp.UTC().Truncate(24 * time.Hour)}
+			items := readItems
+			if funk.ContainsString(m.GorseConfig.Database.PositiveFeedbackType, f.FeedbackType) {
+				items = positiveItems
+			}
+			if _, exist := items[key]; !exist {
+				items[key] = strset.New()
+			}
+			items[key].Add(f.ItemId)
+		}
+	}
+	if err := <-errChan; err != nil {
+		return errors.Trace(err)
+	}
+	// compute positive feedback rates
+	for key, dates := range armDates {
+		for _, date := range dates {
+			var sum float64
+			var count int
+			for _, userId := range armUsers[key] {
+				read, exist := readItems[userDate{userId, date}]
+				if !exist {
+					continue
+				}
+				if positive, exist := positiveItems[userDate{userId, date}]; exist {
+					sum += float64(strset.Intersection(read, positive).Size()) / float64(read.Size())
+				}
+				count++
+			}
+			// days without active users are not measured
+			if count == 0 {
+				continue
+			}
+			if err := m.DataClient.InsertMeasurement(data.Measurement{
+				Name:      cache.Key(ExperimentPositiveFeedbackRate, key.experiment, key.arm),
+				Timestamp: date,
+				Value:     float32(sum / float64(count)),
+			}); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		base.Logger().Info("update positive feedback rate of arm",
+			zap.String("experiment", key.experiment),
+			zap.String("arm", key.arm),
+			zap.Int("n_users", len(armUsers[key])))
+	}
+	return nil
+}
+
+// analyzeImpressions removes expired impressions and computes daily click-through rates of impressions by
+// recommenders and positions. An impression is clicked if there is positive feedback carrying the request id of the
+// impression on the same item.
+func (m *Master) analyzeImpressions() error {
+	// remove expired impressions
+	if m.GorseConfig.Database.ImpressionTTL > 0 {
+		timeLimit := time.Now().AddDate(0, 0, -int(m.GorseConfig.Database.ImpressionTTL))
+		if err := m.DataClient.DeleteImpressions(timeLimit); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// find dates to analyze
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	measurements, err := m.DataClient.GetMeasurements(ImpressionClickThroughRate, 30)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	existed := strset.New()
+	for _, measurement := range measurements {
+		existed.Add(measurement.Timestamp.String())
+	}
+	var dates []time.Time
+	pending := strset.New()
+	for i := 1; i <= 30; i++ {
+		if date := today.AddDate(0, 0, -i); !existed.Has(date.String()) {
+			dates = append(dates, date)
+			pending.Add(date.String())
+		}
+	}
+	if len(dates) == 0 {
+		return nil
+	}
+	timeLimit := dates[len(dates)-1]
+	// load impressions
+	impressions := make(map[string]data.Impression)
+	impressionChan, errChan := m.DataClient.GetImpressionStream(batchSize, &timeLimit)
+	for batch := range impressionChan {
+		for _, impression := range batch {
+			if impression.Timestamp.Before(today) {
+				impressions[cache.Key(impression.RequestId, impression.ItemId)] = impression
+			}
+		}
+	}
+	if err = <-errChan; err != nil {
+		return errors.Trace(err)
+	}
+	// load clicks
+	clicked := strset.New()
+	feedbackChan, errChan := m.DataClient.GetFeedbackStream(batchSize, &timeLimit, m.GorseConfig.Database.PositiveFeedbackType...)
+	for feedback := range feedbackChan {
+		for _, f := range feedback {
+			if f.RequestId != "" {
+				clicked.Add(cache.Key(f.RequestId, f.ItemId))
+			}
+		}
+	}
+	if err = <-errChan; err != nil {
+		return errors.Trace(err)
+	}
+	// count impressions and clicks
+	type dateName struct {
+		date time.Time
+		name string
+	}
+	numImpressions := make(map[dateName]int)
+	numClicks := make(map[dateName]int)
+	for key, impression := range impressions {
+		date := impression.Timestamp.UTC().Truncate(24 * time.Hour)
+		if !pending.Has(date.String()) {
+			continue
+		}
+		for _, name := range []string{
+			ImpressionClickThroughRate,
+			cache.Key(SourceClickThroughRate, impression.Source),
+			cache.Key(PositionClickThroughRate, strconv.Itoa(impression.Position)),
+		} {
+			numImpressions[dateName{date, name}]++
+			if clicked.Has(key) {
+				numClicks[dateName{date, name}]++
+			}
+		}
+	}
+	// dates without impressions are marked as analyzed
+	for _, date := range dates {
+		if _, exist := numImpressions[dateName{date, ImpressionClickThroughRate}]; !exist {
+			numImpressions[dateName{date, ImpressionClickThroughRate}] = 0
+		}
+	}
+	// insert click-through rates
+	for key, count := range numImpressions {
+		var rate float32
+		if count > 0 {
+			rate = float32(numClicks[key]) / float32(count)
+		}
+		if err = m.DataClient.InsertMeasurement(data.Measurement{
+			Name:      key.name,
+			Timestamp: key.date,
+			Value:     rate,
+		}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	base.Logger().Info("update click-through rates of impressions",
+		zap.Int("n_dates", len(dates)),
+		zap.Int("n_impressions", len(impressions)),
+		zap.Int("n_clicks", clicked.Size()))
+	return nil
+}
+
+// passRankingPromotionGate returns true if the promotion gate is disabled or the candidate ranking model performs
+// better than the incumbent ranking model on the validation set by at least promotion_min_improvement of NDCG. The
+// validation set is only held out for the comparison: both models are fitted on feedback before the validation window,
+// and the promoted model is fitted on all feedback later. Scores of both models are inserted as measurements. It
+// requires read lock on the ranking dataset.
+func (m *Master) passRankingPromotionGate(incumbent, candidate ranking.Model) bool {
+	if !m.GorseConfig.Recommend.EnablePromotionGate || m.rankingValidSet == nil ||
+		incumbent == nil || incumbent.Invalid() {
+		return true
+	}
+	fitConfig := ranking.NewFitConfig().SetJobs(m.GorseConfig.Master.NumJobs)
+	evaluate := func(rankingModel ranking.Model) float32 {
+		rankingModel = ranking.NewModel(ranking.GetModelName(rankingModel), rankingModel.GetParams())
+		return rankingModel.Fit(m.rankingGateTrainSet, m.rankingValidSet, fitConfig).NDCG
+	}
+	incumbentScore, candidateScore := evaluate(incumbent), evaluate(candidate)
+	passed := candidateScore >= incumbentScore+m.GorseConfig.Recommend.PromotionMinImprovement
+	base.Logger().Info("evaluate ranking model by promotion gate",
+		zap.Float32("incumbent_ndcg", incumbentScore),
+		zap.Float32("candidate_ndcg", candidateScore),
+		zap.Bool("passed", passed))
+	m.insertPromotionMeasurements(PromotionRankingNDCG, incumbentScore, candidateScore)
+	return passed
+}
+
+// passClickPromotionGate returns true if the promotion gate is disabled or the candidate click model performs better
+// than the incumbent click model on the validation set by at least promotion_min_improvement of AUC. Both models are
+// fitted on feedback before the validation window. Scores of both models are inserted as measurements. It requires
+// read lock on the click dataset.
+func (m *Master) passClickPromotionGate(incumbent, candidate click.FactorizationMachine) bool {
+	if !m.GorseConfig.Recommend.EnablePromotionGate || m.clickValidSet == nil ||
+		incumbent == nil || incumbent.Invalid() {
+		return true
+	}
+	fitConfig := click.NewFitConfig().SetJobs(m.GorseConfig.Master.NumJobs)
+	evaluate := func(clickModel click.FactorizationMachine) float32 {
+		clickModel = click.NewFM(click.FMClassification, clickModel.GetParams())
+		return clickModel.Fit(m.clickGateTrainSet, m.clickValidSet, fitConfig).AUC
+	}
+	incumbentScore, candidateScore := evaluate(incumbent), evaluate(candidate)
+	passed := candidateScore >= incumbentScore+m.GorseConfig.Recommend.PromotionMinImprovement
+	base.Logger().Info("evaluate click model by promotion gate",
+		zap.Float32("incumbent_auc", incumbentScore),
+		zap.Float32("candidate_auc", candidateScore),
+		zap.Bool("passed", passed))
+	m.insertPromotionMeasurements(PromotionClickAUC, incumbentScore, candidateScore)
+	return passed
+}
+
+func (m *Master) insertPromotionMeasurements(name string, incumbentScore, candidateScore float32) {
+	timestamp := time.Now()
+	for _, measurement := range []data.Measurement{
+		{Name: cache.Key(name, "incumbent"), Timestamp: timestamp, Value: incumbentScore},
+		{Name: cache.Key(name, "candidate"), Timestamp: timestamp, Value: candidateScore},
+	} {
+		if err := m.DataClient.InsertMeasurement(measurement); err != nil {
+			base.Logger().Error("failed to insert measurement", zap.String("name", measurement.Name), zap.Error(err))
+		}
+	}
+}
+
 // runFitClickModelTask fits click model using latest data. After model fitted, following states are changed:
 // 1. Click model version are increased.
 // 2. Click model score are updated.
@@ -866,23 +1579,39 @@ func (m *Master) runFitClickModelTask(
 	}
 
 	bestClickModel, bestClickScore := m.clickModelSearcher.GetBestModel()
-	m.clickModelMutex.Lock()
-	if bestClickModel != nil && !bestClickModel.Invalid() &&
+	m.clickModelMutex.RLock()
+	incumbentModel := m.clickModel
+	shouldPromote := bestClickModel != nil && !bestClickModel.Invalid() && !m.isClickModelPinned() &&
 		bestClickModel.GetParams().ToString() != m.clickModel.GetParams().ToString() &&
-		bestClickScore.Precision > m.clickScore.Precision {
+		(m.GorseConfig.Recommend.EnablePromotionGate || bestClickScore.Precision > m.clickScore.Precision)
+	m.clickModelMutex.RUnlock()
+	// the promotion gate is evaluated without holding the lock since models are fitted
+	if shouldPromote && m.passClickPromotionGate(incumbentModel, bestClickModel) {
 		// 1. best click model must have been found.
-		// 2. best click model must be different from current model
-		// 3. best click model must perform better than current model
-		m.clickModel = bestClickModel
-		m.clickScore = bestClickScore
-		shouldFit = true
-		base.Logger().Info("find better click model",
-			zap.Float32("Precision", bestClickScore.Precision),
-			zap.Float32("Recall", bestClickScore.Recall),
-			zap.Any("params", m.clickModel.GetParams()))
+		// 2. current click model must not be pinned.
+		// 3. best click model must be different from current model
+		// 4. best click model must perform better than current model on the test set
+		// 5. best click model must pass the promotion gate if enabled, which replaces the test set comparison
+		m.clickModelMutex.Lock()
+		if m.clickModel == incumbentModel && !m.isClickModelPinned() {
+			m.clickModel = bestClickModel
+			m.clickScore = bestClickScore
+			shouldFit = true
+			base.Logger().Info("find better click model",
+				zap.Float32("Precision", bestClickScore.Precision),
+				zap.Float32("Recall", bestClickScore.Recall),
+				zap.Any("params", m.clickModel.GetParams()))
+		}
+		m.clickModelMutex.Unlock()
 	}
+	m.clickModelMutex.RLock()
+	pinned := m.isClickModelPinned()
 	clickModel := m.clickModel
-	m.clickModelMutex.Unlock()
+	if pinned {
+		// the pinned model keeps serving while fitting
+		clickModel = click.Clone(clickModel)
+	}
+	m.clickModelMutex.RUnlock()
 
 	// training model
 	if !shouldFit {
@@ -893,14 +1622,38 @@ func (m *Master) runFitClickModelTask(
 		SetJobs(m.GorseConfig.Master.NumJobs).
 		SetTracker(m.taskMonitor.NewTaskTracker(TaskFitClickModel)))
 
-	// update match model
+	// update click model unless pinned
 	m.clickModelMutex.Lock()
-	m.clickModel = clickModel
-	m.clickScore = score
-	m.clickModelVersion++
+	version := m.clickModelVersion + 1
+	pinned = m.isClickModelPinned()
+	if m.modelRegistry != nil {
+		if index := m.modelRegistry.Index(); len(index.ClickModels) > 0 {
+			version = mathutil.MaxInt64(version, index.ClickModels[len(index.ClickModels)-1].Version+1)
+		}
+	}
+	if !pinned {
+		m.clickModel = clickModel
+		m.clickScore = score
+		m.clickModelVersion = version
+	}
 	m.clickModelMutex.Unlock()
 	base.Logger().Info("fit click model complete",
-		zap.String("version", fmt.Sprintf("%x", m.clickModelVersion)))
+		zap.String("version", fmt.Sprintf("%x", version)))
+	if m.modelRegistry != nil {
+		if err := m.modelRegistry.AddClickModel(ClickModelVersion{
+			Version: version,
+			Params:  clickModel.GetParams(),
+			Score:   score,
+			FitTime: time.Now(),
+		}, clickModel); err != nil {
+			base.Logger().Error("failed to save click model to registry", zap.Error(err))
+		}
+	}
+	if pinned {
+		base.Logger().Info("click model is pinned",
+			zap.String("version", base.Hex(m.modelRegistry.Index().PinnedClickModel)))
+		return
+	}
 	RankingPrecision.Set(float64(score.Precision))
 	RankingRecall.Set(float64(score.Recall))
 	RankingAUC.Set(float64(score.AUC))
@@ -1012,6 +1765,7 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 
 	// STEP 1: pull users
 	userLabelIndex := base.NewMapIndex()
+	userAttrIndex := base.NewMapIndex()
 	start := time.Now()
 	userChan, errChan := database.GetUserStream(batchSize)
 	for users := range userChan {
@@ -1026,20 +1780,32 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 				userLabelIndex.Add(label)
 				rankingDataset.UserLabels[userIndex][i] = userLabelIndex.ToNumber(label)
 			}
+			if len(rankingDataset.UserAttributes) == int(userIndex) {
+				rankingDataset.UserAttributes = append(rankingDataset.UserAttributes, nil)
+			}
+			attributes := user.GetAttributes(m.GorseConfig.Database.UserAttributes)
+			rankingDataset.UserAttributes[userIndex] = make([]int32, len(attributes))
+			for i, attribute := range attributes {
+				userAttrIndex.Add(attribute)
+				rankingDataset.UserAttributes[userIndex][i] = userAttrIndex.ToNumber(attribute)
+			}
 		}
 	}
 	if err = <-errChan; err != nil {
 		return nil, nil, nil, nil, errors.Trace(err)
 	}
 	rankingDataset.NumUserLabels = userLabelIndex.Len()
+	rankingDataset.NumUserAttrs = userAttrIndex.Len()
 	m.taskMonitor.Update(TaskLoadDataset, 1)
 	base.Logger().Debug("pulled users from database",
 		zap.Int("n_users", rankingDataset.UserCount()),
 		zap.Int32("n_user_labels", userLabelIndex.Len()),
+		zap.Int32("n_user_attributes", userAttrIndex.Len()),
 		zap.Duration("used_time", time.Since(start)))
 
 	// STEP 2: pull items
 	itemLabelIndex := base.NewMapIndex()
+	itemTokenIndex := base.NewMapIndex()
 	start = time.Now()
 	itemChan, errChan := database.GetItemStream(batchSize, itemTimeLimit)
 	for items := range itemChan {
@@ -1048,6 +1814,7 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 			itemIndex := rankingDataset.ItemIndex.ToNumber(item.ItemId)
 			if len(rankingDataset.ItemLabels) == int(itemIndex) {
 				rankingDataset.ItemLabels = append(rankingDataset.ItemLabels, nil)
+				rankingDataset.ItemTokens = append(rankingDataset.ItemTokens, nil)
 				rankingDataset.HiddenItems = append(rankingDataset.HiddenItems, false)
 				rankingDataset.ItemCategories = append(rankingDataset.ItemCategories, item.Categories)
 				rankingDataset.CategorySet.Add(item.Categories...)
@@ -1057,6 +1824,15 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 				itemLabelIndex.Add(label)
 				rankingDataset.ItemLabels[itemIndex][i] = itemLabelIndex.ToNumber(label)
 			}
+			if m.GorseConfig.Recommend.ItemNeighborType == config.NeighborTypeContent {
+				tokens := strset.New(base.Tokenize(item.Comment)...)
+				rankingDataset.ItemTokens[itemIndex] = make([]int32, 0, tokens.Size())
+				tokens.Each(func(token string) bool {
+					itemTokenIndex.Add(token)
+					rankingDataset.ItemTokens[itemIndex] = append(rankingDataset.ItemTokens[itemIndex], itemTokenIndex.ToNumber(token))
+					return true
+				})
+			}
 			if item.IsHidden { // set hidden flag
 				rankingDataset.HiddenItems[itemIndex] = true
 			} else if !item.Timestamp.IsZero() { // add items to the latest items filter
@@ -1074,6 +1850,7 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 		return nil, nil, nil, nil, errors.Trace(err)
 	}
 	rankingDataset.NumItemLabels = itemLabelIndex.Len()
+	rankingDataset.NumItemTokens = itemTokenIndex.Len()
 	m.taskMonitor.Update(TaskLoadDataset, 2)
 	base.Logger().Debug("pulled items from database",
 		zap.Int("n_items", rankingDataset.ItemCount()),
@@ -1081,18 +1858,28 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 		zap.Duration("used_time", time.Since(start)))
 
 	// create positive set
-	popularCount := make([]int32, rankingDataset.ItemCount())
+	popularCount := make([]float32, rankingDataset.ItemCount())
 	positiveSet := make([]*i32set.Set, rankingDataset.UserCount())
 	for i := range positiveSet {
 		positiveSet[i] = i32set.New()
 	}
+	// context labels of feedback: user index -> item index -> context labels
+	ctxLabelIndex := base.NewMapIndex()
+	feedbackContext := make([]map[int32][]int32, rankingDataset.UserCount())
+	// timestamps of feedback: user index -> item index -> timestamp
+	feedbackTimestamps := make([]map[int32]int64, rankingDataset.UserCount())
 
 	// STEP 3: pull positive feedback
 	start = time.Now()
 	feedbackChan, errChan := database.GetFeedbackStream(batchSize, feedbackTimeLimit, posFeedbackTypes...)
 	for feedback := range feedbackChan {
 		for _, f := range feedback {
-			rankingDataset.AddFeedback(f.UserId, f.ItemId, false)
+			// feedback without value are weighted 1
+			value := float32(f.Value)
+			if value <= 0 {
+				value = 1
+			}
+			rankingDataset.AddTimedFeedback(f.UserId, f.ItemId, value, f.Timestamp, false)
 			// insert feedback to positive set
 			userIndex := rankingDataset.UserIndex.ToNumber(f.UserId)
 			if userIndex == base.NotId {
@@ -1103,9 +1890,11 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 				continue
 			}
 			positiveSet[userIndex].Add(itemIndex)
+			setFeedbackContext(feedbackContext, ctxLabelIndex, userIndex, itemIndex, f)
+			setFeedbackTimestamp(feedbackTimestamps, userIndex, itemIndex, f)
 			// insert feedback to popularity counter
 			if f.Timestamp.After(timeWindowLimit) && !rankingDataset.HiddenItems[itemIndex] {
-				popularCount[itemIndex]++
+				popularCount[itemIndex] += value
 			}
 		}
 	}
@@ -1138,6 +1927,8 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 			}
 			if !positiveSet[userIndex].Has(itemIndex) {
 				negativeSet[userIndex].Add(itemIndex)
+				setFeedbackContext(feedbackContext, ctxLabelIndex, userIndex, itemIndex, f)
+				setFeedbackTimestamp(feedbackTimestamps, userIndex, itemIndex, f)
 			}
 		}
 	}
@@ -1152,37 +1943,55 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 	unifiedIndex.UserIndex = rankingDataset.UserIndex
 	unifiedIndex.ItemLabelIndex = itemLabelIndex
 	unifiedIndex.UserLabelIndex = userLabelIndex
+	unifiedIndex.UserAttrIndex = userAttrIndex
+	unifiedIndex.CtxLabelIndex = ctxLabelIndex
 	clickDataset = &click.Dataset{
-		Index:        unifiedIndex.Build(),
-		UserFeatures: rankingDataset.UserLabels,
-		ItemFeatures: rankingDataset.ItemLabels,
+		Index:          unifiedIndex.Build(),
+		UserFeatures:   rankingDataset.UserLabels,
+		ItemFeatures:   rankingDataset.ItemLabels,
+		UserAttributes: rankingDataset.UserAttributes,
+	}
+	ctxLabelOffset := clickDataset.Index.CountUsers() + clickDataset.Index.CountItems() +
+		clickDataset.Index.CountUserLabels() + clickDataset.Index.CountItemLabels()
+	appendSample := func(dataset *click.Dataset, userIndex, itemIndex int32, target float32) {
+		dataset.Users.Append(userIndex)
+		dataset.Items.Append(itemIndex)
+		dataset.NormValues.Append(1 / math32.Sqrt(float32(len(dataset.UserFeatures[userIndex])+len(dataset.ItemFeatures[itemIndex]))))
+		ctxLabels := feedbackContext[userIndex][itemIndex]
+		features := make([]int32, len(ctxLabels))
+		for i, ctxLabel := range ctxLabels {
+			features[i] = ctxLabelOffset + ctxLabel
+		}
+		dataset.CtxFeatures = append(dataset.CtxFeatures, features)
+		dataset.CtxValues = append(dataset.CtxValues, base.RepeatFloat32s(len(features), 1))
+		dataset.Timestamps = append(dataset.Timestamps, feedbackTimestamps[userIndex][itemIndex])
+		dataset.Target.Append(target)
+		if target > 0 {
+			dataset.PositiveCount++
+		} else {
+			dataset.NegativeCount++
+		}
 	}
-	for userIndex := range positiveSet {
-		if positiveSet[userIndex].IsEmpty() || negativeSet[userIndex].IsEmpty() {
-			// release positive set and negative set
-			positiveSet[userIndex] = nil
-			negativeSet[userIndex] = nil
-			continue
+	appendSamples := func(dataset *click.Dataset, userIndex int32, positiveSet, negativeSet *i32set.Set) {
+		if positiveSet.IsEmpty() || negativeSet.IsEmpty() {
+			return
 		}
 		// insert positive feedback
-		for _, itemIndex := range positiveSet[userIndex].List() {
-			clickDataset.Users.Append(int32(userIndex))
-			clickDataset.Items.Append(itemIndex)
-			clickDataset.NormValues.Append(1 / math32.Sqrt(float32(len(clickDataset.UserFeatures[userIndex])+len(clickDataset.ItemFeatures[itemIndex]))))
-			clickDataset.Target.Append(1)
-			clickDataset.PositiveCount++
+		for _, itemIndex := range positiveSet.List() {
+			appendSample(dataset, userIndex, itemIndex, 1)
 		}
 		// insert negative feedback
-		for _, itemIndex := range negativeSet[userIndex].List() {
-			clickDataset.Users.Append(int32(userIndex))
-			clickDataset.Items.Append(itemIndex)
-			clickDataset.NormValues.Append(1 / math32.Sqrt(float32(len(clickDataset.UserFeatures[userIndex])+len(clickDataset.ItemFeatures[itemIndex]))))
-			clickDataset.Target.Append(-1)
-			clickDataset.NegativeCount++
+		for _, itemIndex := range negativeSet.List() {
+			appendSample(dataset, userIndex, itemIndex, -1)
 		}
+	}
+	for userIndex := range positiveSet {
+		appendSamples(clickDataset, int32(userIndex), positiveSet[userIndex], negativeSet[userIndex])
 		// release positive set and negative set
 		positiveSet[userIndex] = nil
 		negativeSet[userIndex] = nil
+		feedbackContext[userIndex] = nil
+		feedbackTimestamps[userIndex] = nil
 	}
 	base.Logger().Debug("pulled negative feedback from database",
 		zap.Int("n_valid_positive", clickDataset.PositiveCount),
@@ -1200,12 +2009,12 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 	// collect popular items
 	popularItems = make(map[string][]cache.Scored)
 	for itemIndex, val := range popularCount {
-		popularItems[""] = append(popularItems[""], cache.Scored{Id: rankingDataset.ItemIndex.ToName(int32(itemIndex)), Score: float32(val)})
+		popularItems[""] = append(popularItems[""], cache.Scored{Id: rankingDataset.ItemIndex.ToName(int32(itemIndex)), Score: val})
 		for _, category := range rankingDataset.ItemCategories[itemIndex] {
 			if _, exist := popularItems[category]; !exist {
 				popularItems[category] = make([]cache.Scored, 0)
 			}
-			popularItems[category] = append(popularItems[category], cache.Scored{Id: rankingDataset.ItemIndex.ToName(int32(itemIndex)), Score: float32(val)})
+			popularItems[category] = append(popularItems[category], cache.Scored{Id: rankingDataset.ItemIndex.ToName(int32(itemIndex)), Score: val})
 		}
 	}
 	for _, items := range popularItems {
@@ -1215,3 +2024,35 @@ func (m *Master) LoadDataFromDatabase(database data.Database, posFeedbackTypes,
 	m.taskMonitor.Finish(TaskLoadDataset)
 	return rankingDataset, clickDataset, latestItems, popularItems, nil
 }
+
+// setFeedbackTimestamp records the timestamp of a feedback if it exists.
+func setFeedbackTimestamp(feedbackTimestamps []map[int32]int64, userIndex, itemIndex int32, feedback data.Feedback) {
+	if feedback.Timestamp.IsZero() {
+		return
+	}
+	if feedbackTimestamps[userIndex] == nil {
+		feedbackTimestamps[userIndex] = make(map[int32]int64)
+	}
+	feedbackTimestamps[userIndex][itemIndex] = feedback.Timestamp.Unix()
+}
+
+// setFeedbackContext encodes context labels of a feedback, including the labels given by the feedback and the labels
+// derived from the timestamp of the feedback.
+func setFeedbackContext(feedbackContext []map[int32][]int32, ctxLabelIndex base.Index, userIndex, itemIndex int32, feedback data.Feedback) {
+	ctxLabels := append([]string{}, feedback.Context...)
+	if !feedback.Timestamp.IsZero() {
+		ctxLabels = append(ctxLabels, click.TimeContextLabels(feedback.Timestamp)...)
+	}
+	if len(ctxLabels) == 0 {
+		return
+	}
+	if feedbackContext[userIndex] == nil {
+		feedbackContext[userIndex] = make(map[int32][]int32)
+	}
+	encoded := make([]int32, len(ctxLabels))
+	for i, ctxLabel := range ctxLabels {
+		ctxLabelIndex.Add(ctxLabel)
+		encoded[i] = ctxLabelIndex.ToNumber(ctxLabel)
+	}
+	feedbackContext[userIndex][itemIndex] = encoded
+}
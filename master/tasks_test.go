@@ -15,10 +15,17 @@
 package master
 
 import (
+	"github.com/bits-and-blooms/bitset"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/click"
+	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -127,6 +134,48 @@ func TestMaster_FindItemNeighborsBruteForce(t *testing.T) {
 	assert.Equal(t, TaskStatusComplete, m.taskMonitor.Tasks[TaskFindItemNeighbors].Status)
 }
 
+func TestMaster_FindItemNeighborsContent(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.NumJobs = 4
+	m.GorseConfig.Recommend.ItemNeighborType = config.NeighborTypeContent
+	m.GorseConfig.Recommend.ItemNeighborIndexRecall = 1
+	m.GorseConfig.Recommend.ItemNeighborIndexFitEpoch = 3
+	// insert items
+	err := m.DataClient.BatchInsertItems([]data.Item{
+		{ItemId: "0", Comment: "Go is an open source programming language."},
+		{ItemId: "1", Comment: "The Go programming language", Categories: []string{"*"}},
+		{ItemId: "2", Comment: "Rust programming language", Categories: []string{"*"}},
+		{ItemId: "3", Comment: "A recipe of apple pie"},
+		{ItemId: "4", Comment: "Apple pie with cinnamon", Categories: []string{"*"}},
+		{ItemId: "5", Comment: "Go programming language", IsHidden: true},
+	})
+	assert.NoError(t, err)
+	dataset, _, _, _, err := m.LoadDataFromDatabase(m.DataClient, []string{"FeedbackType"}, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(16), dataset.NumItemTokens)
+
+	for _, enableIndex := range []bool{false, true} {
+		m.GorseConfig.Recommend.EnableItemNeighborIndex = enableIndex
+		err = m.CacheClient.SetTime(cache.LastModifyItemTime, "0", time.Now())
+		assert.NoError(t, err)
+		err = m.CacheClient.SetTime(cache.LastModifyItemTime, "3", time.Now())
+		assert.NoError(t, err)
+		m.runFindItemNeighborsTask(dataset)
+		assert.Equal(t, TaskStatusComplete, m.taskMonitor.Tasks[TaskFindItemNeighbors].Status)
+		similar, err := m.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, "0"), 0, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, cache.RemoveScores(similar))
+		similar, err = m.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, "3"), 0, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"4"}, cache.RemoveScores(similar))
+	}
+}
+
 func TestMaster_FindItemNeighborsIVF(t *testing.T) {
 	// create mock master
 	m := newMockMaster(t)
@@ -243,16 +292,16 @@ func TestMaster_FindUserNeighborsBruteForce(t *testing.T) {
 	m.GorseConfig.Master.NumJobs = 4
 	// collect similar
 	users := []data.User{
-		{"0", []string{"a", "b", "c", "d"}, nil, ""},
-		{"1", []string{"b", "c", "d"}, nil, ""},
-		{"2", []string{"b", "c"}, nil, ""},
-		{"3", []string{"c"}, nil, ""},
-		{"4", []string{}, nil, ""},
-		{"5", []string{}, nil, ""},
-		{"6", []string{}, nil, ""},
-		{"7", []string{}, nil, ""},
-		{"8", []string{"a", "b", "c", "d", "e"}, nil, ""},
-		{"9", []string{}, nil, ""},
+		{"0", []string{"a", "b", "c", "d"}, nil, "", "", ""},
+		{"1", []string{"b", "c", "d"}, nil, "", "", ""},
+		{"2", []string{"b", "c"}, nil, "", "", ""},
+		{"3", []string{"c"}, nil, "", "", ""},
+		{"4", []string{}, nil, "", "", ""},
+		{"5", []string{}, nil, "", "", ""},
+		{"6", []string{}, nil, "", "", ""},
+		{"7", []string{}, nil, "", "", ""},
+		{"8", []string{"a", "b", "c", "d", "e"}, nil, "", "", ""},
+		{"9", []string{}, nil, "", "", ""},
 	}
 	feedbacks := make([]data.Feedback, 0)
 	for i := 0; i < 10; i++ {
@@ -325,16 +374,16 @@ func TestMaster_FindUserNeighborsIVF(t *testing.T) {
 	m.GorseConfig.Recommend.UserNeighborIndexFitEpoch = 10
 	// collect similar
 	users := []data.User{
-		{"0", []string{"a", "b", "c", "d"}, nil, ""},
-		{"1", []string{"b", "c", "d"}, nil, ""},
-		{"2", []string{"b", "c"}, nil, ""},
-		{"3", []string{"c"}, nil, ""},
-		{"4", []string{}, nil, ""},
-		{"5", []string{}, nil, ""},
-		{"6", []string{}, nil, ""},
-		{"7", []string{}, nil, ""},
-		{"8", []string{"a", "b", "c", "d", "e"}, nil, ""},
-		{"9", []string{}, nil, ""},
+		{"0", []string{"a", "b", "c", "d"}, nil, "", "", ""},
+		{"1", []string{"b", "c", "d"}, nil, "", "", ""},
+		{"2", []string{"b", "c"}, nil, "", "", ""},
+		{"3", []string{"c"}, nil, "", "", ""},
+		{"4", []string{}, nil, "", "", ""},
+		{"5", []string{}, nil, "", "", ""},
+		{"6", []string{}, nil, "", "", ""},
+		{"7", []string{}, nil, "", "", ""},
+		{"8", []string{"a", "b", "c", "d", "e"}, nil, "", "", ""},
+		{"9", []string{}, nil, "", "", ""},
 	}
 	feedbacks := make([]data.Feedback, 0)
 	for i := 0; i < 10; i++ {
@@ -403,6 +452,7 @@ func TestMaster_LoadDataFromDatabase(t *testing.T) {
 	m.GorseConfig.Database.CacheSize = 3
 	m.GorseConfig.Database.PositiveFeedbackType = []string{"positive"}
 	m.GorseConfig.Database.ReadFeedbackTypes = []string{"negative"}
+	m.GorseConfig.Database.UserAttributes = []string{"gender"}
 
 	// insert items
 	var items []data.Item
@@ -429,6 +479,7 @@ func TestMaster_LoadDataFromDatabase(t *testing.T) {
 		users = append(users, data.User{
 			UserId: strconv.Itoa(i),
 			Labels: []string{strconv.Itoa(i % 5)},
+			Gender: []string{"female", "male"}[i%2],
 		})
 	}
 	err = m.DataClient.BatchInsertUsers(users)
@@ -449,6 +500,7 @@ func TestMaster_LoadDataFromDatabase(t *testing.T) {
 					FeedbackType: "positive",
 				},
 				Timestamp: time.Now(),
+				Context:   []string{"device=mobile"},
 			})
 		}
 		// negative feedback
@@ -485,6 +537,9 @@ func TestMaster_LoadDataFromDatabase(t *testing.T) {
 	assert.Equal(t, int32(5), m.clickTrainSet.Index.CountUserLabels())
 	assert.Equal(t, int32(3), m.clickTestSet.Index.CountItemLabels())
 	assert.Equal(t, int32(5), m.clickTestSet.Index.CountUserLabels())
+	assert.Equal(t, int32(2), m.clickTrainSet.Index.CountUserAttributes())
+	assert.Contains(t, m.clickTrainSet.Index.GetContextLabels(), "device=mobile")
+	assert.Equal(t, m.clickTrainSet.Count(), len(m.clickTrainSet.CtxFeatures))
 	assert.Equal(t, 90, m.clickTrainSet.Count()+m.clickTestSet.Count())
 	assert.Equal(t, 45, m.clickTrainSet.PositiveCount+m.clickTestSet.PositiveCount)
 	assert.Equal(t, 45, m.clickTrainSet.NegativeCount+m.clickTestSet.NegativeCount)
@@ -530,3 +585,554 @@ func TestMaster_LoadDataFromDatabase(t *testing.T) {
 	assert.Equal(t, []string{"2"}, categories)
 
 }
+
+func TestMaster_AnalyzeExperiments(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close()
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.PositiveFeedbackType = []string{"positive"}
+	m.GorseConfig.Database.ReadFeedbackTypes = []string{"read"}
+	m.GorseConfig.Recommend.Experiments = []config.ExperimentConfig{
+		{Name: "e", Arms: []config.ExperimentArm{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}},
+	}
+	// insert users in arms, user 5 is not exposed to recommendation in the analysis window
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	timestamp := yesterday.Add(time.Hour)
+	exposed := float32(timestamp.Unix())
+	err := m.CacheClient.SetSorted(cache.Key(cache.ExperimentUsers, "e", "a"), []cache.Scored{
+		{Id: "1", Score: exposed}, {Id: "2", Score: exposed}, {Id: "5", Score: float32(yesterday.AddDate(0, 0, -40).Unix())}})
+	assert.NoError(t, err)
+	err = m.CacheClient.SetSorted(cache.Key(cache.ExperimentUsers, "e", "b"), []cache.Scored{{Id: "3", Score: exposed}})
+	assert.NoError(t, err)
+	// insert feedback
+	err = m.DataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "1", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "1", ItemId: "2"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "positive", UserId: "1", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "2", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "3", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "positive", UserId: "3", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "4", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "5", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "positive", UserId: "5", ItemId: "1"}, Timestamp: timestamp},
+	}, true, true, true)
+	assert.NoError(t, err)
+	// analyze experiments
+	err = m.analyzeExperiments()
+	assert.NoError(t, err)
+	// days without active users are not measured
+	measurements, err := m.DataClient.GetMeasurements(cache.Key(ExperimentPositiveFeedbackRate, "e", "a"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(measurements))
+	assert.True(t, yesterday.Equal(measurements[0].Timestamp))
+	assert.Equal(t, float32(0.25), measurements[0].Value)
+	measurements, err = m.DataClient.GetMeasurements(cache.Key(ExperimentPositiveFeedbackRate, "e", "b"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(measurements))
+	assert.Equal(t, float32(1), measurements[0].Value)
+	// users not exposed in the analysis window are removed
+	users, err := m.CacheClient.GetSorted(cache.Key(cache.ExperimentUsers, "e", "a"), 0, -1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, cache.RemoveScores(users))
+	// analyzed dates are skipped
+	err = m.analyzeExperiments()
+	assert.NoError(t, err)
+	measurements, err = m.DataClient.GetMeasurements(cache.Key(ExperimentPositiveFeedbackRate, "e", "b"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(measurements))
+}
+
+func TestMaster_AnalyzeImpressions(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close()
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.PositiveFeedbackType = []string{"positive"}
+	m.GorseConfig.Database.ImpressionTTL = 7
+	// insert impressions
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	timestamp := yesterday.Add(time.Hour)
+	err := m.DataClient.BatchInsertImpressions([]data.Impression{
+		{RequestId: "r1", UserId: "1", ItemId: "1", Position: 0, Source: "offline", Timestamp: timestamp},
+		{RequestId: "r1", UserId: "1", ItemId: "2", Position: 1, Source: "latest", Timestamp: timestamp},
+		{RequestId: "r2", UserId: "2", ItemId: "1", Position: 0, Source: "offline", Timestamp: timestamp},
+		{RequestId: "r2", UserId: "2", ItemId: "3", Position: 1, Source: "offline", Timestamp: timestamp},
+		{RequestId: "r3", UserId: "3", ItemId: "1", Position: 0, Source: "offline", Timestamp: yesterday.AddDate(0, 0, -10)},
+	})
+	assert.NoError(t, err)
+	// insert feedback
+	err = m.DataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "positive", UserId: "1", ItemId: "1"}, Timestamp: timestamp, RequestId: "r1"},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "positive", UserId: "2", ItemId: "3"}, Timestamp: timestamp, RequestId: "r2"},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "positive", UserId: "1", ItemId: "2"}, Timestamp: timestamp},
+	}, true, true, true)
+	assert.NoError(t, err)
+	// analyze impressions
+	err = m.analyzeImpressions()
+	assert.NoError(t, err)
+	measurements, err := m.DataClient.GetMeasurements(ImpressionClickThroughRate, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, len(measurements))
+	assert.True(t, yesterday.Equal(measurements[0].Timestamp))
+	assert.Equal(t, float32(0.5), measurements[0].Value)
+	measurements, err = m.DataClient.GetMeasurements(cache.Key(SourceClickThroughRate, "offline"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(2)/3, measurements[0].Value)
+	measurements, err = m.DataClient.GetMeasurements(cache.Key(SourceClickThroughRate, "latest"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(0), measurements[0].Value)
+	measurements, err = m.DataClient.GetMeasurements(cache.Key(PositionClickThroughRate, "0"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(0.5), measurements[0].Value)
+	measurements, err = m.DataClient.GetMeasurements(cache.Key(PositionClickThroughRate, "1"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(0.5), measurements[0].Value)
+	// expired impressions are removed
+	var impressions []data.Impression
+	impressionChan, errChan := m.DataClient.GetImpressionStream(10, nil)
+	for batch := range impressionChan {
+		impressions = append(impressions, batch...)
+	}
+	assert.NoError(t, <-errChan)
+	assert.Equal(t, 4, len(impressions))
+}
+
+func newMockRankingModel() *ranking.BPR {
+	m := ranking.NewBPR(nil)
+	m.UserIndex = base.NewMapIndex()
+	m.UserPredictable = bitset.New(5)
+	m.UserFactor = make([][]float32, 5)
+	for i := 0; i < 5; i++ {
+		m.UserIndex.Add(strconv.Itoa(i))
+		m.UserFactor[i] = make([]float32, 8)
+		if i < 4 {
+			m.UserPredictable.Set(uint(i))
+		}
+	}
+	m.UserFactor[0][0], m.UserFactor[1][0], m.UserFactor[2][0], m.UserFactor[3][1], m.UserFactor[4][0] = 1, 2, 3, 1, 10
+	m.ItemIndex = base.NewMapIndex()
+	m.ItemPredictable = bitset.New(2)
+	m.ItemFactor = make([][]float32, 2)
+	for i := 0; i < 2; i++ {
+		m.ItemIndex.Add(strconv.Itoa(i))
+		m.ItemFactor[i] = make([]float32, 8)
+	}
+	m.ItemPredictable.Set(0)
+	m.ItemFactor[0][0] = 1
+	return m
+}
+
+func TestMaster_FindItemAudience(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.NumJobs = 4
+	m.GorseConfig.Recommend.ItemAudienceIndexRecall = 1
+	m.GorseConfig.Recommend.ItemAudienceIndexFitEpoch = 3
+	rankingModel := newMockRankingModel()
+	for _, enableIndex := range []bool{false, true} {
+		m.GorseConfig.Recommend.EnableItemAudienceIndex = enableIndex
+		m.runFindItemAudienceTask(rankingModel)
+		audience, err := m.CacheClient.GetSorted(cache.Key(cache.ItemAudience, "0"), 0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2", "1", "0"}, cache.RemoveScores(audience))
+		audience, err = m.CacheClient.GetSorted(cache.Key(cache.ItemAudience, "1"), 0, -1)
+		assert.NoError(t, err)
+		assert.Empty(t, audience)
+		assert.Equal(t, TaskStatusComplete, m.taskMonitor.Tasks[TaskFindItemAudience].Status)
+	}
+}
+
+func TestMaster_FindNeighborsEmbedding(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.NumJobs = 4
+	m.GorseConfig.Recommend.ItemNeighborType = config.NeighborTypeEmbedding
+	m.GorseConfig.Recommend.UserNeighborType = config.NeighborTypeEmbedding
+	m.GorseConfig.Recommend.ItemNeighborIndexRecall = 1
+	m.GorseConfig.Recommend.ItemNeighborIndexFitEpoch = 3
+	m.GorseConfig.Recommend.UserNeighborIndexRecall = 1
+	m.GorseConfig.Recommend.UserNeighborIndexFitEpoch = 3
+	// insert data
+	err := m.DataClient.BatchInsertItems([]data.Item{
+		{ItemId: "0"},
+		{ItemId: "1", Categories: []string{"*"}},
+		{ItemId: "2", Categories: []string{"*"}},
+		{ItemId: "3", Categories: []string{"*"}},
+		{ItemId: "4", Categories: []string{"*"}},
+	})
+	assert.NoError(t, err)
+	var feedbacks []data.Feedback
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 5; j++ {
+			feedbacks = append(feedbacks, data.Feedback{FeedbackKey: data.FeedbackKey{
+				FeedbackType: "FeedbackType",
+				UserId:       strconv.Itoa(i),
+				ItemId:       strconv.Itoa(j),
+			}})
+		}
+	}
+	err = m.DataClient.BatchInsertFeedback(feedbacks, true, true, true)
+	assert.NoError(t, err)
+	dataset, _, _, _, err := m.LoadDataFromDatabase(m.DataClient, []string{"FeedbackType"}, nil, 0, 0)
+	assert.NoError(t, err)
+
+	// no ranking model
+	m.runFindItemNeighborsTask(dataset)
+	assert.Equal(t, TaskStatusFailed, m.taskMonitor.Tasks[TaskFindItemNeighbors].Status)
+
+	// create ranking model, item 4 is unknown to the ranking model
+	rankingModel := ranking.NewBPR(nil)
+	rankingModel.UserIndex = base.NewMapIndex()
+	rankingModel.UserPredictable = bitset.New(3)
+	rankingModel.ItemIndex = base.NewMapIndex()
+	rankingModel.ItemPredictable = bitset.New(4)
+	for _, userId := range []string{"2", "1", "0"} {
+		rankingModel.UserIndex.Add(userId)
+		rankingModel.UserPredictable.Set(uint(rankingModel.UserIndex.ToNumber(userId)))
+	}
+	for _, itemId := range []string{"3", "2", "1", "0"} {
+		rankingModel.ItemIndex.Add(itemId)
+		rankingModel.ItemPredictable.Set(uint(rankingModel.ItemIndex.ToNumber(itemId)))
+	}
+	rankingModel.UserFactor = [][]float32{
+		{0, 1, 0, 0, 0, 0, 0, 0},
+		{1, 1, 0, 0, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0, 0, 0, 0},
+	}
+	rankingModel.ItemFactor = [][]float32{
+		{0, 1, 0, 0, 0, 0, 0, 0},
+		{0.9, 0.5, 0, 0, 0, 0, 0, 0},
+		{1, 0.1, 0, 0, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0, 0, 0, 0},
+	}
+	m.rankingModel = rankingModel
+
+	for _, enableIndex := range []bool{false, true} {
+		m.GorseConfig.Recommend.EnableItemNeighborIndex = enableIndex
+		m.GorseConfig.Recommend.EnableUserNeighborIndex = enableIndex
+		err = m.CacheClient.SetTime(cache.LastModifyItemTime, "0", time.Now())
+		assert.NoError(t, err)
+		err = m.CacheClient.SetTime(cache.LastModifyUserTime, "0", time.Now())
+		assert.NoError(t, err)
+		err = m.CacheClient.SetTime(cache.LastModifyUserTime, "1", time.Now())
+		assert.NoError(t, err)
+		// neighbors of items
+		m.runFindItemNeighborsTask(dataset)
+		assert.Equal(t, TaskStatusComplete, m.taskMonitor.Tasks[TaskFindItemNeighbors].Status)
+		similar, err := m.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, "0"), 0, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, cache.RemoveScores(similar))
+		similar, err = m.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, "0", "*"), 0, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, cache.RemoveScores(similar))
+		// neighbors of users
+		m.runFindUserNeighborsTask(dataset)
+		assert.Equal(t, TaskStatusComplete, m.taskMonitor.Tasks[TaskFindUserNeighbors].Status)
+		similar, err = m.CacheClient.GetSorted(cache.Key(cache.UserNeighbors, "0"), 0, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1"}, cache.RemoveScores(similar))
+		similar, err = m.CacheClient.GetSorted(cache.Key(cache.UserNeighbors, "1"), 0, 100)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"0", "2"}, cache.RemoveScores(similar))
+	}
+
+	// neighbors of unmodified items are kept if the ranking model is unchanged
+	m.GorseConfig.Recommend.EnableItemNeighborIndex = false
+	err = m.CacheClient.SetTime(cache.LastModifyItemTime, "0", time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	rankingModel.ItemFactor[0] = []float32{1, 0, 0, 0, 0, 0, 0, 0}
+	m.runFindItemNeighborsTask(dataset)
+	similar, err := m.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, "0"), 0, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, cache.RemoveScores(similar))
+	// neighbors of all items are updated once the ranking model changes
+	m.rankingModelVersion++
+	m.runFindItemNeighborsTask(dataset)
+	similar, err = m.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, "0"), 0, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "1", "2"}, cache.RemoveScores(similar))
+}
+
+func TestMaster_FitRankingModelWarmStart(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	m.localCache = &LocalCache{}
+	// create config
+	m.GorseConfig = (*config.Config)(nil).LoadDefaultIfNil()
+	m.GorseConfig.Master.NumJobs = 1
+	m.GorseConfig.Recommend.EnableWarmStart = true
+	m.GorseConfig.Recommend.WarmStartEpochs = 1
+	m.GorseConfig.Recommend.FullRetrainPeriod = 3
+	// create dataset
+	dataset := ranking.NewMapIndexDataset()
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 5; j++ {
+			dataset.AddFeedback(strconv.Itoa(i), strconv.Itoa((i+j)%10), true)
+		}
+	}
+	m.rankingTrainSet, m.rankingTestSet = dataset.Split(2, 0)
+	// latent factors are never updated if the learning rate is zero
+	m.rankingModel = ranking.NewBPR(model.Params{model.NEpochs: 2, model.Lr: 0})
+
+	for i, warmStart := range []bool{false, true, true, false} {
+		lastModel := m.rankingModel
+		if !lastModel.Invalid() {
+			// mark the latent factor of an existing user
+			lastModel.GetUserFactor(lastModel.(*ranking.BPR).UserIndex.ToNumber("1"))[0] = 100
+		}
+		m.runFitRankingModelTask(lastModel)
+		assert.NotSame(t, lastModel, m.rankingModel, i)
+		assert.Equal(t, int64(i+1), m.rankingModelVersion)
+		assert.Equal(t, model.Params{model.NEpochs: 2, model.Lr: 0}, m.rankingModel.GetParams(), i)
+		bpr := m.rankingModel.(*ranking.BPR)
+		userFactor := bpr.GetUserFactor(bpr.UserIndex.ToNumber("1"))
+		if warmStart {
+			assert.Equal(t, 1, m.taskMonitor.Tasks[TaskFitRankingModel].Total, i)
+			assert.Equal(t, float32(100), userFactor[0], i)
+		} else {
+			assert.Equal(t, 2, m.taskMonitor.Tasks[TaskFitRankingModel].Total, i)
+			assert.NotEqual(t, float32(100), userFactor[0], i)
+		}
+	}
+}
+
+func TestMaster_FitRankingModelPinned(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	m.localCache = &LocalCache{}
+	m.GorseConfig = (*config.Config)(nil).LoadDefaultIfNil()
+	m.GorseConfig.Master.NumJobs = 1
+	dir := filepath.Join(os.TempDir(), "TestMaster_FitRankingModelPinned")
+	assert.NoError(t, os.RemoveAll(dir))
+	defer os.RemoveAll(dir)
+	var err error
+	m.modelRegistry, err = OpenModelRegistry(dir, 10)
+	assert.NoError(t, err)
+	m.rankingTrainSet, m.rankingTestSet = newRankingDataset()
+	m.rankingModel = ranking.NewBPR(model.Params{model.NEpochs: 1})
+
+	// fitted model is registered and served
+	m.runFitRankingModelTask(m.rankingModel)
+	assert.Equal(t, int64(1), m.rankingModelVersion)
+	assert.Equal(t, 1, len(m.modelRegistry.Index().RankingModels))
+
+	// fitted model is registered but not served if a model is pinned
+	err = m.pinModel(ModelTypeRanking, 1)
+	assert.NoError(t, err)
+	pinnedModel := m.rankingModel
+	m.runFitRankingModelTask(m.rankingModel)
+	assert.Equal(t, int64(1), m.rankingModelVersion)
+	assert.Same(t, pinnedModel, m.rankingModel)
+	index := m.modelRegistry.Index()
+	assert.Equal(t, 2, len(index.RankingModels))
+	assert.Equal(t, int64(2), index.RankingModels[1].Version)
+
+	// the latest model is served after unpinned
+	err = m.unpinModel(ModelTypeRanking)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), m.rankingModelVersion)
+}
+
+func loadDatasetWithValidationSet(t *testing.T, m *mockMaster) {
+	m.GorseConfig = (*config.Config)(nil).LoadDefaultIfNil()
+	m.GorseConfig.Database.PositiveFeedbackType = []string{"positive"}
+	m.GorseConfig.Database.ReadFeedbackTypes = []string{"read"}
+	m.GorseConfig.Recommend.EnablePromotionGate = true
+	m.GorseConfig.Recommend.ValidationWindow = 1
+	// insert items and users
+	var items []data.Item
+	var users []data.User
+	for i := 0; i < 10; i++ {
+		items = append(items, data.Item{ItemId: strconv.Itoa(i), Labels: []string{strconv.Itoa(i % 3)}})
+		users = append(users, data.User{UserId: strconv.Itoa(i), Labels: []string{strconv.Itoa(i % 2)}})
+	}
+	err := m.DataClient.BatchInsertItems(items)
+	assert.NoError(t, err)
+	err = m.DataClient.BatchInsertUsers(users)
+	assert.NoError(t, err)
+	// insert feedback before and after the validation time limit
+	var feedback []data.Feedback
+	for i := 0; i < 10; i++ {
+		for j, feedbackType := range []string{"positive", "positive", "read", "positive", "read"} {
+			timestamp := time.Now().AddDate(0, 0, -2)
+			if j >= 3 {
+				timestamp = time.Now()
+			}
+			feedback = append(feedback, data.Feedback{
+				FeedbackKey: data.FeedbackKey{
+					FeedbackType: feedbackType,
+					UserId:       strconv.Itoa(i),
+					ItemId:       strconv.Itoa((i + j) % 10),
+				},
+				Timestamp: timestamp,
+			})
+		}
+	}
+	err = m.DataClient.BatchInsertFeedback(feedback, false, false, true)
+	assert.NoError(t, err)
+	err = m.runLoadDatasetTask()
+	assert.NoError(t, err)
+}
+
+func TestMaster_LoadDataFromDatabaseWithValidationSet(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close()
+	loadDatasetWithValidationSet(t, m)
+	// feedback in the validation window is held out for the promotion gate only
+	assert.Equal(t, 30, m.rankingTrainSet.Count()+m.rankingTestSet.Count())
+	assert.Equal(t, 20, m.rankingGateTrainSet.Count())
+	assert.Equal(t, 10, m.rankingValidSet.Count())
+	assert.Equal(t, 10, m.rankingValidSet.UserCount())
+	assert.Equal(t, 10, len(m.rankingValidSet.Negatives))
+	assert.Equal(t, 30, m.clickTrainSet.PositiveCount+m.clickTestSet.PositiveCount)
+	assert.Equal(t, 20, m.clickTrainSet.NegativeCount+m.clickTestSet.NegativeCount)
+	assert.Equal(t, 20, m.clickGateTrainSet.PositiveCount)
+	assert.Equal(t, 10, m.clickGateTrainSet.NegativeCount)
+	assert.Equal(t, 10, m.clickValidSet.PositiveCount)
+	assert.Equal(t, 10, m.clickValidSet.NegativeCount)
+	numTotalPosFeedbacks, err := m.CacheClient.GetInt(cache.GlobalMeta, cache.NumTotalPosFeedbacks)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, numTotalPosFeedbacks)
+}
+
+func TestMaster_PromotionGate(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close()
+	m.localCache = &LocalCache{}
+	loadDatasetWithValidationSet(t, m)
+	m.rankingModel = ranking.NewBPR(model.Params{model.NEpochs: 10})
+	m.rankingModel.Fit(m.rankingTrainSet, m.rankingTestSet, nil)
+	m.clickModel = click.NewFM(click.FMClassification, model.Params{model.NEpochs: 10})
+	m.clickModel.Fit(m.clickTrainSet, m.clickTestSet, nil)
+
+	// models with the same hyper-parameters perform as well as current models
+	assert.True(t, m.passRankingPromotionGate(m.rankingModel, ranking.Clone(m.rankingModel)))
+	assert.True(t, m.passClickPromotionGate(m.clickModel, click.Clone(m.clickModel)))
+	// models must improve scores by the minimum improvement
+	m.GorseConfig.Recommend.PromotionMinImprovement = 1
+	assert.False(t, m.passRankingPromotionGate(m.rankingModel, ranking.Clone(m.rankingModel)))
+	assert.False(t, m.passClickPromotionGate(m.clickModel, click.Clone(m.clickModel)))
+	// scores are recorded
+	for _, name := range []string{PromotionRankingNDCG, PromotionClickAUC} {
+		incumbentScores, err := m.DataClient.GetMeasurements(cache.Key(name, "incumbent"), 10)
+		assert.NoError(t, err)
+		candidateScores, err := m.DataClient.GetMeasurements(cache.Key(name, "candidate"), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(incumbentScores))
+		assert.Equal(t, 2, len(candidateScores))
+		assert.Equal(t, incumbentScores[0].Value, candidateScores[0].Value)
+	}
+
+	// models found by searchers are not promoted if they fail to pass
+	m.taskScheduler = NewTaskScheduler()
+	m.rankingModelSearcher = ranking.NewModelSearcher(1, 1, 1, model.RandomSearch)
+	err := m.rankingModelSearcher.Fit(m.rankingTrainSet, m.rankingTestSet,
+		m.taskMonitor.NewTaskTracker(TaskSearchRankingModel), m.taskScheduler.NewRunner(TaskSearchRankingModel))
+	assert.NoError(t, err)
+	m.clickModelSearcher = click.NewModelSearcher(1, 1, 1, model.RandomSearch)
+	err = m.clickModelSearcher.Fit(m.clickTrainSet, m.clickTestSet,
+		m.taskMonitor.NewTaskTracker(TaskSearchClickModel), m.taskScheduler.NewRunner(TaskSearchClickModel))
+	assert.NoError(t, err)
+	rankingModel, clickModel := m.rankingModel, m.clickModel
+	_, _, _, err = m.runRankingRelatedTasks(m.rankingTrainSet.UserCount(), m.rankingTrainSet.ItemCount(), m.rankingTrainSet.Count())
+	assert.NoError(t, err)
+	assert.Same(t, rankingModel, m.rankingModel)
+	_, _, _, err = m.runFitClickModelTask(m.clickTrainSet.UserCount(), m.clickTrainSet.ItemCount(), m.clickTrainSet.Count())
+	assert.NoError(t, err)
+	assert.Same(t, clickModel, m.clickModel)
+	assert.Zero(t, m.clickModelVersion)
+
+	// periodic refits are not gated
+	_, _, _, err = m.runFitClickModelTask(0, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), m.clickModelVersion)
+	m.runFitRankingModelTask(m.rankingModel)
+	assert.NotSame(t, rankingModel, m.rankingModel)
+	assert.Equal(t, int64(1), m.rankingModelVersion)
+
+	// gates are passed if disabled
+	m.GorseConfig.Recommend.EnablePromotionGate = false
+	assert.True(t, m.passRankingPromotionGate(m.rankingModel, ranking.Clone(m.rankingModel)))
+	assert.True(t, m.passClickPromotionGate(m.clickModel, click.Clone(m.clickModel)))
+}
+
+func TestMaster_SplitStrategy(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close()
+	m.GorseConfig = (*config.Config)(nil).LoadDefaultIfNil()
+	m.GorseConfig.Database.PositiveFeedbackType = []string{"positive"}
+	m.GorseConfig.Database.ReadFeedbackTypes = []string{"read"}
+	// insert items and users
+	var items []data.Item
+	var users []data.User
+	for i := 0; i < 10; i++ {
+		items = append(items, data.Item{ItemId: strconv.Itoa(i)})
+		users = append(users, data.User{UserId: strconv.Itoa(i)})
+	}
+	err := m.DataClient.BatchInsertItems(items)
+	assert.NoError(t, err)
+	err = m.DataClient.BatchInsertUsers(users)
+	assert.NoError(t, err)
+	// insert feedback in the latest 5 days
+	var feedback []data.Feedback
+	for i := 0; i < 10; i++ {
+		for j, feedbackType := range []string{"positive", "positive", "read", "positive", "read"} {
+			feedback = append(feedback, data.Feedback{
+				FeedbackKey: data.FeedbackKey{
+					FeedbackType: feedbackType,
+					UserId:       strconv.Itoa(i),
+					ItemId:       strconv.Itoa((i + j) % 10),
+				},
+				Timestamp: time.Now().AddDate(0, 0, j-5).Add(-time.Hour),
+			})
+		}
+	}
+	err = m.DataClient.BatchInsertFeedback(feedback, false, false, true)
+	assert.NoError(t, err)
+
+	// split randomly
+	err = m.runLoadDatasetTask()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, m.rankingTrainSet.Count())
+	assert.Equal(t, 10, m.rankingTestSet.Count())
+	assert.Equal(t, 50, m.clickTrainSet.Count()+m.clickTestSet.Count())
+
+	// leave the latest feedback out
+	m.GorseConfig.Recommend.SplitStrategy = "leave_latest_out"
+	m.GorseConfig.Recommend.SplitNumLatest = 1
+	err = m.runLoadDatasetTask()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, m.rankingTrainSet.Count())
+	assert.Equal(t, 10, m.rankingTestSet.Count())
+	for userIndex := int32(0); userIndex < 10; userIndex++ {
+		userId, err := strconv.Atoi(m.rankingTestSet.UserIndex.ToName(userIndex))
+		assert.NoError(t, err)
+		itemId := m.rankingTestSet.ItemIndex.ToName(m.rankingTestSet.UserFeedback[userIndex][0])
+		assert.Equal(t, strconv.Itoa((userId+3)%10), itemId)
+	}
+	assert.Equal(t, 30, m.clickTrainSet.PositiveCount)
+	assert.Equal(t, 10, m.clickTrainSet.NegativeCount)
+	assert.Equal(t, 0, m.clickTestSet.PositiveCount)
+	assert.Equal(t, 10, m.clickTestSet.NegativeCount)
+
+	// split by cutoff time
+	m.GorseConfig.Recommend.SplitStrategy = "cutoff_time"
+	m.GorseConfig.Recommend.SplitCutoffWindow = 3
+	err = m.runLoadDatasetTask()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, m.rankingTrainSet.Count())
+	assert.Equal(t, 10, m.rankingTestSet.Count())
+	assert.Equal(t, 20, m.clickTrainSet.PositiveCount)
+	assert.Equal(t, 10, m.clickTrainSet.NegativeCount)
+	assert.Equal(t, 10, m.clickTestSet.PositiveCount)
+	assert.Equal(t, 10, m.clickTestSet.NegativeCount)
+}
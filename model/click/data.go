@@ -16,22 +16,35 @@ package click
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/juju/errors"
 	"github.com/scylladb/go-set"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/model"
 	"modernc.org/mathutil"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// TimeContextLabels derives context labels from a timestamp: the hour of day and the day of week in UTC.
+func TimeContextLabels(timestamp time.Time) []string {
+	timestamp = timestamp.UTC()
+	return []string{
+		fmt.Sprintf("hour=%d", timestamp.Hour()),
+		fmt.Sprintf("weekday=%d", timestamp.Weekday()),
+	}
+}
+
 // Dataset for click-through-rate models.
 type Dataset struct {
 	Index UnifiedIndex
 
-	UserFeatures [][]int32 // features of users
-	ItemFeatures [][]int32 // features of items
+	UserFeatures   [][]int32 // features of users
+	ItemFeatures   [][]int32 // features of items
+	UserAttributes [][]int32 // attributes of users
 
 	Users       base.Integers
 	Items       base.Integers
@@ -39,6 +52,7 @@ type Dataset struct {
 	CtxValues   [][]float32
 	NormValues  base.Floats
 	Target      base.Floats
+	Timestamps  []int64 // timestamps (in seconds) of samples, 0 if missing
 
 	PositiveCount int
 	NegativeCount int
@@ -114,6 +128,15 @@ func (dataset *Dataset) Get(i int) ([]int32, []float32, float32) {
 		features = append(features, dataset.CtxFeatures[i]...)
 		values = append(values, dataset.CtxValues[i]...)
 	}
+	// append user attributes
+	if dataset.Users.Len() > 0 && dataset.UserAttributes != nil {
+		position += dataset.Index.CountContextLabels()
+		userAttributes := dataset.UserAttributes[dataset.Users.Get(i)]
+		for _, attribute := range userAttributes {
+			features = append(features, position+attribute)
+		}
+		values = append(values, base.RepeatFloat32s(len(userAttributes), 1)...)
+	}
 	return features, values, dataset.Target.Get(i)
 }
 
@@ -188,58 +211,109 @@ func LoadDataFromBuiltIn(name string) (train, test *Dataset, err error) {
 	return
 }
 
-// Split a dataset to training set and test set.
-func (dataset *Dataset) Split(ratio float32, seed int64) (*Dataset, *Dataset) {
-	// create train/test dataset
+// emptySplit creates an empty training set and an empty test set sharing the index and features with the dataset.
+func (dataset *Dataset) emptySplit() (*Dataset, *Dataset) {
 	trainSet := &Dataset{
-		Index:        dataset.Index,
-		UserFeatures: dataset.UserFeatures,
-		ItemFeatures: dataset.ItemFeatures,
+		Index:          dataset.Index,
+		UserFeatures:   dataset.UserFeatures,
+		ItemFeatures:   dataset.ItemFeatures,
+		UserAttributes: dataset.UserAttributes,
 	}
 	testSet := &Dataset{
-		Index:        dataset.Index,
-		UserFeatures: dataset.UserFeatures,
-		ItemFeatures: dataset.ItemFeatures,
+		Index:          dataset.Index,
+		UserFeatures:   dataset.UserFeatures,
+		ItemFeatures:   dataset.ItemFeatures,
+		UserAttributes: dataset.UserAttributes,
+	}
+	return trainSet, testSet
+}
+
+// appendSample appends the i-th sample of a source dataset.
+func (dataset *Dataset) appendSample(source *Dataset, i int) {
+	dataset.Users.Append(source.Users.Get(i))
+	dataset.Items.Append(source.Items.Get(i))
+	if source.CtxFeatures != nil {
+		dataset.CtxFeatures = append(dataset.CtxFeatures, source.CtxFeatures[i])
+	}
+	if source.CtxValues != nil {
+		dataset.CtxValues = append(dataset.CtxValues, source.CtxValues[i])
 	}
+	if source.Timestamps != nil {
+		dataset.Timestamps = append(dataset.Timestamps, source.Timestamps[i])
+	}
+	dataset.NormValues.Append(source.NormValues.Get(i))
+	dataset.Target.Append(source.Target.Get(i))
+	if source.Target.Get(i) > 0 {
+		dataset.PositiveCount++
+	} else {
+		dataset.NegativeCount++
+	}
+}
+
+// timestamp returns the timestamp of the i-th sample. The timestamp is 0 if it is missing.
+func (dataset *Dataset) timestamp(i int) int64 {
+	if i < len(dataset.Timestamps) {
+		return dataset.Timestamps[i]
+	}
+	return 0
+}
+
+// Split a dataset to training set and test set.
+func (dataset *Dataset) Split(ratio float32, seed int64) (*Dataset, *Dataset) {
+	trainSet, testSet := dataset.emptySplit()
 	// split by random
 	numTestSize := int(float32(dataset.Count()) * ratio)
 	rng := base.NewRandomGenerator(seed)
 	sampledIndex := set.NewIntSet(rng.Sample(0, dataset.Count(), numTestSize)...)
 	for i := 0; i < dataset.Target.Len(); i++ {
 		if sampledIndex.Has(i) {
-			// add samples into test set
-			testSet.Users.Append(dataset.Users.Get(i))
-			testSet.Items.Append(dataset.Items.Get(i))
-			if dataset.CtxFeatures != nil {
-				testSet.CtxFeatures = append(testSet.CtxFeatures, dataset.CtxFeatures[i])
-			}
-			if dataset.CtxValues != nil {
-				testSet.CtxValues = append(testSet.CtxValues, dataset.CtxValues[i])
-			}
-			testSet.NormValues.Append(dataset.NormValues.Get(i))
-			testSet.Target.Append(dataset.Target.Get(i))
-			if dataset.Target.Get(i) > 0 {
-				testSet.PositiveCount++
-			} else {
-				testSet.NegativeCount++
-			}
+			testSet.appendSample(dataset, i)
 		} else {
-			// add samples into train set
-			trainSet.Users.Append(dataset.Users.Get(i))
-			trainSet.Items.Append(dataset.Items.Get(i))
-			if dataset.CtxFeatures != nil {
-				trainSet.CtxFeatures = append(trainSet.CtxFeatures, dataset.CtxFeatures[i])
-			}
-			if dataset.CtxValues != nil {
-				trainSet.CtxValues = append(trainSet.CtxValues, dataset.CtxValues[i])
-			}
-			trainSet.NormValues.Append(dataset.NormValues.Get(i))
-			trainSet.Target.Append(dataset.Target.Get(i))
-			if dataset.Target.Get(i) > 0 {
-				trainSet.PositiveCount++
-			} else {
-				trainSet.NegativeCount++
-			}
+			trainSet.appendSample(dataset, i)
+		}
+	}
+	return trainSet, testSet
+}
+
+// SplitLatest splits a dataset by leaving the latest samples out. The latest numTestSamples samples of each user are
+// presented in the test set and the rest are presented in the training set. Samples without timestamps are treated
+// as the oldest ones.
+func (dataset *Dataset) SplitLatest(numTestSamples int) (*Dataset, *Dataset) {
+	trainSet, testSet := dataset.emptySplit()
+	// group samples by users
+	userSamples := make(map[int32][]int)
+	for i := 0; i < dataset.Target.Len(); i++ {
+		userIndex := dataset.Users.Get(i)
+		userSamples[userIndex] = append(userSamples[userIndex], i)
+	}
+	isTest := make([]bool, dataset.Target.Len())
+	for _, samples := range userSamples {
+		sort.SliceStable(samples, func(i, j int) bool {
+			return dataset.timestamp(samples[i]) < dataset.timestamp(samples[j])
+		})
+		for k := mathutil.Max(0, len(samples)-numTestSamples); k < len(samples); k++ {
+			isTest[samples[k]] = true
+		}
+	}
+	for i := 0; i < dataset.Target.Len(); i++ {
+		if isTest[i] {
+			testSet.appendSample(dataset, i)
+		} else {
+			trainSet.appendSample(dataset, i)
+		}
+	}
+	return trainSet, testSet
+}
+
+// SplitByTime splits a dataset by a global cutoff time. Samples at or after the cutoff time are presented in the test
+// set and the rest are presented in the training set. Samples without timestamps are presented in the training set.
+func (dataset *Dataset) SplitByTime(cutoff time.Time) (*Dataset, *Dataset) {
+	trainSet, testSet := dataset.emptySplit()
+	for i := 0; i < dataset.Target.Len(); i++ {
+		if dataset.timestamp(i) >= cutoff.Unix() {
+			testSet.appendSample(dataset, i)
+		} else {
+			trainSet.appendSample(dataset, i)
 		}
 	}
 	return trainSet, testSet
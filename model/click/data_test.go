@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestLoadDataFromBuiltIn(t *testing.T) {
@@ -36,6 +37,8 @@ func TestDataset_Split(t *testing.T) {
 		unifiedIndex.AddUserLabel(fmt.Sprintf("user_label%v", 2*i))
 		unifiedIndex.AddUserLabel(fmt.Sprintf("user_label%v", 2*i+1))
 		dataset.UserFeatures = append(dataset.UserFeatures, []int32{int32(2 * i), int32(2*i + 1)})
+		unifiedIndex.AddUserAttribute(fmt.Sprintf("user_attr%v", i))
+		dataset.UserAttributes = append(dataset.UserAttributes, []int32{int32(i)})
 	}
 	for i := 0; i < numItems; i++ {
 		unifiedIndex.AddItem(fmt.Sprintf("item%v", i))
@@ -83,8 +86,10 @@ func TestDataset_Split(t *testing.T) {
 		dataset.Index.CountUsers() + dataset.Index.CountItems() + dataset.Index.CountUserLabels() + 7,
 		dataset.Index.CountUsers() + dataset.Index.CountItems() + dataset.Index.CountUserLabels() + 8,
 		0,
+		dataset.Index.CountUsers() + dataset.Index.CountItems() + dataset.Index.CountUserLabels() +
+			dataset.Index.CountItemLabels() + dataset.Index.CountContextLabels() + 0,
 	}, features)
-	assert.Equal(t, []float32{1, 1, 1.5, 1.5, 1.5, 1.5, 1.5, 2}, values)
+	assert.Equal(t, []float32{1, 1, 1.5, 1.5, 1.5, 1.5, 1.5, 2, 1}, values)
 	assert.Equal(t, float32(-1), target)
 
 	// split
@@ -100,3 +105,72 @@ func TestDataset_Split(t *testing.T) {
 	assert.Equal(t, 3, test.PositiveCount)
 	assert.Equal(t, 3, test.NegativeCount)
 }
+
+func TestTimeContextLabels(t *testing.T) {
+	labels := TimeContextLabels(time.Date(2021, 10, 1, 15, 30, 0, 0, time.UTC))
+	assert.Equal(t, []string{"hour=15", "weekday=5"}, labels)
+}
+
+func newTimedDataset() *Dataset {
+	unifiedIndex := NewUnifiedMapIndexBuilder()
+	dataset := &Dataset{}
+	numUsers, numItems := 3, 4
+	for i := 0; i < numUsers; i++ {
+		unifiedIndex.AddUser(fmt.Sprintf("user%v", i))
+		dataset.UserFeatures = append(dataset.UserFeatures, nil)
+	}
+	for i := 0; i < numItems; i++ {
+		unifiedIndex.AddItem(fmt.Sprintf("item%v", i))
+		dataset.ItemFeatures = append(dataset.ItemFeatures, nil)
+	}
+	start := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < numUsers; i++ {
+		for j := numItems - 1; j >= 0; j-- {
+			dataset.Users.Append(int32(i))
+			dataset.Items.Append(int32(j))
+			dataset.NormValues.Append(1)
+			dataset.Timestamps = append(dataset.Timestamps, start.Add(time.Duration(j)*time.Hour).Unix())
+			if j%2 == 0 {
+				dataset.Target.Append(1)
+				dataset.PositiveCount++
+			} else {
+				dataset.Target.Append(-1)
+				dataset.NegativeCount++
+			}
+		}
+	}
+	dataset.Index = unifiedIndex.Build()
+	return dataset
+}
+
+func TestDataset_SplitLatest(t *testing.T) {
+	dataset := newTimedDataset()
+	train, test := dataset.SplitLatest(2)
+	assert.Equal(t, 6, train.Count())
+	assert.Equal(t, 3, train.PositiveCount)
+	assert.Equal(t, 3, train.NegativeCount)
+	assert.Equal(t, 6, test.Count())
+	assert.Equal(t, 3, test.PositiveCount)
+	assert.Equal(t, 3, test.NegativeCount)
+	for i := 0; i < test.Count(); i++ {
+		assert.GreaterOrEqual(t, test.Items.Get(i), int32(2))
+		assert.Equal(t, time.Date(2021, 10, 1, int(test.Items.Get(i)), 0, 0, 0, time.UTC).Unix(), test.Timestamps[i])
+	}
+	// all samples of users are in the test set if there are too few samples
+	train, test = dataset.SplitLatest(5)
+	assert.Equal(t, 0, train.Count())
+	assert.Equal(t, 12, test.Count())
+}
+
+func TestDataset_SplitByTime(t *testing.T) {
+	dataset := newTimedDataset()
+	train, test := dataset.SplitByTime(time.Date(2021, 10, 1, 3, 0, 0, 0, time.UTC))
+	assert.Equal(t, 9, train.Count())
+	assert.Equal(t, 3, test.Count())
+	for i := 0; i < test.Count(); i++ {
+		assert.Equal(t, int32(3), test.Items.Get(i))
+	}
+	for i := 0; i < train.Count(); i++ {
+		assert.Less(t, train.Items.Get(i), int32(3))
+	}
+}
@@ -84,6 +84,18 @@ func (score Score) BetterThan(s Score) bool {
 	}
 }
 
+// objective returns the value to maximize in hyper-parameter searching.
+func (score Score) objective() float32 {
+	switch score.Task {
+	case FMRegression:
+		return -score.RMSE
+	case FMClassification:
+		return score.AUC
+	default:
+		return math32.NaN()
+	}
+}
+
 type FitConfig struct {
 	Jobs    int
 	Verbose int
@@ -121,7 +133,7 @@ func (config *FitConfig) LoadDefaultIfNil() *FitConfig {
 
 type FactorizationMachine interface {
 	model.Model
-	Predict(userId, itemId string, userLabels, itemLabels []string) float32
+	Predict(userId, itemId string, userLabels, itemLabels, userAttributes, ctxLabels []string) float32
 	InternalPredict(x []int32, values []float32) float32
 	Fit(trainSet *Dataset, testSet *Dataset, config *FitConfig) Score
 	Marshal(w io.Writer) error
@@ -189,7 +201,7 @@ func (fm *FM) SetParams(params model.Params) {
 	fm.initStdDev = fm.Params.GetFloat32(model.InitStdDev, 0.01)
 }
 
-func (fm *FM) Predict(userId, itemId string, userLabels, itemLabels []string) float32 {
+func (fm *FM) Predict(userId, itemId string, userLabels, itemLabels, userAttributes, ctxLabels []string) float32 {
 	var features []int32
 	var values []float32
 	// encode user
@@ -218,6 +230,20 @@ func (fm *FM) Predict(userId, itemId string, userLabels, itemLabels []string) fl
 			values = append(values, 1/norm)
 		}
 	}
+	// encode user attributes
+	for _, userAttribute := range userAttributes {
+		if userAttrIndex := fm.Index.EncodeUserAttribute(userAttribute); userAttrIndex != base.NotId {
+			features = append(features, userAttrIndex)
+			values = append(values, 1)
+		}
+	}
+	// encode context labels
+	for _, ctxLabel := range ctxLabels {
+		if ctxLabelIndex := fm.Index.EncodeContextLabel(ctxLabel); ctxLabelIndex != base.NotId {
+			features = append(features, ctxLabelIndex)
+			values = append(values, 1)
+		}
+	}
 	return fm.InternalPredict(features, values)
 }
 
@@ -441,6 +467,15 @@ func (fm *FM) Init(trainSet *Dataset) {
 				newV[newIndex] = fm.V[oldIndex]
 			}
 		}
+		// user attributes
+		for _, attribute := range trainSet.Index.GetUserAttributes() {
+			oldIndex := fm.Index.EncodeUserAttribute(attribute)
+			newIndex := trainSet.Index.EncodeUserAttribute(attribute)
+			if oldIndex != base.NotId {
+				newW[newIndex] = fm.W[oldIndex]
+				newV[newIndex] = fm.V[oldIndex]
+			}
+		}
 	}
 	fm.MinTarget = math32.Inf(1)
 	fm.MaxTarget = math32.Inf(-1)
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/model"
 )
 
@@ -135,8 +136,8 @@ func TestFM_Regression_Criteo(t *testing.T) {
 	assert.InDelta(t, 0.839194, score.RMSE, regressionDelta)
 
 	// test prediction
-	assert.Equal(t, m.InternalPredict([]int32{1, 2, 3, 4, 5, 6}, []float32{1, 1, 0.5, 0.5, 0.5, 0.5}),
-		m.Predict("1", "2", []string{"3", "4"}, []string{"5", "6"}))
+	assert.Equal(t, m.InternalPredict([]int32{1, 2, 3, 4, 5, 6, 7, 8}, []float32{1, 1, 0.5, 0.5, 0.5, 0.5, 1, 1}),
+		m.Predict("1", "2", []string{"3", "4"}, []string{"5", "6"}, []string{"7"}, []string{"8"}))
 
 	// test increment test
 	buf := bytes.NewBuffer(nil)
@@ -192,3 +193,41 @@ func TestFM_Regression_Criteo(t *testing.T) {
 //	score := m.Fit(train, test, fitConfig)
 //	assertEpsilon(t, 0.570648, score.RMSE)
 //}
+
+func TestFM_UnmarshalLegacyIndex(t *testing.T) {
+	builder := NewUnifiedMapIndexBuilder()
+	builder.AddUser("1")
+	builder.AddItem("2")
+	builder.AddUserLabel("3")
+	builder.AddItemLabel("4")
+	builder.AddCtxLabel("5")
+	index := builder.Build().(*UnifiedMapIndex)
+	m := NewFM(FMClassification, model.Params{model.NFactors: 2})
+	m.Init(&Dataset{Index: index})
+	// replace the index of the model by the layout without user attributes
+	buf := bytes.NewBuffer(nil)
+	err := MarshalModel(buf, m)
+	assert.NoError(t, err)
+	params := bytes.NewBuffer(nil)
+	err = base.WriteGob(params, m.Params)
+	assert.NoError(t, err)
+	newIndex := bytes.NewBuffer(nil)
+	err = MarshalIndex(newIndex, index)
+	assert.NoError(t, err)
+	legacyIndex := bytes.NewBuffer([]byte{mapIndex})
+	for _, i := range []base.Index{index.UserIndex, index.ItemIndex, index.UserLabelIndex, index.ItemLabelIndex, index.CtxLabelIndex} {
+		err = base.MarshalIndex(legacyIndex, i)
+		assert.NoError(t, err)
+	}
+	data := buf.Bytes()
+	legacy := append(append(append([]byte{}, data[:params.Len()]...), legacyIndex.Bytes()...), data[params.Len()+newIndex.Len():]...)
+	// load the model written by earlier versions
+	tmp, err := UnmarshalModel(bytes.NewReader(legacy))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), tmp.(*FM).Index.CountUserAttributes())
+	assert.Equal(t, m.Index.Len(), tmp.(*FM).Index.Len())
+	assert.Equal(t, m.W, tmp.(*FM).W)
+	assert.Equal(t, m.V, tmp.(*FM).V)
+	assert.Equal(t, m.Predict("1", "2", []string{"3"}, []string{"4"}, nil, []string{"5"}),
+		tmp.Predict("1", "2", []string{"3"}, []string{"4"}, nil, []string{"5"}))
+}
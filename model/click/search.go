@@ -128,6 +128,45 @@ func RandomSearchCV(estimator FactorizationMachine, trainSet *Dataset, testSet *
 	return results
 }
 
+// BayesianSearchCV searches hyper-parameters by the tree-structured Parzen estimator. Hyper-parameters of each trial
+// are proposed from the results of previous trials.
+func BayesianSearchCV(estimator FactorizationMachine, trainSet *Dataset, testSet *Dataset, space model.ParamsSpace,
+	numTrials int, seed int64, fitConfig *FitConfig, runner model.Runner) ParamsSearchResult {
+	// if there is no continuous range and the number of combination is less than number of trials, use grid search
+	if len(space.Ranges) == 0 && space.Grid.NumCombinations() < numTrials {
+		return GridSearchCV(estimator, trainSet, testSet, space.Grid, seed, fitConfig, runner)
+	}
+	tpe := model.NewTPE(space, seed)
+	results := ParamsSearchResult{
+		Scores: make([]Score, 0, numTrials),
+		Params: make([]model.Params, 0, numTrials),
+	}
+	for i := 1; i <= numTrials; i++ {
+		// Make parameters
+		params := tpe.Suggest()
+		// Cross validate
+		base.Logger().Info(fmt.Sprintf("bayesian search %v/%v", i, numTrials),
+			zap.Any("params", params))
+		estimator.Clear()
+		estimator.SetParams(estimator.GetParams().Overwrite(params))
+		fitConfig.Tracker.Suspend(true)
+		runner.Lock()
+		fitConfig.Tracker.Suspend(false)
+		score := estimator.Fit(trainSet, testSet, fitConfig)
+		runner.UnLock()
+		tpe.Observe(params, float64(score.objective()))
+		results.Scores = append(results.Scores, score)
+		results.Params = append(results.Params, params.Copy())
+		if len(results.Scores) == 0 || score.BetterThan(results.BestScore) {
+			results.BestScore = score
+			results.BestParams = params.Copy()
+			results.BestIndex = len(results.Params) - 1
+			results.BestModel = Clone(estimator)
+		}
+	}
+	return results
+}
+
 // ModelSearcher is a thread-safe click model searcher.
 type ModelSearcher struct {
 	model FactorizationMachine
@@ -135,19 +174,22 @@ type ModelSearcher struct {
 	numEpochs int
 	numTrials int
 	numJobs   int
+	strategy  string
 	// results
 	bestMutex sync.Mutex
 	bestModel FactorizationMachine
 	bestScore Score
 }
 
-// NewModelSearcher creates a thread-safe personal ranking model searcher.
-func NewModelSearcher(nEpoch, nTrials, nJobs int) *ModelSearcher {
+// NewModelSearcher creates a thread-safe personal ranking model searcher. Hyper-parameters are searched randomly
+// unless the strategy is model.BayesianSearch.
+func NewModelSearcher(nEpoch, nTrials, nJobs int, strategy string) *ModelSearcher {
 	return &ModelSearcher{
 		model:     NewFM(FMClassification, model.Params{model.NEpochs: nEpoch}),
 		numTrials: nTrials,
 		numEpochs: nEpoch,
 		numJobs:   nJobs,
+		strategy:  strategy,
 	}
 }
 
@@ -170,11 +212,18 @@ func (searcher *ModelSearcher) Fit(trainSet, valSet *Dataset, tracker model.Trac
 		zap.Int32("n_item_labels", trainSet.Index.CountItemLabels()))
 	startTime := time.Now()
 
-	// Random search
 	grid := searcher.model.GetParamsGrid()
-	r := RandomSearchCV(searcher.model, trainSet, valSet, grid, searcher.numTrials, 0, NewFitConfig().
+	fitConfig := NewFitConfig().
 		SetJobs(searcher.numJobs).
-		SetTracker(tracker.SubTracker()), runner)
+		SetTracker(tracker.SubTracker())
+	var r ParamsSearchResult
+	if searcher.strategy == model.BayesianSearch {
+		// Bayesian search
+		r = BayesianSearchCV(searcher.model, trainSet, valSet, model.NewParamsSpace(grid), searcher.numTrials, 0, fitConfig, runner)
+	} else {
+		// Random search
+		r = RandomSearchCV(searcher.model, trainSet, valSet, grid, searcher.numTrials, 0, fitConfig, runner)
+	}
 	searcher.bestMutex.Lock()
 	defer searcher.bestMutex.Unlock()
 	searcher.bestModel = r.BestModel
@@ -59,7 +59,7 @@ func (m *mockFactorizationMachineForSearch) Fit(_, _ *Dataset, _ *FitConfig) Sco
 	return Score{Task: FMClassification, AUC: score}
 }
 
-func (m *mockFactorizationMachineForSearch) Predict(_, _ string, _, _ []string) float32 {
+func (m *mockFactorizationMachineForSearch) Predict(_, _ string, _, _, _, _ []string) float32 {
 	panic("don't call me")
 }
 
@@ -137,6 +137,30 @@ func TestRandomSearchCV(t *testing.T) {
 	}, r.BestParams)
 }
 
+func TestBayesianSearchCV(t *testing.T) {
+	m := &mockFactorizationMachineForSearch{}
+	fitConfig, tracker := newFitConfigForSearch()
+	runner := new(mockRunner)
+	runner.On("Lock")
+	runner.On("UnLock")
+	space := model.ParamsSpace{
+		Grid:   model.ParamsGrid{model.NFactors: []interface{}{1, 2, 3, 4}},
+		Ranges: map[model.ParamName]model.ParamsRange{model.InitStdDev: {Low: 1, High: 4}},
+	}
+	r := BayesianSearchCV(m, nil, nil, space, 30, 0, fitConfig, runner)
+	tracker.AssertExpectations(t)
+	runner.AssertCalled(t, "Lock")
+	runner.AssertCalled(t, "UnLock")
+	assert.Equal(t, 30, len(r.Scores))
+	assert.Equal(t, 4, r.BestParams[model.NFactors])
+	assert.GreaterOrEqual(t, r.BestParams.GetFloat32(model.InitStdDev, 0), float32(3.5))
+	assert.GreaterOrEqual(t, r.BestScore.AUC, float32(7.5))
+	// use grid search if there are less combinations than trials
+	r = BayesianSearchCV(m, nil, nil, model.NewParamsSpace(m.GetParamsGrid()), 65, 0, fitConfig, runner)
+	assert.Equal(t, 64, len(r.Scores))
+	assert.Equal(t, float32(12), r.BestScore.AUC)
+}
+
 func TestModelSearcher(t *testing.T) {
 	tracker := new(mockTracker)
 	tracker.On("Start", 63*2)
@@ -145,7 +169,28 @@ func TestModelSearcher(t *testing.T) {
 	runner := new(mockRunner)
 	runner.On("Lock")
 	runner.On("UnLock")
-	searcher := NewModelSearcher(2, 63, 1)
+	searcher := NewModelSearcher(2, 63, 1, model.RandomSearch)
+	searcher.model = &mockFactorizationMachineForSearch{}
+	err := searcher.Fit(NewMapIndexDataset(), NewMapIndexDataset(), tracker, runner)
+	assert.NoError(t, err)
+	m, score := searcher.GetBestModel()
+	assert.Equal(t, float32(12), score.AUC)
+	assert.Equal(t, model.Params{
+		model.NFactors:   4,
+		model.InitMean:   4,
+		model.InitStdDev: 4,
+	}, m.GetParams())
+}
+
+func TestModelSearcher_Bayesian(t *testing.T) {
+	tracker := new(mockTracker)
+	tracker.On("Start", 63*2)
+	tracker.On("SubTracker")
+	tracker.On("Finish")
+	runner := new(mockRunner)
+	runner.On("Lock")
+	runner.On("UnLock")
+	searcher := NewModelSearcher(2, 63, 1, model.BayesianSearch)
 	searcher.model = &mockFactorizationMachineForSearch{}
 	err := searcher.Fit(NewMapIndexDataset(), NewMapIndexDataset(), tracker, runner)
 	assert.NoError(t, err)
@@ -23,7 +23,7 @@ import (
 	"strconv"
 )
 
-// UnifiedIndex maps users, items and labels into a unified encoding space.
+// UnifiedIndex maps users, items, labels and user attributes into a unified encoding space.
 type UnifiedIndex interface {
 	Len() int32
 	EncodeUser(userId string) int32
@@ -31,23 +31,29 @@ type UnifiedIndex interface {
 	EncodeUserLabel(userLabel string) int32
 	EncodeItemLabel(itemLabel string) int32
 	EncodeContextLabel(ctxLabel string) int32
+	EncodeUserAttribute(userAttribute string) int32
 	GetUsers() []string
 	GetItems() []string
 	GetUserLabels() []string
 	GetItemLabels() []string
 	GetContextLabels() []string
+	GetUserAttributes() []string
 	CountUsers() int32
 	CountItems() int32
 	CountUserLabels() int32
 	CountItemLabels() int32
 	CountContextLabels() int32
+	CountUserAttributes() int32
 	Marshal(w io.Writer) error
 	Unmarshal(r io.Reader) error
 }
 
 const (
+	// mapIndex is the layout of map index without user attributes.
 	mapIndex uint8 = iota
 	directIndex
+	// attrMapIndex is the layout of map index with user attributes.
+	attrMapIndex
 )
 
 // MarshalIndex marshal index into byte stream.
@@ -56,7 +62,7 @@ func MarshalIndex(w io.Writer, index UnifiedIndex) error {
 	var indexType uint8
 	switch index.(type) {
 	case *UnifiedMapIndex:
-		indexType = mapIndex
+		indexType = attrMapIndex
 	case *UnifiedDirectIndex:
 		indexType = directIndex
 	default:
@@ -81,6 +87,13 @@ func UnmarshalIndex(r io.Reader) (UnifiedIndex, error) {
 	var index UnifiedIndex
 	switch indexType {
 	case mapIndex:
+		// user attributes are empty in indices written by earlier versions
+		mapIndex := &UnifiedMapIndex{}
+		if err = mapIndex.unmarshal(r, false); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return mapIndex, nil
+	case attrMapIndex:
 		index = &UnifiedMapIndex{}
 	case directIndex:
 		index = &UnifiedDirectIndex{}
@@ -102,6 +115,7 @@ type UnifiedMapIndexBuilder struct {
 	UserLabelIndex base.Index
 	ItemLabelIndex base.Index
 	CtxLabelIndex  base.Index
+	UserAttrIndex  base.Index
 }
 
 // NewUnifiedMapIndexBuilder creates a UnifiedMapIndexBuilder.
@@ -112,6 +126,7 @@ func NewUnifiedMapIndexBuilder() *UnifiedMapIndexBuilder {
 		UserLabelIndex: base.NewMapIndex(),
 		ItemLabelIndex: base.NewMapIndex(),
 		CtxLabelIndex:  base.NewMapIndex(),
+		UserAttrIndex:  base.NewMapIndex(),
 	}
 }
 
@@ -140,6 +155,11 @@ func (builder *UnifiedMapIndexBuilder) AddCtxLabel(ctxLabel string) {
 	builder.CtxLabelIndex.Add(ctxLabel)
 }
 
+// AddUserAttribute adds a user attribute into the unified index.
+func (builder *UnifiedMapIndexBuilder) AddUserAttribute(userAttribute string) {
+	builder.UserAttrIndex.Add(userAttribute)
+}
+
 // Build UnifiedMapIndex from UnifiedMapIndexBuilder.
 func (builder *UnifiedMapIndexBuilder) Build() UnifiedIndex {
 	return &UnifiedMapIndex{
@@ -148,17 +168,19 @@ func (builder *UnifiedMapIndexBuilder) Build() UnifiedIndex {
 		UserLabelIndex: builder.UserLabelIndex,
 		ItemLabelIndex: builder.ItemLabelIndex,
 		CtxLabelIndex:  builder.CtxLabelIndex,
+		UserAttrIndex:  builder.UserAttrIndex,
 	}
 }
 
 // UnifiedMapIndex is the id -> index mapper for factorization machines.
-// The division of id is: | user | item | user label | item label | context label |
+// The division of id is: | user | item | user label | item label | context label | user attribute |
 type UnifiedMapIndex struct {
 	UserIndex      base.Index
 	ItemIndex      base.Index
 	UserLabelIndex base.Index
 	ItemLabelIndex base.Index
 	CtxLabelIndex  base.Index
+	UserAttrIndex  base.Index
 }
 
 // GetUserLabels returns all user labels.
@@ -176,6 +198,11 @@ func (unified *UnifiedMapIndex) GetContextLabels() []string {
 	return unified.CtxLabelIndex.GetNames()
 }
 
+// GetUserAttributes returns all user attributes.
+func (unified *UnifiedMapIndex) GetUserAttributes() []string {
+	return unified.UserAttrIndex.GetNames()
+}
+
 // CountUserLabels returns the number of user labels.
 func (unified *UnifiedMapIndex) CountUserLabels() int32 {
 	return unified.UserLabelIndex.Len()
@@ -191,11 +218,16 @@ func (unified *UnifiedMapIndex) CountContextLabels() int32 {
 	return unified.CtxLabelIndex.Len()
 }
 
+// CountUserAttributes returns the number of user attributes.
+func (unified *UnifiedMapIndex) CountUserAttributes() int32 {
+	return unified.UserAttrIndex.Len()
+}
+
 // Len returns the size of unified index.
 func (unified *UnifiedMapIndex) Len() int32 {
 	return unified.UserIndex.Len() + unified.ItemIndex.Len() +
 		unified.UserLabelIndex.Len() + unified.ItemLabelIndex.Len() +
-		unified.CtxLabelIndex.Len()
+		unified.CtxLabelIndex.Len() + unified.UserAttrIndex.Len()
 }
 
 // EncodeUser converts a user id to a integer in the encoding space.
@@ -240,6 +272,16 @@ func (unified *UnifiedMapIndex) EncodeContextLabel(label string) int32 {
 	return ctxLabelIndex
 }
 
+// EncodeUserAttribute converts a user attribute to a integer in the encoding space.
+func (unified *UnifiedMapIndex) EncodeUserAttribute(userAttribute string) int32 {
+	userAttrIndex := unified.UserAttrIndex.ToNumber(userAttribute)
+	if userAttrIndex != base.NotId {
+		userAttrIndex += unified.UserIndex.Len() + unified.ItemIndex.Len() +
+			unified.UserLabelIndex.Len() + unified.ItemLabelIndex.Len() + unified.CtxLabelIndex.Len()
+	}
+	return userAttrIndex
+}
+
 // GetUsers returns all users.
 func (unified *UnifiedMapIndex) GetUsers() []string {
 	return unified.UserIndex.GetNames()
@@ -262,7 +304,7 @@ func (unified *UnifiedMapIndex) CountItems() int32 {
 
 // Marshal map index into byte stream.
 func (unified *UnifiedMapIndex) Marshal(w io.Writer) error {
-	indices := []base.Index{unified.UserIndex, unified.ItemIndex, unified.UserLabelIndex, unified.ItemLabelIndex, unified.CtxLabelIndex}
+	indices := []base.Index{unified.UserIndex, unified.ItemIndex, unified.UserLabelIndex, unified.ItemLabelIndex, unified.CtxLabelIndex, unified.UserAttrIndex}
 	for _, index := range indices {
 		err := base.MarshalIndex(w, index)
 		if err != nil {
@@ -274,7 +316,16 @@ func (unified *UnifiedMapIndex) Marshal(w io.Writer) error {
 
 // Unmarshal map index from byte stream.
 func (unified *UnifiedMapIndex) Unmarshal(r io.Reader) error {
+	return unified.unmarshal(r, true)
+}
+
+func (unified *UnifiedMapIndex) unmarshal(r io.Reader, withUserAttributes bool) error {
 	indices := []*base.Index{&unified.UserIndex, &unified.ItemIndex, &unified.UserLabelIndex, &unified.ItemLabelIndex, &unified.CtxLabelIndex}
+	if withUserAttributes {
+		indices = append(indices, &unified.UserAttrIndex)
+	} else {
+		unified.UserAttrIndex = base.NewMapIndex()
+	}
 	for i := range indices {
 		var err error
 		*indices[i], err = base.UnmarshalIndex(r)
@@ -338,6 +389,11 @@ func (unified *UnifiedDirectIndex) GetContextLabels() []string {
 	return names
 }
 
+// GetUserAttributes should be used by unit testing only.
+func (unified *UnifiedDirectIndex) GetUserAttributes() []string {
+	return nil
+}
+
 // CountUserLabels should be used by unit testing only.
 func (unified *UnifiedDirectIndex) CountUserLabels() int32 {
 	return unified.N / 5
@@ -353,6 +409,11 @@ func (unified *UnifiedDirectIndex) CountContextLabels() int32 {
 	return unified.N - unified.N/5*4
 }
 
+// CountUserAttributes should be used by unit testing only.
+func (unified *UnifiedDirectIndex) CountUserAttributes() int32 {
+	return 0
+}
+
 // NewUnifiedDirectIndex creates a UnifiedDirectIndex.
 func NewUnifiedDirectIndex(n int32) UnifiedIndex {
 	return &UnifiedDirectIndex{N: n}
@@ -390,6 +451,15 @@ func (unified *UnifiedDirectIndex) EncodeContextLabel(label string) int32 {
 	}
 }
 
+// EncodeUserAttribute should be used by unit testing only.
+func (unified *UnifiedDirectIndex) EncodeUserAttribute(userAttribute string) int32 {
+	if val, err := strconv.Atoi(userAttribute); err != nil {
+		panic(err)
+	} else {
+		return int32(val)
+	}
+}
+
 // GetUsers should be used by unit testing only.
 func (unified *UnifiedDirectIndex) GetUsers() []string {
 	var names []string
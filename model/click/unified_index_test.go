@@ -23,7 +23,7 @@ import (
 func TestUnifiedMapIndex(t *testing.T) {
 	// create unified map index
 	builder := NewUnifiedMapIndexBuilder()
-	var numUsers, numItems, numUserLabels, numItemLabels, numCtxLabels int32 = 3, 4, 5, 6, 7
+	var numUsers, numItems, numUserLabels, numItemLabels, numCtxLabels, numUserAttrs int32 = 3, 4, 5, 6, 7, 8
 	for i := int32(0); i < numUsers; i++ {
 		builder.AddUser(fmt.Sprintf("user%v", i))
 	}
@@ -39,14 +39,18 @@ func TestUnifiedMapIndex(t *testing.T) {
 	for i := int32(0); i < numCtxLabels; i++ {
 		builder.AddCtxLabel(fmt.Sprintf("ctx_label%v", i))
 	}
+	for i := int32(0); i < numUserAttrs; i++ {
+		builder.AddUserAttribute(fmt.Sprintf("user_attr%v", i))
+	}
 	index := builder.Build()
 	// check count
-	assert.Equal(t, numUsers+numItems+numUserLabels+numItemLabels+numCtxLabels, index.Len())
+	assert.Equal(t, numUsers+numItems+numUserLabels+numItemLabels+numCtxLabels+numUserAttrs, index.Len())
 	assert.Equal(t, numUsers, index.CountUsers())
 	assert.Equal(t, numItems, index.CountItems())
 	assert.Equal(t, numUserLabels, index.CountUserLabels())
 	assert.Equal(t, numItemLabels, index.CountItemLabels())
 	assert.Equal(t, numCtxLabels, index.CountContextLabels())
+	assert.Equal(t, numUserAttrs, index.CountUserAttributes())
 	// check encode
 	users := index.GetUsers()
 	for i := int32(0); i < numUsers; i++ {
@@ -78,6 +82,12 @@ func TestUnifiedMapIndex(t *testing.T) {
 		assert.Equal(t, numUsers+numItems+numUserLabels+numItemLabels+i, ctxLabelIndex)
 		assert.Equal(t, fmt.Sprintf("ctx_label%v", i), ctxLabels[i])
 	}
+	userAttrs := index.GetUserAttributes()
+	for i := int32(0); i < numUserAttrs; i++ {
+		userAttrIndex := index.EncodeUserAttribute(fmt.Sprintf("user_attr%v", i))
+		assert.Equal(t, numUsers+numItems+numUserLabels+numItemLabels+numCtxLabels+i, userAttrIndex)
+		assert.Equal(t, fmt.Sprintf("user_attr%v", i), userAttrs[i])
+	}
 	// Encode and decode
 	buf := bytes.NewBuffer(nil)
 	err := MarshalIndex(buf, index)
@@ -100,11 +110,13 @@ func TestUnifiedDirectIndex(t *testing.T) {
 	assert.Equal(t, int32(2), index.CountItemLabels())
 	assert.Equal(t, int32(2), index.CountUserLabels())
 	assert.Equal(t, int32(2), index.CountContextLabels())
+	assert.Equal(t, int32(0), index.CountUserAttributes())
 	assert.Panics(t, func() { index.EncodeItem("abc") })
 	assert.Panics(t, func() { index.EncodeUser("abc") })
 	assert.Panics(t, func() { index.EncodeItemLabel("abc") })
 	assert.Panics(t, func() { index.EncodeUserLabel("abc") })
 	assert.Panics(t, func() { index.EncodeContextLabel("abc") })
+	assert.Panics(t, func() { index.EncodeUserAttribute("abc") })
 	assert.Equal(t, int32(1), index.EncodeItem("1"))
 	assert.Equal(t, int32(2), index.EncodeUser("2"))
 	assert.Equal(t, int32(3), index.EncodeItemLabel("3"))
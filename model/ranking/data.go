@@ -25,7 +25,9 @@ import (
 	"github.com/zhenghaoz/gorse/model"
 	"go.uber.org/zap"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
 // DataSet contains preprocessed data structures for recommendation models.
@@ -36,15 +38,22 @@ type DataSet struct {
 	FeedbackItems  base.Integers
 	UserFeedback   [][]int32
 	ItemFeedback   [][]int32
+	UserValues     [][]float32 // weights of feedback aligned with UserFeedback
+	ItemValues     [][]float32 // weights of feedback aligned with ItemFeedback
+	UserTimestamps [][]int64   // timestamps (in seconds) of feedback aligned with UserFeedback
 	Negatives      [][]int32
 	ItemLabels     [][]int32
+	ItemTokens     [][]int32 // tokens in descriptions of items
 	UserLabels     [][]int32
+	UserAttributes [][]int32 // typed attributes of users, such as gender
 	HiddenItems    []bool
 	ItemCategories [][]string
 	CategorySet    *strset.Set
 	// statistics
 	NumItemLabels int32
+	NumItemTokens int32
 	NumUserLabels int32
+	NumUserAttrs  int32
 }
 
 // NewMapIndexDataset creates a data set.
@@ -57,6 +66,8 @@ func NewMapIndexDataset() *DataSet {
 	// Initialize slices
 	s.UserFeedback = make([][]int32, 0)
 	s.ItemFeedback = make([][]int32, 0)
+	s.UserValues = make([][]float32, 0)
+	s.ItemValues = make([][]float32, 0)
 	return s
 }
 
@@ -68,6 +79,8 @@ func NewDirectIndexDataset() *DataSet {
 	// Initialize slices
 	dataset.UserFeedback = make([][]int32, 0)
 	dataset.ItemFeedback = make([][]int32, 0)
+	dataset.UserValues = make([][]float32, 0)
+	dataset.ItemValues = make([][]float32, 0)
 	dataset.Negatives = make([][]int32, 0)
 	return dataset
 }
@@ -77,6 +90,7 @@ func (dataset *DataSet) AddUser(userId string) {
 	userIndex := dataset.UserIndex.ToNumber(userId)
 	for int(userIndex) >= len(dataset.UserFeedback) {
 		dataset.UserFeedback = append(dataset.UserFeedback, make([]int32, 0))
+		dataset.UserValues = append(dataset.UserValues, make([]float32, 0))
 	}
 }
 
@@ -85,10 +99,17 @@ func (dataset *DataSet) AddItem(itemId string) {
 	itemIndex := dataset.ItemIndex.ToNumber(itemId)
 	for int(itemIndex) >= len(dataset.ItemFeedback) {
 		dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int32, 0))
+		dataset.ItemValues = append(dataset.ItemValues, make([]float32, 0))
 	}
 }
 
+// AddFeedback adds a feedback with weight 1.
 func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool) {
+	dataset.AddWeightedFeedback(userId, itemId, 1, insertUserItem)
+}
+
+// AddWeightedFeedback adds a feedback with weight.
+func (dataset *DataSet) AddWeightedFeedback(userId, itemId string, value float32, insertUserItem bool) {
 	if insertUserItem {
 		dataset.UserIndex.Add(userId)
 	}
@@ -104,10 +125,35 @@ func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool)
 			dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int32, 0))
 		}
 		dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
+		for int(itemIndex) >= len(dataset.ItemValues) {
+			dataset.ItemValues = append(dataset.ItemValues, make([]float32, 0))
+		}
+		dataset.ItemValues[itemIndex] = append(dataset.ItemValues[itemIndex], value)
 		for int(userIndex) >= len(dataset.UserFeedback) {
 			dataset.UserFeedback = append(dataset.UserFeedback, make([]int32, 0))
 		}
 		dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
+		for int(userIndex) >= len(dataset.UserValues) {
+			dataset.UserValues = append(dataset.UserValues, make([]float32, 0))
+		}
+		dataset.UserValues[userIndex] = append(dataset.UserValues[userIndex], value)
+	}
+}
+
+// AddTimedFeedback adds a feedback with weight and timestamp. Zero timestamp is stored as 0.
+func (dataset *DataSet) AddTimedFeedback(userId, itemId string, value float32, timestamp time.Time, insertUserItem bool) {
+	dataset.AddWeightedFeedback(userId, itemId, value, insertUserItem)
+	var unix int64
+	if !timestamp.IsZero() {
+		unix = timestamp.Unix()
+	}
+	userIndex := dataset.UserIndex.ToNumber(userId)
+	itemIndex := dataset.ItemIndex.ToNumber(itemId)
+	if userIndex != base.NotId && itemIndex != base.NotId {
+		for int(userIndex) >= len(dataset.UserTimestamps) {
+			dataset.UserTimestamps = append(dataset.UserTimestamps, make([]int64, 0))
+		}
+		dataset.UserTimestamps[userIndex] = append(dataset.UserTimestamps[userIndex], unix)
 	}
 }
 
@@ -152,6 +198,61 @@ func createSliceOfSlice(n int) [][]int32 {
 	return x
 }
 
+func createFloatSliceOfSlice(n int) [][]float32 {
+	x := make([][]float32, n)
+	for i := range x {
+		x[i] = make([]float32, 0)
+	}
+	return x
+}
+
+func createInt64SliceOfSlice(n int) [][]int64 {
+	x := make([][]int64, n)
+	for i := range x {
+		x[i] = make([]int64, 0)
+	}
+	return x
+}
+
+// UserFeedbackValue returns the weight of the i-th feedback of a user. The weight is 1 if it is missing.
+func (dataset *DataSet) UserFeedbackValue(userIndex int32, i int) float32 {
+	if int(userIndex) < len(dataset.UserValues) && i < len(dataset.UserValues[userIndex]) {
+		return dataset.UserValues[userIndex][i]
+	}
+	return 1
+}
+
+// ItemFeedbackValue returns the weight of the i-th feedback of an item. The weight is 1 if it is missing.
+func (dataset *DataSet) ItemFeedbackValue(itemIndex int32, i int) float32 {
+	if int(itemIndex) < len(dataset.ItemValues) && i < len(dataset.ItemValues[itemIndex]) {
+		return dataset.ItemValues[itemIndex][i]
+	}
+	return 1
+}
+
+// UserFeedbackTimestamp returns the timestamp (in seconds) of the i-th feedback of a user. The timestamp is 0 if it
+// is missing.
+func (dataset *DataSet) UserFeedbackTimestamp(userIndex int32, i int) int64 {
+	if int(userIndex) < len(dataset.UserTimestamps) && i < len(dataset.UserTimestamps[userIndex]) {
+		return dataset.UserTimestamps[userIndex][i]
+	}
+	return 0
+}
+
+// appendFeedback appends a feedback with weight and timestamp to the data set. The timestamp is dropped if the data
+// set doesn't keep timestamps.
+func (dataset *DataSet) appendFeedback(userIndex, itemIndex int32, value float32, timestamp int64) {
+	dataset.FeedbackUsers.Append(userIndex)
+	dataset.FeedbackItems.Append(itemIndex)
+	dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
+	dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
+	dataset.UserValues[userIndex] = append(dataset.UserValues[userIndex], value)
+	dataset.ItemValues[itemIndex] = append(dataset.ItemValues[itemIndex], value)
+	if dataset.UserTimestamps != nil {
+		dataset.UserTimestamps[userIndex] = append(dataset.UserTimestamps[userIndex], timestamp)
+	}
+}
+
 func (dataset *DataSet) NegativeSample(excludeSet *DataSet, numCandidates int) [][]int32 {
 	if len(dataset.Negatives) == 0 {
 		rng := base.NewRandomGenerator(0)
@@ -165,37 +266,48 @@ func (dataset *DataSet) NegativeSample(excludeSet *DataSet, numCandidates int) [
 	return dataset.Negatives
 }
 
-// Split dataset by user-leave-one-out method. The argument `numTestUsers` determines the number of users in the test
-// set. If numTestUsers is equal or greater than the number of total users or numTestUsers <= 0, all users are presented
-// in the test set.
-func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet) {
+// emptySplit creates an empty training set and an empty test set sharing users, items and their features with the
+// data set.
+func (dataset *DataSet) emptySplit() (*DataSet, *DataSet) {
 	trainSet, testSet := new(DataSet), new(DataSet)
 	trainSet.NumItemLabels, testSet.NumItemLabels = dataset.NumItemLabels, dataset.NumItemLabels
+	trainSet.NumItemTokens, testSet.NumItemTokens = dataset.NumItemTokens, dataset.NumItemTokens
 	trainSet.NumUserLabels, testSet.NumUserLabels = dataset.NumUserLabels, dataset.NumUserLabels
+	trainSet.NumUserAttrs, testSet.NumUserAttrs = dataset.NumUserAttrs, dataset.NumUserAttrs
 	trainSet.HiddenItems, testSet.HiddenItems = dataset.HiddenItems, dataset.HiddenItems
 	trainSet.ItemCategories, testSet.ItemCategories = dataset.ItemCategories, dataset.ItemCategories
 	trainSet.CategorySet, testSet.CategorySet = dataset.CategorySet, dataset.CategorySet
 	trainSet.ItemLabels, testSet.ItemLabels = dataset.ItemLabels, dataset.ItemLabels
+	trainSet.ItemTokens, testSet.ItemTokens = dataset.ItemTokens, dataset.ItemTokens
 	trainSet.UserLabels, testSet.UserLabels = dataset.UserLabels, dataset.UserLabels
+	trainSet.UserAttributes, testSet.UserAttributes = dataset.UserAttributes, dataset.UserAttributes
 	trainSet.UserIndex, testSet.UserIndex = dataset.UserIndex, dataset.UserIndex
 	trainSet.ItemIndex, testSet.ItemIndex = dataset.ItemIndex, dataset.ItemIndex
 	trainSet.UserFeedback, testSet.UserFeedback = createSliceOfSlice(dataset.UserCount()), createSliceOfSlice(dataset.UserCount())
 	trainSet.ItemFeedback, testSet.ItemFeedback = createSliceOfSlice(dataset.ItemCount()), createSliceOfSlice(dataset.ItemCount())
+	trainSet.UserValues, testSet.UserValues = createFloatSliceOfSlice(dataset.UserCount()), createFloatSliceOfSlice(dataset.UserCount())
+	trainSet.ItemValues, testSet.ItemValues = createFloatSliceOfSlice(dataset.ItemCount()), createFloatSliceOfSlice(dataset.ItemCount())
+	if dataset.UserTimestamps != nil {
+		trainSet.UserTimestamps = createInt64SliceOfSlice(dataset.UserCount())
+		testSet.UserTimestamps = createInt64SliceOfSlice(dataset.UserCount())
+	}
+	return trainSet, testSet
+}
+
+// Split dataset by user-leave-one-out method. The argument `numTestUsers` determines the number of users in the test
+// set. If numTestUsers is equal or greater than the number of total users or numTestUsers <= 0, all users are presented
+// in the test set.
+func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet) {
+	trainSet, testSet := dataset.emptySplit()
 	rng := base.NewRandomGenerator(seed)
 	if numTestUsers >= dataset.UserCount() || numTestUsers <= 0 {
 		for userIndex := int32(0); userIndex < int32(dataset.UserCount()); userIndex++ {
 			if len(dataset.UserFeedback[userIndex]) > 0 {
 				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers.Append(userIndex)
-				testSet.FeedbackItems.Append(dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
+				testSet.appendFeedback(userIndex, dataset.UserFeedback[userIndex][k], dataset.UserFeedbackValue(userIndex, k), dataset.UserFeedbackTimestamp(userIndex, k))
 				for i, itemIndex := range dataset.UserFeedback[userIndex] {
 					if i != k {
-						trainSet.FeedbackUsers.Append(userIndex)
-						trainSet.FeedbackItems.Append(itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+						trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), dataset.UserFeedbackTimestamp(userIndex, i))
 					}
 				}
 			}
@@ -205,16 +317,10 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 		for _, userIndex := range testUsers {
 			if len(dataset.UserFeedback[userIndex]) > 0 {
 				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers.Append(userIndex)
-				testSet.FeedbackItems.Append(dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
+				testSet.appendFeedback(userIndex, dataset.UserFeedback[userIndex][k], dataset.UserFeedbackValue(userIndex, k), dataset.UserFeedbackTimestamp(userIndex, k))
 				for i, itemIndex := range dataset.UserFeedback[userIndex] {
 					if i != k {
-						trainSet.FeedbackUsers.Append(userIndex)
-						trainSet.FeedbackItems.Append(itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+						trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), dataset.UserFeedbackTimestamp(userIndex, i))
 					}
 				}
 			}
@@ -222,11 +328,8 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 		testUserSet := i32set.New(testUsers...)
 		for userIndex := int32(0); userIndex < int32(dataset.UserCount()); userIndex++ {
 			if !testUserSet.Has(userIndex) {
-				for _, itemIndex := range dataset.UserFeedback[userIndex] {
-					trainSet.FeedbackUsers.Append(userIndex)
-					trainSet.FeedbackItems.Append(itemIndex)
-					trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-					trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+				for i, itemIndex := range dataset.UserFeedback[userIndex] {
+					trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), dataset.UserFeedbackTimestamp(userIndex, i))
 				}
 			}
 		}
@@ -234,6 +337,48 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 	return trainSet, testSet
 }
 
+// SplitLatest splits dataset by user-leave-latest-out method. The latest numTestFeedback feedback of each user are
+// presented in the test set and the rest are presented in the training set. Feedback without timestamps are treated
+// as the oldest ones.
+func (dataset *DataSet) SplitLatest(numTestFeedback int) (*DataSet, *DataSet) {
+	trainSet, testSet := dataset.emptySplit()
+	for userIndex := int32(0); userIndex < int32(dataset.UserCount()); userIndex++ {
+		order := make([]int, len(dataset.UserFeedback[userIndex]))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return dataset.UserFeedbackTimestamp(userIndex, order[i]) < dataset.UserFeedbackTimestamp(userIndex, order[j])
+		})
+		for k, i := range order {
+			itemIndex := dataset.UserFeedback[userIndex][i]
+			if k >= len(order)-numTestFeedback {
+				testSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), dataset.UserFeedbackTimestamp(userIndex, i))
+			} else {
+				trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), dataset.UserFeedbackTimestamp(userIndex, i))
+			}
+		}
+	}
+	return trainSet, testSet
+}
+
+// SplitByTime splits dataset by a global cutoff time. Feedback at or after the cutoff time are presented in the test
+// set and the rest are presented in the training set. Feedback without timestamps are presented in the training set.
+func (dataset *DataSet) SplitByTime(cutoff time.Time) (*DataSet, *DataSet) {
+	trainSet, testSet := dataset.emptySplit()
+	for userIndex := int32(0); userIndex < int32(dataset.UserCount()); userIndex++ {
+		for i, itemIndex := range dataset.UserFeedback[userIndex] {
+			timestamp := dataset.UserFeedbackTimestamp(userIndex, i)
+			if timestamp >= cutoff.Unix() {
+				testSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), timestamp)
+			} else {
+				trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValue(userIndex, i), timestamp)
+			}
+		}
+	}
+	return trainSet, testSet
+}
+
 // GetIndex gets the i-th record by <user index, item index, rating>.
 func (dataset *DataSet) GetIndex(i int) (int32, int32) {
 	return dataset.FeedbackUsers.Get(i), dataset.FeedbackItems.Get(i)
@@ -18,6 +18,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewMapIndexDataset(t *testing.T) {
@@ -79,3 +80,84 @@ func TestDataSet_Split(t *testing.T) {
 	assert.Equal(t, numItems, test2.ItemCount())
 	assert.Equal(t, 2, test2.Count())
 }
+
+func TestDataSet_AddWeightedFeedback(t *testing.T) {
+	dataset := NewMapIndexDataset()
+	dataset.AddWeightedFeedback("user0", "item0", 3, true)
+	dataset.AddWeightedFeedback("user0", "item1", 1, true)
+	dataset.AddWeightedFeedback("user1", "item0", 2, true)
+	assert.Equal(t, 3, dataset.Count())
+	assert.Equal(t, float32(3), dataset.UserFeedbackValue(0, 0))
+	assert.Equal(t, float32(1), dataset.UserFeedbackValue(0, 1))
+	assert.Equal(t, float32(2), dataset.ItemFeedbackValue(0, 1))
+	// missing values are treated as 1
+	assert.Equal(t, float32(1), dataset.UserFeedbackValue(5, 0))
+	// values are kept after splitting
+	train, test := dataset.Split(0, 0)
+	for userIndex := int32(0); userIndex < int32(dataset.UserCount()); userIndex++ {
+		for _, set := range []*DataSet{train, test} {
+			for i, itemIndex := range set.UserFeedback[userIndex] {
+				for j, originItemIndex := range dataset.UserFeedback[userIndex] {
+					if originItemIndex == itemIndex {
+						assert.Equal(t, dataset.UserFeedbackValue(userIndex, j), set.UserFeedbackValue(userIndex, i))
+					}
+				}
+			}
+		}
+	}
+}
+
+func newTimedDataset() *DataSet {
+	dataset := NewMapIndexDataset()
+	start := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		for j := 4; j >= i; j-- {
+			dataset.AddTimedFeedback(fmt.Sprintf("user%v", i), fmt.Sprintf("item%v", j), float32(j+1),
+				start.Add(time.Duration(j)*time.Hour), true)
+		}
+	}
+	return dataset
+}
+
+func TestDataSet_SplitLatest(t *testing.T) {
+	dataset := newTimedDataset()
+	assert.Equal(t, 12, dataset.Count())
+	assert.Equal(t, time.Date(2021, 10, 1, 4, 0, 0, 0, time.UTC).Unix(), dataset.UserFeedbackTimestamp(0, 0))
+	// missing timestamps are treated as 0
+	assert.Equal(t, int64(0), dataset.UserFeedbackTimestamp(5, 0))
+	// the latest two feedback of each user are in the test set
+	train, test := dataset.SplitLatest(2)
+	assert.Equal(t, 6, train.Count())
+	assert.Equal(t, 6, test.Count())
+	for userIndex := int32(0); userIndex < 3; userIndex++ {
+		assert.ElementsMatch(t, []int32{
+			dataset.ItemIndex.ToNumber("item3"),
+			dataset.ItemIndex.ToNumber("item4"),
+		}, test.UserFeedback[userIndex])
+		// weights and timestamps are kept after splitting
+		for i := range test.UserFeedback[userIndex] {
+			hour := int(test.UserFeedbackValue(userIndex, i)) - 1
+			assert.Equal(t, time.Date(2021, 10, 1, hour, 0, 0, 0, time.UTC).Unix(), test.UserFeedbackTimestamp(userIndex, i))
+		}
+	}
+	// all feedback of a user are in the test set if the user has too few feedback
+	train, test = dataset.SplitLatest(4)
+	assert.Equal(t, 1, train.Count())
+	assert.Equal(t, 11, test.Count())
+}
+
+func TestDataSet_SplitByTime(t *testing.T) {
+	dataset := newTimedDataset()
+	dataset.AddFeedback("user0", "item0", false)
+	train, test := dataset.SplitByTime(time.Date(2021, 10, 1, 3, 0, 0, 0, time.UTC))
+	assert.Equal(t, 7, train.Count())
+	assert.Equal(t, 6, test.Count())
+	for userIndex := int32(0); userIndex < 3; userIndex++ {
+		for i := range test.UserFeedback[userIndex] {
+			assert.GreaterOrEqual(t, test.UserFeedbackTimestamp(userIndex, i), time.Date(2021, 10, 1, 3, 0, 0, 0, time.UTC).Unix())
+		}
+		for i := range train.UserFeedback[userIndex] {
+			assert.Less(t, train.UserFeedbackTimestamp(userIndex, i), time.Date(2021, 10, 1, 3, 0, 0, 0, time.UTC).Unix())
+		}
+	}
+}
@@ -112,6 +112,41 @@ type MatrixFactorization interface {
 	Unmarshal(r io.Reader) error
 }
 
+// FoldIn computes the latent factor of a user from items the user interacted with while latent factors of items are
+// fixed. The user factor minimizes the regularized squared error between predictions and ones:
+//   p_u = (Q^T Q + reg * I)^{-1} Q^T 1
+// where Q consists of latent factors of the items. It returns nil if there is no item.
+func FoldIn(m Model, itemIndices []int32, reg float32) []float32 {
+	if len(itemIndices) == 0 {
+		return nil
+	}
+	nFactors := len(m.GetItemFactor(itemIndices[0]))
+	a := mat.NewDense(nFactors, nFactors, nil)
+	b := mat.NewVecDense(nFactors, nil)
+	for _, itemIndex := range itemIndices {
+		factor := m.GetItemFactor(itemIndex)
+		for i := 0; i < nFactors; i++ {
+			for j := 0; j < nFactors; j++ {
+				a.Set(i, j, a.At(i, j)+float64(factor[i]*factor[j]))
+			}
+			b.SetVec(i, b.AtVec(i)+float64(factor[i]))
+		}
+	}
+	for i := 0; i < nFactors; i++ {
+		a.Set(i, i, a.At(i, i)+float64(reg))
+	}
+	var x mat.VecDense
+	if err := x.SolveVec(a, b); err != nil {
+		base.Logger().Warn("failed to fold in user factor", zap.Error(err))
+		return nil
+	}
+	userFactor := make([]float32, nFactors)
+	for i := range userFactor {
+		userFactor[i] = float32(x.AtVec(i))
+	}
+	return userFactor
+}
+
 type BaseMatrixFactorization struct {
 	model.BaseModel
 	UserIndex       base.Index
@@ -249,6 +284,19 @@ func GetModelName(m Model) string {
 	}
 }
 
+// NewModel creates a ranking model by name. It returns nil if the name is unknown.
+func NewModel(name string, params model.Params) Model {
+	switch name {
+	case CollaborativeBPR:
+		return NewBPR(params)
+	case CollaborativeALS:
+		return NewALS(params)
+	case CollaborativeCCD:
+		return NewCCD(params)
+	}
+	return nil
+}
+
 func MarshalModel(w io.Writer, m Model) error {
 	if err := base.WriteString(w, GetModelName(m)); err != nil {
 		return errors.Trace(err)
@@ -619,13 +667,22 @@ func NewALS(params model.Params) *ALS {
 }
 
 // GetUserFactor returns the user latent factors.
-func (als *ALS) GetUserFactor(_ int32) []float32 {
-	panic("not implemented")
+func (als *ALS) GetUserFactor(userIndex int32) []float32 {
+	return denseRow(als.UserFactor, userIndex)
 }
 
 // GetItemFactor returns the item latent factors.
-func (als *ALS) GetItemFactor(_ int32) []float32 {
-	panic("not implemented")
+func (als *ALS) GetItemFactor(itemIndex int32) []float32 {
+	return denseRow(als.ItemFactor, itemIndex)
+}
+
+func denseRow(m *mat.Dense, i int32) []float32 {
+	_, c := m.Dims()
+	row := make([]float32, c)
+	for j := range row {
+		row[j] = float32(m.At(int(i), j))
+	}
+	return row
 }
 
 // SetParams sets hyper-parameters for the ALS model.
@@ -726,12 +783,14 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		err := base.Parallel(trainSet.UserCount(), config.Jobs, func(workerId, userIndex int) error {
 			a[workerId].Copy(c)
 			b := mat.NewVecDense(als.nFactors, nil)
-			for _, itemIndex := range trainSet.UserFeedback[userIndex] {
+			for i, itemIndex := range trainSet.UserFeedback[userIndex] {
+				// confidence of observed feedback is weighted by feedback value
+				value := float64(trainSet.UserFeedbackValue(int32(userIndex), i))
 				// Y^T (C^u-I) Y
-				temp1[workerId].Outer(1, als.ItemFactor.RowView(int(itemIndex)), als.ItemFactor.RowView(int(itemIndex)))
+				temp1[workerId].Outer(value, als.ItemFactor.RowView(int(itemIndex)), als.ItemFactor.RowView(int(itemIndex)))
 				a[workerId].Add(a[workerId], temp1[workerId])
 				// Y^T C^u p(u)
-				temp2[workerId].ScaleVec(1+als.weight, als.ItemFactor.RowView(int(itemIndex)))
+				temp2[workerId].ScaleVec(value+als.weight, als.ItemFactor.RowView(int(itemIndex)))
 				b.AddVec(b, temp2[workerId])
 			}
 			a[workerId].Add(a[workerId], regI)
@@ -750,12 +809,14 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		err = base.Parallel(trainSet.ItemCount(), config.Jobs, func(workerId, itemIndex int) error {
 			a[workerId].Copy(c)
 			b := mat.NewVecDense(als.nFactors, nil)
-			for _, index := range trainSet.ItemFeedback[itemIndex] {
+			for i, index := range trainSet.ItemFeedback[itemIndex] {
+				// confidence of observed feedback is weighted by feedback value
+				value := float64(trainSet.ItemFeedbackValue(int32(itemIndex), i))
 				// X^T (C^i-I) X
-				temp1[workerId].Outer(1, als.UserFactor.RowView(int(index)), als.UserFactor.RowView(int(index)))
+				temp1[workerId].Outer(value, als.UserFactor.RowView(int(index)), als.UserFactor.RowView(int(index)))
 				a[workerId].Add(a[workerId], temp1[workerId])
 				// X^T C^i p(i)
-				temp2[workerId].ScaleVec(1+als.weight, als.UserFactor.RowView(int(index)))
+				temp2[workerId].ScaleVec(value+als.weight, als.UserFactor.RowView(int(index)))
 				b.AddVec(b, temp2[workerId])
 			}
 			a[workerId].Add(a[workerId], regI)
@@ -235,3 +235,27 @@ func TestCCD_MovieLens(t *testing.T) {
 //	score := m.Fit(trainSet, testSet, fitConfig)
 //	assertEpsilon(t, 0.52, score.NDCG, benchDelta)
 //}
+
+func TestNewModel(t *testing.T) {
+	params := model.Params{model.NFactors: 4}
+	for _, name := range []string{CollaborativeBPR, CollaborativeALS, CollaborativeCCD} {
+		m := NewModel(name, params)
+		assert.Equal(t, name, GetModelName(m))
+		assert.Equal(t, params, m.GetParams())
+		assert.True(t, m.Invalid())
+	}
+	assert.Nil(t, NewModel("unknown", params))
+}
+
+func TestFoldIn(t *testing.T) {
+	m := NewBPR(nil)
+	m.ItemFactor = [][]float32{{1, 0}, {0, 1}, {1, 1}}
+	assert.Nil(t, FoldIn(m, nil, 0.01))
+	userFactor := FoldIn(m, []int32{0}, 0.01)
+	assert.InDeltaSlice(t, []float32{1 / 1.01, 0}, userFactor, 1e-5)
+	userFactor = FoldIn(m, []int32{0, 1}, 0.01)
+	assert.InDeltaSlice(t, []float32{1 / 1.01, 1 / 1.01}, userFactor, 1e-5)
+	// items interacted by the user are preferred
+	userFactor = FoldIn(m, []int32{0, 2}, 0.01)
+	assert.Greater(t, userFactor[0], userFactor[1])
+}
@@ -138,6 +138,45 @@ func RandomSearchCV(estimator MatrixFactorization, trainSet *DataSet, testSet *D
 	return results
 }
 
+// BayesianSearchCV searches hyper-parameters by the tree-structured Parzen estimator. Hyper-parameters of each trial
+// are proposed from the results of previous trials.
+func BayesianSearchCV(estimator MatrixFactorization, trainSet *DataSet, testSet *DataSet, space model.ParamsSpace,
+	numTrials int, seed int64, fitConfig *FitConfig, runner model.Runner) ParamsSearchResult {
+	// if there is no continuous range and the number of combination is less than number of trials, use grid search
+	if len(space.Ranges) == 0 && space.Grid.NumCombinations() < numTrials {
+		return GridSearchCV(estimator, trainSet, testSet, space.Grid, seed, fitConfig, runner)
+	}
+	tpe := model.NewTPE(space, seed)
+	results := ParamsSearchResult{
+		Scores: make([]Score, 0, numTrials),
+		Params: make([]model.Params, 0, numTrials),
+	}
+	for i := 1; i <= numTrials; i++ {
+		// Make parameters
+		params := tpe.Suggest()
+		// Cross validate
+		base.Logger().Info(fmt.Sprintf("bayesian search (%v/%v)", i, numTrials),
+			zap.Any("params", params))
+		estimator.Clear()
+		estimator.SetParams(estimator.GetParams().Overwrite(params))
+		fitConfig.Tracker.Suspend(true)
+		runner.Lock()
+		fitConfig.Tracker.Suspend(false)
+		score := estimator.Fit(trainSet, testSet, fitConfig)
+		runner.UnLock()
+		tpe.Observe(params, float64(score.NDCG))
+		results.Scores = append(results.Scores, score)
+		results.Params = append(results.Params, params.Copy())
+		if len(results.Scores) == 0 || score.NDCG > results.BestScore.NDCG {
+			results.BestModel = Clone(estimator)
+			results.BestScore = score
+			results.BestParams = params.Copy()
+			results.BestIndex = len(results.Params) - 1
+		}
+	}
+	return results
+}
+
 // ModelSearcher is a thread-safe personal ranking model searcher.
 type ModelSearcher struct {
 	models []MatrixFactorization
@@ -145,6 +184,7 @@ type ModelSearcher struct {
 	numEpochs int
 	numTrials int
 	numJobs   int
+	strategy  string
 	// results
 	bestMutex     sync.Mutex
 	bestModelName string
@@ -152,12 +192,14 @@ type ModelSearcher struct {
 	bestScore     Score
 }
 
-// NewModelSearcher creates a thread-safe personal ranking model searcher.
-func NewModelSearcher(nEpoch, nTrials, nJobs int) *ModelSearcher {
+// NewModelSearcher creates a thread-safe personal ranking model searcher. Hyper-parameters are searched randomly
+// unless the strategy is model.BayesianSearch.
+func NewModelSearcher(nEpoch, nTrials, nJobs int, strategy string) *ModelSearcher {
 	searcher := &ModelSearcher{
 		numTrials: nTrials,
 		numEpochs: nEpoch,
 		numJobs:   nJobs,
+		strategy:  strategy,
 	}
 	searcher.models = append(searcher.models, NewBPR(model.Params{model.NEpochs: searcher.numEpochs}))
 	searcher.models = append(searcher.models, NewCCD(model.Params{model.NEpochs: searcher.numEpochs}))
@@ -181,10 +223,15 @@ func (searcher *ModelSearcher) Fit(trainSet, valSet *DataSet, tracker model.Trac
 	startTime := time.Now()
 	tracker.Start(len(searcher.models) * searcher.numEpochs * searcher.numTrials)
 	for _, m := range searcher.models {
-		r := RandomSearchCV(m, trainSet, valSet, m.GetParamsGrid(), searcher.numTrials, 0,
-			NewFitConfig().
-				SetJobs(searcher.numJobs).
-				SetTracker(tracker.SubTracker()), runner)
+		fitConfig := NewFitConfig().
+			SetJobs(searcher.numJobs).
+			SetTracker(tracker.SubTracker())
+		var r ParamsSearchResult
+		if searcher.strategy == model.BayesianSearch {
+			r = BayesianSearchCV(m, trainSet, valSet, model.NewParamsSpace(m.GetParamsGrid()), searcher.numTrials, 0, fitConfig, runner)
+		} else {
+			r = RandomSearchCV(m, trainSet, valSet, m.GetParamsGrid(), searcher.numTrials, 0, fitConfig, runner)
+		}
 		searcher.bestMutex.Lock()
 		if searcher.bestModel == nil || r.BestScore.NDCG > searcher.bestScore.NDCG {
 			searcher.bestModel = r.BestModel
@@ -150,6 +150,30 @@ func TestRandomSearchCV(t *testing.T) {
 	}, r.BestParams)
 }
 
+func TestBayesianSearchCV(t *testing.T) {
+	m := &mockMatrixFactorizationForSearch{}
+	fitConfig, tracker := newFitConfigForSearch()
+	runner := new(mockRunner)
+	runner.On("Lock")
+	runner.On("UnLock")
+	space := model.ParamsSpace{
+		Grid:   model.ParamsGrid{model.NFactors: []interface{}{1, 2, 3, 4}},
+		Ranges: map[model.ParamName]model.ParamsRange{model.InitStdDev: {Low: 1, High: 4}},
+	}
+	r := BayesianSearchCV(m, nil, nil, space, 30, 0, fitConfig, runner)
+	tracker.AssertExpectations(t)
+	runner.AssertCalled(t, "Lock")
+	runner.AssertCalled(t, "UnLock")
+	assert.Equal(t, 30, len(r.Scores))
+	assert.Equal(t, 4, r.BestParams[model.NFactors])
+	assert.GreaterOrEqual(t, r.BestParams.GetFloat32(model.InitStdDev, 0), float32(3.5))
+	assert.GreaterOrEqual(t, r.BestScore.NDCG, float32(7.5))
+	// use grid search if there are less combinations than trials
+	r = BayesianSearchCV(m, nil, nil, model.NewParamsSpace(m.GetParamsGrid()), 65, 0, fitConfig, runner)
+	assert.Equal(t, 64, len(r.Scores))
+	assert.Equal(t, float32(12), r.BestScore.NDCG)
+}
+
 func TestModelSearcher(t *testing.T) {
 	tracker := new(mockTracker)
 	tracker.On("Start", 63*2)
@@ -158,7 +182,28 @@ func TestModelSearcher(t *testing.T) {
 	runner := new(mockRunner)
 	runner.On("Lock")
 	runner.On("UnLock")
-	searcher := NewModelSearcher(2, 63, 1)
+	searcher := NewModelSearcher(2, 63, 1, model.RandomSearch)
+	searcher.models = []MatrixFactorization{&mockMatrixFactorizationForSearch{}}
+	err := searcher.Fit(NewMapIndexDataset(), NewMapIndexDataset(), tracker, runner)
+	assert.NoError(t, err)
+	_, m, score := searcher.GetBestModel()
+	assert.Equal(t, float32(12), score.NDCG)
+	assert.Equal(t, model.Params{
+		model.NFactors:   4,
+		model.InitMean:   4,
+		model.InitStdDev: 4,
+	}, m.GetParams())
+}
+
+func TestModelSearcher_Bayesian(t *testing.T) {
+	tracker := new(mockTracker)
+	tracker.On("Start", 63*2)
+	tracker.On("SubTracker")
+	tracker.On("Finish")
+	runner := new(mockRunner)
+	runner.On("Lock")
+	runner.On("UnLock")
+	searcher := NewModelSearcher(2, 63, 1, model.BayesianSearch)
 	searcher.models = []MatrixFactorization{&mockMatrixFactorizationForSearch{}}
 	err := searcher.Fit(NewMapIndexDataset(), NewMapIndexDataset(), tracker, runner)
 	assert.NoError(t, err)
@@ -0,0 +1,309 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/zhenghaoz/gorse/base"
+	"math"
+	"sort"
+)
+
+// Strategies of hyper-parameter searching.
+const (
+	RandomSearch   = "random"
+	BayesianSearch = "bayesian"
+)
+
+// continuousParams are hyper-parameters could be searched in continuous ranges.
+var continuousParams = map[ParamName]struct{}{
+	Lr:         {},
+	Reg:        {},
+	InitStdDev: {},
+	Alpha:      {},
+}
+
+// ParamsRange is a continuous range of a hyper-parameter. Values are sampled in log scale if Log is true.
+type ParamsRange struct {
+	Low  float64
+	High float64
+	Log  bool
+}
+
+// transform maps a value to the space where values are sampled.
+func (r ParamsRange) transform(x float64) float64 {
+	if r.Log {
+		return math.Log(x)
+	}
+	return x
+}
+
+// inverse maps a value from the space where values are sampled.
+func (r ParamsRange) inverse(z float64) float64 {
+	if r.Log {
+		return math.Exp(z)
+	}
+	return z
+}
+
+// ParamsSpace is the search space of hyper-parameters. A hyper-parameter is searched in a continuous range if it
+// exists in Ranges, otherwise it is searched in the grid.
+type ParamsSpace struct {
+	Grid   ParamsGrid
+	Ranges map[ParamName]ParamsRange
+}
+
+// NewParamsSpace creates a search space from a grid. Learning rate, regularization strength, standard deviation of
+// initialization and weight of positive feedback are searched in continuous ranges in log scale, which are bounded by
+// the minimal and maximal positive candidates in the grid. Other hyper-parameters are searched in the grid.
+func NewParamsSpace(grid ParamsGrid) ParamsSpace {
+	space := ParamsSpace{
+		Grid:   make(ParamsGrid),
+		Ranges: make(map[ParamName]ParamsRange),
+	}
+	for name, values := range grid {
+		if _, exist := continuousParams[name]; exist {
+			if low, high, ok := floatBounds(values); ok && low > 0 && low < high {
+				space.Ranges[name] = ParamsRange{Low: low, High: high, Log: true}
+				continue
+			}
+		}
+		space.Grid[name] = values
+	}
+	return space
+}
+
+// floatBounds returns the minimum and the maximum of numbers. It fails if there is any non-numeric value.
+func floatBounds(values []interface{}) (low, high float64, ok bool) {
+	low, high = math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		var x float64
+		switch value := value.(type) {
+		case float32:
+			x = float64(value)
+		case float64:
+			x = value
+		case int:
+			x = float64(value)
+		default:
+			return 0, 0, false
+		}
+		low, high = math.Min(low, x), math.Max(high, x)
+	}
+	return low, high, len(values) > 0
+}
+
+// TPE proposes hyper-parameters by the tree-structured Parzen estimator. Previous trials are divided into good trials
+// and bad trials by their scores. Candidates are sampled from the density of good trials and the candidate maximizing
+// the ratio between the density of good trials and the density of bad trials is proposed. Hyper-parameters are
+// proposed randomly until there are enough trials.
+type TPE struct {
+	space         ParamsSpace
+	names         []ParamName
+	numStartup    int     // number of random trials at the beginning
+	numCandidates int     // number of candidates sampled for each hyper-parameter
+	gamma         float64 // fraction of good trials
+	rng           base.RandomGenerator
+	trials        []Params
+	scores        []float64
+}
+
+// NewTPE creates a tree-structured Parzen estimator for a search space.
+func NewTPE(space ParamsSpace, seed int64) *TPE {
+	tpe := &TPE{
+		space:         space,
+		numStartup:    3,
+		numCandidates: 24,
+		gamma:         0.25,
+		rng:           base.NewRandomGenerator(seed),
+	}
+	// iterate hyper-parameters in fixed order to make proposals reproducible
+	for name := range space.Grid {
+		tpe.names = append(tpe.names, name)
+	}
+	for name := range space.Ranges {
+		tpe.names = append(tpe.names, name)
+	}
+	sort.Slice(tpe.names, func(i, j int) bool {
+		return tpe.names[i] < tpe.names[j]
+	})
+	return tpe
+}
+
+// Observe records the score of a trial. Higher score is better and NaN is the worst.
+func (tpe *TPE) Observe(params Params, score float64) {
+	if math.IsNaN(score) {
+		score = math.Inf(-1)
+	}
+	tpe.trials = append(tpe.trials, params.Copy())
+	tpe.scores = append(tpe.scores, score)
+}
+
+// Suggest proposes hyper-parameters for next trial.
+func (tpe *TPE) Suggest() Params {
+	params := make(Params)
+	if len(tpe.trials) < tpe.numStartup {
+		for _, name := range tpe.names {
+			if r, exist := tpe.space.Ranges[name]; exist {
+				low, high := r.transform(r.Low), r.transform(r.High)
+				params[name] = r.inverse(low + tpe.rng.Float64()*(high-low))
+			} else {
+				values := tpe.space.Grid[name]
+				params[name] = values[tpe.rng.Intn(len(values))]
+			}
+		}
+		return params
+	}
+	// divide trials into good trials and bad trials
+	order := make([]int, len(tpe.trials))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return tpe.scores[order[i]] > tpe.scores[order[j]]
+	})
+	numGood := int(math.Ceil(tpe.gamma * float64(len(order))))
+	good, bad := order[:numGood], order[numGood:]
+	for _, name := range tpe.names {
+		if r, exist := tpe.space.Ranges[name]; exist {
+			params[name] = tpe.suggestContinuous(name, r, good, bad)
+		} else {
+			params[name] = tpe.suggestCategorical(name, tpe.space.Grid[name], good, bad)
+		}
+	}
+	return params
+}
+
+func (tpe *TPE) suggestContinuous(name ParamName, r ParamsRange, good, bad []int) float64 {
+	low, high := r.transform(r.Low), r.transform(r.High)
+	observe := func(trials []int) []float64 {
+		x := make([]float64, 0, len(trials))
+		for _, i := range trials {
+			x = append(x, r.transform(float64(tpe.trials[i].GetFloat32(name, float32(r.Low)))))
+		}
+		return x
+	}
+	l := newParzenEstimator(observe(good), low, high)
+	g := newParzenEstimator(observe(bad), low, high)
+	best, bestRatio := 0.0, math.Inf(-1)
+	for i := 0; i < tpe.numCandidates; i++ {
+		z := l.sample(tpe.rng)
+		if ratio := l.logPdf(z) - g.logPdf(z); ratio > bestRatio {
+			best, bestRatio = z, ratio
+		}
+	}
+	return r.inverse(best)
+}
+
+func (tpe *TPE) suggestCategorical(name ParamName, values []interface{}, good, bad []int) interface{} {
+	// densities with a uniform prior
+	density := func(trials []int) []float64 {
+		weights := make([]float64, len(values))
+		for i := range weights {
+			weights[i] = 1 / float64(len(trials)+len(values))
+		}
+		for _, i := range trials {
+			for j, value := range values {
+				if tpe.trials[i][name] == value {
+					weights[j] += 1 / float64(len(trials)+len(values))
+				}
+			}
+		}
+		return weights
+	}
+	l, g := density(good), density(bad)
+	best, bestRatio := 0, math.Inf(-1)
+	for i := 0; i < tpe.numCandidates; i++ {
+		// sample a candidate from the density of good trials
+		j, p := 0, tpe.rng.Float64()
+		for j < len(l)-1 && p >= l[j] {
+			p -= l[j]
+			j++
+		}
+		if ratio := l[j] / g[j]; ratio > bestRatio {
+			best, bestRatio = j, ratio
+		}
+	}
+	return values[best]
+}
+
+// parzenEstimator is a mixture of truncated Gaussian distributions centered at observations. A prior component
+// covering the whole range is included.
+type parzenEstimator struct {
+	mus    []float64
+	sigmas []float64
+	low    float64
+	high   float64
+}
+
+func newParzenEstimator(observations []float64, low, high float64) parzenEstimator {
+	sorted := append([]float64{}, observations...)
+	sort.Float64s(sorted)
+	estimator := parzenEstimator{
+		mus:    []float64{(low + high) / 2},
+		sigmas: []float64{high - low},
+		low:    low,
+		high:   high,
+	}
+	// the bandwidth of a component is the distance to the farther neighbor
+	minSigma := (high - low) / math.Min(100, float64(len(sorted)+1))
+	for i, mu := range sorted {
+		left, right := low, high
+		if i > 0 {
+			left = sorted[i-1]
+		}
+		if i+1 < len(sorted) {
+			right = sorted[i+1]
+		}
+		sigma := math.Max(mu-left, right-mu)
+		sigma = math.Max(minSigma, math.Min(high-low, sigma))
+		estimator.mus = append(estimator.mus, mu)
+		estimator.sigmas = append(estimator.sigmas, sigma)
+	}
+	return estimator
+}
+
+// sample draws a value from a random component. Values out of the range are redrawn.
+func (estimator parzenEstimator) sample(rng base.RandomGenerator) float64 {
+	k := rng.Intn(len(estimator.mus))
+	for i := 0; i < 100; i++ {
+		z := estimator.mus[k] + estimator.sigmas[k]*rng.NormFloat64()
+		if z >= estimator.low && z <= estimator.high {
+			return z
+		}
+	}
+	return math.Max(estimator.low, math.Min(estimator.high, estimator.mus[k]))
+}
+
+// logPdf returns the logarithm of the density at a value.
+func (estimator parzenEstimator) logPdf(z float64) float64 {
+	logs := make([]float64, len(estimator.mus))
+	maxLog := math.Inf(-1)
+	for i, mu := range estimator.mus {
+		sigma := estimator.sigmas[i]
+		// normalize the truncated Gaussian distribution by the probability mass in the range
+		mass := normalCdf((estimator.high-mu)/sigma) - normalCdf((estimator.low-mu)/sigma)
+		logs[i] = -0.5*math.Pow((z-mu)/sigma, 2) - math.Log(sigma*math.Sqrt(2*math.Pi)*mass)
+		maxLog = math.Max(maxLog, logs[i])
+	}
+	var sum float64
+	for _, x := range logs {
+		sum += math.Exp(x - maxLog)
+	}
+	return maxLog + math.Log(sum/float64(len(logs)))
+}
+
+func normalCdf(x float64) float64 {
+	return 0.5 * (1 + math.Erf(x/math.Sqrt2))
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestNewParamsSpace(t *testing.T) {
+	space := NewParamsSpace(ParamsGrid{
+		NFactors:   []interface{}{8, 16, 32},
+		Lr:         []interface{}{0.001, 0.01, 0.1},
+		Reg:        []interface{}{0.01},
+		InitMean:   []interface{}{0},
+		InitStdDev: []interface{}{0, 0.1},
+		Alpha:      []interface{}{0.5, float32(2)},
+	})
+	assert.Equal(t, ParamsGrid{
+		NFactors:   []interface{}{8, 16, 32},
+		Reg:        []interface{}{0.01},
+		InitMean:   []interface{}{0},
+		InitStdDev: []interface{}{0, 0.1},
+	}, space.Grid)
+	assert.Equal(t, map[ParamName]ParamsRange{
+		Lr:    {Low: 0.001, High: 0.1, Log: true},
+		Alpha: {Low: 0.5, High: 2, Log: true},
+	}, space.Ranges)
+}
+
+func TestTPE(t *testing.T) {
+	space := ParamsSpace{
+		Grid:   ParamsGrid{NFactors: []interface{}{8, 16, 32, 64}},
+		Ranges: map[ParamName]ParamsRange{Lr: {Low: 0.0001, High: 1, Log: true}},
+	}
+	// the optimal learning rate is 0.01 and the optimal number of factors is 32
+	objective := func(params Params) float64 {
+		lr := float64(params.GetFloat32(Lr, 0))
+		return -math.Pow(math.Log10(lr)+2, 2) - math.Abs(float64(params.GetInt(NFactors, 0)-32))
+	}
+	tpe := NewTPE(space, 0)
+	var scores []float64
+	for i := 0; i < 50; i++ {
+		params := tpe.Suggest()
+		assert.GreaterOrEqual(t, params.GetFloat32(Lr, 0), float32(0.0001))
+		assert.LessOrEqual(t, params.GetFloat32(Lr, 0), float32(1))
+		assert.Contains(t, space.Grid[NFactors], params[NFactors])
+		score := objective(params)
+		tpe.Observe(params, score)
+		scores = append(scores, score)
+	}
+	// later proposals are better than random proposals at the beginning
+	var early, late float64
+	for i := 0; i < 10; i++ {
+		early += scores[i] / 10
+		late += scores[len(scores)-10+i] / 10
+	}
+	assert.Greater(t, late, early)
+	assert.Greater(t, late, -0.5)
+
+	// NaN scores are the worst
+	tpe.Observe(Params{NFactors: 32, Lr: 0.01}, math.NaN())
+	assert.True(t, math.IsInf(tpe.scores[len(tpe.scores)-1], -1))
+}
@@ -25,6 +25,16 @@ var (
 		Subsystem: "server",
 		Name:      "get_recommend_seconds",
 	})
+	GetBatchRecommendSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "get_batch_recommend_seconds",
+	})
+	GetSessionRecommendSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "get_session_recommend_seconds",
+	})
 	LoadCTRRecommendCacheSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "gorse",
 		Subsystem: "server",
@@ -45,6 +55,16 @@ var (
 		Subsystem: "server",
 		Name:      "user_based_recommend_seconds",
 	})
+	CollaborativeOnlineRecommendSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "collaborative_online_recommend_seconds",
+	})
+	LoadSubscribeRecommendCacheSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "load_subscribe_recommend_cache_seconds",
+	})
 	LoadLatestRecommendCacheSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "gorse",
 		Subsystem: "server",
@@ -55,4 +75,19 @@ var (
 		Subsystem: "server",
 		Name:      "load_popular_recommend_cache_seconds",
 	})
+	RankByContextSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "rank_by_context_seconds",
+	})
+	RankSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "rank_seconds",
+	})
+	APIKeyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gorse",
+		Subsystem: "server",
+		Name:      "api_key_requests_total",
+	}, []string{"key", "result"})
 )
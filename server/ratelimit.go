@@ -0,0 +1,58 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of requests. The bucket is refilled by rate tokens per second and holds burst tokens
+// at most. Each request takes a token from the bucket and it is rejected if the bucket is empty.
+type tokenBucket struct {
+	mutex    sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastTime time.Time
+}
+
+// newTokenBucket creates a full token bucket. The burst is the same as the rate if it is not positive.
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Allow takes a token from the bucket at the given time. It returns false if there is no token.
+func (b *tokenBucket) Allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if now.After(b.lastTime) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.lastTime).Seconds()*b.rate)
+		b.lastTime = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(2, 3)
+	// burst
+	assert.True(t, bucket.Allow(now))
+	assert.True(t, bucket.Allow(now))
+	assert.True(t, bucket.Allow(now))
+	assert.False(t, bucket.Allow(now))
+	// refill
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, bucket.Allow(now))
+	assert.False(t, bucket.Allow(now))
+	// refill up to burst
+	now = now.Add(time.Minute)
+	assert.True(t, bucket.Allow(now))
+	assert.True(t, bucket.Allow(now))
+	assert.True(t, bucket.Allow(now))
+	assert.False(t, bucket.Allow(now))
+	// burst is the same as rate by default
+	bucket = newTokenBucket(1, 0)
+	assert.True(t, bucket.Allow(now))
+	assert.False(t, bucket.Allow(now))
+}
@@ -15,25 +15,34 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/araddon/dateparse"
 	"github.com/chewxy/math32"
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
+	"github.com/google/uuid"
 	"github.com/juju/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/scylladb/go-set"
 	"github.com/scylladb/go-set/strset"
 	"github.com/thoas/go-funk"
 	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/base/floats"
 	"github.com/zhenghaoz/gorse/base/heap"
+	"github.com/zhenghaoz/gorse/base/search"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/click"
+	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
 	"modernc.org/mathutil"
 	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -46,6 +55,76 @@ type RestServer struct {
 	HttpPort    int
 	IsDashboard bool
 	WebService  *restful.WebService
+
+	clickModel      click.FactorizationMachine
+	clickModelMutex sync.RWMutex
+
+	rankingModel      ranking.MatrixFactorization
+	rankingIndex      *search.HNSW
+	rankingModelMutex sync.RWMutex
+
+	rateLimiters      map[string]*tokenBucket
+	rateLimitersMutex sync.Mutex
+
+	rules      []data.Rule
+	rulesTime  time.Time
+	rulesMutex sync.Mutex
+}
+
+// getRateLimiter returns the token bucket of an API key. The bucket is recreated if the limit of the key changes.
+func (s *RestServer) getRateLimiter(key config.APIKey) *tokenBucket {
+	s.rateLimitersMutex.Lock()
+	defer s.rateLimitersMutex.Unlock()
+	if s.rateLimiters == nil {
+		s.rateLimiters = make(map[string]*tokenBucket)
+	}
+	bucket := newTokenBucket(key.RateLimit, key.Burst)
+	if limiter, exist := s.rateLimiters[key.Name]; exist && limiter.rate == bucket.rate && limiter.burst == bucket.burst {
+		return limiter
+	}
+	s.rateLimiters[key.Name] = bucket
+	return bucket
+}
+
+// SetClickModel sets the click model used by context-aware ranking.
+func (s *RestServer) SetClickModel(clickModel click.FactorizationMachine) {
+	s.clickModelMutex.Lock()
+	defer s.clickModelMutex.Unlock()
+	s.clickModel = clickModel
+}
+
+// getClickModel returns the click model used by context-aware ranking.
+func (s *RestServer) getClickModel() click.FactorizationMachine {
+	s.clickModelMutex.RLock()
+	defer s.clickModelMutex.RUnlock()
+	return s.clickModel
+}
+
+// SetRankingModel sets the ranking model used by online collaborative filtering recommendation. An index of item
+// factors is built if the collaborative filtering index is enabled.
+func (s *RestServer) SetRankingModel(rankingModel ranking.MatrixFactorization) {
+	var rankingIndex *search.HNSW
+	if s.GorseConfig.Recommend.EnableColIndex {
+		vectors := make([]search.Vector, rankingModel.GetItemIndex().Len())
+		for i := range vectors {
+			itemIndex := int32(i)
+			vectors[i] = search.NewDenseVector(rankingModel.GetItemFactor(itemIndex), nil, !rankingModel.IsItemPredictable(itemIndex))
+		}
+		rankingIndex = search.NewHNSW(vectors)
+		rankingIndex.Build()
+	}
+	s.rankingModelMutex.Lock()
+	defer s.rankingModelMutex.Unlock()
+	s.rankingModel = rankingModel
+	s.rankingIndex = rankingIndex
+}
+
+// getRankingModel returns the ranking model and the index of item factors used by online collaborative filtering
+// recommendation.
+func (s *RestServer) getRankingModel() (ranking.MatrixFactorization, *search.HNSW) {
+	s.rankingModelMutex.RLock()
+	defer s.rankingModelMutex.RUnlock()
+	return s.rankingModel, s.rankingIndex
 }
 
 // StartHttpServer starts the REST-ful API server.
@@ -79,16 +158,59 @@ func LogFilter(req *restful.Request, resp *restful.Response, chain *restful.Filt
 	}
 }
 
+// KeyScope is the key of route metadata overriding the scope of a route. Otherwise, the scope of a route is read for
+// GET, delete for DELETE and write for other methods.
+const KeyScope = "gorse.scope"
+
+// requestScope returns the scope required by a request.
+func requestScope(req *restful.Request) string {
+	if route := req.SelectedRoute(); route != nil {
+		if scope, ok := route.Metadata()[KeyScope].(string); ok {
+			return scope
+		}
+	}
+	switch req.Request.Method {
+	case http.MethodGet:
+		return config.ScopeRead
+	case http.MethodDelete:
+		return config.ScopeDelete
+	default:
+		return config.ScopeWrite
+	}
+}
+
 func (s *RestServer) AuthFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
-	if s.IsDashboard || s.GorseConfig.Server.APIKey == "" {
+	if s.IsDashboard || (s.GorseConfig.Server.APIKey == "" && len(s.GorseConfig.Server.APIKeys) == 0) {
 		chain.ProcessFilter(req, resp)
 		return
 	}
 	apikey := req.HeaderParameter("X-API-Key")
-	if apikey == s.GorseConfig.Server.APIKey {
+	if s.GorseConfig.Server.APIKey != "" && apikey == s.GorseConfig.Server.APIKey {
 		chain.ProcessFilter(req, resp)
 		return
 	}
+	for _, key := range s.GorseConfig.Server.APIKeys {
+		if apikey == key.Key {
+			scope := requestScope(req)
+			if !key.HasScope(scope) {
+				APIKeyRequestsTotal.WithLabelValues(key.Name, "forbidden").Inc()
+				if err := resp.WriteError(http.StatusForbidden, fmt.Errorf("API key %s is not allowed to %s", key.Name, scope)); err != nil {
+					base.Logger().Error("failed to write error", zap.Error(err))
+				}
+				return
+			}
+			if key.RateLimit > 0 && !s.getRateLimiter(key).Allow(time.Now()) {
+				APIKeyRequestsTotal.WithLabelValues(key.Name, "throttled").Inc()
+				if err := resp.WriteError(http.StatusTooManyRequests, fmt.Errorf("API key %s exceeds rate limit", key.Name)); err != nil {
+					base.Logger().Error("failed to write error", zap.Error(err))
+				}
+				return
+			}
+			APIKeyRequestsTotal.WithLabelValues(key.Name, "ok").Inc()
+			chain.ProcessFilter(req, resp)
+			return
+		}
+	}
 	base.Logger().Error("unauthorized",
 		zap.String("api_key", s.GorseConfig.Server.APIKey),
 		zap.String("X-API-Key", apikey))
@@ -155,6 +277,25 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
 		Returns(200, "OK", Success{}).
 		Writes(Success{}))
+	// Insert subscription
+	ws.Route(ws.PUT("/user/{user-id}/subscribe/{subscription}").To(s.insertUserSubscribe).
+		Doc("Insert a subscription for a user. Subscriptions match categories or labels of items.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.PathParameter("subscription", "subscribed category or label").DataType("string")).
+		Returns(200, "OK", Success{}).
+		Writes(Success{}))
+	// Delete subscription
+	ws.Route(ws.DELETE("/user/{user-id}/subscribe/{subscription}").To(s.deleteUserSubscribe).
+		Doc("Delete a subscription from a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		Metadata(KeyScope, config.ScopeWrite).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.PathParameter("subscription", "subscribed category or label").DataType("string")).
+		Returns(200, "OK", Success{}).
+		Writes(Success{}))
 
 	// Insert an item
 	ws.Route(ws.POST("/item").To(s.insertItem).
@@ -215,6 +356,7 @@ func (s *RestServer) CreateWebService() {
 	ws.Route(ws.DELETE("/item/{item-id}/category/{category}").To(s.deleteItemCategory).
 		Doc("Delete a category from a item").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"item"}).
+		Metadata(KeyScope, config.ScopeWrite).
 		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
 		Param(ws.PathParameter("item-id", "identified of the item").DataType("string")).
 		Param(ws.PathParameter("category", "category of the item").DataType("string")).
@@ -341,6 +483,26 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("integer")).
 		Returns(200, "OK", []string{}).
 		Writes([]string{}))
+	// Get subscribed items by user id
+	ws.Route(ws.GET("/intermediate/subscribe/{user-id}").To(s.getSubscribe).
+		Doc("get subscribed items for a user").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"intermediate"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("integer")).
+		Param(ws.QueryParameter("offset", "offset of the list").DataType("integer")).
+		Returns(200, "OK", []cache.Scored{}).
+		Writes([]cache.Scored{}))
+	ws.Route(ws.GET("/intermediate/subscribe/{user-id}/{category}").To(s.getSubscribe).
+		Doc("get subscribed items in category for a user").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"intermediate"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.PathParameter("category", "category of items").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("integer")).
+		Param(ws.QueryParameter("offset", "offset of the list").DataType("integer")).
+		Returns(200, "OK", []cache.Scored{}).
+		Writes([]cache.Scored{}))
 
 	/* Rank recommendation */
 
@@ -400,6 +562,16 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("integer")).
 		Returns(200, "OK", []string{}).
 		Writes([]string{}))
+	ws.Route(ws.GET("/item/{item-id}/audience").To(s.getItemAudience).
+		Doc("get users most likely to like an item").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("item-id", "identifier of the item").DataType("string")).
+		Param(ws.QueryParameter("label", "labels of returned users").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned users").DataType("integer")).
+		Param(ws.QueryParameter("offset", "offset of the list").DataType("integer")).
+		Returns(200, "OK", []cache.Scored{}).
+		Writes([]cache.Scored{}))
 	ws.Route(ws.GET("/user/{user-id}/neighbors/").To(s.getUserNeighbors).
 		Doc("get neighbors of a user").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
@@ -418,6 +590,39 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("write-back-delay", "timestamp delay of write back feedback in minutes").DataType("integer")).
 		Param(ws.QueryParameter("n", "number of returned items").DataType("integer")).
 		Param(ws.QueryParameter("offset", "offset in the recommendation result").DataType("integer")).
+		Param(ws.QueryParameter("context", "context labels for ranking, such as device=mobile").DataType("string")).
+		Param(ws.QueryParameter("explain", "return sources and scores of items if true").DataType("boolean")).
+		Returns(200, "OK", []string{}).
+		Writes([]string{}))
+	ws.Route(ws.POST("/recommend").To(s.getBatchRecommend).
+		Doc("Get recommendation for multiple users.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Metadata(KeyScope, config.ScopeRead).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Reads(BatchRecommendRequest{}).
+		Returns(200, "OK", map[string][]string{}).
+		Writes(map[string][]string{}))
+	ws.Route(ws.POST("/session/recommend").To(s.getSessionRecommend).
+		Doc("Get recommendation for an anonymous session.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Metadata(KeyScope, config.ScopeRead).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("integer")).
+		Param(ws.QueryParameter("offset", "offset in the recommendation result").DataType("integer")).
+		Param(ws.QueryParameter("explain", "return sources and scores of items if true").DataType("boolean")).
+		Reads([]Feedback{}).
+		Returns(200, "OK", []string{}).
+		Writes([]string{}))
+	ws.Route(ws.POST("/session/recommend/{category}").To(s.getSessionRecommend).
+		Doc("Get recommendation for an anonymous session.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Metadata(KeyScope, config.ScopeRead).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("category", "category of items").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("integer")).
+		Param(ws.QueryParameter("offset", "offset in the recommendation result").DataType("integer")).
+		Param(ws.QueryParameter("explain", "return sources and scores of items if true").DataType("boolean")).
+		Reads([]Feedback{}).
 		Returns(200, "OK", []string{}).
 		Writes([]string{}))
 	ws.Route(ws.GET("/recommend/{user-id}/{category}").To(s.getRecommend).
@@ -430,9 +635,22 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("write-back-delay", "timestamp delay of write back feedback in minutes").DataType("integer")).
 		Param(ws.QueryParameter("n", "number of returned items").DataType("integer")).
 		Param(ws.QueryParameter("offset", "offset in the recommendation result").DataType("integer")).
+		Param(ws.QueryParameter("context", "context labels for ranking, such as device=mobile").DataType("string")).
+		Param(ws.QueryParameter("explain", "return sources and scores of items if true").DataType("boolean")).
 		Returns(200, "OK", []string{}).
 		Writes([]string{}))
 
+	ws.Route(ws.POST("/rank/{user-id}").To(s.rank).
+		Doc("Rank candidate items for user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Metadata(KeyScope, config.ScopeRead).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API").DataType("string")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("context", "context labels for ranking, such as device=mobile").DataType("string")).
+		Reads([]string{}).
+		Returns(200, "OK", []cache.Scored{}).
+		Writes([]cache.Scored{}))
+
 	/* Interaction with measurements */
 
 	ws.Route(ws.GET("/measurements/{name}").To(s.getMeasurements).
@@ -455,6 +673,17 @@ func ParseInt(request *restful.Request, name string, fallback int) (value int, e
 	return
 }
 
+// ParseBool parses booleans from the query parameter.
+func ParseBool(request *restful.Request, name string, fallback bool) (value bool, err error) {
+	valueString := request.QueryParameter(name)
+	value, err = strconv.ParseBool(valueString)
+	if err != nil && valueString == "" {
+		value = fallback
+		err = nil
+	}
+	return
+}
+
 func (s *RestServer) getList(prefix, name string, request *restful.Request, response *restful.Response) {
 	var n, begin, end int
 	var err error
@@ -551,6 +780,70 @@ func (s *RestServer) getItemCategorizedNeighbors(request *restful.Request, respo
 	s.getSort(cache.Key(cache.ItemNeighbors, itemId, category), request, response)
 }
 
+// audiencePageSize is the minimal number of users in the audience loaded at a time while filtering by labels.
+const audiencePageSize = 100
+
+// getItemAudience gets users most likely to like an item from database. Users are filtered by labels if labels are
+// given.
+func (s *RestServer) getItemAudience(request *restful.Request, response *restful.Response) {
+	itemId := request.PathParameter("item-id")
+	labels := request.QueryParameters("label")
+	offset, err := ParseInt(request, "offset", 0)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	n, err := ParseInt(request, "n", s.GorseConfig.Server.DefaultN)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if n < 0 || offset < 0 {
+		BadRequest(response, fmt.Errorf("invalid n %d or offset %d", n, offset))
+		return
+	}
+	if len(labels) == 0 {
+		s.getSort(cache.Key(cache.ItemAudience, itemId), request, response)
+		return
+	}
+	// users in the audience are loaded page by page, and users in a page are loaded in a batch
+	pageSize := mathutil.Max(offset+n, audiencePageSize)
+	audience := make([]cache.Scored, 0, offset+n)
+	for begin := 0; len(audience) < offset+n; begin += pageSize {
+		users, err := s.CacheClient.GetSorted(cache.Key(cache.ItemAudience, itemId), begin, begin+pageSize-1)
+		if err != nil {
+			InternalServerError(response, err)
+			return
+		}
+		userInfos, err := s.DataClient.BatchGetUsers(cache.RemoveScores(users))
+		if err != nil {
+			InternalServerError(response, err)
+			return
+		}
+		userLabels := make(map[string]*strset.Set, len(userInfos))
+		for _, userInfo := range userInfos {
+			userLabels[userInfo.UserId] = strset.New(userInfo.Labels...)
+		}
+		for _, user := range users {
+			if len(audience) >= offset+n {
+				break
+			}
+			if labelSet, exist := userLabels[user.Id]; exist && labelSet.Has(labels...) {
+				audience = append(audience, user)
+			}
+		}
+		if len(users) < pageSize {
+			break
+		}
+	}
+	if offset < len(audience) {
+		audience = audience[offset:]
+	} else {
+		audience = []cache.Scored{}
+	}
+	Ok(response, audience)
+}
+
 // getUserNeighbors gets neighbors of a user from database.
 func (s *RestServer) getUserNeighbors(request *restful.Request, response *restful.Response) {
 	// Get item id
@@ -559,15 +852,12 @@ func (s *RestServer) getUserNeighbors(request *restful.Request, response *restfu
 }
 
 // getSubscribe gets subscribed items of a user from database.
-//func (s *RestServer) getSubscribe(request *restful.Request, response *restful.Response) {
-//	// Authorize
-//	if !s.auth(request, response) {
-//		return
-//	}
-//	// Get user id
-//	userId := request.PathParameter("user-id")
-//	s.getList(cache.SubscribeItems, userId, request, response)
-//}
+func (s *RestServer) getSubscribe(request *restful.Request, response *restful.Response) {
+	// Get user id
+	userId := request.PathParameter("user-id")
+	category := request.PathParameter("category")
+	s.getList(cache.SubscribeItems, cache.Key(userId, category), request, response)
+}
 
 // getCategorizedCollaborative gets cached categorized recommended items from database.
 func (s *RestServer) getCategorizedCollaborative(request *restful.Request, response *restful.Response) {
@@ -589,14 +879,36 @@ func (s *RestServer) getCollaborative(request *restful.Request, response *restfu
 // 2. If there are historical interactions of the users, return similar items.
 // 3. Otherwise, return fallback recommendation (popular/latest).
 func (s *RestServer) Recommend(userId, category string, n int, recommenders ...Recommender) ([]string, error) {
+	ctx, err := s.recommend(userId, category, n, newRecommendCache(), recommenders...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return ctx.results, nil
+}
+
+// RecommendWithExplanation recommends items to users and explains where each item comes from.
+func (s *RestServer) RecommendWithExplanation(userId, category string, n int, recommenders ...Recommender) ([]Explanation, error) {
+	ctx, err := s.recommend(userId, category, n, newRecommendCache(), recommenders...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return ctx.explanations, nil
+}
+
+func (s *RestServer) recommend(userId, category string, n int, shared *recommendCache, recommenders ...Recommender) (*recommendContext, error) {
 	initStart := time.Now()
 
 	// create context
-	ctx, err := s.createRecommendContext(userId, category, n)
+	ctx, err := s.createRecommendContext(userId, category, n, shared)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	// load merchandising rules, blocked items are excluded before recommenders run
+	if err = s.loadRules(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	// execute recommenders
 	for _, recommender := range recommenders {
 		err = recommender(ctx)
@@ -605,9 +917,15 @@ func (s *RestServer) Recommend(userId, category string, n int, recommenders ...R
 		}
 	}
 
+	// apply merchandising rules and diversity
+	if err = s.rerank(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	// return recommendations
 	if len(ctx.results) > n {
 		ctx.results = ctx.results[:n]
+		ctx.explanations = ctx.explanations[:n]
 	}
 	totalTime := time.Since(initStart)
 	base.Logger().Info("complete recommendation",
@@ -615,6 +933,8 @@ func (s *RestServer) Recommend(userId, category string, n int, recommenders ...R
 		zap.Int("num_from_collaborative", ctx.numFromCollaborative),
 		zap.Int("num_from_item_based", ctx.numFromItemBased),
 		zap.Int("num_from_user_based", ctx.numFromUserBased),
+		zap.Int("num_from_subscribe", ctx.numFromSubscribe),
+		zap.Int("num_from_collaborative_online", ctx.numFromCollaborativeOnline),
 		zap.Int("num_from_latest", ctx.numFromLatest),
 		zap.Int("num_from_poplar", ctx.numFromPopular),
 		zap.Duration("total_time", totalTime),
@@ -623,41 +943,113 @@ func (s *RestServer) Recommend(userId, category string, n int, recommenders ...R
 		zap.Duration("load_hist_time", ctx.loadLoadHistTime),
 		zap.Duration("item_based_recommend_time", ctx.itemBasedTime),
 		zap.Duration("user_based_recommend_time", ctx.userBasedTime),
+		zap.Duration("load_subscribe_time", ctx.loadSubscribeTime),
+		zap.Duration("collaborative_online_recommend_time", ctx.colOnlineRecTime),
 		zap.Duration("load_latest_time", ctx.loadLatestTime),
 		zap.Duration("load_popular_time", ctx.loadPopularTime))
-	return ctx.results, nil
+	return ctx, nil
+}
+
+// Explanation describes where a recommended item comes from.
+type Explanation struct {
+	ItemId string
+	// Source is the recommender producing the item: collaborative, item_based, user_based, subscribe,
+	// collaborative_online, latest or popular. Items in offline recommendation have the source recorded by workers,
+	// replacement for replaced items or offline if unknown. Items pinned by merchandising rules have the source pin.
+	Source string
+	Score  float32
+	// Because contains anchors of the recommendation: items liked by the user for item-based recommendation and
+	// similar users for user-based recommendation.
+	Because []string `json:",omitempty"`
 }
 
 type recommendContext struct {
 	userId       string
 	category     string
+	user         *data.User // the user loaded from database, nil if not loaded
 	userFeedback []data.Feedback
 	n            int
 	results      []string
+	explanations []Explanation
 	excludeSet   *strset.Set
+	shared       *recommendCache
+	rules        []data.Rule // active merchandising rules matching the request
 
 	numPrevStage         int
 	numFromLatest        int
 	numFromPopular       int
 	numFromUserBased     int
 	numFromItemBased     int
+	numFromSubscribe     int
 	numFromCollaborative int
 	numFromOffline       int
 
+	numFromCollaborativeOnline int
+
 	loadOfflineRecTime time.Duration
 	loadColRecTime     time.Duration
 	loadLoadHistTime   time.Duration
 	itemBasedTime      time.Duration
 	userBasedTime      time.Duration
+	loadSubscribeTime  time.Duration
+	colOnlineRecTime   time.Duration
 	loadLatestTime     time.Duration
 	loadPopularTime    time.Duration
 }
 
-func (s *RestServer) createRecommendContext(userId, category string, n int) (*recommendContext, error) {
-	// pull ignored items
-	ignoreItems, err := s.CacheClient.GetSortedByScore(cache.Key(cache.IgnoreItems, userId), math32.Inf(-1), float32(time.Now().Unix()))
-	if err != nil {
-		return nil, errors.Trace(err)
+// recommendCache stores cache lookups shared by recommendations for multiple users.
+type recommendCache struct {
+	// hiddenItems records whether items are hidden.
+	hiddenItems map[string]bool
+	// sortedItems stores popular and latest items.
+	sortedItems map[string][]cache.Scored
+	// prefetched stores cached recommendations for users, indexed by cache prefix and user id.
+	prefetched map[string]map[string][]cache.Scored
+	// items stores items loaded from database.
+	items map[string]data.Item
+	// ignoreItems stores prefetched ignored items of users, indexed by user id.
+	ignoreItems map[string][]cache.Scored
+}
+
+func newRecommendCache() *recommendCache {
+	return &recommendCache{
+		hiddenItems: make(map[string]bool),
+		sortedItems: make(map[string][]cache.Scored),
+		prefetched:  make(map[string]map[string][]cache.Scored),
+		items:       make(map[string]data.Item),
+		ignoreItems: make(map[string][]cache.Scored),
+	}
+}
+
+// rerank boosts items, diversifies recommendations and pins items in order. Pinned items are placed last so that their
+// positions are kept.
+func (s *RestServer) rerank(ctx *recommendContext) error {
+	// boost items by merchandising rules
+	s.boostItems(ctx)
+
+	// diversify recommendations
+	if s.GorseConfig.Recommend.EnableDiversity {
+		if err := s.diversify(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	// pin items by merchandising rules
+	if err := s.pinItems(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (s *RestServer) createRecommendContext(userId, category string, n int, shared *recommendCache) (*recommendContext, error) {
+	// pull ignored items unless prefetched
+	ignoreItems, prefetched := shared.ignoreItems[userId]
+	if !prefetched {
+		var err error
+		ignoreItems, err = s.CacheClient.GetSortedByScore(cache.Key(cache.IgnoreItems, userId), math32.Inf(-1), float32(time.Now().Unix()))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
 	excludeSet := strset.New()
 	for _, item := range ignoreItems {
@@ -668,9 +1060,23 @@ func (s *RestServer) createRecommendContext(userId, category string, n int) (*re
 		category:   category,
 		n:          n,
 		excludeSet: excludeSet,
+		shared:     shared,
 	}, nil
 }
 
+// requireUser loads the user once for a recommendation. Unknown users are treated as users without labels.
+func (s *RestServer) requireUser(ctx *recommendContext) error {
+	if ctx.user == nil {
+		user, err := s.DataClient.GetUser(ctx.userId)
+		if err != nil && !errors.IsNotFound(err) {
+			return errors.Trace(err)
+		}
+		user.UserId = ctx.userId
+		ctx.user = &user
+	}
+	return nil
+}
+
 func (s *RestServer) requireUserFeedback(ctx *recommendContext) error {
 	if ctx.userFeedback == nil {
 		start := time.Now()
@@ -687,106 +1093,332 @@ func (s *RestServer) requireUserFeedback(ctx *recommendContext) error {
 	return nil
 }
 
-func (s *RestServer) filterOutHiddenScores(items []cache.Scored) []cache.Scored {
-	isHidden, err := s.CacheClient.Exists(cache.HiddenItems, cache.RemoveScores(items)...)
+// checkHiddenItems checks whether items are hidden. Items checked before are not checked again.
+func (s *RestServer) checkHiddenItems(shared *recommendCache, itemIds []string) error {
+	var unchecked []string
+	for _, itemId := range itemIds {
+		if _, checked := shared.hiddenItems[itemId]; !checked {
+			unchecked = append(unchecked, itemId)
+		}
+	}
+	if len(unchecked) == 0 {
+		return nil
+	}
+	isHidden, err := s.CacheClient.Exists(cache.HiddenItems, unchecked...)
 	if err != nil {
+		return errors.Trace(err)
+	}
+	for i, itemId := range unchecked {
+		shared.hiddenItems[itemId] = isHidden[i] != 0
+	}
+	return nil
+}
+
+func (s *RestServer) filterOutHiddenScores(ctx *recommendContext, items []cache.Scored) []cache.Scored {
+	if err := s.checkHiddenItems(ctx.shared, cache.RemoveScores(items)); err != nil {
 		base.Logger().Error("failed to check hidden items", zap.Error(err))
 		return items
 	}
 	var results []cache.Scored
-	for i := range isHidden {
-		if isHidden[i] == 0 {
-			results = append(results, items[i])
+	for _, item := range items {
+		if !ctx.shared.hiddenItems[item.Id] {
+			results = append(results, item)
 		}
 	}
 	return results
 }
 
-func (s *RestServer) filterOutHiddenFeedback(feedbacks []data.Feedback) []data.Feedback {
+func (s *RestServer) filterOutHiddenFeedback(ctx *recommendContext, feedbacks []data.Feedback) []data.Feedback {
 	names := make([]string, len(feedbacks))
 	for i, item := range feedbacks {
 		names[i] = item.ItemId
 	}
-	isHidden, err := s.CacheClient.Exists(cache.HiddenItems, names...)
-	if err != nil {
+	if err := s.checkHiddenItems(ctx.shared, names); err != nil {
 		base.Logger().Error("failed to check hidden items", zap.Error(err))
 		return feedbacks
 	}
 	var results []data.Feedback
-	for i := range isHidden {
-		if isHidden[i] == 0 {
-			results = append(results, feedbacks[i])
+	for _, feedback := range feedbacks {
+		if !ctx.shared.hiddenItems[feedback.ItemId] {
+			results = append(results, feedback)
 		}
 	}
 	return results
 }
 
-type Recommender func(ctx *recommendContext) error
+// getCachedRecommend returns cached recommendations for the user. Recommendations prefetched in batch are used if
+// exist.
+func (s *RestServer) getCachedRecommend(ctx *recommendContext, prefix string) ([]cache.Scored, error) {
+	if prefetched, exist := ctx.shared.prefetched[prefix]; exist {
+		if items, exist := prefetched[ctx.userId]; exist {
+			return items, nil
+		}
+	}
+	return s.CacheClient.GetCategoryScores(prefix, ctx.userId, ctx.category, 0, s.GorseConfig.Database.CacheSize)
+}
 
-func (s *RestServer) RecommendOffline(ctx *recommendContext) error {
-	if len(ctx.results) < ctx.n {
-		start := time.Now()
-		recommendation, err := s.CacheClient.GetCategoryScores(cache.OfflineRecommend, ctx.userId, ctx.category, 0, s.GorseConfig.Database.CacheSize)
+// getSortedItems returns top n+1 items in a sorted set. The sorted set is loaded once for all users in a batch since
+// they share the same number of recommendations.
+func (s *RestServer) getSortedItems(ctx *recommendContext, key string, n int) ([]cache.Scored, error) {
+	items, exist := ctx.shared.sortedItems[key]
+	if !exist {
+		var err error
+		if items, err = s.CacheClient.GetSorted(key, 0, ctx.n); err != nil {
+			return nil, errors.Trace(err)
+		}
+		ctx.shared.sortedItems[key] = items
+	}
+	return items[:mathutil.Min(n+1, len(items))], nil
+}
+
+// getRules returns merchandising rules. Rules are cached and reloaded from database once meta timeout expires, so
+// changes of rules take effect as fast as changes of config.
+func (s *RestServer) getRules() ([]data.Rule, error) {
+	s.rulesMutex.Lock()
+	defer s.rulesMutex.Unlock()
+	if s.rulesTime.IsZero() || time.Since(s.rulesTime) >= time.Duration(s.GorseConfig.Master.MetaTimeout)*time.Second {
+		rules, err := s.DataClient.GetRules()
 		if err != nil {
-			return errors.Trace(err)
+			return nil, errors.Trace(err)
 		}
-		recommendation = s.filterOutHiddenScores(recommendation)
-		for _, item := range recommendation {
-			if !ctx.excludeSet.Has(item.Id) {
-				ctx.results = append(ctx.results, item.Id)
-				ctx.excludeSet.Add(item.Id)
+		s.rules, s.rulesTime = rules, time.Now()
+	}
+	return s.rules, nil
+}
+
+// loadRules loads active merchandising rules matching the request. Blocked items are added to the exclude set.
+func (s *RestServer) loadRules(ctx *recommendContext) error {
+	rules, err := s.getRules()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	now := time.Now()
+	for _, rule := range rules {
+		if !rule.IsActive(now) {
+			continue
+		}
+		// load labels of the user for rules on user segments
+		var userLabels []string
+		if len(rule.UserLabels) > 0 {
+			if err = s.requireUser(ctx); err != nil {
+				return errors.Trace(err)
 			}
+			userLabels = ctx.user.Labels
+		}
+		if !rule.Match(ctx.category, userLabels) {
+			continue
+		}
+		ctx.rules = append(ctx.rules, rule)
+		if rule.Type == data.RuleBlock {
+			ctx.excludeSet.Add(rule.ItemId)
 		}
-		ctx.loadOfflineRecTime = time.Since(start)
-		LoadCTRRecommendCacheSeconds.Observe(ctx.loadOfflineRecTime.Seconds())
-		ctx.numFromOffline = len(ctx.results) - ctx.numPrevStage
-		ctx.numPrevStage = len(ctx.results)
 	}
 	return nil
 }
 
-func (s *RestServer) RecommendCollaborative(ctx *recommendContext) error {
-	if len(ctx.results) < ctx.n {
-		start := time.Now()
-		collaborativeRecommendation, err := s.CacheClient.GetCategoryScores(cache.CollaborativeRecommend, ctx.userId, ctx.category, 0, s.GorseConfig.Database.CacheSize)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		collaborativeRecommendation = s.filterOutHiddenScores(collaborativeRecommendation)
-		for _, item := range collaborativeRecommendation {
-			if !ctx.excludeSet.Has(item.Id) {
-				ctx.results = append(ctx.results, item.Id)
-				ctx.excludeSet.Add(item.Id)
+// boostItems re-ranks items boosted by merchandising rules. Since scores from different recommenders are not
+// comparable, the relevance of an item is given by its position and multiplied by multipliers of rules.
+func (s *RestServer) boostItems(ctx *recommendContext) {
+	multipliers := make(map[string]float32)
+	for _, rule := range ctx.rules {
+		if rule.Type == data.RuleBoost {
+			if _, exist := multipliers[rule.ItemId]; !exist {
+				multipliers[rule.ItemId] = 1
 			}
+			multipliers[rule.ItemId] *= rule.Multiplier
 		}
-		ctx.loadColRecTime = time.Since(start)
-		LoadCollaborativeRecommendCacheSeconds.Observe(ctx.loadColRecTime.Seconds())
-		ctx.numFromCollaborative = len(ctx.results) - ctx.numPrevStage
-		ctx.numPrevStage = len(ctx.results)
 	}
-	return nil
+	if len(multipliers) == 0 {
+		return
+	}
+	relevance := make(map[string]float32, len(ctx.results))
+	for i, itemId := range ctx.results {
+		relevance[itemId] = float32(len(ctx.results) - i)
+		if multiplier, exist := multipliers[itemId]; exist {
+			relevance[itemId] *= multiplier
+			ctx.explanations[i].Score *= multiplier
+		}
+	}
+	sort.SliceStable(ctx.explanations, func(i, j int) bool {
+		return relevance[ctx.explanations[i].ItemId] > relevance[ctx.explanations[j].ItemId]
+	})
+	for i := range ctx.explanations {
+		ctx.results[i] = ctx.explanations[i].ItemId
+	}
 }
 
-func (s *RestServer) RecommendUserBased(ctx *recommendContext) error {
-	if len(ctx.results) < ctx.n {
-		err := s.requireUserFeedback(ctx)
-		if err != nil {
-			return errors.Trace(err)
+// pinItems places items pinned by merchandising rules at their positions. Hidden items are not pinned.
+func (s *RestServer) pinItems(ctx *recommendContext) error {
+	var pins []data.Rule
+	var pinnedItems []string
+	for _, rule := range ctx.rules {
+		// recommended items are excluded as well, but they could be pinned
+		if rule.Type == data.RulePin && (!ctx.excludeSet.Has(rule.ItemId) || funk.ContainsString(ctx.results, rule.ItemId)) {
+			pins = append(pins, rule)
+			pinnedItems = append(pinnedItems, rule.ItemId)
 		}
-		start := time.Now()
-		candidates := make(map[string]float32)
-		// load similar users
-		similarUsers, err := s.CacheClient.GetSorted(cache.Key(cache.UserNeighbors, ctx.userId), 0, s.GorseConfig.Database.CacheSize)
-		if err != nil {
-			return errors.Trace(err)
+	}
+	if len(pins) == 0 {
+		return nil
+	}
+	if err := s.checkHiddenItems(ctx.shared, pinnedItems); err != nil {
+		return errors.Trace(err)
+	}
+	sort.SliceStable(pins, func(i, j int) bool {
+		return pins[i].Position < pins[j].Position
+	})
+	for _, pin := range pins {
+		if ctx.shared.hiddenItems[pin.ItemId] {
+			continue
 		}
-		for _, user := range similarUsers {
-			// load historical feedback
-			feedbacks, err := s.DataClient.GetUserFeedback(user.Id, false, s.GorseConfig.Database.PositiveFeedbackType...)
-			if err != nil {
+		explanation := Explanation{ItemId: pin.ItemId, Source: data.RulePin}
+		// remove the item from its original position
+		for i, itemId := range ctx.results {
+			if itemId == pin.ItemId {
+				explanation = ctx.explanations[i]
+				explanation.Source = data.RulePin
+				ctx.results = append(ctx.results[:i], ctx.results[i+1:]...)
+				ctx.explanations = append(ctx.explanations[:i], ctx.explanations[i+1:]...)
+				break
+			}
+		}
+		position := mathutil.Min(pin.Position, len(ctx.results))
+		ctx.results = append(ctx.results[:position], append([]string{pin.ItemId}, ctx.results[position:]...)...)
+		ctx.explanations = append(ctx.explanations[:position], append([]Explanation{explanation}, ctx.explanations[position:]...)...)
+		ctx.excludeSet.Add(pin.ItemId)
+	}
+	return nil
+}
+
+// diversify re-ranks recommended items by maximal marginal relevance with caps on labels. Since scores from different
+// recommenders are not comparable, the relevance of an item is given by its position.
+func (s *RestServer) diversify(ctx *recommendContext) error {
+	scores := make([]float32, len(ctx.results))
+	labels := make([][]string, len(ctx.results))
+	categories := make([][]string, len(ctx.results))
+	if err := s.loadItems(ctx.shared.items, ctx.results); err != nil {
+		return errors.Trace(err)
+	}
+	for i, itemId := range ctx.results {
+		item := ctx.shared.items[itemId]
+		scores[i] = float32(len(ctx.results) - i)
+		labels[i] = item.Labels
+		categories[i] = item.Categories
+	}
+	order := base.Diversify(scores, labels, categories, s.GorseConfig.Recommend.DiversityLambda,
+		s.GorseConfig.Recommend.DiversityWindow, s.GorseConfig.Recommend.DiversityCaps)
+	results := make([]string, len(order))
+	explanations := make([]Explanation, len(order))
+	for i, j := range order {
+		results[i] = ctx.results[j]
+		explanations[i] = ctx.explanations[j]
+	}
+	ctx.results, ctx.explanations = results, explanations
+	return nil
+}
+
+// appendResult appends an item to results with its explanation.
+func (ctx *recommendContext) appendResult(itemId, source string, score float32, because []string) {
+	ctx.results = append(ctx.results, itemId)
+	ctx.explanations = append(ctx.explanations, Explanation{
+		ItemId:  itemId,
+		Score:   score,
+		Source:  source,
+		Because: because,
+	})
+	ctx.excludeSet.Add(itemId)
+}
+
+type Recommender func(ctx *recommendContext) error
+
+// getOfflineSources returns recommenders producing items in offline recommendation for a user. Sources are empty if
+// they haven't been stored by workers.
+func (s *RestServer) getOfflineSources(userId string) (map[string]string, error) {
+	value, err := s.CacheClient.GetString(cache.OfflineRecommendSources, userId)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	var sources map[string]string
+	if err = json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return sources, nil
+}
+
+func (s *RestServer) RecommendOffline(ctx *recommendContext) error {
+	if len(ctx.results) < ctx.n {
+		start := time.Now()
+		recommendation, err := s.getCachedRecommend(ctx, cache.OfflineRecommend)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		recommendation = s.filterOutHiddenScores(ctx, recommendation)
+		sources, err := s.getOfflineSources(ctx.userId)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, item := range recommendation {
+			if !ctx.excludeSet.Has(item.Id) {
+				source, exist := sources[item.Id]
+				if !exist {
+					source = "offline"
+				}
+				ctx.appendResult(item.Id, source, item.Score, nil)
+			}
+		}
+		ctx.loadOfflineRecTime = time.Since(start)
+		LoadCTRRecommendCacheSeconds.Observe(ctx.loadOfflineRecTime.Seconds())
+		ctx.numFromOffline = len(ctx.results) - ctx.numPrevStage
+		ctx.numPrevStage = len(ctx.results)
+	}
+	return nil
+}
+
+func (s *RestServer) RecommendCollaborative(ctx *recommendContext) error {
+	if len(ctx.results) < ctx.n {
+		start := time.Now()
+		collaborativeRecommendation, err := s.getCachedRecommend(ctx, cache.CollaborativeRecommend)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		collaborativeRecommendation = s.filterOutHiddenScores(ctx, collaborativeRecommendation)
+		for _, item := range collaborativeRecommendation {
+			if !ctx.excludeSet.Has(item.Id) {
+				ctx.appendResult(item.Id, "collaborative", item.Score, nil)
+			}
+		}
+		ctx.loadColRecTime = time.Since(start)
+		LoadCollaborativeRecommendCacheSeconds.Observe(ctx.loadColRecTime.Seconds())
+		ctx.numFromCollaborative = len(ctx.results) - ctx.numPrevStage
+		ctx.numPrevStage = len(ctx.results)
+	}
+	return nil
+}
+
+func (s *RestServer) RecommendUserBased(ctx *recommendContext) error {
+	if len(ctx.results) < ctx.n {
+		err := s.requireUserFeedback(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		start := time.Now()
+		candidates := make(map[string]float32)
+		because := make(map[string][]string)
+		// load similar users
+		similarUsers, err := s.CacheClient.GetSorted(cache.Key(cache.UserNeighbors, ctx.userId), 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, user := range similarUsers {
+			// load historical feedback
+			feedbacks, err := s.DataClient.GetUserFeedback(user.Id, false, s.GorseConfig.Database.PositiveFeedbackType...)
+			if err != nil {
 				return errors.Trace(err)
 			}
-			feedbacks = s.filterOutHiddenFeedback(feedbacks)
+			feedbacks = s.filterOutHiddenFeedback(ctx, feedbacks)
 			// add unseen items
 			for _, feedback := range feedbacks {
 				if !ctx.excludeSet.Has(feedback.ItemId) {
@@ -796,6 +1428,9 @@ func (s *RestServer) RecommendUserBased(ctx *recommendContext) error {
 					}
 					if ctx.category == "" || funk.ContainsString(categories, ctx.category) {
 						candidates[feedback.ItemId] += user.Score
+						if !funk.ContainsString(because[feedback.ItemId], user.Id) {
+							because[feedback.ItemId] = append(because[feedback.ItemId], user.Id)
+						}
 					}
 				}
 			}
@@ -806,9 +1441,10 @@ func (s *RestServer) RecommendUserBased(ctx *recommendContext) error {
 		for id, score := range candidates {
 			filter.Push(id, score)
 		}
-		ids, _ := filter.PopAll()
-		ctx.results = append(ctx.results, ids...)
-		ctx.excludeSet.Add(ids...)
+		ids, scores := filter.PopAll()
+		for i, id := range ids {
+			ctx.appendResult(id, "user_based", scores[i], because[id])
+		}
 		ctx.userBasedTime = time.Since(start)
 		UserBasedRecommendSeconds.Observe(ctx.userBasedTime.Seconds())
 		ctx.numFromUserBased = len(ctx.results) - ctx.numPrevStage
@@ -832,6 +1468,7 @@ func (s *RestServer) RecommendItemBased(ctx *recommendContext) error {
 		}
 		// collect candidates
 		candidates := make(map[string]float32)
+		because := make(map[string][]string)
 		for _, feedback := range userFeedback {
 			// load similar items
 			similarItems, err := s.CacheClient.GetSorted(cache.Key(cache.ItemNeighbors, feedback.ItemId, ctx.category), 0, s.GorseConfig.Database.CacheSize)
@@ -839,10 +1476,13 @@ func (s *RestServer) RecommendItemBased(ctx *recommendContext) error {
 				return errors.Trace(err)
 			}
 			// add unseen items
-			similarItems = s.filterOutHiddenScores(similarItems)
+			similarItems = s.filterOutHiddenScores(ctx, similarItems)
 			for _, item := range similarItems {
 				if !ctx.excludeSet.Has(item.Id) {
 					candidates[item.Id] += item.Score
+					if !funk.ContainsString(because[item.Id], feedback.ItemId) {
+						because[item.Id] = append(because[item.Id], feedback.ItemId)
+					}
 				}
 			}
 		}
@@ -852,9 +1492,10 @@ func (s *RestServer) RecommendItemBased(ctx *recommendContext) error {
 		for id, score := range candidates {
 			filter.Push(id, score)
 		}
-		ids, _ := filter.PopAll()
-		ctx.results = append(ctx.results, ids...)
-		ctx.excludeSet.Add(ids...)
+		ids, scores := filter.PopAll()
+		for i, id := range ids {
+			ctx.appendResult(id, "item_based", scores[i], because[id])
+		}
 		ctx.itemBasedTime = time.Since(start)
 		ItemBasedRecommendSeconds.Observe(ctx.itemBasedTime.Seconds())
 		ctx.numFromItemBased = len(ctx.results) - ctx.numPrevStage
@@ -863,6 +1504,105 @@ func (s *RestServer) RecommendItemBased(ctx *recommendContext) error {
 	return nil
 }
 
+// RecommendCollaborativeOnline recommends items by a user factor folded in from the latest feedback of the user.
+func (s *RestServer) RecommendCollaborativeOnline(ctx *recommendContext) error {
+	rankingModel, rankingIndex := s.getRankingModel()
+	if len(ctx.results) < ctx.n && rankingModel != nil && !rankingModel.Invalid() {
+		err := s.requireUserFeedback(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		start := time.Now()
+		// truncate user feedback
+		data.SortFeedbacks(ctx.userFeedback)
+		userFeedback := ctx.userFeedback
+		if s.GorseConfig.Recommend.NumFeedbackFallbackItemBased < len(userFeedback) {
+			userFeedback = userFeedback[:s.GorseConfig.Recommend.NumFeedbackFallbackItemBased]
+		}
+		// fold in user factor
+		itemIndices := make([]int32, 0, len(userFeedback))
+		for _, feedback := range userFeedback {
+			if itemIndex := rankingModel.GetItemIndex().ToNumber(feedback.ItemId); itemIndex != base.NotId {
+				itemIndices = append(itemIndices, itemIndex)
+			}
+		}
+		userFactor := ranking.FoldIn(rankingModel, itemIndices, rankingModel.GetParams().GetFloat32(model.Reg, 0.06))
+		if userFactor != nil {
+			// retrieve candidates
+			var candidates []cache.Scored
+			numCandidates := s.GorseConfig.Database.CacheSize + ctx.excludeSet.Size()
+			if rankingIndex != nil {
+				values, scores := rankingIndex.Search(search.NewDenseVector(userFactor, nil, false), numCandidates, false)
+				for i, value := range values {
+					if rankingModel.IsItemPredictable(value) {
+						candidates = append(candidates, cache.Scored{Id: rankingModel.GetItemIndex().ToName(value), Score: -scores[i]})
+					}
+				}
+			} else {
+				filter := heap.NewTopKStringFilter(numCandidates)
+				for i, itemId := range rankingModel.GetItemIndex().GetNames() {
+					itemIndex := int32(i)
+					if !ctx.excludeSet.Has(itemId) && rankingModel.IsItemPredictable(itemIndex) {
+						filter.Push(itemId, floats.Dot(userFactor, rankingModel.GetItemFactor(itemIndex)))
+					}
+				}
+				ids, scores := filter.PopAll()
+				candidates = cache.CreateScoredItems(ids, scores)
+			}
+			// add unseen items
+			candidates = s.filterOutHiddenScores(ctx, candidates)
+			for _, candidate := range candidates {
+				if len(ctx.results) >= ctx.n {
+					break
+				}
+				if ctx.excludeSet.Has(candidate.Id) {
+					continue
+				}
+				if ctx.category != "" {
+					categories, err := s.CacheClient.GetSet(cache.Key(cache.ItemCategories, candidate.Id))
+					if err != nil {
+						return errors.Trace(err)
+					}
+					if !funk.ContainsString(categories, ctx.category) {
+						continue
+					}
+				}
+				ctx.appendResult(candidate.Id, "collaborative_online", candidate.Score, nil)
+			}
+		}
+		ctx.colOnlineRecTime = time.Since(start)
+		CollaborativeOnlineRecommendSeconds.Observe(ctx.colOnlineRecTime.Seconds())
+		ctx.numFromCollaborativeOnline = len(ctx.results) - ctx.numPrevStage
+		ctx.numPrevStage = len(ctx.results)
+	}
+	return nil
+}
+
+func (s *RestServer) RecommendSubscribe(ctx *recommendContext) error {
+	if len(ctx.results) < ctx.n {
+		err := s.requireUserFeedback(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		start := time.Now()
+		items, err := s.getCachedRecommend(ctx, cache.SubscribeItems)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		items = s.filterOutHiddenScores(ctx, items)
+		for _, item := range items {
+			if !ctx.excludeSet.Has(item.Id) {
+				ctx.appendResult(item.Id, "subscribe", item.Score, nil)
+			}
+		}
+		ctx.loadSubscribeTime = time.Since(start)
+		LoadSubscribeRecommendCacheSeconds.Observe(ctx.loadSubscribeTime.Seconds())
+		ctx.numFromSubscribe = len(ctx.results) - ctx.numPrevStage
+		ctx.numPrevStage = len(ctx.results)
+	}
+	return nil
+}
+
 func (s *RestServer) RecommendLatest(ctx *recommendContext) error {
 	if len(ctx.results) < ctx.n {
 		err := s.requireUserFeedback(ctx)
@@ -870,15 +1610,14 @@ func (s *RestServer) RecommendLatest(ctx *recommendContext) error {
 			return errors.Trace(err)
 		}
 		start := time.Now()
-		items, err := s.CacheClient.GetSorted(cache.Key(cache.LatestItems, ctx.category), 0, ctx.n-len(ctx.results))
+		items, err := s.getSortedItems(ctx, cache.Key(cache.LatestItems, ctx.category), ctx.n-len(ctx.results))
 		if err != nil {
 			return errors.Trace(err)
 		}
-		items = s.filterOutHiddenScores(items)
+		items = s.filterOutHiddenScores(ctx, items)
 		for _, item := range items {
 			if !ctx.excludeSet.Has(item.Id) {
-				ctx.results = append(ctx.results, item.Id)
-				ctx.excludeSet.Add(item.Id)
+				ctx.appendResult(item.Id, "latest", item.Score, nil)
 			}
 		}
 		ctx.loadLatestTime = time.Since(start)
@@ -896,15 +1635,14 @@ func (s *RestServer) RecommendPopular(ctx *recommendContext) error {
 			return errors.Trace(err)
 		}
 		start := time.Now()
-		items, err := s.CacheClient.GetSorted(cache.Key(cache.PopularItems, ctx.category), 0, ctx.n-len(ctx.results))
+		items, err := s.getSortedItems(ctx, cache.Key(cache.PopularItems, ctx.category), ctx.n-len(ctx.results))
 		if err != nil {
 			return errors.Trace(err)
 		}
-		items = s.filterOutHiddenScores(items)
+		items = s.filterOutHiddenScores(ctx, items)
 		for _, item := range items {
 			if !ctx.excludeSet.Has(item.Id) {
-				ctx.results = append(ctx.results, item.Id)
-				ctx.excludeSet.Add(item.Id)
+				ctx.appendResult(item.Id, "popular", item.Score, nil)
 			}
 		}
 		ctx.loadPopularTime = time.Since(start)
@@ -936,31 +1674,45 @@ func (s *RestServer) getRecommend(request *restful.Request, response *restful.Re
 		BadRequest(response, err)
 		return
 	}
+	explain, err := ParseBool(request, "explain", false)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	ctxLabels := request.QueryParameters("context")
+	clickModel := s.getClickModel()
+	// apply arms of experiments
+	strategy := s.GorseConfig.Recommend.GetRecommendStrategy(userId)
+	if !strategy.EnableClickThroughPrediction {
+		clickModel = nil
+	}
+	if err = s.recordExperimentArms(map[string]*config.RecommendStrategy{userId: strategy}); err != nil {
+		InternalServerError(response, err)
+		return
+	}
 	// online recommendation
-	recommenders := []Recommender{s.RecommendOffline}
-	for _, recommender := range s.GorseConfig.Recommend.FallbackRecommend {
-		switch recommender {
-		case "collaborative":
-			recommenders = append(recommenders, s.RecommendCollaborative)
-		case "item_based":
-			recommenders = append(recommenders, s.RecommendItemBased)
-		case "user_based":
-			recommenders = append(recommenders, s.RecommendUserBased)
-		case "latest":
-			recommenders = append(recommenders, s.RecommendLatest)
-		case "popular":
-			recommenders = append(recommenders, s.RecommendPopular)
-		default:
-			InternalServerError(response, fmt.Errorf("unknown fallback recommendation method `%s`", recommender))
-			return
-		}
+	recommenders, err := s.onlineRecommenders(strategy.FallbackRecommend)
+	if err != nil {
+		InternalServerError(response, err)
+		return
 	}
-	results, err := s.Recommend(userId, category, offset+n, recommenders...)
+	numCandidates := offset + n
+	if len(ctxLabels) > 0 && clickModel != nil {
+		// rank more candidates with context before merchandising rules and diversity are applied
+		numCandidates = mathutil.Max(numCandidates, s.GorseConfig.Database.CacheSize)
+		recommenders = append(recommenders, s.contextRanker(clickModel, ctxLabels, offset+n))
+	}
+	recommendCtx, err := s.recommend(userId, category, numCandidates, newRecommendCache(), recommenders...)
 	if err != nil {
 		InternalServerError(response, err)
 		return
 	}
-	results = results[mathutil.Min(offset, len(results)):]
+	explanations := recommendCtx.explanations
+	explanations = explanations[mathutil.Min(offset, len(explanations)):mathutil.Min(offset+n, len(explanations))]
+	results := make([]string, len(explanations))
+	for i := range explanations {
+		results[i] = explanations[i].ItemId
+	}
 	// write back
 	if writeBackFeedback != "" {
 		for _, itemId := range results {
@@ -986,11 +1738,470 @@ func (s *RestServer) getRecommend(request *restful.Request, response *restful.Re
 			}
 		}
 	}
+	// log impressions
+	if s.GorseConfig.Server.EnableImpressionLog {
+		requestId := uuid.New().String()
+		s.logImpressions(response, requestId, newImpressions(requestId, userId, offset, explanations))
+	}
 	GetRecommendSeconds.Observe(time.Since(startTime).Seconds())
 	// Send result
+	if explain {
+		Ok(response, explanations)
+	} else {
+		Ok(response, results)
+	}
+}
+
+// newImpressions creates impressions of items returned to a user by a recommendation request.
+func newImpressions(requestId, userId string, offset int, explanations []Explanation) []data.Impression {
+	timestamp := time.Now()
+	impressions := make([]data.Impression, len(explanations))
+	for i, explanation := range explanations {
+		impressions[i] = data.Impression{
+			RequestId: requestId,
+			UserId:    userId,
+			ItemId:    explanation.ItemId,
+			Position:  offset + i,
+			Source:    explanation.Source,
+			Timestamp: timestamp,
+		}
+	}
+	return impressions
+}
+
+// logImpressions inserts returned items of a recommendation request into the impression log and returns the id of
+// the request in the header X-Request-Id. Clients attach the request id to feedback so that clicks could be attributed
+// to impressions. Impression logging is best-effort: recommendations are still served if logging fails.
+func (s *RestServer) logImpressions(response *restful.Response, requestId string, impressions []data.Impression) {
+	if err := s.DataClient.BatchInsertImpressions(impressions); err != nil {
+		base.Logger().Error("failed to log impressions", zap.String("request_id", requestId), zap.Error(err))
+		return
+	}
+	response.AddHeader("X-Request-Id", requestId)
+}
+
+// onlineRecommenders returns offline recommendation followed by fallback recommenders.
+func (s *RestServer) onlineRecommenders(fallbackRecommend []string) ([]Recommender, error) {
+	recommenders := []Recommender{s.RecommendOffline}
+	for _, recommender := range fallbackRecommend {
+		switch recommender {
+		case "collaborative":
+			recommenders = append(recommenders, s.RecommendCollaborative)
+		case "item_based":
+			recommenders = append(recommenders, s.RecommendItemBased)
+		case "user_based":
+			recommenders = append(recommenders, s.RecommendUserBased)
+		case "subscribe":
+			recommenders = append(recommenders, s.RecommendSubscribe)
+		case "collaborative_online":
+			recommenders = append(recommenders, s.RecommendCollaborativeOnline)
+		case "latest":
+			recommenders = append(recommenders, s.RecommendLatest)
+		case "popular":
+			recommenders = append(recommenders, s.RecommendPopular)
+		default:
+			return nil, fmt.Errorf("unknown fallback recommendation method `%s`", recommender)
+		}
+	}
+	return recommenders, nil
+}
+
+// BatchRecommendRequest is the request of recommendation for multiple users.
+type BatchRecommendRequest struct {
+	UserIds  []string
+	N        int
+	Category string
+	Offset   int
+}
+
+// getBatchRecommend recommends items to multiple users. Cached recommendations of all users are loaded in batch,
+// hidden items, latest items and popular items are shared between users.
+func (s *RestServer) getBatchRecommend(request *restful.Request, response *restful.Response) {
+	startTime := time.Now()
+	// parse arguments
+	var req BatchRecommendRequest
+	if err := request.ReadEntity(&req); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if req.N == 0 {
+		req.N = s.GorseConfig.Server.DefaultN
+	}
+	if req.N < 0 || req.Offset < 0 {
+		BadRequest(response, fmt.Errorf("invalid n %d or offset %d", req.N, req.Offset))
+		return
+	}
+	if len(req.UserIds) > s.GorseConfig.Server.MaxBatchRecommend {
+		BadRequest(response, fmt.Errorf("number of users %d exceeds limit %d", len(req.UserIds), s.GorseConfig.Server.MaxBatchRecommend))
+		return
+	}
+	// prefetch cached recommendations
+	shared := newRecommendCache()
+	var prefetchedItems []string
+	for _, prefix := range s.cachedRecommendPrefixes() {
+		recommendations, err := s.CacheClient.BatchGetCategoryScores(prefix, req.UserIds, req.Category, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			InternalServerError(response, err)
+			return
+		}
+		shared.prefetched[prefix] = make(map[string][]cache.Scored, len(req.UserIds))
+		for i, userId := range req.UserIds {
+			shared.prefetched[prefix][userId] = recommendations[i]
+			prefetchedItems = append(prefetchedItems, cache.RemoveScores(recommendations[i])...)
+		}
+	}
+	if err := s.checkHiddenItems(shared, prefetchedItems); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	// prefetch ignored items
+	ignoreKeys := make([]string, len(req.UserIds))
+	for i, userId := range req.UserIds {
+		ignoreKeys[i] = cache.Key(cache.IgnoreItems, userId)
+	}
+	ignoreItems, err := s.CacheClient.BatchGetSortedByScore(ignoreKeys, math32.Inf(-1), float32(time.Now().Unix()))
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	for i, userId := range req.UserIds {
+		shared.ignoreItems[userId] = ignoreItems[i]
+	}
+	// apply arms of experiments
+	strategies := make(map[string]*config.RecommendStrategy, len(req.UserIds))
+	for _, userId := range req.UserIds {
+		strategies[userId] = s.GorseConfig.Recommend.GetRecommendStrategy(userId)
+	}
+	if err = s.recordExperimentArms(strategies); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	// recommend items to users
+	results := make(map[string][]string, len(req.UserIds))
+	requestId := uuid.New().String()
+	var impressions []data.Impression
+	for _, userId := range req.UserIds {
+		if _, exist := results[userId]; exist {
+			continue
+		}
+		recommenders, err := s.onlineRecommenders(strategies[userId].FallbackRecommend)
+		if err != nil {
+			InternalServerError(response, err)
+			return
+		}
+		ctx, err := s.recommend(userId, req.Category, req.Offset+req.N, shared, recommenders...)
+		if err != nil {
+			InternalServerError(response, err)
+			return
+		}
+		results[userId] = ctx.results[mathutil.Min(req.Offset, len(ctx.results)):]
+		if s.GorseConfig.Server.EnableImpressionLog {
+			explanations := ctx.explanations[mathutil.Min(req.Offset, len(ctx.explanations)):]
+			impressions = append(impressions, newImpressions(requestId, userId, req.Offset, explanations)...)
+		}
+	}
+	// log impressions
+	if s.GorseConfig.Server.EnableImpressionLog {
+		s.logImpressions(response, requestId, impressions)
+	}
+	GetBatchRecommendSeconds.Observe(time.Since(startTime).Seconds())
 	Ok(response, results)
 }
 
+// getSessionRecommend recommends items to an anonymous visitor by items in the session. Items similar to positive
+// items in the session are recommended first, followed by latest and popular items in the order of fallback
+// recommenders. Feedback without type is treated as positive feedback.
+func (s *RestServer) getSessionRecommend(request *restful.Request, response *restful.Response) {
+	startTime := time.Now()
+	// parse arguments
+	category := request.PathParameter("category")
+	n, err := ParseInt(request, "n", s.GorseConfig.Server.DefaultN)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	offset, err := ParseInt(request, "offset", 0)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if n < 0 || offset < 0 {
+		BadRequest(response, fmt.Errorf("invalid n %d or offset %d", n, offset))
+		return
+	}
+	explain, err := ParseBool(request, "explain", false)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	var sessionFeedback []Feedback
+	if err = request.ReadEntity(&sessionFeedback); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	// create context, the anonymous visitor has no labels
+	ctx := &recommendContext{
+		category:     category,
+		user:         &data.User{},
+		n:            offset + n,
+		userFeedback: make([]data.Feedback, 0, len(sessionFeedback)),
+		excludeSet:   strset.New(),
+		shared:       newRecommendCache(),
+	}
+	for _, feedback := range sessionFeedback {
+		ctx.excludeSet.Add(feedback.ItemId)
+		if feedback.FeedbackType != "" && !funk.ContainsString(s.GorseConfig.Database.PositiveFeedbackType, feedback.FeedbackType) {
+			continue
+		}
+		var timestamp time.Time
+		if feedback.Timestamp != "" {
+			if timestamp, err = dateparse.ParseAny(feedback.Timestamp); err != nil {
+				BadRequest(response, err)
+				return
+			}
+		}
+		ctx.userFeedback = append(ctx.userFeedback, data.Feedback{FeedbackKey: feedback.FeedbackKey, Timestamp: timestamp})
+	}
+	// execute recommenders
+	recommenders := []Recommender{s.RecommendItemBased}
+	for _, recommender := range s.GorseConfig.Recommend.FallbackRecommend {
+		switch recommender {
+		case "latest":
+			recommenders = append(recommenders, s.RecommendLatest)
+		case "popular":
+			recommenders = append(recommenders, s.RecommendPopular)
+		}
+	}
+	// load merchandising rules, blocked items are excluded before recommenders run
+	if err = s.loadRules(ctx); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	for _, recommender := range recommenders {
+		if err = recommender(ctx); err != nil {
+			InternalServerError(response, err)
+			return
+		}
+	}
+	// apply merchandising rules and diversity
+	if err = s.rerank(ctx); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	explanations := ctx.explanations[mathutil.Min(offset, len(ctx.explanations)):mathutil.Min(offset+n, len(ctx.explanations))]
+	// log impressions of the anonymous visitor
+	if s.GorseConfig.Server.EnableImpressionLog {
+		requestId := uuid.New().String()
+		s.logImpressions(response, requestId, newImpressions(requestId, "", offset, explanations))
+	}
+	GetSessionRecommendSeconds.Observe(time.Since(startTime).Seconds())
+	// send result
+	if explain {
+		Ok(response, explanations)
+	} else {
+		results := make([]string, len(explanations))
+		for i := range explanations {
+			results[i] = explanations[i].ItemId
+		}
+		Ok(response, results)
+	}
+}
+
+// cachedRecommendPrefixes returns cache prefixes of cached recommendations used in online recommendation.
+func (s *RestServer) cachedRecommendPrefixes() []string {
+	prefixes := []string{cache.OfflineRecommend}
+	for _, recommender := range s.GorseConfig.Recommend.FallbackRecommend {
+		switch recommender {
+		case "collaborative":
+			prefixes = append(prefixes, cache.CollaborativeRecommend)
+		case "subscribe":
+			prefixes = append(prefixes, cache.SubscribeItems)
+		}
+	}
+	return prefixes
+}
+
+// recordExperimentArms records users in arms of experiments. Users are scored by the latest timestamp of
+// recommendation. Users in all arms are written at once.
+func (s *RestServer) recordExperimentArms(strategies map[string]*config.RecommendStrategy) error {
+	timestamp := float32(time.Now().Unix())
+	arms := make(map[string][]cache.Scored)
+	for userId, strategy := range strategies {
+		for experiment, arm := range strategy.Arms {
+			key := cache.Key(cache.ExperimentUsers, experiment, arm)
+			arms[key] = append(arms[key], cache.Scored{Id: userId, Score: timestamp})
+		}
+	}
+	if len(arms) == 0 {
+		return nil
+	}
+	return errors.Trace(s.CacheClient.BatchAddSorted(arms))
+}
+
+// contextRanker returns a recommender ranking items recommended by previous recommenders with context labels. The top
+// n items are kept.
+func (s *RestServer) contextRanker(clickModel click.FactorizationMachine, ctxLabels []string, n int) Recommender {
+	return func(ctx *recommendContext) error {
+		// labels of the user might have been loaded by merchandising rules
+		if err := s.requireUser(ctx); err != nil {
+			return errors.Trace(err)
+		}
+		explanations, err := s.rankByContext(clickModel, *ctx.user, ctx.explanations, ctxLabels)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// dropped items could be pinned
+		for _, explanation := range explanations[mathutil.Min(n, len(explanations)):] {
+			ctx.excludeSet.Remove(explanation.ItemId)
+		}
+		explanations = explanations[:mathutil.Min(n, len(explanations))]
+		ctx.results = make([]string, len(explanations))
+		for i := range explanations {
+			ctx.results[i] = explanations[i].ItemId
+		}
+		ctx.explanations = explanations
+		return nil
+	}
+}
+
+// rankByContext ranks items by the click model with context labels. Labels derived from the current time are appended
+// to the given context labels. Explanations of items are kept except that scores are replaced by click-through rates.
+func (s *RestServer) rankByContext(clickModel click.FactorizationMachine, user data.User, explanations []Explanation, ctxLabels []string) ([]Explanation, error) {
+	startTime := time.Now()
+	itemIds := make([]string, len(explanations))
+	explanationSet := make(map[string]Explanation, len(explanations))
+	for i, explanation := range explanations {
+		itemIds[i] = explanation.ItemId
+		explanationSet[explanation.ItemId] = explanation
+	}
+	scores, err := s.predictClick(clickModel, user, itemIds, ctxLabels)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cache.SortScores(scores)
+	ranked := make([]Explanation, len(scores))
+	for i, score := range scores {
+		ranked[i] = explanationSet[score.Id]
+		ranked[i].Score = score.Score
+	}
+	RankByContextSeconds.Observe(time.Since(startTime).Seconds())
+	return ranked, nil
+}
+
+// loadItems loads items into a map in a batch. Items in the map are not loaded again, and items not found are stored
+// as items without labels so that they are not loaded again either.
+func (s *RestServer) loadItems(items map[string]data.Item, itemIds []string) error {
+	var unloaded []string
+	for _, itemId := range itemIds {
+		if _, exist := items[itemId]; !exist {
+			unloaded = append(unloaded, itemId)
+			items[itemId] = data.Item{ItemId: itemId}
+		}
+	}
+	if len(unloaded) == 0 {
+		return nil
+	}
+	loaded, err := s.DataClient.BatchGetItems(unloaded)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, item := range loaded {
+		items[item.ItemId] = item
+	}
+	return nil
+}
+
+// predictClick predicts click-through rates of items for a user by the click model.
+func (s *RestServer) predictClick(clickModel click.FactorizationMachine, user data.User, itemIds, ctxLabels []string) ([]cache.Scored, error) {
+	items := make(map[string]data.Item, len(itemIds))
+	if err := s.loadItems(items, itemIds); err != nil {
+		return nil, errors.Trace(err)
+	}
+	userAttributes := user.GetAttributes(s.GorseConfig.Database.UserAttributes)
+	ctxLabels = append(append([]string{}, ctxLabels...), click.TimeContextLabels(time.Now())...)
+	scores := make([]cache.Scored, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		item := items[itemId]
+		scores = append(scores, cache.Scored{
+			Id:    itemId,
+			Score: clickModel.Predict(user.UserId, itemId, user.Labels, item.Labels, userAttributes, ctxLabels),
+		})
+	}
+	return scores, nil
+}
+
+// rankItems sorts candidate items for a user. Items are scored by the click model if click-through rate prediction
+// is enabled, otherwise by the ranking model if the user is known to it. Items unknown to the ranking model are placed
+// after known items. Items are sorted by popularity if neither model is available.
+func (s *RestServer) rankItems(userId string, itemIds, ctxLabels []string) ([]cache.Scored, error) {
+	strategy := s.GorseConfig.Recommend.GetRecommendStrategy(userId)
+	if clickModel := s.getClickModel(); strategy.EnableClickThroughPrediction && clickModel != nil && !clickModel.Invalid() {
+		user, err := s.DataClient.GetUser(userId)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, errors.Trace(err)
+		}
+		user.UserId = userId
+		scores, err := s.predictClick(clickModel, user, itemIds, ctxLabels)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cache.SortScores(scores)
+		return scores, nil
+	}
+	if rankingModel, _ := s.getRankingModel(); rankingModel != nil && !rankingModel.Invalid() &&
+		rankingModel.GetUserIndex().ToNumber(userId) != base.NotId {
+		var scores, unknown []cache.Scored
+		for _, itemId := range itemIds {
+			if rankingModel.GetItemIndex().ToNumber(itemId) != base.NotId {
+				scores = append(scores, cache.Scored{Id: itemId, Score: rankingModel.Predict(userId, itemId)})
+			} else {
+				unknown = append(unknown, cache.Scored{Id: itemId})
+			}
+		}
+		cache.SortScores(scores)
+		return append(scores, unknown...), nil
+	}
+	// popular items are loaded at once since the number of them is limited by the cache size
+	popularItems, err := s.CacheClient.GetSorted(cache.PopularItems, 0, -1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	popularity := make(map[string]float32, len(popularItems))
+	for _, item := range popularItems {
+		popularity[item.Id] = item.Score
+	}
+	scores := make([]cache.Scored, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		scores = append(scores, cache.Scored{Id: itemId, Score: popularity[itemId]})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return scores, nil
+}
+
+func (s *RestServer) rank(request *restful.Request, response *restful.Response) {
+	startTime := time.Now()
+	if !s.GorseConfig.Recommend.EnableRankAPI {
+		PageNotFound(response, errors.New("rank API is disabled"))
+		return
+	}
+	userId := request.PathParameter("user-id")
+	ctxLabels := request.QueryParameters("context")
+	var itemIds []string
+	if err := request.ReadEntity(&itemIds); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	scores, err := s.rankItems(userId, itemIds, ctxLabels)
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	RankSeconds.Observe(time.Since(startTime).Seconds())
+	Ok(response, scores)
+}
+
 // Success is the returned data structure for data insert operations.
 type Success struct {
 	RowAffected int
@@ -1107,6 +2318,67 @@ func (s *RestServer) deleteUser(request *restful.Request, response *restful.Resp
 	Ok(response, Success{RowAffected: 1})
 }
 
+func (s *RestServer) insertUserSubscribe(request *restful.Request, response *restful.Response) {
+	// Get user id and subscription
+	userId := request.PathParameter("user-id")
+	subscription := request.PathParameter("subscription")
+	// Insert subscription
+	user, err := s.DataClient.GetUser(userId)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			PageNotFound(response, err)
+		} else {
+			InternalServerError(response, err)
+		}
+		return
+	}
+	if !funk.ContainsString(user.Subscribe, subscription) {
+		user.Subscribe = append(user.Subscribe, subscription)
+	}
+	if err = s.DataClient.ModifyUser(userId, data.UserPatch{Subscribe: user.Subscribe}); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	// insert modify timestamp
+	if err = s.CacheClient.SetTime(cache.LastModifyUserTime, userId, time.Now()); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	Ok(response, Success{RowAffected: 1})
+}
+
+func (s *RestServer) deleteUserSubscribe(request *restful.Request, response *restful.Response) {
+	// Get user id and subscription
+	userId := request.PathParameter("user-id")
+	subscription := request.PathParameter("subscription")
+	// Delete subscription
+	user, err := s.DataClient.GetUser(userId)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			PageNotFound(response, err)
+		} else {
+			InternalServerError(response, err)
+		}
+		return
+	}
+	subscribe := make([]string, 0, len(user.Subscribe))
+	for _, sub := range user.Subscribe {
+		if sub != subscription {
+			subscribe = append(subscribe, sub)
+		}
+	}
+	if err = s.DataClient.ModifyUser(userId, data.UserPatch{Subscribe: subscribe}); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	// insert modify timestamp
+	if err = s.CacheClient.SetTime(cache.LastModifyUserTime, userId, time.Now()); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	Ok(response, Success{RowAffected: len(user.Subscribe) - len(subscribe)})
+}
+
 // get feedback by user-id with feedback type
 func (s *RestServer) getTypedFeedbackByUser(request *restful.Request, response *restful.Response) {
 	feedbackType := request.PathParameter("feedback-type")
@@ -1462,6 +2734,9 @@ type Feedback struct {
 	data.FeedbackKey
 	Timestamp string
 	Comment   string
+	Value     float64
+	Context   []string
+	RequestId string
 }
 
 func (s *RestServer) insertFeedback(overwrite bool) func(request *restful.Request, response *restful.Response) {
@@ -1482,6 +2757,9 @@ func (s *RestServer) insertFeedback(overwrite bool) func(request *restful.Reques
 			items.Add((*feedbackLiterTime)[i].ItemId)
 			feedback[i].FeedbackKey = (*feedbackLiterTime)[i].FeedbackKey
 			feedback[i].Comment = (*feedbackLiterTime)[i].Comment
+			feedback[i].Value = (*feedbackLiterTime)[i].Value
+			feedback[i].Context = (*feedbackLiterTime)[i].Context
+			feedback[i].RequestId = (*feedbackLiterTime)[i].RequestId
 			feedback[i].Timestamp, err = dateparse.ParseAny((*feedbackLiterTime)[i].Timestamp)
 			if err != nil {
 				BadRequest(response, err)
@@ -1509,6 +2787,10 @@ func (s *RestServer) insertFeedback(overwrite bool) func(request *restful.Reques
 				return
 			}
 		}
+		// push users into refresh queue, failure to enqueue is logged since feedback has been inserted
+		if s.GorseConfig.Recommend.EnableRefreshQueue {
+			s.enqueueUsers(feedback)
+		}
 		for _, itemId := range items.List() {
 			err = s.CacheClient.SetTime(cache.LastModifyItemTime, itemId, time.Now())
 			if err != nil {
@@ -1520,6 +2802,25 @@ func (s *RestServer) insertFeedback(overwrite bool) func(request *restful.Reques
 	}
 }
 
+// enqueueUsers pushes users of feedback into the refresh queue. Each user is enqueued once with the number of new
+// feedback.
+func (s *RestServer) enqueueUsers(feedback []data.Feedback) {
+	counts := make(map[string]float32)
+	var deltas []cache.Scored
+	for _, f := range feedback {
+		if _, exist := counts[f.UserId]; !exist {
+			deltas = append(deltas, cache.Scored{Id: f.UserId})
+		}
+		counts[f.UserId]++
+	}
+	for i := range deltas {
+		deltas[i].Score = counts[deltas[i].Id]
+	}
+	if err := s.CacheClient.BatchIncrSorted(cache.RefreshUsers, deltas); err != nil {
+		base.Logger().Error("failed to enqueue users", zap.Int("n_users", len(deltas)), zap.Error(err))
+	}
+}
+
 // FeedbackIterator is the iterator for feedback.
 type FeedbackIterator struct {
 	Cursor   string
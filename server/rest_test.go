@@ -15,17 +15,23 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"google.golang.org/protobuf/proto"
 	"net/http"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/bits-and-blooms/bitset"
 	"github.com/emicklei/go-restful/v3"
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/click"
+	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 )
@@ -168,6 +174,53 @@ func TestServer_Users(t *testing.T) {
 		End()
 }
 
+func TestServer_Subscribe(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.DataClient.BatchInsertUsers([]data.User{{UserId: "0", Subscribe: []string{"a"}}})
+	assert.NoError(t, err)
+	// insert subscription
+	apitest.New().
+		Handler(s.handler).
+		Put("/api/user/0/subscribe/b").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Put("/api/user/0/subscribe/b").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	user, err := s.DataClient.GetUser("0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, user.Subscribe)
+	// delete subscription
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/user/0/subscribe/a").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	user, err = s.DataClient.GetUser("0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, user.Subscribe)
+	// user not exists
+	apitest.New().
+		Handler(s.handler).
+		Put("/api/user/1/subscribe/a").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
 func TestServer_Items(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -606,7 +659,7 @@ func TestServer_Feedback(t *testing.T) {
 	feedback := []data.Feedback{
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}, Value: 3, Context: []string{"mobile"}},
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "3", ItemId: "6"}},
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "4", ItemId: "8"}},
 	}
@@ -694,7 +747,16 @@ func TestServer_Feedback(t *testing.T) {
 		Header("X-API-Key", apiKey).
 		Expect(t).
 		Status(http.StatusOK).
-		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z","Comment":""}]`).
+		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z","Comment":"","Value":3,"Context":["mobile"]}]`).
+		End()
+	// empty optional fields are omitted
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/user/1/feedback/click").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`[{"FeedbackType":"click", "UserId": "1", "ItemId": "2", "Timestamp":"0001-01-01T00:00:00Z","Comment":""}]`).
 		End()
 	apitest.New().
 		Handler(s.handler).
@@ -702,7 +764,7 @@ func TestServer_Feedback(t *testing.T) {
 		Header("X-API-Key", apiKey).
 		Expect(t).
 		Status(http.StatusOK).
-		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z","Comment":""}]`).
+		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z","Comment":"","Value":3,"Context":["mobile"]}]`).
 		End()
 	// test overwrite
 	apitest.New().
@@ -740,6 +802,50 @@ func TestServer_Feedback(t *testing.T) {
 	assert.Equal(t, "override", ret[0].Comment)
 }
 
+func TestServer_Feedback_RefreshQueue(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.EnableRefreshQueue = true
+	// insert feedback
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON([]data.Feedback{
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "0"}},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 3}`).
+		End()
+	// users are queued by number of feedback
+	queued, err := s.CacheClient.GetSorted(cache.RefreshUsers, 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Scored{{"0", 2}, {"1", 1}}, queued)
+	// feedback is inserted even if users fail to be enqueued
+	s.CacheClient = &failRefreshQueue{Database: s.CacheClient}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "0"}}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+}
+
+// failRefreshQueue fails to push users into the refresh queue.
+type failRefreshQueue struct {
+	cache.Database
+}
+
+func (db *failRefreshQueue) BatchIncrSorted(string, []cache.Scored) error {
+	return errors.New("failed to enqueue users")
+}
+
 func TestServer_List(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -752,6 +858,8 @@ func TestServer_List(t *testing.T) {
 	operators := []ListOperator{
 		{"Offline Recommend", cache.OfflineRecommend, "0", "/api/intermediate/recommend/0"},
 		{"Offline Recommend in Category", cache.OfflineRecommend, "0/0", "/api/intermediate/recommend/0/0"},
+		{"Subscribe Items", cache.SubscribeItems, "0", "/api/intermediate/subscribe/0"},
+		{"Subscribe Items in Category", cache.SubscribeItems, "0/0", "/api/intermediate/subscribe/0/0"},
 	}
 
 	for i, operator := range operators {
@@ -823,6 +931,7 @@ func TestServer_Sort(t *testing.T) {
 		{"User Neighbors", cache.Key(cache.UserNeighbors, "0"), "/api/user/0/neighbors"},
 		{"Item Neighbors", cache.Key(cache.ItemNeighbors, "0"), "/api/item/0/neighbors"},
 		{"Item Neighbors in Category", cache.Key(cache.ItemNeighbors, "0", "0"), "/api/item/0/neighbors/0"},
+		{"Item Audience", cache.Key(cache.ItemAudience, "0"), "/api/item/0/audience"},
 		{"Latest Items", cache.LatestItems, "/api/latest/"},
 		{"Latest Items in Category", cache.Key(cache.LatestItems, "0"), "/api/latest/0"},
 		{"Popular Items", cache.PopularItems, "/api/popular/"},
@@ -982,6 +1091,82 @@ func TestServer_Measurement(t *testing.T) {
 		End()
 }
 
+func TestServer_APIKeys(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.APIKeys = []config.APIKey{
+		{Name: "reader", Key: "reader_key", Scopes: []string{config.ScopeRead}, RateLimit: 1, Burst: 2},
+		{Name: "writer", Key: "writer_key", Scopes: []string{config.ScopeRead, config.ScopeWrite}},
+	}
+	// write with the writer key
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/item").
+		Header("X-API-Key", "writer_key").
+		JSON(data.Item{ItemId: "1"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, Success{RowAffected: 1})).
+		End()
+	// write with the reader key
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/item").
+		Header("X-API-Key", "reader_key").
+		JSON(data.Item{ItemId: "2"}).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+	// delete with the writer key
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/item/1").
+		Header("X-API-Key", "writer_key").
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+	// delete with the legacy key
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/item/1").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	// recommend in a session with the reader key
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", "reader_key").
+		JSON([]data.Feedback{}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	// read with the reader key until rate limited
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/items").
+		Header("X-API-Key", "reader_key").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/items").
+		Header("X-API-Key", "reader_key").
+		Expect(t).
+		Status(http.StatusTooManyRequests).
+		End()
+	// read with an unknown key
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/items").
+		Header("X-API-Key", "unknown_key").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
 func TestServer_GetRecommends(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -1040,6 +1225,49 @@ func TestServer_GetRecommends(t *testing.T) {
 		Status(http.StatusOK).
 		Body(marshal(t, []string{"6", "7", "8"})).
 		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "2",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "1", Source: "offline", Score: 99},
+			{ItemId: "3", Source: "offline", Score: 97},
+		})).
+		End()
+	// sources of offline recommendation are stored by workers
+	err = s.CacheClient.SetString(cache.OfflineRecommendSources, "0", `{"1":"item_based"}`)
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "2",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "1", Source: "item_based", Score: 99},
+			{ItemId: "3", Source: "offline", Score: 97},
+		})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"explain": "maybe",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
 	apitest.New().
 		Handler(s.handler).
 		Get("/api/recommend/0").
@@ -1090,110 +1318,646 @@ func TestServer_GetRecommends(t *testing.T) {
 		End()
 }
 
-func TestServer_GetRecommends_Replacement(t *testing.T) {
+// mockContextModel prefers items with larger ids on mobile devices and items with smaller ids on other devices.
+type mockContextModel struct {
+	click.FactorizationMachine
+}
+
+func (m *mockContextModel) Predict(_, itemId string, _, _, _, ctxLabels []string) float32 {
+	score, err := strconv.Atoi(itemId)
+	if err != nil {
+		panic(err)
+	}
+	for _, label := range ctxLabels {
+		if label == "device=mobile" {
+			return float32(score)
+		}
+	}
+	return -float32(score)
+}
+
+func (m *mockContextModel) Invalid() bool {
+	return false
+}
+
+func TestServer_GetBatchRecommends(t *testing.T) {
 	s := newMockServer(t)
-	s.GorseConfig.Recommend.EnableReplacement = true
 	defer s.Close(t)
+	s.GorseConfig.Recommend.FallbackRecommend = []string{"popular"}
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0",
+		[]cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetScores(cache.OfflineRecommend, "1",
+		[]cache.Scored{{"2", 98}, {"4", 96}, {"5", 95}, {"6", 94}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetCategoryScores(cache.OfflineRecommend, "0", "*",
+		[]cache.Scored{{"101", 99}, {"102", 98}})
+	assert.NoError(t, err)
+	// insert popular
+	err = s.CacheClient.SetSorted(cache.PopularItems,
+		[]cache.Scored{{"9", 91}, {"10", 90}, {"11", 89}, {"12", 88}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.Key(cache.PopularItems, "*"),
+		[]cache.Scored{{"109", 91}, {"110", 90}})
+	assert.NoError(t, err)
 	// insert hidden items
-	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"0", 100}})
+	err = s.CacheClient.SetInt(cache.HiddenItems, "2", 1)
 	assert.NoError(t, err)
-	err = s.CacheClient.SetInt(cache.HiddenItems, "0", 1)
+	err = s.CacheClient.SetInt(cache.HiddenItems, "10", 1)
 	assert.NoError(t, err)
-	// insert recommendation
-	err = s.CacheClient.AppendScores(cache.OfflineRecommend, "0",
-		cache.Scored{Id: "1", Score: 99},
-		cache.Scored{Id: "2", Score: 98},
-		cache.Scored{Id: "3", Score: 97},
-		cache.Scored{Id: "4", Score: 96},
-		cache.Scored{Id: "5", Score: 95},
-		cache.Scored{Id: "6", Score: 94},
-		cache.Scored{Id: "7", Score: 93},
-		cache.Scored{Id: "8", Score: 92},
-	)
+	// insert ignored items
+	err = s.CacheClient.AddSorted(cache.Key(cache.IgnoreItems, "2"), []cache.Scored{{"12", float32(time.Now().Unix() - 1)}})
 	assert.NoError(t, err)
 	// insert feedback
-	feedback := []data.Feedback{
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "2"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "4"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "1"}, Timestamp: time.Now().Add(time.Hour)},
-	}
 	apitest.New().
 		Handler(s.handler).
 		Post("/api/feedback").
 		Header("X-API-Key", apiKey).
-		JSON(feedback).
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "1", ItemId: "5"}}}).
 		Expect(t).
 		Status(http.StatusOK).
-		Body(`{"RowAffected": 3}`).
+		Body(`{"RowAffected": 1}`).
 		End()
 	apitest.New().
 		Handler(s.handler).
-		Get("/api/recommend/0").
+		Post("/api/recommend").
 		Header("X-API-Key", apiKey).
-		QueryParams(map[string]string{
-			"n": "3",
-		}).
+		JSON(BatchRecommendRequest{UserIds: []string{"0", "1", "2"}, N: 4}).
 		Expect(t).
 		Status(http.StatusOK).
-		Body(marshal(t, []string{"1", "2", "3"})).
+		Body(marshal(t, map[string][]string{
+			"0": {"1", "3", "4", "9"},
+			"1": {"4", "6", "9", "11"},
+			"2": {"9", "11"},
+		})).
 		End()
-}
-
-func TestServer_GetRecommends_Fallback_ItemBasedSimilar(t *testing.T) {
-	s := newMockServer(t)
-	s.GorseConfig.Recommend.NumFeedbackFallbackItemBased = 4
-	defer s.Close(t)
-	// insert recommendation
-	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0",
-		[]cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
-	assert.NoError(t, err)
-	// insert feedback
-	feedback := []data.Feedback{
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "1"}, Timestamp: time.Date(2010, 1, 1, 1, 1, 1, 1, time.UTC)},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "2"}, Timestamp: time.Date(2009, 1, 1, 1, 1, 1, 1, time.UTC)},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "3"}, Timestamp: time.Date(2008, 1, 1, 1, 1, 1, 1, time.UTC)},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "4"}, Timestamp: time.Date(2007, 1, 1, 1, 1, 1, 1, time.UTC)},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "5"}, Timestamp: time.Date(2006, 1, 1, 1, 1, 1, 1, time.UTC)},
-	}
 	apitest.New().
 		Handler(s.handler).
-		Post("/api/feedback").
+		Post("/api/recommend").
 		Header("X-API-Key", apiKey).
-		JSON(feedback).
+		JSON(BatchRecommendRequest{UserIds: []string{"0", "1"}, N: 2, Offset: 1, Category: "*"}).
 		Expect(t).
 		Status(http.StatusOK).
-		Body(`{"RowAffected": 5}`).
+		Body(marshal(t, map[string][]string{
+			"0": {"102", "109"},
+			"1": {"110"},
+		})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/recommend").
+		Header("X-API-Key", apiKey).
+		JSON(BatchRecommendRequest{UserIds: []string{"0"}, N: -1}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	s.GorseConfig.Server.MaxBatchRecommend = 1
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/recommend").
+		Header("X-API-Key", apiKey).
+		JSON(BatchRecommendRequest{UserIds: []string{"0", "1"}}).
+		Expect(t).
+		Status(http.StatusBadRequest).
 		End()
+}
 
+func TestServer_SessionRecommend(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Database.PositiveFeedbackType = []string{"star"}
+	s.GorseConfig.Recommend.FallbackRecommend = []string{"popular"}
 	// insert similar items
-	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "1"), []cache.Scored{
-		{"2", 100000},
-		{"9", 1},
-	})
+	err := s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "1"), []cache.Scored{{"2", 100}, {"3", 2}, {"4", 1}})
 	assert.NoError(t, err)
-	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "2"), []cache.Scored{
-		{"3", 100000},
-		{"8", 1},
-		{"9", 1},
-	})
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "2"), []cache.Scored{{"9", 3}})
 	assert.NoError(t, err)
-	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "3"), []cache.Scored{
-		{"4", 100000},
-		{"7", 1},
-		{"8", 1},
-		{"9", 1},
-	})
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "5"), []cache.Scored{{"3", 1}, {"6", 50}})
 	assert.NoError(t, err)
-	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "4"), []cache.Scored{
-		{"1", 100000},
-		{"6", 1},
-		{"7", 1},
-		{"8", 1},
-		{"9", 1},
-	})
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "1", "*"), []cache.Scored{{"103", 1}})
 	assert.NoError(t, err)
-	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "5"), []cache.Scored{
-		{"1", 1},
+	// insert popular items
+	err = s.CacheClient.SetSorted(cache.PopularItems, []cache.Scored{{"3", 11}, {"7", 10}, {"8", 9}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.Key(cache.PopularItems, "*"), []cache.Scored{{"107", 10}})
+	assert.NoError(t, err)
+	// insert hidden items
+	err = s.CacheClient.SetInt(cache.HiddenItems, "4", 1)
+	assert.NoError(t, err)
+	// recommend for session
+	session := []Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", ItemId: "5"}},
+		{FeedbackKey: data.FeedbackKey{ItemId: "2"}, Timestamp: "2022-01-01"},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "4"}).
+		JSON(session).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"9", "3", "7", "8"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "10", "offset": "3"}).
+		JSON(session).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"8"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "2", "explain": "true"}).
+		JSON(session).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "9", Source: "item_based", Score: 3, Because: []string{"2"}},
+			{ItemId: "3", Source: "item_based", Score: 2, Because: []string{"1"}},
+		})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend/*").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "3"}).
+		JSON(session[:1]).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"103", "107"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		JSON([]Feedback{{FeedbackKey: data.FeedbackKey{ItemId: "1"}, Timestamp: "not a time"}}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "-1"}).
+		JSON(session).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"offset": "-1"}).
+		JSON(session).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_SessionRecommend_Rules(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.FallbackRecommend = []string{"popular"}
+	// insert similar items
+	err := s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "1"), []cache.Scored{{"2", 100}, {"3", 2}, {"4", 1}})
+	assert.NoError(t, err)
+	// insert popular items
+	err = s.CacheClient.SetSorted(cache.PopularItems, []cache.Scored{{"5", 11}, {"6", 10}})
+	assert.NoError(t, err)
+	// insert rules
+	rules := []data.Rule{
+		{RuleId: "0", Type: data.RuleBlock, ItemId: "2"},
+		{RuleId: "1", Type: data.RuleBoost, ItemId: "5", Multiplier: 3},
+		{RuleId: "2", Type: data.RulePin, ItemId: "10", Position: 0},
+		{RuleId: "3", Type: data.RulePin, ItemId: "6", Position: 1, UserLabels: []string{"vip"}},
+	}
+	for _, rule := range rules {
+		err = s.DataClient.InsertRule(rule)
+		assert.NoError(t, err)
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "4"}).
+		JSON([]Feedback{{FeedbackKey: data.FeedbackKey{ItemId: "1"}}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"10", "5", "3", "4"})).
+		End()
+}
+
+func TestServer_GetRecommends_Impressions(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.EnableImpressionLog = true
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}})
+	assert.NoError(t, err)
+	result := apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":      "2",
+			"offset": "1",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "3"})).
+		End()
+	requestId := result.Response.Header.Get("X-Request-Id")
+	assert.NotEmpty(t, requestId)
+	// check impressions
+	var impressions []data.Impression
+	impressionChan, errChan := s.DataClient.GetImpressionStream(10, nil)
+	for batch := range impressionChan {
+		impressions = append(impressions, batch...)
+	}
+	assert.NoError(t, <-errChan)
+	assert.Equal(t, 2, len(impressions))
+	for _, impression := range impressions {
+		assert.Equal(t, requestId, impression.RequestId)
+		assert.Equal(t, "0", impression.UserId)
+		assert.Equal(t, "offline", impression.Source)
+		if impression.ItemId == "2" {
+			assert.Equal(t, 1, impression.Position)
+		} else {
+			assert.Equal(t, "3", impression.ItemId)
+			assert.Equal(t, 2, impression.Position)
+		}
+	}
+	// insert feedback with request id
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON([]Feedback{{
+			FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "2"},
+			Timestamp:   "2000-01-01",
+			RequestId:   requestId,
+		}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	feedback, err := s.DataClient.GetUserItemFeedback("0", "2")
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(feedback)) {
+		assert.Equal(t, requestId, feedback[0].RequestId)
+	}
+}
+
+// impressionFailedDatabase is a database failing to insert impressions.
+type impressionFailedDatabase struct {
+	data.Database
+}
+
+func (impressionFailedDatabase) BatchInsertImpressions([]data.Impression) error {
+	return errors.New("failed to insert impressions")
+}
+
+func TestServer_GetRecommends_ImpressionsBestEffort(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.EnableImpressionLog = true
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}})
+	assert.NoError(t, err)
+	// recommendations are served without request id if impressions fail to be logged
+	s.DataClient = impressionFailedDatabase{Database: s.DataClient}
+	result := apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "2"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2"})).
+		End()
+	assert.Empty(t, result.Response.Header.Get("X-Request-Id"))
+}
+
+func TestServer_GetBatchRecommends_Impressions(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.EnableImpressionLog = true
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"1", 99}, {"2", 98}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetScores(cache.OfflineRecommend, "1", []cache.Scored{{"3", 97}, {"4", 96}})
+	assert.NoError(t, err)
+	result := apitest.New().
+		Handler(s.handler).
+		Post("/api/recommend").
+		Header("X-API-Key", apiKey).
+		JSON(BatchRecommendRequest{UserIds: []string{"0", "1"}, N: 1, Offset: 1}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, map[string][]string{"0": {"2"}, "1": {"4"}})).
+		End()
+	requestId := result.Response.Header.Get("X-Request-Id")
+	assert.NotEmpty(t, requestId)
+	// impressions of all users share the request id
+	var impressions []data.Impression
+	impressionChan, errChan := s.DataClient.GetImpressionStream(10, nil)
+	for batch := range impressionChan {
+		impressions = append(impressions, batch...)
+	}
+	assert.NoError(t, <-errChan)
+	sort.Slice(impressions, func(i, j int) bool {
+		return impressions[i].ItemId < impressions[j].ItemId
+	})
+	if assert.Equal(t, 2, len(impressions)) {
+		assert.Equal(t, requestId, impressions[0].RequestId)
+		assert.Equal(t, "0", impressions[0].UserId)
+		assert.Equal(t, "2", impressions[0].ItemId)
+		assert.Equal(t, 1, impressions[0].Position)
+		assert.Equal(t, requestId, impressions[1].RequestId)
+		assert.Equal(t, "1", impressions[1].UserId)
+		assert.Equal(t, "4", impressions[1].ItemId)
+		assert.Equal(t, 1, impressions[1].Position)
+	}
+}
+
+func TestServer_SessionRecommend_Impressions(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.EnableImpressionLog = true
+	s.GorseConfig.Recommend.FallbackRecommend = []string{"popular"}
+	err := s.CacheClient.SetSorted(cache.PopularItems, []cache.Scored{{"1", 10}, {"2", 9}})
+	assert.NoError(t, err)
+	result := apitest.New().
+		Handler(s.handler).
+		Post("/api/session/recommend").
+		Header("X-API-Key", apiKey).
+		JSON([]Feedback{}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2"})).
+		End()
+	requestId := result.Response.Header.Get("X-Request-Id")
+	assert.NotEmpty(t, requestId)
+	var impressions []data.Impression
+	impressionChan, errChan := s.DataClient.GetImpressionStream(10, nil)
+	for batch := range impressionChan {
+		impressions = append(impressions, batch...)
+	}
+	assert.NoError(t, <-errChan)
+	assert.Equal(t, 2, len(impressions))
+	for _, impression := range impressions {
+		assert.Equal(t, requestId, impression.RequestId)
+		assert.Empty(t, impression.UserId)
+		assert.Equal(t, "popular", impression.Source)
+	}
+}
+
+func TestServer_GetRecommends_Experiment(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.FallbackRecommend = []string{"latest"}
+	s.GorseConfig.Recommend.Experiments = []config.ExperimentConfig{
+		{Name: "e", Arms: []config.ExperimentArm{
+			{Name: "control", Weight: 0},
+			{Name: "popular", Weight: 1, FallbackRecommend: []string{"popular"}},
+		}},
+	}
+	// insert latest and popular items
+	err := s.CacheClient.SetSorted(cache.LatestItems, []cache.Scored{{"1", 10}, {"2", 9}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.PopularItems, []cache.Scored{{"3", 10}, {"4", 9}})
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{"n": "2"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"3", "4"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/recommend").
+		Header("X-API-Key", apiKey).
+		JSON(BatchRecommendRequest{UserIds: []string{"1"}, N: 2}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, map[string][]string{"1": {"3", "4"}})).
+		End()
+	// users in arms are recorded
+	users, err := s.CacheClient.GetSorted(cache.Key(cache.ExperimentUsers, "e", "popular"), 0, -1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0", "1"}, cache.RemoveScores(users))
+}
+
+func TestServer_GetRecommends_Context(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.EnableClickThroughPrediction = true
+	s.SetClickModel(&mockContextModel{})
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{
+		{Id: "1", Score: 99},
+		{Id: "2", Score: 98},
+		{Id: "3", Score: 97},
+		{Id: "4", Score: 96},
+		{Id: "5", Score: 95},
+	})
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "3",
+			"context": "device=mobile",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"5", "4", "3"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "2",
+			"offset":  "1",
+			"context": "device=mobile",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"4", "3"})).
+		End()
+	// scores are click-through rates after ranking by context
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "2",
+			"context": "device=mobile",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "5", Source: "offline", Score: 5},
+			{ItemId: "4", Source: "offline", Score: 4},
+		})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "3",
+			"context": "device=desktop",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3"})).
+		End()
+	// pinned items keep their positions after ranking by context
+	err = s.DataClient.InsertRule(data.Rule{RuleId: "0", Type: data.RulePin, ItemId: "1", Position: 1})
+	assert.NoError(t, err)
+	s.GorseConfig.Master.MetaTimeout = 0
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "3",
+			"context": "device=mobile",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"5", "1", "4"})).
+		End()
+}
+
+func TestServer_GetRecommends_Replacement(t *testing.T) {
+	s := newMockServer(t)
+	s.GorseConfig.Recommend.EnableReplacement = true
+	defer s.Close(t)
+	// insert hidden items
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"0", 100}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetInt(cache.HiddenItems, "0", 1)
+	assert.NoError(t, err)
+	// insert recommendation
+	err = s.CacheClient.AppendScores(cache.OfflineRecommend, "0",
+		cache.Scored{Id: "1", Score: 99},
+		cache.Scored{Id: "2", Score: 98},
+		cache.Scored{Id: "3", Score: 97},
+		cache.Scored{Id: "4", Score: 96},
+		cache.Scored{Id: "5", Score: 95},
+		cache.Scored{Id: "6", Score: 94},
+		cache.Scored{Id: "7", Score: 93},
+		cache.Scored{Id: "8", Score: 92},
+	)
+	assert.NoError(t, err)
+	// insert feedback
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "4"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "1"}, Timestamp: time.Now().Add(time.Hour)},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 3}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3"})).
+		End()
+}
+
+func TestServer_GetRecommends_Fallback_ItemBasedSimilar(t *testing.T) {
+	s := newMockServer(t)
+	s.GorseConfig.Recommend.NumFeedbackFallbackItemBased = 4
+	defer s.Close(t)
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.OfflineRecommend, "0",
+		[]cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
+	assert.NoError(t, err)
+	// insert feedback
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "1"}, Timestamp: time.Date(2010, 1, 1, 1, 1, 1, 1, time.UTC)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "2"}, Timestamp: time.Date(2009, 1, 1, 1, 1, 1, 1, time.UTC)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "3"}, Timestamp: time.Date(2008, 1, 1, 1, 1, 1, 1, time.UTC)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "4"}, Timestamp: time.Date(2007, 1, 1, 1, 1, 1, 1, time.UTC)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "5"}, Timestamp: time.Date(2006, 1, 1, 1, 1, 1, 1, time.UTC)},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 5}`).
+		End()
+
+	// insert similar items
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "1"), []cache.Scored{
+		{"2", 100000},
+		{"9", 1},
+	})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "2"), []cache.Scored{
+		{"3", 100000},
+		{"8", 1},
+		{"9", 1},
+	})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "3"), []cache.Scored{
+		{"4", 100000},
+		{"7", 1},
+		{"8", 1},
+		{"9", 1},
+	})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "4"), []cache.Scored{
+		{"1", 100000},
+		{"6", 1},
+		{"7", 1},
+		{"8", 1},
+		{"9", 1},
+	})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemNeighbors, "5"), []cache.Scored{
+		{"1", 1},
 		{"6", 1},
 		{"7", 100000},
 		{"8", 100},
@@ -1236,6 +2000,22 @@ func TestServer_GetRecommends_Fallback_ItemBasedSimilar(t *testing.T) {
 		Status(http.StatusOK).
 		Body(marshal(t, []string{"9", "8", "7"})).
 		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "3",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "9", Source: "item_based", Score: 4, Because: []string{"1", "2", "3", "4"}},
+			{ItemId: "8", Source: "item_based", Score: 3, Because: []string{"2", "3", "4"}},
+			{ItemId: "7", Source: "item_based", Score: 2, Because: []string{"3", "4"}},
+		})).
+		End()
 	s.GorseConfig.Recommend.FallbackRecommend = []string{"item_based"}
 	apitest.New().
 		Handler(s.handler).
@@ -1317,6 +2097,22 @@ func TestServer_GetRecommends_Fallback_UserBasedSimilar(t *testing.T) {
 		Status(http.StatusOK).
 		Body(marshal(t, []string{"48", "11", "12"})).
 		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "3",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "48", Source: "user_based", Score: 2.5, Because: []string{"2", "3"}},
+			{ItemId: "11", Source: "user_based", Score: 2, Because: []string{"1"}},
+			{ItemId: "12", Source: "user_based", Score: 1.5, Because: []string{"2"}},
+		})).
+		End()
 	apitest.New().
 		Handler(s.handler).
 		Get("/api/recommend/0/*").
@@ -1330,6 +2126,371 @@ func TestServer_GetRecommends_Fallback_UserBasedSimilar(t *testing.T) {
 		End()
 }
 
+func newMockRankingModel() ranking.MatrixFactorization {
+	m := ranking.NewBPR(nil)
+	m.UserIndex = base.NewMapIndex()
+	m.UserFactor = [][]float32{}
+	m.ItemIndex = base.NewMapIndex()
+	m.ItemPredictable = bitset.New(6)
+	for i := 1; i <= 6; i++ {
+		m.ItemIndex.Add(strconv.Itoa(i))
+		if i != 6 {
+			m.ItemPredictable.Set(uint(i - 1))
+		}
+	}
+	m.ItemFactor = [][]float32{
+		{1, 0, 0, 0, 0, 0, 0, 0},
+		{0, 1, 0, 0, 0, 0, 0, 0},
+		{1, 1, 0, 0, 0, 0, 0, 0},
+		{0.5, 0, 0, 0, 0, 0, 0, 0},
+		{0.1, 0, 0, 0, 0, 0, 0, 0},
+		{1, 1, 1, 1, 1, 1, 1, 1},
+	}
+	return m
+}
+
+func TestServer_GetRecommends_Diversity(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.EnableDiversity = true
+	s.GorseConfig.Recommend.DiversityWindow = 3
+	// insert items
+	err := s.DataClient.BatchInsertItems([]data.Item{
+		{ItemId: "1", Labels: []string{"author:x", "a"}},
+		{ItemId: "2", Labels: []string{"author:x", "a"}},
+		{ItemId: "3", Labels: []string{"author:x", "b"}},
+		{ItemId: "4", Labels: []string{"author:y", "b"}},
+	})
+	assert.NoError(t, err)
+	// insert recommendation
+	err = s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
+	assert.NoError(t, err)
+	// similar items are pushed back
+	s.GorseConfig.Recommend.DiversityLambda = 0.5
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "3", "2", "4"})).
+		End()
+	// at most 2 items of an author in the first 3 positions
+	s.GorseConfig.Recommend.DiversityLambda = 1
+	s.GorseConfig.Recommend.DiversityCaps = map[string]int{"author:": 2}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "4", "3"})).
+		End()
+}
+
+func TestServer_GetRecommends_DiversityContext(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.EnableClickThroughPrediction = true
+	s.SetClickModel(&mockContextModel{})
+	s.GorseConfig.Recommend.EnableDiversity = true
+	s.GorseConfig.Recommend.DiversityWindow = 3
+	s.GorseConfig.Recommend.DiversityLambda = 1
+	s.GorseConfig.Recommend.DiversityCaps = map[string]int{"author:": 2}
+	// insert items
+	err := s.DataClient.BatchInsertItems([]data.Item{
+		{ItemId: "1", Labels: []string{"author:y"}},
+		{ItemId: "2", Labels: []string{"author:x"}},
+		{ItemId: "3", Labels: []string{"author:x"}},
+		{ItemId: "4", Labels: []string{"author:x"}},
+	})
+	assert.NoError(t, err)
+	// insert recommendation
+	err = s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
+	assert.NoError(t, err)
+	// caps are kept after ranking by context
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "4",
+			"context": "device=mobile",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"4", "3", "1", "2"})).
+		End()
+}
+
+func TestServer_GetRecommends_Rules(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert user
+	err := s.DataClient.BatchInsertUsers([]data.User{{UserId: "0", Labels: []string{"vip"}}})
+	assert.NoError(t, err)
+	// insert recommendation
+	err = s.CacheClient.SetScores(cache.OfflineRecommend, "0", []cache.Scored{
+		{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}, {"5", 95}, {"6", 94}, {"7", 93}})
+	assert.NoError(t, err)
+	// insert hidden item
+	err = s.CacheClient.SetInt(cache.HiddenItems, "11", 1)
+	assert.NoError(t, err)
+	// insert rules
+	now := time.Now()
+	rules := []data.Rule{
+		{RuleId: "0", Type: data.RuleBlock, ItemId: "2"},
+		{RuleId: "1", Type: data.RuleBlock, ItemId: "3", UserLabels: []string{"other"}},
+		{RuleId: "2", Type: data.RuleBlock, ItemId: "1", Category: "*"},
+		{RuleId: "3", Type: data.RuleBoost, ItemId: "5", Multiplier: 3},
+		{RuleId: "4", Type: data.RulePin, ItemId: "10", Position: 0, StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)},
+		{RuleId: "5", Type: data.RulePin, ItemId: "4", Position: 3, EndTime: now.Add(-time.Hour)},
+		{RuleId: "6", Type: data.RulePin, ItemId: "6", Position: 1, UserLabels: []string{"vip"}},
+		{RuleId: "7", Type: data.RulePin, ItemId: "11", Position: 2},
+	}
+	for _, rule := range rules {
+		err = s.DataClient.InsertRule(rule)
+		assert.NoError(t, err)
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "5",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"10", "6", "5", "1", "3"})).
+		End()
+	// rules are cached until meta timeout expires
+	err = s.DataClient.InsertRule(data.Rule{RuleId: "8", Type: data.RuleBlock, ItemId: "5"})
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "5",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"10", "6", "5", "1", "3"})).
+		End()
+	s.GorseConfig.Master.MetaTimeout = 0
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "5",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"10", "6", "1", "3", "4"})).
+		End()
+}
+
+func TestServer_GetRecommends_Fallback_CollaborativeOnline(t *testing.T) {
+	for _, enableColIndex := range []bool{false, true} {
+		s := newMockServer(t)
+		s.GorseConfig.Recommend.FallbackRecommend = []string{"collaborative_online"}
+		s.GorseConfig.Recommend.EnableColIndex = enableColIndex
+		// no ranking model
+		apitest.New().
+			Handler(s.handler).
+			Get("/api/recommend/0").
+			Header("X-API-Key", apiKey).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, []string{})).
+			End()
+		s.SetRankingModel(newMockRankingModel())
+		// insert feedback
+		err := s.DataClient.BatchInsertFeedback([]data.Feedback{
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "1"}},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "2"}},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "100"}},
+		}, true, true, true)
+		assert.NoError(t, err)
+		err = s.CacheClient.AddSet(cache.Key(cache.ItemCategories, "4"), "*")
+		assert.NoError(t, err)
+		// test fallback
+		apitest.New().
+			Handler(s.handler).
+			Get("/api/recommend/0").
+			Header("X-API-Key", apiKey).
+			QueryParams(map[string]string{
+				"n": "3",
+			}).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, []string{"3", "4", "5"})).
+			End()
+		apitest.New().
+			Handler(s.handler).
+			Get("/api/recommend/0/*").
+			Header("X-API-Key", apiKey).
+			QueryParams(map[string]string{
+				"n": "3",
+			}).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, []string{"4"})).
+			End()
+		s.Close(t)
+	}
+}
+
+func TestServer_GetItemAudience(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.CacheClient.SetSorted(cache.Key(cache.ItemAudience, "0"), []cache.Scored{
+		{Id: "1", Score: 100},
+		{Id: "2", Score: 99},
+		{Id: "3", Score: 98},
+		{Id: "4", Score: 97},
+		{Id: "5", Score: 96},
+	})
+	assert.NoError(t, err)
+	err = s.DataClient.BatchInsertUsers([]data.User{
+		{UserId: "1", Labels: []string{"a", "b"}},
+		{UserId: "2", Labels: []string{"a"}},
+		{UserId: "4", Labels: []string{"a", "b"}},
+		{UserId: "5", Labels: []string{"a", "b"}},
+	})
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/item/0/audience").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":     "2",
+			"label": "a",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{{Id: "1", Score: 100}, {Id: "2", Score: 99}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/item/0/audience").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":      "2",
+			"offset": "1",
+			"label":  "b",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{{Id: "4", Score: 97}, {Id: "5", Score: 96}})).
+		End()
+	// users in the audience are loaded page by page
+	audience := make([]cache.Scored, audiencePageSize+1)
+	for i := range audience {
+		audience[i] = cache.Scored{Id: strconv.Itoa(i + 10), Score: float32(-i)}
+	}
+	err = s.CacheClient.SetSorted(cache.Key(cache.ItemAudience, "1"), audience)
+	assert.NoError(t, err)
+	err = s.DataClient.BatchInsertUsers([]data.User{{UserId: audience[audiencePageSize].Id, Labels: []string{"c"}}})
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/item/1/audience").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":     "2",
+			"label": "c",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{audience[audiencePageSize]})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/item/0/audience").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":     "-1",
+			"label": "a",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_Rank(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Recommend.EnableClickThroughPrediction = false
+	// rank API is disabled
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rank/0").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"3", "1", "4"}).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	s.GorseConfig.Recommend.EnableRankAPI = true
+	// rank by popularity
+	err := s.CacheClient.SetSorted(cache.PopularItems, []cache.Scored{{Id: "1", Score: 10}, {Id: "4", Score: 20}})
+	assert.NoError(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rank/0").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"3", "1", "4"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{{Id: "4", Score: 20}, {Id: "1", Score: 10}, {Id: "3", Score: 0}})).
+		End()
+	// rank by ranking model
+	rankingModel := newMockRankingModel().(*ranking.BPR)
+	rankingModel.UserIndex.Add("0")
+	rankingModel.UserFactor = [][]float32{{1, 1, 0, 0, 0, 0, 0, 0}}
+	s.SetRankingModel(rankingModel)
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rank/0").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"4", "100", "3", "1"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{{Id: "3", Score: 2}, {Id: "1", Score: 1}, {Id: "4", Score: 0.5}, {Id: "100", Score: 0}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rank/1").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"3", "1", "4"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{{Id: "4", Score: 20}, {Id: "1", Score: 10}, {Id: "3", Score: 0}})).
+		End()
+	// rank by click model
+	s.GorseConfig.Recommend.EnableClickThroughPrediction = true
+	s.SetClickModel(&mockContextModel{})
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rank/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"context": "device=mobile",
+		}).
+		JSON([]string{"3", "1", "4"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.Scored{{Id: "4", Score: 4}, {Id: "3", Score: 3}, {Id: "1", Score: 1}})).
+		End()
+}
+
 func TestServer_GetRecommends_Fallback_PreCached(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -1409,6 +2570,36 @@ func TestServer_GetRecommends_Fallback_PreCached(t *testing.T) {
 		Status(http.StatusOK).
 		Body(marshal(t, []string{"101", "102", "103", "104", "105", "106", "107", "108"})).
 		End()
+	// test subscribe fallback
+	err = s.CacheClient.SetScores(cache.SubscribeItems, "0",
+		[]cache.Scored{{"17", 75}, {"18", 74}, {"19", 73}, {"20", 72}})
+	assert.NoError(t, err)
+	err = s.CacheClient.SetCategoryScores(cache.SubscribeItems, "0", "*",
+		[]cache.Scored{{"117", 75}, {"118", 74}, {"119", 73}, {"120", 72}})
+	assert.NoError(t, err)
+	s.GorseConfig.Recommend.FallbackRecommend = []string{"subscribe"}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "8",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3", "4", "17", "18", "19", "20"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0/*").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "8",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"101", "102", "103", "104", "117", "118", "119", "120"})).
+		End()
 	// test collaborative filtering
 	s.GorseConfig.Recommend.FallbackRecommend = []string{"collaborative"}
 	apitest.New().
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/emicklei/go-restful/v3"
+	"math"
 	"math/rand"
 	"time"
 
@@ -42,6 +43,9 @@ type Server struct {
 	masterPort   int
 	testMode     bool
 	cacheFile    string
+
+	clickModelVersion   int64
+	rankingModelVersion int64
 }
 
 // NewServer creates a server node.
@@ -96,6 +100,15 @@ func (s *Server) Serve() {
 	s.StartHttpServer()
 }
 
+// Shutdown closes the cache store so that the in-memory cache store writes its snapshot.
+func (s *Server) Shutdown() {
+	if s.CacheClient != nil {
+		if err := s.CacheClient.Close(); err != nil {
+			base.Logger().Error("failed to close cache store", zap.Error(err))
+		}
+	}
+}
+
 // Sync this server to the master.
 func (s *Server) Sync() {
 	defer base.CheckPanic()
@@ -133,13 +146,53 @@ func (s *Server) Sync() {
 		// connect to cache store
 		if s.cachePath != s.GorseConfig.Database.CacheStore {
 			base.Logger().Info("connect cache store", zap.String("database", s.GorseConfig.Database.CacheStore))
-			if s.CacheClient, err = cache.Open(s.GorseConfig.Database.CacheStore); err != nil {
+			var cacheClient cache.Database
+			if cacheClient, err = cache.Open(s.GorseConfig.Database.CacheStore); err != nil {
 				base.Logger().Error("failed to connect cache store", zap.Error(err))
 				goto sleep
 			}
+			// release previous cache store
+			if s.CacheClient != nil {
+				if err = s.CacheClient.Close(); err != nil {
+					base.Logger().Error("failed to close cache store", zap.Error(err))
+				}
+			}
+			s.CacheClient = cacheClient
 			s.cachePath = s.GorseConfig.Database.CacheStore
 		}
 
+		// pull click model for context-aware ranking if click-through rate prediction is enabled in any arm
+		if s.GorseConfig.Recommend.HasClickThroughPrediction() && meta.ClickModelVersion != s.clickModelVersion {
+			base.Logger().Info("start pull click model", zap.String("version", base.Hex(meta.ClickModelVersion)))
+			if clickModelReceiver, err := s.masterClient.GetClickModel(context.Background(),
+				&protocol.VersionInfo{Version: meta.ClickModelVersion},
+				grpc.MaxCallRecvMsgSize(math.MaxInt)); err != nil {
+				base.Logger().Error("failed to pull click model", zap.Error(err))
+			} else if clickModel, err := protocol.UnmarshalClickModel(clickModelReceiver); err != nil {
+				base.Logger().Error("failed to unmarshal click model", zap.Error(err))
+			} else {
+				s.SetClickModel(clickModel)
+				s.clickModelVersion = meta.ClickModelVersion
+				base.Logger().Info("synced click model", zap.String("version", base.Hex(s.clickModelVersion)))
+			}
+		}
+
+		// pull ranking model for ranking and online collaborative filtering recommendation
+		if s.GorseConfig.Recommend.RequireRankingModel() && meta.RankingModelVersion != s.rankingModelVersion {
+			base.Logger().Info("start pull ranking model", zap.String("version", base.Hex(meta.RankingModelVersion)))
+			if rankingModelReceiver, err := s.masterClient.GetRankingModel(context.Background(),
+				&protocol.VersionInfo{Version: meta.RankingModelVersion},
+				grpc.MaxCallRecvMsgSize(math.MaxInt)); err != nil {
+				base.Logger().Error("failed to pull ranking model", zap.Error(err))
+			} else if rankingModel, err := protocol.UnmarshalRankingModel(rankingModelReceiver); err != nil {
+				base.Logger().Error("failed to unmarshal ranking model", zap.Error(err))
+			} else {
+				s.SetRankingModel(rankingModel)
+				s.rankingModelVersion = meta.RankingModelVersion
+				base.Logger().Info("synced ranking model", zap.String("version", base.Hex(s.rankingModelVersion)))
+			}
+		}
+
 	sleep:
 		if s.testMode {
 			return
@@ -92,6 +92,9 @@ func TestServer_Sync(t *testing.T) {
 			GorseConfig: (*config.Config)(nil).LoadDefaultIfNil(),
 		},
 	}
+	// models are not pulled unless they are used
+	master.meta.ClickModelVersion = 1
+	master.meta.RankingModelVersion = 1
 	serv.Sync()
 	assert.Equal(t, "redis://"+master.dataStore.Addr(), serv.dataPath)
 	assert.Equal(t, "redis://"+master.cacheStore.Addr(), serv.cachePath)
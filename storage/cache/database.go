@@ -38,9 +38,23 @@ const (
 	//  User neighbors      - user_neighbors/{user_id}
 	UserNeighbors = "user_neighbors"
 
+	// ItemAudience is sorted set of users most likely to like each item.
+	//  Item audience - item_audience/{item_id}
+	ItemAudience = "item_audience"
+
 	CollaborativeRecommend = "collaborative_recommend" // collaborative filtering recommendation for each user
 	OfflineRecommend       = "offline_recommend"       // offline recommendation for each user
 
+	// OfflineRecommendSources is recommenders producing items in offline recommendation for each user, encoded as a
+	// JSON object from item ids to recommenders.
+	//  Sources of offline recommendation - offline_recommend_sources/{user_id}
+	OfflineRecommendSources = "offline_recommend_sources"
+
+	// SubscribeItems is sorted list of subscribed items for each user. The format of key:
+	//  Global subscribed items      - subscribe_items/{user_id}
+	//  Categorized subscribed items - subscribe_items/{user_id}/{category}
+	SubscribeItems = "subscribe_items"
+
 	// PopularItems is sorted set of popular items. The format of key:
 	//  Global popular items      - latest_items
 	//  Categorized popular items - latest_items/{category}
@@ -56,11 +70,20 @@ const (
 	//	Categories of an item  - item_categories/{item_id}
 	ItemCategories = "item_categories"
 
+	// ExperimentUsers is sorted set of users assigned to an arm of an experiment. The format of key:
+	//	Users in an arm - experiment_users/{experiment}/{arm}
+	ExperimentUsers = "experiment_users"
+
+	// RefreshUsers is sorted set of users waiting for refreshing offline recommendation. The score of a user is the
+	// number of feedback inserted since the last refresh.
+	RefreshUsers = "refresh_users"
+
 	LastModifyItemTime          = "last_modify_item_time"           // the latest timestamp that a user related data was modified
 	LastModifyUserTime          = "last_modify_user_time"           // the latest timestamp that an item related data was modified
 	LastUpdateUserRecommendTime = "last_update_user_recommend_time" // the latest timestamp that a user's recommendation was updated
 	LastUpdateUserNeighborsTime = "last_update_user_neighbors_time" // the latest timestamp that a user's neighbors item was updated
 	LastUpdateItemNeighborsTime = "last_update_item_neighbors_time" // the latest timestamp that an item's neighbors was updated
+	LastUpdateItemAudienceTime  = "last_update_item_audience_time"  // the latest timestamp that audiences of items were updated
 
 	// GlobalMeta is global meta information
 	GlobalMeta                 = "global_meta"
@@ -79,6 +102,10 @@ const (
 	UserNeighborIndexRecall    = "user_neighbor_index_recall"
 	ItemNeighborIndexRecall    = "item_neighbor_index_recall"
 	MatchingIndexRecall        = "matching_index_recall"
+	ItemAudienceIndexRecall    = "item_audience_index_recall"
+	ItemNeighborsModelVersion  = "item_neighbors_model_version" // the version of the ranking model searching neighbors of items
+	UserNeighborsModelVersion  = "user_neighbors_model_version" // the version of the ranking model searching neighbors of users
+	APIKeys                    = "api_keys"                     // API keys managed in the dashboard
 )
 
 var (
@@ -170,6 +197,7 @@ type Database interface {
 	AppendScores(prefix, name string, items ...Scored) error
 	SetCategoryScores(prefix, name, category string, items []Scored) error
 	GetCategoryScores(prefix, name, category string, begin, end int) ([]Scored, error)
+	BatchGetCategoryScores(prefix string, names []string, category string, begin, end int) ([][]Scored, error)
 	GetString(prefix, name string) (string, error)
 	SetString(prefix, name string, val string) error
 	GetTime(prefix, name string) (time.Time, error)
@@ -188,13 +216,21 @@ type Database interface {
 	GetSortedScore(key, member string) (float32, error)
 	GetSorted(key string, begin, end int) ([]Scored, error)
 	GetSortedByScore(key string, begin, end float32) ([]Scored, error)
+	BatchGetSortedByScore(keys []string, begin, end float32) ([][]Scored, error)
 	AddSorted(key string, scores []Scored) error
+	BatchAddSorted(sets map[string][]Scored) error
 	SetSorted(key string, scores []Scored) error
 	IncrSorted(key, member string) error
+	BatchIncrSorted(key string, deltas []Scored) error
 	RemSorted(key, member string) error
+	RemSortedIfScore(key, member string, score float32) error
+	RemSortedByScore(key string, begin, end float32) error
 }
 
-const redisPrefix = "redis://"
+const (
+	redisPrefix  = "redis://"
+	memoryPrefix = "memory://"
+)
 
 // Open a connection to a database.
 func Open(path string) (Database, error) {
@@ -206,6 +242,13 @@ func Open(path string) (Database, error) {
 		database := new(Redis)
 		database.client = redis.NewClient(opt)
 		return database, nil
+	} else if strings.HasPrefix(path, memoryPrefix) {
+		// memory://<snapshot path>, snapshot is disabled if the path is empty.
+		database, err := openMemory(path)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return database, nil
 	}
 	return nil, errors.Errorf("Unknown database: %s", path)
 }
@@ -137,6 +137,10 @@ func testScores(t *testing.T, db Database) {
 	totalItems, err = db.GetCategoryScores("list", "0", "cat", 0, -1)
 	assert.NoError(t, err)
 	assert.Equal(t, scores, totalItems)
+	// Get scores in category in batch
+	batchItems, err := db.BatchGetCategoryScores("list", []string{"0", "1"}, "cat", 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Scored{scores[:3], {}}, batchItems)
 }
 
 func testSet(t *testing.T, db Database) {
@@ -205,6 +209,19 @@ func testSort(t *testing.T, db Database) {
 		{"2", 1.2},
 		{"3", 1.3},
 	}, partItems)
+	// add and get scores of multiple sorted sets
+	err = db.BatchAddSorted(map[string][]Scored{
+		"sort_a": {{"a0", 0.1}, {"a1", 0.2}},
+		"sort_b": {{"b0", 0.3}},
+	})
+	assert.NoError(t, err)
+	batchItems, err := db.BatchGetSortedByScore([]string{"sort_a", "sort_b", "sort_c"}, 0.15, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Scored{
+		{{"a1", 0.2}},
+		{{"b0", 0.3}},
+		{},
+	}, batchItems)
 	// Increase score
 	err = db.IncrSorted("sort", "0")
 	assert.NoError(t, err)
@@ -219,6 +236,14 @@ func testSort(t *testing.T, db Database) {
 		{"2", 1.2},
 		{"1", 1.1},
 	}, totalItems)
+	// increase scores by deltas
+	err = db.BatchIncrSorted("sort_incr", []Scored{{"0", 1}, {"1", 2}})
+	assert.NoError(t, err)
+	err = db.BatchIncrSorted("sort_incr", []Scored{{"0", 2}})
+	assert.NoError(t, err)
+	incrItems, err := db.GetSorted("sort_incr", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Scored{{"0", 3}, {"1", 2}}, incrItems)
 	// Remove score
 	err = db.RemSorted("sort", "0")
 	assert.NoError(t, err)
@@ -230,10 +255,28 @@ func testSort(t *testing.T, db Database) {
 		{"2", 1.2},
 		{"1", 1.1},
 	}, totalItems)
+	// Remove score if unchanged
+	err = db.RemSortedIfScore("sort", "4", 1)
+	assert.NoError(t, err)
+	err = db.RemSortedIfScore("sort", "3", 1.3)
+	assert.NoError(t, err)
+	totalItems, err = db.GetSorted("sort", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Scored{
+		{"4", 1.4},
+		{"2", 1.2},
+		{"1", 1.1},
+	}, totalItems)
 	// Get score
 	score, err := db.GetSortedScore("sort", "2")
 	assert.NoError(t, err)
 	assert.Equal(t, float32(1.2), score)
+	// Remove scores by score
+	err = db.RemSortedByScore("sort", 1, 1.3)
+	assert.NoError(t, err)
+	totalItems, err = db.GetSorted("sort", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Scored{{"4", 1.4}}, totalItems)
 
 	// test set empty
 	err = db.SetSorted("sort", []Scored{})
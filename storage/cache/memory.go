@@ -0,0 +1,699 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/gob"
+	"github.com/araddon/dateparse"
+	"github.com/juju/errors"
+	"github.com/zhenghaoz/gorse/base"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory cache storage for single node deployments and tests. If path is set, data is loaded
+// from the snapshot at path while opening, written back periodically and written back while closing.
+type Memory struct {
+	path    string
+	mu      sync.RWMutex
+	scores  map[string][]Scored
+	values  map[string]string
+	sets    map[string]map[string]struct{}
+	sorteds map[string]map[string]float32
+	// registry fields
+	dsn  string
+	refs int
+	done chan struct{}
+}
+
+// memorySnapshotInterval is the interval of writing snapshots.
+var memorySnapshotInterval = time.Minute
+
+var (
+	memoriesMutex sync.Mutex
+	memories      = make(map[string]*Memory)
+)
+
+// openMemory returns the in-memory cache storage of a DSN. Nodes in the same process share the storage of the same
+// DSN, and the storage is released after all nodes close it.
+func openMemory(dsn string) (*Memory, error) {
+	memoriesMutex.Lock()
+	defer memoriesMutex.Unlock()
+	if m, exist := memories[dsn]; exist {
+		m.refs++
+		return m, nil
+	}
+	m, err := NewMemory(dsn[len(memoryPrefix):])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	m.dsn = dsn
+	m.refs = 1
+	memories[dsn] = m
+	return m, nil
+}
+
+// memorySnapshot is the persisted format of Memory.
+type memorySnapshot struct {
+	Scores  map[string][]Scored
+	Values  map[string]string
+	Sets    map[string]map[string]struct{}
+	Sorteds map[string]map[string]float32
+}
+
+// NewMemory creates an empty in-memory cache storage. Snapshot is loaded from path if exists.
+func NewMemory(path string) (*Memory, error) {
+	m := &Memory{
+		path:    path,
+		scores:  make(map[string][]Scored),
+		values:  make(map[string]string),
+		sets:    make(map[string]map[string]struct{}),
+		sorteds: make(map[string]map[string]float32),
+	}
+	if path == "" {
+		return m, nil
+	}
+	// check if file exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		m.startSnapshots()
+		return m, nil
+	}
+	// open file
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	var snapshot memorySnapshot
+	if err = gob.NewDecoder(f).Decode(&snapshot); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if snapshot.Scores != nil {
+		m.scores = snapshot.Scores
+	}
+	if snapshot.Values != nil {
+		m.values = snapshot.Values
+	}
+	if snapshot.Sets != nil {
+		m.sets = snapshot.Sets
+	}
+	if snapshot.Sorteds != nil {
+		m.sorteds = snapshot.Sorteds
+	}
+	m.startSnapshots()
+	return m, nil
+}
+
+// startSnapshots writes snapshots periodically until the storage is closed.
+func (m *Memory) startSnapshots() {
+	m.done = make(chan struct{})
+	ticker := time.NewTicker(memorySnapshotInterval)
+	go func(done chan struct{}) {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.snapshot(); err != nil {
+					base.Logger().Error("failed to write snapshot", zap.String("path", m.path), zap.Error(err))
+				}
+			case <-done:
+				return
+			}
+		}
+	}(m.done)
+}
+
+// Close writes snapshot to disk if path is set. The storage shared by nodes is closed after all nodes close it.
+func (m *Memory) Close() error {
+	memoriesMutex.Lock()
+	defer memoriesMutex.Unlock()
+	if m.refs > 1 {
+		m.refs--
+		return nil
+	}
+	if memories[m.dsn] == m {
+		delete(memories, m.dsn)
+	}
+	m.refs = 0
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
+	return m.snapshot()
+}
+
+// snapshot writes data to disk if path is set. Data is written to a temporary file first and then renamed, so that
+// the previous snapshot is kept if the process is killed while writing. Data is copied under the lock and encoded
+// outside it, so that writes aren't blocked by disk I/O.
+func (m *Memory) snapshot() error {
+	if m.path == "" {
+		return nil
+	}
+	data := m.copyData()
+	// create parent folder if not exists
+	parent := filepath.Dir(m.path)
+	if _, err := os.Stat(parent); os.IsNotExist(err) {
+		if err = os.MkdirAll(parent, os.ModePerm); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// create file
+	f, err := ioutil.TempFile(parent, filepath.Base(m.path))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// write file
+	if err = gob.NewEncoder(f).Encode(data); err != nil {
+		if closeErr := f.Close(); closeErr != nil {
+			base.Logger().Warn("failed to close snapshot", zap.String("path", f.Name()), zap.Error(closeErr))
+		}
+		removeSnapshot(f.Name())
+		return errors.Trace(err)
+	}
+	if err = f.Close(); err != nil {
+		removeSnapshot(f.Name())
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(f.Name(), m.path))
+}
+
+// copyData copies data in memory for snapshot.
+func (m *Memory) copyData() memorySnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data := memorySnapshot{
+		Scores:  make(map[string][]Scored, len(m.scores)),
+		Values:  make(map[string]string, len(m.values)),
+		Sets:    make(map[string]map[string]struct{}, len(m.sets)),
+		Sorteds: make(map[string]map[string]float32, len(m.sorteds)),
+	}
+	for name, scores := range m.scores {
+		data.Scores[name] = append([]Scored(nil), scores...)
+	}
+	for name, value := range m.values {
+		data.Values[name] = value
+	}
+	for key, set := range m.sets {
+		data.Sets[key] = make(map[string]struct{}, len(set))
+		for member := range set {
+			data.Sets[key][member] = struct{}{}
+		}
+	}
+	for key, sorted := range m.sorteds {
+		data.Sorteds[key] = make(map[string]float32, len(sorted))
+		for member, score := range sorted {
+			data.Sorteds[key][member] = score
+		}
+	}
+	return data
+}
+
+// removeSnapshot removes an incomplete snapshot file.
+func removeSnapshot(name string) {
+	if err := os.Remove(name); err != nil {
+		base.Logger().Warn("failed to remove incomplete snapshot", zap.String("path", name), zap.Error(err))
+	}
+}
+
+// rangeIndices converts an inclusive range with Redis semantics (negative indices count from the end) to
+// a half-open range [lo, hi). hi <= lo means an empty range.
+func rangeIndices(length, begin, end int) (int, int) {
+	if begin < 0 {
+		begin += length
+		if begin < 0 {
+			begin = 0
+		}
+	}
+	if end < 0 {
+		end += length
+	}
+	if end >= length {
+		end = length - 1
+	}
+	return begin, end + 1
+}
+
+// SetScores save a list of scored items to memory.
+func (m *Memory) SetScores(prefix, name string, items []Scored) error {
+	startTime := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := prefix + "/" + name
+	if len(items) == 0 {
+		delete(m.scores, key)
+	} else {
+		m.scores[key] = append([]Scored(nil), items...)
+	}
+	SetScoresSeconds.Observe(time.Since(startTime).Seconds())
+	return nil
+}
+
+// GetScores returns a list of scored items from memory.
+func (m *Memory) GetScores(prefix, name string, begin, end int) ([]Scored, error) {
+	startTime := time.Now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scores := m.scores[prefix+"/"+name]
+	res := make([]Scored, 0)
+	lo, hi := rangeIndices(len(scores), begin, end)
+	if lo < hi {
+		res = append(res, scores[lo:hi]...)
+	}
+	GetScoresSeconds.Observe(time.Since(startTime).Seconds())
+	return res, nil
+}
+
+// SetCategoryScores save a list of scored items in a category to memory.
+func (m *Memory) SetCategoryScores(prefix, name, category string, items []Scored) error {
+	if category != "" {
+		name += "/" + category
+	}
+	return m.SetScores(prefix, name, items)
+}
+
+// GetCategoryScores returns a list of scored items in a category from memory.
+func (m *Memory) GetCategoryScores(prefix, name, category string, begin, end int) ([]Scored, error) {
+	if category != "" {
+		name += "/" + category
+	}
+	return m.GetScores(prefix, name, begin, end)
+}
+
+// BatchGetCategoryScores returns lists of scored items in a category from memory.
+func (m *Memory) BatchGetCategoryScores(prefix string, names []string, category string, begin, end int) ([][]Scored, error) {
+	results := make([][]Scored, len(names))
+	for i, name := range names {
+		var err error
+		if results[i], err = m.GetCategoryScores(prefix, name, category, begin, end); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return results, nil
+}
+
+// ClearScores clears a list of scored items in memory.
+func (m *Memory) ClearScores(prefix, name string) error {
+	startTime := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.scores, prefix+"/"+name)
+	ClearScoresSeconds.Observe(time.Since(startTime).Seconds())
+	return nil
+}
+
+// AppendScores appends a list of scored items to memory.
+func (m *Memory) AppendScores(prefix, name string, items ...Scored) error {
+	startTime := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(items) > 0 {
+		key := prefix + "/" + name
+		m.scores[key] = append(m.scores[key], items...)
+	}
+	AppendScoresSeconds.Observe(time.Since(startTime).Seconds())
+	return nil
+}
+
+// GetString returns a string from memory.
+func (m *Memory) GetString(prefix, name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key := prefix + "/" + name
+	val, exist := m.values[key]
+	if !exist {
+		return "", errors.Annotate(ErrObjectNotExist, key)
+	}
+	return val, nil
+}
+
+// SetString saves a string to memory.
+func (m *Memory) SetString(prefix, name, val string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[prefix+"/"+name] = val
+	return nil
+}
+
+// GetInt returns a integer from memory.
+func (m *Memory) GetInt(prefix, name string) (int, error) {
+	val, err := m.GetString(prefix, name)
+	if err != nil {
+		return 0, nil
+	}
+	buf, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, err
+	}
+	return buf, err
+}
+
+// SetInt saves a integer to memory.
+func (m *Memory) SetInt(prefix, name string, val int) error {
+	return m.SetString(prefix, name, strconv.Itoa(val))
+}
+
+// IncrInt increase a integer in memory.
+func (m *Memory) IncrInt(prefix, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := prefix + "/" + name
+	val := 0
+	if text, exist := m.values[key]; exist {
+		var err error
+		if val, err = strconv.Atoi(text); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	m.values[key] = strconv.Itoa(val + 1)
+	return nil
+}
+
+// GetTime returns a time from memory.
+func (m *Memory) GetTime(prefix, name string) (time.Time, error) {
+	val, err := m.GetString(prefix, name)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	tm, err := dateparse.ParseAny(val)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return tm, nil
+}
+
+// SetTime saves a time to memory.
+func (m *Memory) SetTime(prefix, name string, val time.Time) error {
+	return m.SetString(prefix, name, val.String())
+}
+
+// Delete object from memory.
+func (m *Memory) Delete(prefix, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := prefix + "/" + name
+	delete(m.scores, key)
+	delete(m.values, key)
+	delete(m.sets, key)
+	delete(m.sorteds, key)
+	return nil
+}
+
+// Exists check keys in memory.
+func (m *Memory) Exists(prefix string, names ...string) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	existences := make([]int, len(names))
+	for i, name := range names {
+		if m.exists(prefix + "/" + name) {
+			existences[i] = 1
+		}
+	}
+	return existences, nil
+}
+
+func (m *Memory) exists(key string) bool {
+	if _, exist := m.scores[key]; exist {
+		return true
+	}
+	if _, exist := m.values[key]; exist {
+		return true
+	}
+	if _, exist := m.sets[key]; exist {
+		return true
+	}
+	_, exist := m.sorteds[key]
+	return exist
+}
+
+// GetSet returns members of a set from memory.
+func (m *Memory) GetSet(key string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	members := make([]string, 0, len(m.sets[key]))
+	for member := range m.sets[key] {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// SetSet overrides a set with members in memory.
+func (m *Memory) SetSet(key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	m.sets[key] = set
+	return nil
+}
+
+// AddSet adds members to a set in memory.
+func (m *Memory) AddSet(key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set, exist := m.sets[key]
+	if !exist {
+		set = make(map[string]struct{}, len(members))
+		m.sets[key] = set
+	}
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	return nil
+}
+
+// RemSet removes members from a set in memory.
+func (m *Memory) RemSet(key string, members ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set, exist := m.sets[key]
+	if !exist {
+		return nil
+	}
+	for _, member := range members {
+		delete(set, member)
+	}
+	if len(set) == 0 {
+		delete(m.sets, key)
+	}
+	return nil
+}
+
+// GetSortedScore get the score of a member from sorted set.
+func (m *Memory) GetSortedScore(key, member string) (float32, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	score, exist := m.sorteds[key][member]
+	if !exist {
+		return 0, errors.Annotate(ErrObjectNotExist, key)
+	}
+	return score, nil
+}
+
+// GetSorted get scores from sorted set (from high score to low score).
+func (m *Memory) GetSorted(key string, begin, end int) ([]Scored, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	members := m.sortedMembers(key)
+	// reverse order
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+	results := make([]Scored, 0)
+	lo, hi := rangeIndices(len(members), begin, end)
+	if lo < hi {
+		results = append(results, members[lo:hi]...)
+	}
+	return results, nil
+}
+
+// GetSortedByScore get scores between begin and end (inclusive) from sorted set (from low score to high score).
+func (m *Memory) GetSortedByScore(key string, begin, end float32) ([]Scored, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	results := make([]Scored, 0)
+	for _, member := range m.sortedMembers(key) {
+		if member.Score >= begin && member.Score <= end {
+			results = append(results, member)
+		}
+	}
+	return results, nil
+}
+
+// BatchGetSortedByScore get scores from sorted sets by scores in memory.
+func (m *Memory) BatchGetSortedByScore(keys []string, begin, end float32) ([][]Scored, error) {
+	results := make([][]Scored, len(keys))
+	for i, key := range keys {
+		var err error
+		if results[i], err = m.GetSortedByScore(key, begin, end); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return results, nil
+}
+
+// sortedMembers returns members in a sorted set from low score to high score. Members with the same score are
+// ordered lexicographically.
+func (m *Memory) sortedMembers(key string) []Scored {
+	members := make([]Scored, 0, len(m.sorteds[key]))
+	for member, score := range m.sorteds[key] {
+		members = append(members, Scored{Id: member, Score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Id < members[j].Id
+	})
+	return members
+}
+
+// AddSorted add scores to sorted set.
+func (m *Memory) AddSorted(key string, scores []Scored) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sorted, exist := m.sorteds[key]
+	if !exist {
+		sorted = make(map[string]float32, len(scores))
+		m.sorteds[key] = sorted
+	}
+	for _, score := range scores {
+		sorted[score.Id] = score.Score
+	}
+	return nil
+}
+
+// BatchAddSorted add scores to sorted sets in memory.
+func (m *Memory) BatchAddSorted(sets map[string][]Scored) error {
+	for key, scores := range sets {
+		if err := m.AddSorted(key, scores); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// SetSorted set scores in sorted set and clear previous scores.
+func (m *Memory) SetSorted(key string, scores []Scored) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(scores) == 0 {
+		delete(m.sorteds, key)
+		return nil
+	}
+	sorted := make(map[string]float32, len(scores))
+	for _, score := range scores {
+		sorted[score.Id] = score.Score
+	}
+	m.sorteds[key] = sorted
+	return nil
+}
+
+// IncrSorted increase score in sorted set.
+func (m *Memory) IncrSorted(key, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sorted, exist := m.sorteds[key]
+	if !exist {
+		sorted = make(map[string]float32)
+		m.sorteds[key] = sorted
+	}
+	sorted[member]++
+	return nil
+}
+
+// BatchIncrSorted increase scores of members in sorted set by deltas.
+func (m *Memory) BatchIncrSorted(key string, deltas []Scored) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sorted, exist := m.sorteds[key]
+	if !exist {
+		sorted = make(map[string]float32)
+		m.sorteds[key] = sorted
+	}
+	for _, delta := range deltas {
+		sorted[delta.Id] += delta.Score
+	}
+	return nil
+}
+
+// RemSorted removes a member from sorted set.
+func (m *Memory) RemSorted(key, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sorted, exist := m.sorteds[key]
+	if !exist {
+		return nil
+	}
+	delete(sorted, member)
+	if len(sorted) == 0 {
+		delete(m.sorteds, key)
+	}
+	return nil
+}
+
+// RemSortedByScore removes members from sorted set with scores between begin and end.
+func (m *Memory) RemSortedByScore(key string, begin, end float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sorted, exist := m.sorteds[key]
+	if !exist {
+		return nil
+	}
+	for member, score := range sorted {
+		if score >= begin && score <= end {
+			delete(sorted, member)
+		}
+	}
+	if len(sorted) == 0 {
+		delete(m.sorteds, key)
+	}
+	return nil
+}
+
+// RemSortedIfScore removes a member from sorted set if its score is unchanged.
+func (m *Memory) RemSortedIfScore(key, member string, score float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sorted, exist := m.sorteds[key]
+	if !exist || sorted[member] != score {
+		return nil
+	}
+	delete(sorted, member)
+	if len(sorted) == 0 {
+		delete(m.sorteds, key)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newMemory(t *testing.T) Database {
+	db, err := Open(memoryPrefix)
+	assert.NoError(t, err)
+	return db
+}
+
+func TestMemory_Meta(t *testing.T) {
+	db := newMemory(t)
+	defer db.Close()
+	testMeta(t, db)
+}
+
+func TestMemory_Scores(t *testing.T) {
+	db := newMemory(t)
+	defer db.Close()
+	testScores(t, db)
+}
+
+func TestMemory_Sort(t *testing.T) {
+	db := newMemory(t)
+	defer db.Close()
+	testSort(t, db)
+}
+
+func TestMemory_Set(t *testing.T) {
+	db := newMemory(t)
+	defer db.Close()
+	testSet(t, db)
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "gorse", "TestMemory_Snapshot.bin")
+	err := os.RemoveAll(path)
+	assert.NoError(t, err)
+	// write snapshot
+	db, err := Open(memoryPrefix + path)
+	assert.NoError(t, err)
+	err = db.SetScores("list", "0", []Scored{{"0", 0}, {"1", 1}})
+	assert.NoError(t, err)
+	err = db.SetInt("meta", "0", 100)
+	assert.NoError(t, err)
+	err = db.AddSet("set", "a", "b")
+	assert.NoError(t, err)
+	err = db.AddSorted("sort", []Scored{{"0", 0}, {"1", 1}})
+	assert.NoError(t, err)
+	err = db.Close()
+	assert.NoError(t, err)
+	// load snapshot
+	db, err = Open(memoryPrefix + path)
+	assert.NoError(t, err)
+	scores, err := db.GetScores("list", "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Scored{{"0", 0}, {"1", 1}}, scores)
+	val, err := db.GetInt("meta", "0")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, val)
+	members, err := db.GetSet("set")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	scores, err = db.GetSorted("sort", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Scored{{"1", 1}, {"0", 0}}, scores)
+	err = db.Close()
+	assert.NoError(t, err)
+}
+
+func TestMemory_Shared(t *testing.T) {
+	// nodes in the same process share the storage
+	db1, err := Open(memoryPrefix)
+	assert.NoError(t, err)
+	db2, err := Open(memoryPrefix)
+	assert.NoError(t, err)
+	err = db1.SetInt("meta", "0", 100)
+	assert.NoError(t, err)
+	val, err := db2.GetInt("meta", "0")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, val)
+	// the storage is kept until all nodes close it
+	err = db1.Close()
+	assert.NoError(t, err)
+	val, err = db2.GetInt("meta", "0")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, val)
+	err = db2.Close()
+	assert.NoError(t, err)
+	db3, err := Open(memoryPrefix)
+	assert.NoError(t, err)
+	defer db3.Close()
+	val, err = db3.GetInt("meta", "0")
+	assert.NoError(t, err)
+	assert.Zero(t, val)
+}
+
+func TestMemory_PeriodicSnapshot(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "gorse", "TestMemory_PeriodicSnapshot.bin")
+	err := os.RemoveAll(path)
+	assert.NoError(t, err)
+	interval := memorySnapshotInterval
+	memorySnapshotInterval = 10 * time.Millisecond
+	defer func() { memorySnapshotInterval = interval }()
+	db, err := Open(memoryPrefix + path)
+	assert.NoError(t, err)
+	defer db.Close()
+	err = db.SetInt("meta", "0", 100)
+	assert.NoError(t, err)
+	// snapshot is written without closing, it is copied to another path since closing a storage writes snapshot
+	copyPath := filepath.Join(os.TempDir(), "gorse", "TestMemory_PeriodicSnapshot_copy.bin")
+	assert.Eventually(t, func() bool {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false
+		}
+		if err = ioutil.WriteFile(copyPath, data, 0644); err != nil {
+			return false
+		}
+		snapshot, err := NewMemory(copyPath)
+		if err != nil {
+			return false
+		}
+		defer snapshot.Close()
+		val, err := snapshot.GetInt("meta", "0")
+		return err == nil && val == 100
+	}, time.Second, 10*time.Millisecond)
+}
@@ -44,6 +44,11 @@ func (NoDatabase) GetCategoryScores(_, _, _ string, _, _ int) ([]Scored, error)
 	return nil, ErrNoDatabase
 }
 
+// BatchGetCategoryScores method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchGetCategoryScores(_ string, _ []string, _ string, _, _ int) ([][]Scored, error) {
+	return nil, ErrNoDatabase
+}
+
 // ClearScores method of NoDatabase returns ErrNoDatabase.
 func (NoDatabase) ClearScores(_, _ string) error {
 	return ErrNoDatabase
@@ -134,6 +139,16 @@ func (NoDatabase) GetSortedByScore(_ string, _, _ float32) ([]Scored, error) {
 	return nil, ErrNoDatabase
 }
 
+// BatchGetSortedByScore method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchGetSortedByScore(_ []string, _, _ float32) ([][]Scored, error) {
+	return nil, ErrNoDatabase
+}
+
+// BatchAddSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchAddSorted(_ map[string][]Scored) error {
+	return ErrNoDatabase
+}
+
 // AddSorted method of NoDatabase returns ErrNoDatabase.
 func (NoDatabase) AddSorted(_ string, _ []Scored) error {
 	return ErrNoDatabase
@@ -149,7 +164,22 @@ func (NoDatabase) IncrSorted(_, _ string) error {
 	return ErrNoDatabase
 }
 
+// BatchIncrSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchIncrSorted(_ string, _ []Scored) error {
+	return ErrNoDatabase
+}
+
 // RemSorted method of NoDatabase returns ErrNoDatabase.
 func (NoDatabase) RemSorted(_, _ string) error {
 	return ErrNoDatabase
 }
+
+// RemSortedByScore method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) RemSortedByScore(_ string, _, _ float32) error {
+	return ErrNoDatabase
+}
+
+// RemSortedIfScore method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) RemSortedIfScore(_, _ string, _ float32) error {
+	return ErrNoDatabase
+}
@@ -54,6 +54,8 @@ func TestNoDatabase(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNoDatabase)
 	_, err = database.GetCategoryScores("", "", "", 0, 0)
 	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, err = database.BatchGetCategoryScores("", nil, "", 0, 0)
+	assert.ErrorIs(t, err, ErrNoDatabase)
 
 	_, err = database.GetSet("")
 	assert.ErrorIs(t, err, ErrNoDatabase)
@@ -70,12 +72,22 @@ func TestNoDatabase(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNoDatabase)
 	_, err = database.GetSortedByScore("", 0, 0)
 	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, err = database.BatchGetSortedByScore(nil, 0, 0)
+	assert.ErrorIs(t, err, ErrNoDatabase)
 	err = database.SetSorted("", nil)
 	assert.ErrorIs(t, err, ErrNoDatabase)
 	err = database.AddSorted("", nil)
 	assert.ErrorIs(t, err, ErrNoDatabase)
+	err = database.BatchAddSorted(nil)
+	assert.ErrorIs(t, err, ErrNoDatabase)
 	err = database.IncrSorted("", "")
 	assert.ErrorIs(t, err, ErrNoDatabase)
+	err = database.BatchIncrSorted("", nil)
+	assert.ErrorIs(t, err, ErrNoDatabase)
 	err = database.RemSorted("", "")
 	assert.ErrorIs(t, err, ErrNoDatabase)
+	err = database.RemSortedIfScore("", "", 0)
+	assert.ErrorIs(t, err, ErrNoDatabase)
+	err = database.RemSortedByScore("", 0, 0)
+	assert.ErrorIs(t, err, ErrNoDatabase)
 }
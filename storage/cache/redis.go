@@ -95,6 +95,38 @@ func (r *Redis) GetCategoryScores(prefix, name, category string, begin, end int)
 	return r.GetScores(prefix, name, begin, end)
 }
 
+// BatchGetCategoryScores returns lists of scored items in a category from Redis in a pipeline.
+func (r *Redis) BatchGetCategoryScores(prefix string, names []string, category string, begin, end int) ([][]Scored, error) {
+	startTime := time.Now()
+	ctx := context.Background()
+	pipeline := r.client.Pipeline()
+	commands := make([]*redis.StringSliceCmd, len(names))
+	for i, name := range names {
+		key := prefix + "/" + name
+		if category != "" {
+			key += "/" + category
+		}
+		commands[i] = pipeline.LRange(ctx, key, int64(begin), int64(end))
+	}
+	_, err := pipeline.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Trace(err)
+	}
+	results := make([][]Scored, len(names))
+	for i, command := range commands {
+		results[i] = make([]Scored, 0)
+		for _, s := range command.Val() {
+			var item Scored
+			if err = json.Unmarshal([]byte(s), &item); err != nil {
+				return nil, errors.Trace(err)
+			}
+			results[i] = append(results[i], item)
+		}
+	}
+	GetScoresSeconds.Observe(time.Since(startTime).Seconds())
+	return results, nil
+}
+
 // ClearScores clears a list of scored items in Redis.
 func (r *Redis) ClearScores(prefix, name string) error {
 	startTime := time.Now()
@@ -314,6 +346,33 @@ func (r *Redis) GetSortedByScore(key string, begin, end float32) ([]Scored, erro
 	return results, nil
 }
 
+// BatchGetSortedByScore get scores from sorted sets by scores in a pipeline.
+func (r *Redis) BatchGetSortedByScore(keys []string, begin, end float32) ([][]Scored, error) {
+	ctx := context.Background()
+	pipeline := r.client.Pipeline()
+	commands := make([]*redis.ZSliceCmd, len(keys))
+	for i, key := range keys {
+		commands[i] = pipeline.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:    strconv.FormatFloat(float64(begin), 'g', -1, 64),
+			Max:    strconv.FormatFloat(float64(end), 'g', -1, 64),
+			Offset: 0,
+			Count:  -1,
+		})
+	}
+	_, err := pipeline.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Trace(err)
+	}
+	results := make([][]Scored, len(keys))
+	for i, command := range commands {
+		results[i] = make([]Scored, 0, len(command.Val()))
+		for _, member := range command.Val() {
+			results[i] = append(results[i], Scored{Id: member.Member.(string), Score: float32(member.Score)})
+		}
+	}
+	return results, nil
+}
+
 // AddSorted add scores to sorted set.
 func (r *Redis) AddSorted(key string, scores []Scored) error {
 	if len(scores) == 0 {
@@ -327,6 +386,24 @@ func (r *Redis) AddSorted(key string, scores []Scored) error {
 	return r.client.ZAdd(ctx, key, members...).Err()
 }
 
+// BatchAddSorted add scores to sorted sets in a pipeline.
+func (r *Redis) BatchAddSorted(sets map[string][]Scored) error {
+	ctx := context.Background()
+	pipeline := r.client.Pipeline()
+	for key, scores := range sets {
+		if len(scores) == 0 {
+			continue
+		}
+		members := make([]*redis.Z, 0, len(scores))
+		for _, score := range scores {
+			members = append(members, &redis.Z{Member: score.Id, Score: float64(score.Score)})
+		}
+		pipeline.ZAdd(ctx, key, members...)
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
 // SetSorted set scores in sorted set and clear previous scores.
 func (r *Redis) SetSorted(key string, scores []Scored) error {
 	members := make([]*redis.Z, 0, len(scores))
@@ -349,8 +426,46 @@ func (r *Redis) IncrSorted(key, member string) error {
 	return r.client.ZIncrBy(ctx, key, 1, member).Err()
 }
 
+// BatchIncrSorted increase scores of members in sorted set by deltas in a pipeline.
+func (r *Redis) BatchIncrSorted(key string, deltas []Scored) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	pipeline := r.client.Pipeline()
+	for _, delta := range deltas {
+		pipeline.ZIncrBy(ctx, key, float64(delta.Score), delta.Id)
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
 // RemSorted method of NoDatabase returns ErrNoDatabase.
 func (r *Redis) RemSorted(key, member string) error {
 	ctx := context.Background()
 	return r.client.ZRem(ctx, key, member).Err()
 }
+
+// remSortedIfScore removes a member if its score equals to the expected score atomically. Scores are compared with a
+// tolerance far below the precision of float32 since scores returned by ZSCORE might be rounded.
+var remSortedIfScore = redis.NewScript(`
+local score = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1]))
+local expected = tonumber(ARGV[2])
+if score and math.abs(score - expected) <= 1e-9 * math.max(1, math.abs(expected)) then
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0`)
+
+// RemSortedByScore removes members from sorted set with scores between begin and end.
+func (r *Redis) RemSortedByScore(key string, begin, end float32) error {
+	ctx := context.Background()
+	return r.client.ZRemRangeByScore(ctx, key,
+		strconv.FormatFloat(float64(begin), 'g', -1, 64),
+		strconv.FormatFloat(float64(end), 'g', -1, 64)).Err()
+}
+
+// RemSortedIfScore removes a member from sorted set if its score is unchanged.
+func (r *Redis) RemSortedIfScore(key, member string, score float32) error {
+	ctx := context.Background()
+	return remSortedIfScore.Run(ctx, r.client, []string{key}, member, float64(score)).Err()
+}
@@ -64,6 +64,26 @@ type User struct {
 	Gender    string
 }
 
+// UserAttributes are typed fields of users which could be used as features. Add a new entry here to support
+// another attribute.
+var UserAttributes = map[string]func(user *User) string{
+	"gender": func(user *User) string { return user.Gender },
+}
+
+// GetAttributes returns values of given attributes in the format of "name=value". Empty or unknown attributes are
+// ignored.
+func (user *User) GetAttributes(names []string) []string {
+	var attributes []string
+	for _, name := range names {
+		if getter, exist := UserAttributes[name]; exist {
+			if value := getter(user); value != "" {
+				attributes = append(attributes, name+"="+value)
+			}
+		}
+	}
+	return attributes
+}
+
 // UserPatch is the modification on a user.
 type UserPatch struct {
 	Labels    []string
@@ -80,11 +100,18 @@ type FeedbackKey struct {
 	ItemId       string
 }
 
-// Feedback stores feedback.
+// Feedback stores feedback. Value is an optional weight of the feedback, such as rating, dwell time or quantity.
+// Feedback without positive value is treated as feedback with value 1 in training. Context is optional labels of the
+// context where the feedback happened, such as device, page or locale. RequestId is optional id of the recommendation
+// request which led to the feedback, it is used to attribute feedback to impressions. Optional fields are omitted in
+// JSON if they are empty.
 type Feedback struct {
 	FeedbackKey
 	Timestamp time.Time
 	Comment   string
+	Value     float64  `json:",omitempty"`
+	Context   []string `json:",omitempty"`
+	RequestId string   `json:",omitempty"`
 }
 
 // SortFeedbacks sorts feedback from latest to oldest.
@@ -106,6 +133,17 @@ func (sorter feedbackSorter) Swap(i, j int) {
 	sorter[i], sorter[j] = sorter[j], sorter[i]
 }
 
+// Impression stores an item shown to a user in a recommendation request. Position is the zero-based position of the
+// item in returned results and Source is the recommender which produced the item.
+type Impression struct {
+	RequestId string
+	UserId    string
+	ItemId    string
+	Position  int
+	Source    string
+	Timestamp time.Time
+}
+
 // Measurement stores a statistical value.
 type Measurement struct {
 	Name      string
@@ -114,6 +152,57 @@ type Measurement struct {
 	Comment   string
 }
 
+const (
+	RulePin   = "pin"   // pin an item at a position
+	RuleBoost = "boost" // multiply the score of an item
+	RuleBlock = "block" // remove an item from recommendation
+)
+
+// Rule is a merchandising rule applied to recommendation. A rule is applied to recommendation in the category, or
+// all recommendation if the category is empty. A rule is applied to users having any of user labels, or all users if
+// user labels are empty. A rule is active between start time and end time, and zero time means unbounded.
+type Rule struct {
+	RuleId     string
+	Type       string
+	ItemId     string
+	Category   string
+	UserLabels []string
+	Position   int     // position of the pinned item
+	Multiplier float32 // multiplier of the score of the boosted item
+	StartTime  time.Time
+	EndTime    time.Time
+	Comment    string
+}
+
+// IsActive checks whether the rule is active at the time.
+func (rule *Rule) IsActive(now time.Time) bool {
+	if !rule.StartTime.IsZero() && now.Before(rule.StartTime) {
+		return false
+	}
+	if !rule.EndTime.IsZero() && !now.Before(rule.EndTime) {
+		return false
+	}
+	return true
+}
+
+// Match checks whether the rule is applied to recommendation in the category for a user with labels.
+func (rule *Rule) Match(category string, userLabels []string) bool {
+	if rule.Category != "" && rule.Category != category {
+		return false
+	}
+	if len(rule.UserLabels) == 0 {
+		return true
+	}
+	for _, ruleLabel := range rule.UserLabels {
+		for _, label := range userLabels {
+			if ruleLabel == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type Database interface {
 	Init() error
 	Close() error
@@ -121,12 +210,14 @@ type Database interface {
 	BatchInsertItems(items []Item) error
 	DeleteItem(itemId string) error
 	GetItem(itemId string) (Item, error)
+	BatchGetItems(itemIds []string) ([]Item, error)
 	ModifyItem(itemId string, patch ItemPatch) error
 	GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error)
 	GetItemFeedback(itemId string, feedbackTypes ...string) ([]Feedback, error)
 	BatchInsertUsers(users []User) error
 	DeleteUser(userId string) error
 	GetUser(userId string) (User, error)
+	BatchGetUsers(userIds []string) ([]User, error)
 	ModifyUser(userId string, patch UserPatch) error
 	GetUsers(cursor string, n int) (string, []User, error)
 	GetUserFeedback(userId string, withFuture bool, feedbackTypes ...string) ([]Feedback, error)
@@ -137,6 +228,12 @@ type Database interface {
 	InsertMeasurement(measurement Measurement) error
 	GetMeasurements(name string, n int) ([]Measurement, error)
 	GetClickThroughRate(date time.Time, positiveTypes, readTypes []string) (float64, error)
+	BatchInsertImpressions(impressions []Impression) error
+	DeleteImpressions(timeLimit time.Time) error
+	GetImpressionStream(batchSize int, timeLimit *time.Time) (chan []Impression, chan error)
+	InsertRule(rule Rule) error
+	DeleteRule(ruleId string) (int, error)
+	GetRules() ([]Rule, error)
 	GetUserStream(batchSize int) (chan []User, chan error)
 	GetItemStream(batchSize int, timeLimit *time.Time) (chan []Item, chan error)
 	GetFeedbackStream(batchSize int, timeLimit *time.Time, feedbackTypes ...string) (chan []Feedback, chan error)
@@ -148,6 +245,7 @@ const (
 	redisPrefix      = "redis://"
 	postgresPrefix   = "postgres://"
 	clickhousePrefix = "clickhouse://"
+	sqlitePrefix     = "sqlite://"
 )
 
 // Open a connection to a database.
@@ -176,6 +274,18 @@ func Open(path string) (Database, error) {
 			return nil, errors.Trace(err)
 		}
 		return database, nil
+	} else if strings.HasPrefix(path, sqlitePrefix) {
+		name := path[len(sqlitePrefix):]
+		// wait for locks instead of failing immediately
+		if !strings.Contains(name, "?") {
+			name += "?_busy_timeout=10000&_journal_mode=WAL"
+		}
+		database := new(SQLDatabase)
+		database.driver = SQLite
+		if database.client, err = sql.Open("sqlite3", name); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return database, nil
 	} else if strings.HasPrefix(path, mongoPrefix) || strings.HasPrefix(path, "mongodb+srv://") {
 		// connect to database
 		database := new(MongoDB)
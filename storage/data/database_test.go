@@ -153,6 +153,10 @@ func testUsers(t *testing.T, db Database) {
 	user, err := db.GetUser("0")
 	assert.NoError(t, err)
 	assert.Equal(t, "0", user.UserId)
+	// Batch get users
+	batchUsers, err := db.BatchGetUsers([]string{"2", "4", "100"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []User{insertedUsers[7], insertedUsers[5]}, batchUsers)
 	// Delete this user
 	err = db.DeleteUser("0")
 	assert.NoError(t, err)
@@ -167,7 +171,7 @@ func testUsers(t *testing.T, db Database) {
 	assert.NoError(t, err)
 	assert.Equal(t, "override", user.Comment)
 	// test modify
-	err = db.ModifyUser("1", UserPatch{Comment: proto.String("modify"), Labels: []string{"a", "b", "c"}})
+	err = db.ModifyUser("1", UserPatch{Comment: proto.String("modify"), Labels: []string{"a", "b", "c"}, Subscribe: []string{"d", "e"}})
 	assert.NoError(t, err)
 	err = db.Optimize()
 	assert.NoError(t, err)
@@ -175,22 +179,23 @@ func testUsers(t *testing.T, db Database) {
 	assert.NoError(t, err)
 	assert.Equal(t, "modify", user.Comment)
 	assert.Equal(t, []string{"a", "b", "c"}, user.Labels)
+	assert.Equal(t, []string{"d", "e"}, user.Subscribe)
 }
 
 func testFeedback(t *testing.T, db Database) {
 	// users that already exists
-	err := db.BatchInsertUsers([]User{{"0", []string{"a"}, []string{"x"}, "comment"}})
+	err := db.BatchInsertUsers([]User{{UserId: "0", Labels: []string{"a"}, Subscribe: []string{"x"}, Comment: "comment"}})
 	assert.NoError(t, err)
 	// items that already exists
 	err = db.BatchInsertItems([]Item{{ItemId: "0", Labels: []string{"b"}, Timestamp: time.Date(1996, 4, 8, 10, 0, 0, 0, time.UTC)}})
 	assert.NoError(t, err)
 	// insert feedbacks
 	feedback := []Feedback{
-		{FeedbackKey{positiveFeedbackType, "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "1", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "3", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey{positiveFeedbackType, "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 1, []string{"mobile"}, "request"},
+		{FeedbackKey{positiveFeedbackType, "1", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 2, []string{"mobile"}, "request"},
+		{FeedbackKey{positiveFeedbackType, "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 3, []string{"mobile"}, "request"},
+		{FeedbackKey{positiveFeedbackType, "3", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 4, []string{"mobile"}, "request"},
+		{FeedbackKey{positiveFeedbackType, "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 5, []string{"mobile"}, "request"},
 	}
 	err = db.BatchInsertFeedback(feedback, true, true, true)
 	assert.NoError(t, err)
@@ -201,11 +206,11 @@ func testFeedback(t *testing.T, db Database) {
 	assert.NoError(t, err)
 	// future feedback
 	futureFeedback := []Feedback{
-		{FeedbackKey{duplicateFeedbackType, "0", "0"}, time.Now().Add(time.Hour), "comment"},
-		{FeedbackKey{duplicateFeedbackType, "1", "2"}, time.Now().Add(time.Hour), "comment"},
-		{FeedbackKey{duplicateFeedbackType, "2", "4"}, time.Now().Add(time.Hour), "comment"},
-		{FeedbackKey{duplicateFeedbackType, "3", "6"}, time.Now().Add(time.Hour), "comment"},
-		{FeedbackKey{duplicateFeedbackType, "4", "8"}, time.Now().Add(time.Hour), "comment"},
+		{FeedbackKey{duplicateFeedbackType, "0", "0"}, time.Now().Add(time.Hour), "comment", 0, nil, ""},
+		{FeedbackKey{duplicateFeedbackType, "1", "2"}, time.Now().Add(time.Hour), "comment", 0, nil, ""},
+		{FeedbackKey{duplicateFeedbackType, "2", "4"}, time.Now().Add(time.Hour), "comment", 0, nil, ""},
+		{FeedbackKey{duplicateFeedbackType, "3", "6"}, time.Now().Add(time.Hour), "comment", 0, nil, ""},
+		{FeedbackKey{duplicateFeedbackType, "4", "8"}, time.Now().Add(time.Hour), "comment", 0, nil, ""},
 	}
 	err = db.BatchInsertFeedback(futureFeedback, true, true, true)
 	assert.NoError(t, err)
@@ -251,7 +256,7 @@ func testFeedback(t *testing.T, db Database) {
 	// check users that already exists
 	user, err := db.GetUser("0")
 	assert.NoError(t, err)
-	assert.Equal(t, User{"0", []string{"a"}, []string{"x"}, "comment"}, user)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"a"}, Subscribe: []string{"x"}, Comment: "comment"}, user)
 	// check items that already exists
 	item, err := db.GetItem("0")
 	assert.NoError(t, err)
@@ -387,6 +392,10 @@ func testItems(t *testing.T, db Database) {
 		assert.NoError(t, err)
 		assert.Equal(t, item, ret)
 	}
+	// Batch get items
+	batchItems, err := db.BatchGetItems([]string{"2", "4", "100"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Item{items[1], items[2]}, batchItems)
 	// Delete item
 	err = db.DeleteItem("0")
 	assert.NoError(t, err)
@@ -423,11 +432,11 @@ func testItems(t *testing.T, db Database) {
 func testDeleteUser(t *testing.T, db Database) {
 	// Insert ret
 	feedback := []Feedback{
-		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "0", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "0", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "0", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
 	}
 	err := db.BatchInsertFeedback(feedback, true, true, true)
 	assert.NoError(t, err)
@@ -447,11 +456,11 @@ func testDeleteUser(t *testing.T, db Database) {
 func testDeleteItem(t *testing.T, db Database) {
 	// Insert ret
 	feedbacks := []Feedback{
-		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "1", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "2", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "3", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "1", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "2", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "3", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{positiveFeedbackType, "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
 	}
 	err := db.BatchInsertFeedback(feedbacks, true, true, true)
 	assert.NoError(t, err)
@@ -470,11 +479,11 @@ func testDeleteItem(t *testing.T, db Database) {
 
 func testDeleteFeedback(t *testing.T, db Database) {
 	feedbacks := []Feedback{
-		{FeedbackKey{"type1", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type2", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type3", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "1", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey{"type1", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type2", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type3", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type1", "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type1", "1", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
 	}
 	err := db.BatchInsertFeedback(feedbacks, true, true, true)
 	assert.NoError(t, err)
@@ -534,6 +543,85 @@ func testMeasurements(t *testing.T, db Database) {
 	}, ret)
 }
 
+func testImpressions(t *testing.T, db Database) {
+	impressions := []Impression{
+		{"1", "0", "2", 0, "offline", time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"1", "0", "4", 1, "latest", time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"2", "1", "2", 0, "popular", time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"3", "2", "6", 0, "offline", time.Date(2002, 1, 1, 1, 1, 1, 0, time.UTC)},
+	}
+	err := db.BatchInsertImpressions(impressions)
+	assert.NoError(t, err)
+	// insert duplicate impression
+	err = db.BatchInsertImpressions([]Impression{{"1", "0", "2", 5, "popular", time.Date(2003, 1, 1, 1, 1, 1, 0, time.UTC)}})
+	assert.NoError(t, err)
+	err = db.Optimize()
+	assert.NoError(t, err)
+	// get impressions
+	ret := getImpressions(t, db, nil)
+	assert.ElementsMatch(t, impressions, ret)
+	timeLimit := time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)
+	ret = getImpressions(t, db, &timeLimit)
+	assert.ElementsMatch(t, impressions[2:], ret)
+	// delete impressions
+	err = db.DeleteImpressions(timeLimit)
+	assert.NoError(t, err)
+	ret = getImpressions(t, db, nil)
+	assert.ElementsMatch(t, impressions[2:], ret)
+}
+
+func testRules(t *testing.T, db Database) {
+	rules := []Rule{
+		{"0", RulePin, "1", "", []string{"a"}, 2, 0,
+			time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), "pin"},
+		{"1", RuleBoost, "2", "*", []string{"a", "b"}, 0, 1.5,
+			time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC), "boost"},
+		{"2", RuleBlock, "3", "*", []string{"c"}, 0, 0,
+			time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC), "block"},
+		// zero time means unbounded
+		{"3", RuleBlock, "4", "", nil, 0, 0, time.Time{}, time.Time{}, "unbounded"},
+		{"4", RuleBlock, "5", "", nil, 0, 0, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}, "no end"},
+	}
+	for _, rule := range rules {
+		err := db.InsertRule(rule)
+		assert.NoError(t, err)
+	}
+	// overwrite rule
+	rules[1].Multiplier = 2
+	err := db.InsertRule(rules[1])
+	assert.NoError(t, err)
+	err = db.Optimize()
+	assert.NoError(t, err)
+	ret, err := db.GetRules()
+	assert.NoError(t, err)
+	assert.Equal(t, rules, ret)
+	// delete rule
+	deleteCount, err := db.DeleteRule("0")
+	assert.NoError(t, err)
+	if !isClickHouse(db) {
+		// RowAffected isn't supported by ClickHouse,
+		assert.Equal(t, 1, deleteCount)
+	}
+	deleteCount, err = db.DeleteRule("100")
+	assert.NoError(t, err)
+	assert.Zero(t, deleteCount)
+	err = db.Optimize()
+	assert.NoError(t, err)
+	ret, err = db.GetRules()
+	assert.NoError(t, err)
+	assert.Equal(t, rules[1:], ret)
+}
+
+func getImpressions(t *testing.T, db Database, timeLimit *time.Time) []Impression {
+	var impressions []Impression
+	impressionChan, errChan := db.GetImpressionStream(2, timeLimit)
+	for batch := range impressionChan {
+		impressions = append(impressions, batch...)
+	}
+	assert.NoError(t, <-errChan)
+	return impressions
+}
+
 func testTimeLimit(t *testing.T, db Database) {
 	// insert items
 	items := []Item{
@@ -577,11 +665,11 @@ func testTimeLimit(t *testing.T, db Database) {
 
 	// insert feedback
 	feedbacks := []Feedback{
-		{FeedbackKey{"type1", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type2", "2", "3"}, time.Date(1997, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type3", "2", "3"}, time.Date(1998, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "2", "4"}, time.Date(1999, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "1", "3"}, time.Date(2000, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey{"type1", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type2", "2", "3"}, time.Date(1997, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type3", "2", "3"}, time.Date(1998, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type1", "2", "4"}, time.Date(1999, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
+		{FeedbackKey{"type1", "1", "3"}, time.Date(2000, 3, 15, 0, 0, 0, 0, time.UTC), "comment", 0, nil, ""},
 	}
 	err = db.BatchInsertFeedback(feedbacks, true, true, true)
 	assert.NoError(t, err)
@@ -647,3 +735,29 @@ func TestSortFeedbacks(t *testing.T) {
 		{FeedbackKey: FeedbackKey{"star", "1", "1"}, Timestamp: time.Date(2000, 10, 1, 0, 0, 0, 0, time.UTC)},
 	}, feedback)
 }
+
+func TestUser_GetAttributes(t *testing.T) {
+	user := User{UserId: "1", Gender: "female"}
+	assert.Equal(t, []string{"gender=female"}, user.GetAttributes([]string{"gender", "unknown"}))
+	user.Gender = ""
+	assert.Empty(t, user.GetAttributes([]string{"gender"}))
+}
+
+func TestRule_IsActive(t *testing.T) {
+	rule := Rule{StartTime: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), EndTime: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)}
+	assert.False(t, rule.IsActive(time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, rule.IsActive(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, rule.IsActive(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)))
+	rule = Rule{}
+	assert.True(t, rule.IsActive(time.Now()))
+}
+
+func TestRule_Match(t *testing.T) {
+	rule := Rule{Category: "*", UserLabels: []string{"a", "b"}}
+	assert.True(t, rule.Match("*", []string{"b", "c"}))
+	assert.False(t, rule.Match("*", []string{"c"}))
+	assert.False(t, rule.Match("", []string{"a"}))
+	rule = Rule{}
+	assert.True(t, rule.Match("*", nil))
+	assert.True(t, rule.Match("", []string{"a"}))
+}
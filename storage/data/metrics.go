@@ -85,4 +85,9 @@ var (
 		Subsystem: "database",
 		Name:      "get_click_through_rate_seconds",
 	})
+	BatchInsertImpressionsSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "database",
+		Name:      "batch_insert_impressions_seconds",
+	})
 )
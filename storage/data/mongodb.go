@@ -53,7 +53,7 @@ func (db *MongoDB) Init() error {
 	ctx := context.Background()
 	d := db.client.Database(db.dbName)
 	// list collections
-	var hasUsers, hasItems, hasFeedback, hasMeasurements bool
+	var hasUsers, hasItems, hasFeedback, hasMeasurements, hasImpressions, hasRules bool
 	collections, err := d.ListCollectionNames(ctx, bson.M{})
 	if err != nil {
 		return errors.Trace(err)
@@ -68,6 +68,10 @@ func (db *MongoDB) Init() error {
 			hasFeedback = true
 		case "measurements":
 			hasMeasurements = true
+		case "impressions":
+			hasImpressions = true
+		case "rules":
+			hasRules = true
 		}
 	}
 	// create collections
@@ -91,6 +95,16 @@ func (db *MongoDB) Init() error {
 			return errors.Trace(err)
 		}
 	}
+	if !hasImpressions {
+		if err = d.CreateCollection(ctx, "impressions"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if !hasRules {
+		if err = d.CreateCollection(ctx, "rules"); err != nil {
+			return errors.Trace(err)
+		}
+	}
 	// create index
 	_, err = d.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys: bson.M{
@@ -135,6 +149,33 @@ func (db *MongoDB) Init() error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	_, err = d.Collection("impressions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{"requestid", 1},
+			{"itemid", 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = d.Collection("impressions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{
+			"timestamp": 1,
+		},
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = d.Collection("rules").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{
+			"ruleid": 1,
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
 	return nil
 }
 
@@ -182,6 +223,123 @@ func (db *MongoDB) GetMeasurements(name string, n int) ([]Measurement, error) {
 	return measurements, nil
 }
 
+// InsertRule inserts a rule into MongoDB. The rule with the same id is overwritten.
+func (db *MongoDB) InsertRule(rule Rule) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("rules")
+	opt := options.Update()
+	opt.SetUpsert(true)
+	_, err := c.UpdateOne(ctx, bson.M{"ruleid": bson.M{"$eq": rule.RuleId}}, bson.M{"$set": rule}, opt)
+	return errors.Trace(err)
+}
+
+// DeleteRule deletes a rule from MongoDB and returns the number of deleted rules.
+func (db *MongoDB) DeleteRule(ruleId string) (int, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("rules")
+	r, err := c.DeleteOne(ctx, bson.M{"ruleid": bson.M{"$eq": ruleId}})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return int(r.DeletedCount), nil
+}
+
+// GetRules returns all rules from MongoDB.
+func (db *MongoDB) GetRules() ([]Rule, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("rules")
+	opt := options.Find()
+	opt.SetSort(bson.D{{"ruleid", 1}})
+	r, err := c.Find(ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close(ctx)
+	var rules []Rule
+	for r.Next(ctx) {
+		var rule Rule
+		if err = r.Decode(&rule); err != nil {
+			return nil, errors.Trace(err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// BatchInsertImpressions inserts impressions into MongoDB.
+func (db *MongoDB) BatchInsertImpressions(impressions []Impression) error {
+	if len(impressions) == 0 {
+		return nil
+	}
+	startTime := time.Now()
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("impressions")
+	var models []mongo.WriteModel
+	for _, impression := range impressions {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetUpsert(true).
+			SetFilter(bson.M{
+				"requestid": bson.M{"$eq": impression.RequestId},
+				"itemid":    bson.M{"$eq": impression.ItemId},
+			}).
+			SetUpdate(bson.M{"$setOnInsert": impression}))
+	}
+	_, err := c.BulkWrite(ctx, models)
+	if err == nil {
+		BatchInsertImpressionsSeconds.Observe(time.Since(startTime).Seconds())
+	}
+	return errors.Trace(err)
+}
+
+// DeleteImpressions deletes impressions older than the time limit from MongoDB.
+func (db *MongoDB) DeleteImpressions(timeLimit time.Time) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("impressions")
+	_, err := c.DeleteMany(ctx, bson.M{"timestamp": bson.M{"$lt": timeLimit}})
+	return errors.Trace(err)
+}
+
+// GetImpressionStream reads impressions from MongoDB by stream.
+func (db *MongoDB) GetImpressionStream(batchSize int, timeLimit *time.Time) (chan []Impression, chan error) {
+	impressionChan := make(chan []Impression, bufSize)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(impressionChan)
+		defer close(errChan)
+		// send query
+		ctx := context.Background()
+		c := db.client.Database(db.dbName).Collection("impressions")
+		filter := make(bson.M)
+		if timeLimit != nil {
+			filter["timestamp"] = bson.M{"$gte": *timeLimit}
+		}
+		r, err := c.Find(ctx, filter)
+		if err != nil {
+			errChan <- errors.Trace(err)
+			return
+		}
+		impressions := make([]Impression, 0, batchSize)
+		defer r.Close(ctx)
+		for r.Next(ctx) {
+			var impression Impression
+			if err = r.Decode(&impression); err != nil {
+				errChan <- errors.Trace(err)
+				return
+			}
+			impressions = append(impressions, impression)
+			if len(impressions) == batchSize {
+				impressionChan <- impressions
+				impressions = make([]Impression, 0, batchSize)
+			}
+		}
+		if len(impressions) > 0 {
+			impressionChan <- impressions
+		}
+		errChan <- nil
+	}()
+	return impressionChan, errChan
+}
+
 // BatchInsertItems insert items into MongoDB.
 func (db *MongoDB) BatchInsertItems(items []Item) error {
 	startTime := time.Now()
@@ -263,6 +421,29 @@ func (db *MongoDB) GetItem(itemId string) (item Item, err error) {
 	return
 }
 
+// BatchGetItems returns items from MongoDB. Items not found are skipped.
+func (db *MongoDB) BatchGetItems(itemIds []string) ([]Item, error) {
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("items")
+	r, err := c.Find(ctx, bson.M{"itemid": bson.M{"$in": itemIds}})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close(ctx)
+	var items []Item
+	for r.Next(ctx) {
+		var item Item
+		if err = r.Decode(&item); err != nil {
+			return nil, errors.Trace(err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // GetItems returns items from MongoDB.
 func (db *MongoDB) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	ctx := context.Background()
@@ -395,6 +576,9 @@ func (db *MongoDB) ModifyUser(userId string, patch UserPatch) error {
 	if patch.Labels != nil {
 		update["labels"] = patch.Labels
 	}
+	if patch.Subscribe != nil {
+		update["subscribe"] = patch.Subscribe
+	}
 	if patch.Comment != nil {
 		update["comment"] = patch.Comment
 	}
@@ -441,6 +625,29 @@ func (db *MongoDB) GetUser(userId string) (user User, err error) {
 	return
 }
 
+// BatchGetUsers returns users from MongoDB. Users not found are skipped.
+func (db *MongoDB) BatchGetUsers(userIds []string) ([]User, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("users")
+	r, err := c.Find(ctx, bson.M{"userid": bson.M{"$in": userIds}})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close(ctx)
+	var users []User
+	for r.Next(ctx) {
+		var user User
+		if err = r.Decode(&user); err != nil {
+			return nil, errors.Trace(err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
 // GetUsers returns users from MongoDB.
 func (db *MongoDB) GetUsers(cursor string, n int) (string, []User, error) {
 	ctx := context.Background()
@@ -118,6 +118,18 @@ func TestMongoDatabase_Measurements(t *testing.T) {
 	testMeasurements(t, db.Database)
 }
 
+func TestMongoDatabase_Impressions(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestMongoDatabase_Rules(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
 func TestMongoDatabase_TimeLimit(t *testing.T) {
 	db := newTestMongoDatabase(t, "TestMongoDatabase_TimeLimit")
 	defer db.Close(t)
@@ -51,6 +51,16 @@ func (NoDatabase) GetItem(_ string) (Item, error) {
 	return Item{}, ErrNoDatabase
 }
 
+// BatchGetUsers method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchGetUsers(_ []string) ([]User, error) {
+	return nil, ErrNoDatabase
+}
+
+// BatchGetItems method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchGetItems(_ []string) ([]Item, error) {
+	return nil, ErrNoDatabase
+}
+
 // GetItems method of NoDatabase returns ErrNoDatabase.
 func (NoDatabase) GetItems(_ string, _ int, _ *time.Time) (string, []Item, error) {
 	return "", nil, ErrNoDatabase
@@ -157,6 +167,28 @@ func (NoDatabase) GetClickThroughRate(_ time.Time, _, _ []string) (float64, erro
 	return 0, ErrNoDatabase
 }
 
+// BatchInsertImpressions method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchInsertImpressions(_ []Impression) error {
+	return ErrNoDatabase
+}
+
+// DeleteImpressions method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) DeleteImpressions(_ time.Time) error {
+	return ErrNoDatabase
+}
+
+// GetImpressionStream method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) GetImpressionStream(_ int, _ *time.Time) (chan []Impression, chan error) {
+	impressionChan := make(chan []Impression, bufSize)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(impressionChan)
+		defer close(errChan)
+		errChan <- ErrNoDatabase
+	}()
+	return impressionChan, errChan
+}
+
 func (d NoDatabase) ModifyItem(_ string, _ ItemPatch) error {
 	return ErrNoDatabase
 }
@@ -164,3 +196,18 @@ func (d NoDatabase) ModifyItem(_ string, _ ItemPatch) error {
 func (d NoDatabase) ModifyUser(_ string, _ UserPatch) error {
 	return ErrNoDatabase
 }
+
+// InsertRule method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) InsertRule(_ Rule) error {
+	return ErrNoDatabase
+}
+
+// DeleteRule method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) DeleteRule(_ string) (int, error) {
+	return 0, ErrNoDatabase
+}
+
+// GetRules method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) GetRules() ([]Rule, error) {
+	return nil, ErrNoDatabase
+}
@@ -17,6 +17,7 @@ package data
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestNoDatabase(t *testing.T) {
@@ -35,6 +36,10 @@ func TestNoDatabase(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNoDatabase)
 	_, err = database.GetItem("")
 	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, err = database.BatchGetItems(nil)
+	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, err = database.BatchGetUsers(nil)
+	assert.ErrorIs(t, err, ErrNoDatabase)
 	_, _, err = database.GetItems("", 0, nil)
 	assert.ErrorIs(t, err, ErrNoDatabase)
 	err = database.DeleteItem("")
@@ -76,4 +81,18 @@ func TestNoDatabase(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNoDatabase)
 	_, err = database.GetMeasurements("", 0)
 	assert.ErrorIs(t, err, ErrNoDatabase)
+
+	err = database.BatchInsertImpressions(nil)
+	assert.ErrorIs(t, err, ErrNoDatabase)
+	err = database.DeleteImpressions(time.Time{})
+	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, c = database.GetImpressionStream(0, nil)
+	assert.ErrorIs(t, <-c, ErrNoDatabase)
+
+	err = database.InsertRule(Rule{})
+	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, err = database.DeleteRule("")
+	assert.ErrorIs(t, err, ErrNoDatabase)
+	_, err = database.GetRules()
+	assert.ErrorIs(t, err, ErrNoDatabase)
 }
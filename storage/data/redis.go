@@ -31,6 +31,9 @@ const (
 	prefixUser     = "user/"     // prefix for users
 	prefixFeedback = "feedback/" // prefix for feedback
 	prefixMeasure  = "measure/"  // prefix for measurements
+
+	prefixImpression = "impression/" // prefix for impressions
+	prefixRule       = "rule/"       // prefix for rules
 )
 
 // Redis use Redis as data storage, but used for test only.
@@ -120,6 +123,146 @@ func (s *sortMeasurements) Swap(i, j int) {
 	s.measurements[i], s.measurements[j] = s.measurements[j], s.measurements[i]
 }
 
+// InsertRule inserts a rule into Redis. The rule with the same id is overwritten.
+func (r *Redis) InsertRule(rule Rule) error {
+	var ctx = context.Background()
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(r.client.Set(ctx, prefixRule+rule.RuleId, data, 0).Err())
+}
+
+// DeleteRule deletes a rule from Redis and returns the number of deleted rules.
+func (r *Redis) DeleteRule(ruleId string) (int, error) {
+	var ctx = context.Background()
+	deleteCount, err := r.client.Del(ctx, prefixRule+ruleId).Result()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return int(deleteCount), nil
+}
+
+// GetRules returns all rules from Redis.
+func (r *Redis) GetRules() ([]Rule, error) {
+	var ctx = context.Background()
+	var rules []Rule
+	var cursor uint64
+	for {
+		var keys []string
+		var err error
+		keys, cursor, err = r.client.Scan(ctx, cursor, prefixRule+"*", 0).Result()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, key := range keys {
+			data, err := r.client.Get(ctx, key).Result()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			var rule Rule
+			if err = json.Unmarshal([]byte(data), &rule); err != nil {
+				return nil, errors.Trace(err)
+			}
+			rules = append(rules, rule)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].RuleId < rules[j].RuleId
+	})
+	return rules, nil
+}
+
+// BatchInsertImpressions inserts impressions into Redis.
+func (r *Redis) BatchInsertImpressions(impressions []Impression) error {
+	var ctx = context.Background()
+	for _, impression := range impressions {
+		data, err := json.Marshal(impression)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = r.client.SetNX(ctx, prefixImpression+impression.RequestId+"/"+impression.ItemId,
+			data, 0).Err(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// forImpressions iterates all impressions in Redis.
+func (r *Redis) forImpressions(ctx context.Context, action func(key string, impression Impression) error) error {
+	var cursor uint64
+	for {
+		var keys []string
+		var err error
+		keys, cursor, err = r.client.Scan(ctx, cursor, prefixImpression+"*", 0).Result()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, key := range keys {
+			data, err := r.client.Get(ctx, key).Result()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			var impression Impression
+			if err = json.Unmarshal([]byte(data), &impression); err != nil {
+				return errors.Trace(err)
+			}
+			if err = action(key, impression); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// DeleteImpressions deletes impressions older than the time limit from Redis.
+func (r *Redis) DeleteImpressions(timeLimit time.Time) error {
+	var ctx = context.Background()
+	return r.forImpressions(ctx, func(key string, impression Impression) error {
+		if impression.Timestamp.Before(timeLimit) {
+			return r.client.Del(ctx, key).Err()
+		}
+		return nil
+	})
+}
+
+// GetImpressionStream reads impressions from Redis by stream.
+func (r *Redis) GetImpressionStream(batchSize int, timeLimit *time.Time) (chan []Impression, chan error) {
+	impressionChan := make(chan []Impression, bufSize)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(impressionChan)
+		defer close(errChan)
+		impressions := make([]Impression, 0, batchSize)
+		err := r.forImpressions(context.Background(), func(_ string, impression Impression) error {
+			if timeLimit != nil && impression.Timestamp.Before(*timeLimit) {
+				return nil
+			}
+			impressions = append(impressions, impression)
+			if len(impressions) == batchSize {
+				impressionChan <- impressions
+				impressions = make([]Impression, 0, batchSize)
+			}
+			return nil
+		})
+		if err != nil {
+			errChan <- errors.Trace(err)
+			return
+		}
+		if len(impressions) > 0 {
+			impressionChan <- impressions
+		}
+		errChan <- nil
+	}()
+	return impressionChan, errChan
+}
+
 // insertItem inserts an item into Redis.
 func (r *Redis) insertItem(item Item) error {
 	var ctx = context.Background()
@@ -198,6 +341,35 @@ func (r *Redis) GetItem(itemId string) (Item, error) {
 	return item, err
 }
 
+// BatchGetItems returns items from Redis. Items not found are skipped.
+func (r *Redis) BatchGetItems(itemIds []string) ([]Item, error) {
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+	var ctx = context.Background()
+	keys := make([]string, len(itemIds))
+	for i, itemId := range itemIds {
+		keys[i] = prefixItem + itemId
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var items []Item
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var item Item
+		if err = json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, errors.Trace(err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // GetItems returns items from Redis.
 func (r *Redis) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	var ctx = context.Background()
@@ -366,6 +538,35 @@ func (r *Redis) GetUser(userId string) (User, error) {
 	return user, err
 }
 
+// BatchGetUsers returns users from Redis. Users not found are skipped.
+func (r *Redis) BatchGetUsers(userIds []string) ([]User, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	var ctx = context.Background()
+	keys := make([]string, len(userIds))
+	for i, userId := range userIds {
+		keys[i] = prefixUser + userId
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var users []User
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var user User
+		if err = json.Unmarshal([]byte(data), &user); err != nil {
+			return nil, errors.Trace(err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
 // GetUsers returns users from Redis.
 func (r *Redis) GetUsers(cursor string, n int) (string, []User, error) {
 	var ctx = context.Background()
@@ -718,6 +919,9 @@ func (r *Redis) ModifyUser(userId string, patch UserPatch) error {
 	if patch.Labels != nil {
 		user.Labels = patch.Labels
 	}
+	if patch.Subscribe != nil {
+		user.Subscribe = patch.Subscribe
+	}
 	// write back
 	return r.insertUser(user)
 }
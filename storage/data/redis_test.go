@@ -82,6 +82,18 @@ func TestRedis_Measurements(t *testing.T) {
 	testMeasurements(t, db.Database)
 }
 
+func TestRedis_Impressions(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestRedis_Rules(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
 func TestRedis_TimeLimit(t *testing.T) {
 	db := newMockRedis(t)
 	defer db.Close(t)
@@ -21,6 +21,7 @@ import (
 	"github.com/juju/errors"
 	_ "github.com/lib/pq"
 	_ "github.com/mailru/go-clickhouse"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/scylladb/go-set/strset"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/base/json"
@@ -37,6 +38,7 @@ const (
 	MySQL SQLDriver = iota
 	Postgres
 	ClickHouse
+	SQLite
 )
 
 // SQLDatabase use MySQL as data storage.
@@ -48,7 +50,7 @@ type SQLDatabase struct {
 // Optimize is used by ClickHouse only.
 func (d *SQLDatabase) Optimize() error {
 	if d.driver == ClickHouse {
-		for _, tableName := range []string{"users", "items", "feedback", "measurements"} {
+		for _, tableName := range []string{"users", "items", "feedback", "measurements", "impressions", "rules"} {
 			_, err := d.client.Exec("OPTIMIZE TABLE " + tableName)
 			if err != nil {
 				return errors.Trace(err)
@@ -89,12 +91,27 @@ func (d *SQLDatabase) Init() error {
 			"item_id varchar(256) NOT NULL," +
 			"time_stamp datetime NOT NULL," +
 			"comment TEXT NOT NULL," +
+			"value double NOT NULL DEFAULT 0," +
+			"context json NOT NULL," +
+			"request_id varchar(256) NOT NULL DEFAULT ''," +
 			"PRIMARY KEY(feedback_type, user_id, item_id)," +
 			"INDEX (user_id)," +
 			"INDEX (item_id)" +
 			")  ENGINE=InnoDB"); err != nil {
 			return errors.Trace(err)
 		}
+		if err := d.addColumn("feedback", "value", "double NOT NULL DEFAULT 0"); err != nil {
+			return errors.Trace(err)
+		}
+		// JSON columns can't have literal defaults in MySQL, so existing rows are filled before adding the constraint.
+		if err := d.addColumn("feedback", "context", "json",
+			"UPDATE feedback SET context = '[]'",
+			"ALTER TABLE feedback MODIFY context json NOT NULL"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "request_id", "varchar(256) NOT NULL DEFAULT ''"); err != nil {
+			return errors.Trace(err)
+		}
 		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS measurements (" +
 			"name varchar(256) NOT NULL," +
 			"time_stamp datetime NOT NULL," +
@@ -104,6 +121,33 @@ func (d *SQLDatabase) Init() error {
 			")  ENGINE=InnoDB"); err != nil {
 			return errors.Trace(err)
 		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS impressions (" +
+			"request_id varchar(256) NOT NULL," +
+			"user_id varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"position int NOT NULL," +
+			"source varchar(256) NOT NULL," +
+			"time_stamp datetime NOT NULL," +
+			"PRIMARY KEY(request_id, item_id)," +
+			"INDEX (time_stamp)" +
+			")  ENGINE=InnoDB"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS rules (" +
+			"rule_id varchar(256) NOT NULL," +
+			"rule_type varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"category varchar(256) NOT NULL," +
+			"user_labels json NOT NULL," +
+			"position int NOT NULL," +
+			"multiplier double NOT NULL," +
+			"start_time datetime NULL," +
+			"end_time datetime NULL," +
+			"comment TEXT NOT NULL," +
+			"PRIMARY KEY(rule_id)" +
+			")  ENGINE=InnoDB"); err != nil {
+			return errors.Trace(err)
+		}
 		// change settings
 		_, err := d.client.Exec("SET SESSION sql_mode=\"" +
 			"ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,ERROR_FOR_DIVISION_BY_ZERO," +
@@ -137,10 +181,22 @@ func (d *SQLDatabase) Init() error {
 			"item_id varchar(256) NOT NULL," +
 			"time_stamp timestamptz NOT NULL DEFAULT '0001-01-01'," +
 			"comment TEXT NOT NULL DEFAULT ''," +
+			"value double precision NOT NULL DEFAULT 0," +
+			"context json NOT NULL DEFAULT '[]'," +
+			"request_id varchar(256) NOT NULL DEFAULT ''," +
 			"PRIMARY KEY(feedback_type, user_id, item_id)" +
 			")"); err != nil {
 			return errors.Trace(err)
 		}
+		if err := d.addColumn("feedback", "value", "double precision NOT NULL DEFAULT 0"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "context", "json NOT NULL DEFAULT '[]'"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "request_id", "varchar(256) NOT NULL DEFAULT ''"); err != nil {
+			return errors.Trace(err)
+		}
 		if _, err := d.client.Exec("CREATE INDEX IF NOT EXISTS user_id_index ON feedback(user_id)"); err != nil {
 			return errors.Trace(err)
 		}
@@ -156,6 +212,35 @@ func (d *SQLDatabase) Init() error {
 			")"); err != nil {
 			return errors.Trace(err)
 		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS impressions (" +
+			"request_id varchar(256) NOT NULL," +
+			"user_id varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"position integer NOT NULL," +
+			"source varchar(256) NOT NULL," +
+			"time_stamp timestamptz NOT NULL," +
+			"PRIMARY KEY(request_id, item_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE INDEX IF NOT EXISTS time_stamp_index ON impressions(time_stamp)"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS rules (" +
+			"rule_id varchar(256) NOT NULL," +
+			"rule_type varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"category varchar(256) NOT NULL DEFAULT ''," +
+			"user_labels json NOT NULL DEFAULT '[]'," +
+			"position integer NOT NULL DEFAULT 0," +
+			"multiplier double precision NOT NULL DEFAULT 0," +
+			"start_time timestamptz NULL," +
+			"end_time timestamptz NULL," +
+			"comment TEXT NOT NULL DEFAULT ''," +
+			"PRIMARY KEY(rule_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
 	case ClickHouse:
 		// create tables
 		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS items (" +
@@ -184,12 +269,24 @@ func (d *SQLDatabase) Init() error {
 			"item_id String," +
 			"time_stamp Datetime," +
 			"comment String," +
+			"value Float64 DEFAULT 0," +
+			"context String DEFAULT '[]'," +
+			"request_id String DEFAULT ''," +
 			"version DateTime," +
 			"INDEX user_index user_id TYPE bloom_filter(0.01) GRANULARITY 1," +
 			"INDEX item_index item_id TYPE bloom_filter(0.01) GRANULARITY 1" +
 			") ENGINE = ReplacingMergeTree(version) ORDER BY (feedback_type, user_id, item_id)"); err != nil {
 			return errors.Trace(err)
 		}
+		if err := d.addColumn("feedback", "value", "Float64 DEFAULT 0"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "context", "String DEFAULT '[]'"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "request_id", "String DEFAULT ''"); err != nil {
+			return errors.Trace(err)
+		}
 		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS measurements (" +
 			"name String," +
 			"time_stamp Datetime," +
@@ -198,6 +295,168 @@ func (d *SQLDatabase) Init() error {
 			") ENGINE = ReplacingMergeTree() ORDER BY (name, time_stamp)"); err != nil {
 			return errors.Trace(err)
 		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS impressions (" +
+			"request_id String," +
+			"user_id String," +
+			"item_id String," +
+			"position Int32," +
+			"source String," +
+			"time_stamp Datetime" +
+			") ENGINE = ReplacingMergeTree() ORDER BY (request_id, item_id)"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS rules (" +
+			"rule_id String," +
+			"rule_type String," +
+			"item_id String," +
+			"category String," +
+			"user_labels String DEFAULT '[]'," +
+			"position Int32," +
+			"multiplier Float64," +
+			"start_time Nullable(Datetime)," +
+			"end_time Nullable(Datetime)," +
+			"comment String," +
+			"version DateTime" +
+			") ENGINE = ReplacingMergeTree(version) ORDER BY rule_id"); err != nil {
+			return errors.Trace(err)
+		}
+	case SQLite:
+		// create tables
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS items (" +
+			"item_id varchar(256) NOT NULL," +
+			"time_stamp datetime NOT NULL DEFAULT '0001-01-01'," +
+			"labels json NOT NULL DEFAULT '[]'," +
+			"comment TEXT NOT NULL DEFAULT ''," +
+			"is_hidden boolean NOT NULL DEFAULT FALSE," +
+			"categories json NOT NULL DEFAULT '[]'," +
+			"PRIMARY KEY(item_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS users (" +
+			"user_id varchar(256) NOT NULL," +
+			"labels json NOT NULL DEFAULT '[]'," +
+			"subscribe json NOT NULL DEFAULT '[]'," +
+			"comment TEXT NOT NULL DEFAULT ''," +
+			"user_name TEXT NOT NULL DEFAULT ''," +
+			"gender TEXT NOT NULL DEFAULT ''," +
+			"PRIMARY KEY (user_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS feedback (" +
+			"feedback_type varchar(256) NOT NULL," +
+			"user_id varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"time_stamp datetime NOT NULL DEFAULT '0001-01-01'," +
+			"comment TEXT NOT NULL DEFAULT ''," +
+			"value double NOT NULL DEFAULT 0," +
+			"context json NOT NULL DEFAULT '[]'," +
+			"request_id varchar(256) NOT NULL DEFAULT ''," +
+			"PRIMARY KEY(feedback_type, user_id, item_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "value", "double NOT NULL DEFAULT 0"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "context", "json NOT NULL DEFAULT '[]'"); err != nil {
+			return errors.Trace(err)
+		}
+		if err := d.addColumn("feedback", "request_id", "varchar(256) NOT NULL DEFAULT ''"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE INDEX IF NOT EXISTS user_id_index ON feedback(user_id)"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE INDEX IF NOT EXISTS item_id_index ON feedback(item_id)"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS measurements (" +
+			"name varchar(256) NOT NULL," +
+			"time_stamp datetime NOT NULL," +
+			"value double NOT NULL," +
+			"comment TEXT NOT NULL," +
+			"PRIMARY KEY(name, time_stamp)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS impressions (" +
+			"request_id varchar(256) NOT NULL," +
+			"user_id varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"position integer NOT NULL," +
+			"source varchar(256) NOT NULL," +
+			"time_stamp datetime NOT NULL," +
+			"PRIMARY KEY(request_id, item_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE INDEX IF NOT EXISTS time_stamp_index ON impressions(time_stamp)"); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := d.client.Exec("CREATE TABLE IF NOT EXISTS rules (" +
+			"rule_id varchar(256) NOT NULL," +
+			"rule_type varchar(256) NOT NULL," +
+			"item_id varchar(256) NOT NULL," +
+			"category varchar(256) NOT NULL DEFAULT ''," +
+			"user_labels json NOT NULL DEFAULT '[]'," +
+			"position integer NOT NULL DEFAULT 0," +
+			"multiplier double NOT NULL DEFAULT 0," +
+			"start_time datetime NULL," +
+			"end_time datetime NULL," +
+			"comment TEXT NOT NULL DEFAULT ''," +
+			"PRIMARY KEY(rule_id)" +
+			")"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to a table if the column doesn't exist. Tables created by previous versions are not changed by
+// CREATE TABLE IF NOT EXISTS, so columns added later must be added by ALTER TABLE. Backfill statements are executed
+// only if the column is added.
+func (d *SQLDatabase) addColumn(table, column, definition string, backfill ...string) error {
+	var count int
+	var err error
+	switch d.driver {
+	case MySQL:
+		err = d.client.QueryRow("SELECT COUNT(*) FROM information_schema.columns "+
+			"WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?", table, column).Scan(&count)
+	case Postgres:
+		err = d.client.QueryRow("SELECT COUNT(*) FROM information_schema.columns "+
+			"WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2", table, column).Scan(&count)
+	case ClickHouse:
+		err = d.client.QueryRow("SELECT COUNT(*) FROM system.columns "+
+			"WHERE database = currentDatabase() AND table = ? AND name = ?", table, column).Scan(&count)
+	case SQLite:
+		err = d.client.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if _, err = d.client.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return errors.Trace(err)
+	}
+	for _, statement := range backfill {
+		if _, err = d.client.Exec(statement); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// decodeContext decodes context labels of feedback. Empty context is decoded as nil.
+func decodeContext(data string, context *[]string) error {
+	if err := json.Unmarshal([]byte(data), context); err != nil {
+		return err
+	}
+	if len(*context) == 0 {
+		*context = nil
 	}
 	return nil
 }
@@ -223,6 +482,10 @@ func (d *SQLDatabase) InsertMeasurement(measurement Measurement) error {
 	case ClickHouse:
 		_, err = d.client.Exec("INSERT INTO measurements(name, time_stamp, value, `comment`) VALUES (?, ?, ?, ?)",
 			measurement.Name, measurement.Timestamp, measurement.Value, measurement.Comment)
+	case SQLite:
+		_, err = d.client.Exec("INSERT INTO measurements(name, time_stamp, value, comment) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (name, time_stamp) DO UPDATE SET value = EXCLUDED.value, comment = EXCLUDED.comment",
+			measurement.Name, measurement.Timestamp, measurement.Value, measurement.Comment)
 	}
 	if err == nil {
 		InsertMeasurementSeconds.Observe(time.Since(startTime).Seconds())
@@ -236,7 +499,7 @@ func (d *SQLDatabase) GetMeasurements(name string, n int) ([]Measurement, error)
 	var result *sql.Rows
 	var err error
 	switch d.driver {
-	case MySQL, ClickHouse:
+	case MySQL, ClickHouse, SQLite:
 		result, err = d.client.Query("SELECT name, time_stamp, value, `comment` FROM measurements WHERE name = ? ORDER BY time_stamp DESC LIMIT ?", name, n)
 	case Postgres:
 		result, err = d.client.Query("SELECT name, time_stamp, value, comment FROM measurements WHERE name = $1 ORDER BY time_stamp DESC LIMIT $2", name, n)
@@ -255,6 +518,209 @@ func (d *SQLDatabase) GetMeasurements(name string, n int) ([]Measurement, error)
 	return measurements, nil
 }
 
+// BatchInsertImpressions inserts a batch of impressions into MySQL.
+func (d *SQLDatabase) BatchInsertImpressions(impressions []Impression) error {
+	if len(impressions) == 0 {
+		return nil
+	}
+	startTime := time.Now()
+	builder := strings.Builder{}
+	switch d.driver {
+	case MySQL:
+		builder.WriteString("INSERT IGNORE INTO impressions(request_id, user_id, item_id, position, source, time_stamp) VALUES ")
+	case Postgres, ClickHouse, SQLite:
+		builder.WriteString("INSERT INTO impressions(request_id, user_id, item_id, position, source, time_stamp) VALUES ")
+	}
+	var args []interface{}
+	for i, impression := range impressions {
+		switch d.driver {
+		case MySQL, ClickHouse, SQLite:
+			builder.WriteString("(?,?,?,?,?,?)")
+		case Postgres:
+			builder.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d)",
+				len(args)+1, len(args)+2, len(args)+3, len(args)+4, len(args)+5, len(args)+6))
+		}
+		if i+1 < len(impressions) {
+			builder.WriteString(",")
+		}
+		args = append(args, impression.RequestId, impression.UserId, impression.ItemId, impression.Position,
+			impression.Source, impression.Timestamp)
+	}
+	switch d.driver {
+	case Postgres, SQLite:
+		builder.WriteString(" ON CONFLICT (request_id, item_id) DO NOTHING")
+	}
+	_, err := d.client.Exec(builder.String(), args...)
+	if err == nil {
+		BatchInsertImpressionsSeconds.Observe(time.Since(startTime).Seconds())
+	}
+	return errors.Trace(err)
+}
+
+// DeleteImpressions deletes impressions older than the time limit from MySQL.
+func (d *SQLDatabase) DeleteImpressions(timeLimit time.Time) error {
+	var err error
+	switch d.driver {
+	case MySQL:
+		_, err = d.client.Exec("DELETE FROM impressions WHERE time_stamp < ?", timeLimit)
+	case Postgres:
+		_, err = d.client.Exec("DELETE FROM impressions WHERE time_stamp < $1", timeLimit)
+	case ClickHouse:
+		_, err = d.client.Exec("ALTER TABLE impressions DELETE WHERE time_stamp < ?", timeLimit)
+	case SQLite:
+		_, err = d.client.Exec("DELETE FROM impressions WHERE julianday(time_stamp) < julianday(?)", timeLimit)
+	}
+	return errors.Trace(err)
+}
+
+// GetImpressionStream reads impressions by stream.
+func (d *SQLDatabase) GetImpressionStream(batchSize int, timeLimit *time.Time) (chan []Impression, chan error) {
+	impressionChan := make(chan []Impression, bufSize)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(impressionChan)
+		defer close(errChan)
+		// send query
+		var builder strings.Builder
+		builder.WriteString("SELECT request_id, user_id, item_id, position, source, time_stamp FROM impressions")
+		var args []interface{}
+		if timeLimit != nil {
+			switch d.driver {
+			case MySQL, ClickHouse:
+				builder.WriteString(" WHERE time_stamp >= ?")
+			case Postgres:
+				builder.WriteString(" WHERE time_stamp >= $1")
+			case SQLite:
+				builder.WriteString(" WHERE julianday(time_stamp) >= julianday(?)")
+			}
+			args = append(args, *timeLimit)
+		}
+		result, err := d.client.Query(builder.String(), args...)
+		if err != nil {
+			errChan <- errors.Trace(err)
+			return
+		}
+		// fetch result
+		impressions := make([]Impression, 0, batchSize)
+		defer result.Close()
+		for result.Next() {
+			var impression Impression
+			if err = result.Scan(&impression.RequestId, &impression.UserId, &impression.ItemId, &impression.Position,
+				&impression.Source, &impression.Timestamp); err != nil {
+				errChan <- errors.Trace(err)
+				return
+			}
+			impressions = append(impressions, impression)
+			if len(impressions) == batchSize {
+				impressionChan <- impressions
+				impressions = make([]Impression, 0, batchSize)
+			}
+		}
+		if len(impressions) > 0 {
+			impressionChan <- impressions
+		}
+		errChan <- nil
+	}()
+	return impressionChan, errChan
+}
+
+// InsertRule inserts a rule into MySQL. The rule with the same id is overwritten.
+func (d *SQLDatabase) InsertRule(rule Rule) error {
+	userLabels, err := json.Marshal(rule.UserLabels)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch d.driver {
+	case MySQL:
+		_, err = d.client.Exec("INSERT INTO rules(rule_id, rule_type, item_id, category, user_labels, position, multiplier, start_time, end_time, `comment`) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE rule_type = VALUES(rule_type), item_id = VALUES(item_id), "+
+			"category = VALUES(category), user_labels = VALUES(user_labels), position = VALUES(position), multiplier = VALUES(multiplier), "+
+			"start_time = VALUES(start_time), end_time = VALUES(end_time), `comment` = VALUES(`comment`)",
+			rule.RuleId, rule.Type, rule.ItemId, rule.Category, string(userLabels), rule.Position, rule.Multiplier,
+			nullTime(rule.StartTime), nullTime(rule.EndTime), rule.Comment)
+	case Postgres:
+		_, err = d.client.Exec("INSERT INTO rules(rule_id, rule_type, item_id, category, user_labels, position, multiplier, start_time, end_time, comment) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (rule_id) DO UPDATE SET rule_type = EXCLUDED.rule_type, "+
+			"item_id = EXCLUDED.item_id, category = EXCLUDED.category, user_labels = EXCLUDED.user_labels, position = EXCLUDED.position, "+
+			"multiplier = EXCLUDED.multiplier, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, comment = EXCLUDED.comment",
+			rule.RuleId, rule.Type, rule.ItemId, rule.Category, string(userLabels), rule.Position, rule.Multiplier,
+			nullTime(rule.StartTime), nullTime(rule.EndTime), rule.Comment)
+	case ClickHouse:
+		_, err = d.client.Exec("INSERT INTO rules(rule_id, rule_type, item_id, category, user_labels, position, multiplier, start_time, end_time, comment, version) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())",
+			rule.RuleId, rule.Type, rule.ItemId, rule.Category, string(userLabels), rule.Position, rule.Multiplier,
+			nullTime(rule.StartTime), nullTime(rule.EndTime), rule.Comment)
+	case SQLite:
+		_, err = d.client.Exec("INSERT INTO rules(rule_id, rule_type, item_id, category, user_labels, position, multiplier, start_time, end_time, comment) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (rule_id) DO UPDATE SET rule_type = EXCLUDED.rule_type, "+
+			"item_id = EXCLUDED.item_id, category = EXCLUDED.category, user_labels = EXCLUDED.user_labels, position = EXCLUDED.position, "+
+			"multiplier = EXCLUDED.multiplier, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, comment = EXCLUDED.comment",
+			rule.RuleId, rule.Type, rule.ItemId, rule.Category, string(userLabels), rule.Position, rule.Multiplier,
+			nullTime(rule.StartTime), nullTime(rule.EndTime), rule.Comment)
+	}
+	return errors.Trace(err)
+}
+
+// nullTime converts zero time to NULL since zero time is out of range for some databases.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// DeleteRule deletes a rule from MySQL and returns the number of deleted rules. The number is always zero for
+// ClickHouse since RowAffected isn't supported by ClickHouse.
+func (d *SQLDatabase) DeleteRule(ruleId string) (int, error) {
+	var rs sql.Result
+	var err error
+	switch d.driver {
+	case MySQL, SQLite:
+		rs, err = d.client.Exec("DELETE FROM rules WHERE rule_id = ?", ruleId)
+	case Postgres:
+		rs, err = d.client.Exec("DELETE FROM rules WHERE rule_id = $1", ruleId)
+	case ClickHouse:
+		rs, err = d.client.Exec("ALTER TABLE rules DELETE WHERE rule_id = ?", ruleId)
+	}
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	deleteCount, err := rs.RowsAffected()
+	if err != nil && d.driver != ClickHouse {
+		return 0, errors.Trace(err)
+	}
+	return int(deleteCount), nil
+}
+
+// GetRules returns all rules from MySQL.
+func (d *SQLDatabase) GetRules() ([]Rule, error) {
+	var result *sql.Rows
+	var err error
+	switch d.driver {
+	case MySQL, ClickHouse, SQLite:
+		result, err = d.client.Query("SELECT rule_id, rule_type, item_id, category, user_labels, position, multiplier, start_time, end_time, `comment` FROM rules ORDER BY rule_id")
+	case Postgres:
+		result, err = d.client.Query("SELECT rule_id, rule_type, item_id, category, user_labels, position, multiplier, start_time, end_time, comment FROM rules ORDER BY rule_id")
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer result.Close()
+	var rules []Rule
+	for result.Next() {
+		var rule Rule
+		var userLabels string
+		var startTime, endTime sql.NullTime
+		if err = result.Scan(&rule.RuleId, &rule.Type, &rule.ItemId, &rule.Category, &userLabels, &rule.Position,
+			&rule.Multiplier, &startTime, &endTime, &rule.Comment); err != nil {
+			return nil, errors.Trace(err)
+		}
+		rule.StartTime, rule.EndTime = startTime.Time, endTime.Time
+		if err = json.Unmarshal([]byte(userLabels), &rule.UserLabels); err != nil {
+			return nil, errors.Trace(err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
 // BatchInsertItems inserts a batch of items into MySQL.
 func (d *SQLDatabase) BatchInsertItems(items []Item) error {
 	startTime := time.Now()
@@ -262,7 +728,7 @@ func (d *SQLDatabase) BatchInsertItems(items []Item) error {
 	switch d.driver {
 	case MySQL:
 		builder.WriteString("INSERT INTO items(item_id, is_hidden, categories, time_stamp, labels, `comment`) VALUES ")
-	case Postgres:
+	case Postgres, SQLite:
 		builder.WriteString("INSERT INTO items(item_id, is_hidden, categories, time_stamp, labels, comment) VALUES ")
 	case ClickHouse:
 		builder.WriteString("INSERT INTO items(item_id, is_hidden, categories, time_stamp, labels, comment, version) VALUES ")
@@ -278,7 +744,7 @@ func (d *SQLDatabase) BatchInsertItems(items []Item) error {
 			return errors.Trace(err)
 		}
 		switch d.driver {
-		case MySQL:
+		case MySQL, SQLite:
 			builder.WriteString("(?,?,?,?,?,?)")
 		case Postgres:
 			builder.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d)", len(args)+1, len(args)+2, len(args)+3, len(args)+4, len(args)+5, len(args)+6))
@@ -294,7 +760,7 @@ func (d *SQLDatabase) BatchInsertItems(items []Item) error {
 	case MySQL:
 		builder.WriteString(" ON DUPLICATE KEY " +
 			"UPDATE is_hidden = VALUES(is_hidden), categories = VALUES(categories), time_stamp = VALUES(time_stamp), labels = VALUES(labels), `comment` = VALUES(`comment`)")
-	case Postgres:
+	case Postgres, SQLite:
 		builder.WriteString(" ON CONFLICT (item_id) " +
 			"DO UPDATE SET is_hidden = EXCLUDED.is_hidden, categories = EXCLUDED.categories, time_stamp = EXCLUDED.time_stamp, labels = EXCLUDED.labels, comment = EXCLUDED.comment")
 	}
@@ -313,7 +779,7 @@ func (d *SQLDatabase) DeleteItem(itemId string) error {
 		return errors.Trace(err)
 	}
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		_, err = txn.Exec("DELETE FROM items WHERE item_id = ?", itemId)
 	case Postgres:
 		_, err = txn.Exec("DELETE FROM items WHERE item_id = $1", itemId)
@@ -327,7 +793,7 @@ func (d *SQLDatabase) DeleteItem(itemId string) error {
 		return errors.Trace(err)
 	}
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		_, err = txn.Exec("DELETE FROM feedback WHERE item_id = ?", itemId)
 	case Postgres:
 		_, err = txn.Exec("DELETE FROM feedback WHERE item_id = $1", itemId)
@@ -350,7 +816,7 @@ func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
 	var result *sql.Rows
 	var err error
 	switch d.driver {
-	case MySQL, ClickHouse:
+	case MySQL, ClickHouse, SQLite:
 		result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, `comment` FROM items WHERE item_id = ?", itemId)
 	case Postgres:
 		result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items WHERE item_id = $1", itemId)
@@ -377,6 +843,60 @@ func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
 	return Item{}, errors.Annotate(ErrItemNotExist, itemId)
 }
 
+// BatchGetItems returns items from MySQL. Items not found are skipped.
+func (d *SQLDatabase) BatchGetItems(itemIds []string) ([]Item, error) {
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+	var builder strings.Builder
+	switch d.driver {
+	case MySQL, ClickHouse, SQLite:
+		builder.WriteString("SELECT item_id, is_hidden, categories, time_stamp, labels, `comment` FROM items WHERE item_id IN (")
+	case Postgres:
+		builder.WriteString("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items WHERE item_id IN (")
+	}
+	args := make([]interface{}, len(itemIds))
+	for i, itemId := range itemIds {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		if d.driver == Postgres {
+			builder.WriteString(fmt.Sprintf("$%d", i+1))
+		} else {
+			builder.WriteString("?")
+		}
+		args[i] = itemId
+	}
+	builder.WriteString(")")
+	result, err := d.client.Query(builder.String(), args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer result.Close()
+	var items []Item
+	loaded := strset.New()
+	for result.Next() {
+		var item Item
+		var labels, categories string
+		if err = result.Scan(&item.ItemId, &item.IsHidden, &categories, &item.Timestamp, &labels, &item.Comment); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// duplicated rows might exist in ClickHouse before merged
+		if loaded.Has(item.ItemId) {
+			continue
+		}
+		loaded.Add(item.ItemId)
+		if err = json.Unmarshal([]byte(labels), &item.Labels); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = json.Unmarshal([]byte(categories), &item.Categories); err != nil {
+			return nil, errors.Trace(err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // ModifyItem modify an item in MySQL.
 func (d *SQLDatabase) ModifyItem(itemId string, patch ItemPatch) error {
 	// ignore empty patch
@@ -388,7 +908,7 @@ func (d *SQLDatabase) ModifyItem(itemId string, patch ItemPatch) error {
 	var args []interface{}
 	delimiter := " "
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		builder.WriteString("UPDATE items SET")
 		if patch.IsHidden != nil {
 			builder.WriteString(delimiter)
@@ -522,6 +1042,14 @@ func (d *SQLDatabase) GetItems(cursor string, n int, timeLimit *time.Time) (stri
 			result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items "+
 				"WHERE item_id >= $1 AND time_stamp >= $2 ORDER BY item_id LIMIT $3", cursor, *timeLimit, n+1)
 		}
+	case SQLite:
+		if timeLimit == nil {
+			result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items "+
+				"WHERE item_id >= ? ORDER BY item_id LIMIT ?", cursor, n+1)
+		} else {
+			result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items "+
+				"WHERE item_id >= ? AND julianday(time_stamp) >= julianday(?) ORDER BY item_id LIMIT ?", cursor, *timeLimit, n+1)
+		}
 	}
 	if err != nil {
 		return "", nil, errors.Trace(err)
@@ -571,6 +1099,12 @@ func (d *SQLDatabase) GetItemStream(batchSize int, timeLimit *time.Time) (chan [
 			} else {
 				result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items WHERE time_stamp >= $2", *timeLimit)
 			}
+		case SQLite:
+			if timeLimit == nil {
+				result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items")
+			} else {
+				result, err = d.client.Query("SELECT item_id, is_hidden, categories, time_stamp, labels, comment FROM items WHERE julianday(time_stamp) >= julianday(?)", *timeLimit)
+			}
 		}
 		if err != nil {
 			errChan <- errors.Trace(err)
@@ -616,16 +1150,18 @@ func (d *SQLDatabase) GetItemFeedback(itemId string, feedbackTypes ...string) ([
 	var builder strings.Builder
 	switch d.driver {
 	case MySQL, ClickHouse:
-		builder.WriteString("SELECT user_id, item_id, feedback_type, time_stamp FROM feedback WHERE time_stamp <= NOW() AND item_id = ?")
+		builder.WriteString("SELECT user_id, item_id, feedback_type, time_stamp, value, context, request_id FROM feedback WHERE time_stamp <= NOW() AND item_id = ?")
 	case Postgres:
-		builder.WriteString("SELECT user_id, item_id, feedback_type, time_stamp FROM feedback WHERE time_stamp <= NOW() AND item_id = $1")
+		builder.WriteString("SELECT user_id, item_id, feedback_type, time_stamp, value, context, request_id FROM feedback WHERE time_stamp <= NOW() AND item_id = $1")
+	case SQLite:
+		builder.WriteString("SELECT user_id, item_id, feedback_type, time_stamp, value, context, request_id FROM feedback WHERE julianday(time_stamp) <= julianday('now') AND item_id = ?")
 	}
 	args := []interface{}{itemId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
 		for i, feedbackType := range feedbackTypes {
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				builder.WriteString("?")
 			case Postgres:
 				builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
@@ -645,7 +1181,11 @@ func (d *SQLDatabase) GetItemFeedback(itemId string, feedbackTypes ...string) ([
 	defer result.Close()
 	for result.Next() {
 		var feedback Feedback
-		if err = result.Scan(&feedback.UserId, &feedback.ItemId, &feedback.FeedbackType, &feedback.Timestamp); err != nil {
+		var context string
+		if err = result.Scan(&feedback.UserId, &feedback.ItemId, &feedback.FeedbackType, &feedback.Timestamp, &feedback.Value, &context, &feedback.RequestId); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = decodeContext(context, &feedback.Context); err != nil {
 			return nil, errors.Trace(err)
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -661,7 +1201,7 @@ func (d *SQLDatabase) BatchInsertUsers(users []User) error {
 	switch d.driver {
 	case MySQL:
 		builder.WriteString("INSERT INTO users(user_id, labels, subscribe, `comment`) VALUES ")
-	case Postgres:
+	case Postgres, SQLite:
 		builder.WriteString("INSERT INTO users(user_id, labels, subscribe, comment) VALUES ")
 	case ClickHouse:
 		builder.WriteString("INSERT INTO users(user_id, labels, subscribe, comment, version) VALUES ")
@@ -677,7 +1217,7 @@ func (d *SQLDatabase) BatchInsertUsers(users []User) error {
 			return errors.Trace(err)
 		}
 		switch d.driver {
-		case MySQL:
+		case MySQL, SQLite:
 			builder.WriteString("(?,?,?,?)")
 		case Postgres:
 			builder.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", len(args)+1, len(args)+2, len(args)+3, len(args)+4))
@@ -693,7 +1233,7 @@ func (d *SQLDatabase) BatchInsertUsers(users []User) error {
 	case MySQL:
 		builder.WriteString(" ON DUPLICATE KEY " +
 			"UPDATE labels = VALUES(labels), subscribe = VALUES(subscribe), `comment` = VALUES(`comment`)")
-	case Postgres:
+	case Postgres, SQLite:
 		builder.WriteString(" ON CONFLICT (user_id) " +
 			"DO UPDATE SET labels = EXCLUDED.labels, subscribe = EXCLUDED.subscribe, comment = EXCLUDED.comment")
 	}
@@ -712,7 +1252,7 @@ func (d *SQLDatabase) DeleteUser(userId string) error {
 		return errors.Trace(err)
 	}
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		_, err = txn.Exec("DELETE FROM users WHERE user_id = ?", userId)
 	case Postgres:
 		_, err = txn.Exec("DELETE FROM users WHERE user_id = $1", userId)
@@ -726,7 +1266,7 @@ func (d *SQLDatabase) DeleteUser(userId string) error {
 		return errors.Trace(err)
 	}
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		_, err = txn.Exec("DELETE FROM feedback WHERE user_id = ?", userId)
 	case Postgres:
 		_, err = txn.Exec("DELETE FROM feedback WHERE user_id = $1", userId)
@@ -749,7 +1289,7 @@ func (d *SQLDatabase) GetUser(userId string) (User, error) {
 	var result *sql.Rows
 	var err error
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		result, err = d.client.Query("SELECT user_id, labels, subscribe, `comment`, user_name, gender FROM users WHERE user_id = ?", userId)
 	case Postgres:
 		result, err = d.client.Query("SELECT user_id, labels, subscribe, comment, user_name, gender FROM users WHERE user_id = $1", userId)
@@ -779,10 +1319,64 @@ func (d *SQLDatabase) GetUser(userId string) (User, error) {
 	return User{}, errors.Annotate(ErrUserNotExist, userId)
 }
 
+// BatchGetUsers returns users from MySQL. Users not found are skipped.
+func (d *SQLDatabase) BatchGetUsers(userIds []string) ([]User, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	var builder strings.Builder
+	switch d.driver {
+	case MySQL, ClickHouse, SQLite:
+		builder.WriteString("SELECT user_id, labels, subscribe, `comment`, user_name, gender FROM users WHERE user_id IN (")
+	case Postgres:
+		builder.WriteString("SELECT user_id, labels, subscribe, comment, user_name, gender FROM users WHERE user_id IN (")
+	}
+	args := make([]interface{}, len(userIds))
+	for i, userId := range userIds {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		if d.driver == Postgres {
+			builder.WriteString(fmt.Sprintf("$%d", i+1))
+		} else {
+			builder.WriteString("?")
+		}
+		args[i] = userId
+	}
+	builder.WriteString(")")
+	result, err := d.client.Query(builder.String(), args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer result.Close()
+	var users []User
+	loaded := strset.New()
+	for result.Next() {
+		var user User
+		var labels, subscribe string
+		if err = result.Scan(&user.UserId, &labels, &subscribe, &user.Comment, &user.UserName, &user.Gender); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// duplicated rows might exist in ClickHouse before merged
+		if loaded.Has(user.UserId) {
+			continue
+		}
+		loaded.Add(user.UserId)
+		if err = json.Unmarshal([]byte(labels), &user.Labels); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = json.Unmarshal([]byte(subscribe), &user.Subscribe); err != nil {
+			return nil, errors.Trace(err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
 // ModifyUser modify a user in MySQL.
 func (d *SQLDatabase) ModifyUser(userId string, patch UserPatch) error {
 	// ignore empty patch
-	if patch.Labels == nil && patch.Comment == nil {
+	if patch.Labels == nil && patch.Subscribe == nil && patch.Comment == nil {
 		base.Logger().Debug("empty user patch")
 		return nil
 	}
@@ -790,7 +1384,7 @@ func (d *SQLDatabase) ModifyUser(userId string, patch UserPatch) error {
 	var args []interface{}
 	delimiter := " "
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		builder.WriteString("UPDATE users SET")
 		if patch.Comment != nil {
 			builder.WriteString(delimiter)
@@ -805,6 +1399,13 @@ func (d *SQLDatabase) ModifyUser(userId string, patch UserPatch) error {
 			args = append(args, text)
 			delimiter = ", "
 		}
+		if patch.Subscribe != nil {
+			builder.WriteString(delimiter)
+			text, _ := json.Marshal(patch.Subscribe)
+			builder.WriteString("`subscribe` = ?")
+			args = append(args, text)
+			delimiter = ", "
+		}
 		builder.WriteString(" WHERE user_id = ?")
 		args = append(args, userId)
 	case Postgres:
@@ -822,6 +1423,13 @@ func (d *SQLDatabase) ModifyUser(userId string, patch UserPatch) error {
 			args = append(args, text)
 			delimiter = ", "
 		}
+		if patch.Subscribe != nil {
+			builder.WriteString(delimiter)
+			text, _ := json.Marshal(patch.Subscribe)
+			builder.WriteString(fmt.Sprintf("subscribe = $%d", len(args)+1))
+			args = append(args, text)
+			delimiter = ", "
+		}
 		builder.WriteString(fmt.Sprintf(" WHERE user_id = $%d", len(args)+1))
 		args = append(args, userId)
 	case ClickHouse:
@@ -839,6 +1447,13 @@ func (d *SQLDatabase) ModifyUser(userId string, patch UserPatch) error {
 			args = append(args, string(text))
 			delimiter = ", "
 		}
+		if patch.Subscribe != nil {
+			builder.WriteString(delimiter)
+			text, _ := json.Marshal(patch.Subscribe)
+			builder.WriteString("`subscribe` = ?")
+			args = append(args, string(text))
+			delimiter = ", "
+		}
 		builder.WriteString(" WHERE user_id = ?")
 		args = append(args, userId)
 	}
@@ -851,7 +1466,7 @@ func (d *SQLDatabase) GetUsers(cursor string, n int) (string, []User, error) {
 	var result *sql.Rows
 	var err error
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		result, err = d.client.Query("SELECT user_id, labels, subscribe, `comment`, user_name, gender FROM users "+
 			"WHERE user_id >= ? ORDER BY user_id LIMIT ?", cursor, n+1)
 	case Postgres:
@@ -898,7 +1513,7 @@ func (d *SQLDatabase) GetUserStream(batchSize int) (chan []User, chan error) {
 		var result *sql.Rows
 		var err error
 		switch d.driver {
-		case MySQL:
+		case MySQL, SQLite:
 			result, err = d.client.Query("SELECT user_id, labels, subscribe, `comment`, user_name, gender FROM users")
 		case Postgres:
 			result, err = d.client.Query("SELECT user_id, labels, subscribe, comment, user_name, gender FROM users")
@@ -949,20 +1564,24 @@ func (d *SQLDatabase) GetUserFeedback(userId string, withFuture bool, feedbackTy
 	var err error
 	var builder strings.Builder
 	switch d.driver {
-	case MySQL, ClickHouse:
-		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE user_id = ?")
+	case MySQL, ClickHouse, SQLite:
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id FROM feedback WHERE user_id = ?")
 	case Postgres:
-		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment FROM feedback WHERE user_id = $1")
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id FROM feedback WHERE user_id = $1")
 	}
 	if !withFuture {
-		builder.WriteString(" AND time_stamp <= NOW() ")
+		if d.driver == SQLite {
+			builder.WriteString(" AND julianday(time_stamp) <= julianday('now') ")
+		} else {
+			builder.WriteString(" AND time_stamp <= NOW() ")
+		}
 	}
 	args := []interface{}{userId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
 		for i, feedbackType := range feedbackTypes {
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				builder.WriteString("?")
 			case Postgres:
 				builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
@@ -982,7 +1601,11 @@ func (d *SQLDatabase) GetUserFeedback(userId string, withFuture bool, feedbackTy
 	defer result.Close()
 	for result.Next() {
 		var feedback Feedback
-		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+		var context string
+		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment, &feedback.Value, &context, &feedback.RequestId); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = decodeContext(context, &feedback.Context); err != nil {
 			return nil, errors.Trace(err)
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -1018,6 +1641,8 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 			builder.WriteString("INSERT INTO users(user_id) VALUES ")
 		case ClickHouse:
 			builder.WriteString("INSERT INTO users(user_id, version) VALUES ")
+		case SQLite:
+			builder.WriteString("INSERT OR IGNORE INTO users(user_id) VALUES ")
 		}
 		var args []interface{}
 		for i, user := range userList {
@@ -1028,6 +1653,8 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 				builder.WriteString(fmt.Sprintf("($%d)", i+1))
 			case ClickHouse:
 				builder.WriteString("(?,'0000-00-00 00:00:00')")
+			case SQLite:
+				builder.WriteString("(?)")
 			}
 			if i+1 < len(userList) {
 				builder.WriteString(",")
@@ -1045,7 +1672,7 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 			var rs *sql.Rows
 			var err error
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				rs, err = d.client.Query("SELECT user_id FROM users WHERE user_id = ?", user)
 			case Postgres:
 				rs, err = d.client.Query("SELECT user_id FROM users WHERE user_id = $1", user)
@@ -1071,6 +1698,8 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 			builder.WriteString("INSERT INTO items(item_id) VALUES ")
 		case ClickHouse:
 			builder.WriteString("INSERT INTO items(item_id, version) VALUES ")
+		case SQLite:
+			builder.WriteString("INSERT OR IGNORE INTO items(item_id) VALUES ")
 		}
 		var args []interface{}
 		for i, item := range itemList {
@@ -1081,6 +1710,8 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 				builder.WriteString(fmt.Sprintf("($%d)", i+1))
 			case ClickHouse:
 				builder.WriteString("(?,'0000-00-00 00:00:00')")
+			case SQLite:
+				builder.WriteString("(?)")
 			}
 			if i+1 < len(itemList) {
 				builder.WriteString(",")
@@ -1098,7 +1729,7 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 			var rs *sql.Rows
 			var err error
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				rs, err = d.client.Query("SELECT item_id FROM items WHERE item_id = ?", item)
 			case Postgres:
 				rs, err = d.client.Query("SELECT item_id FROM items WHERE item_id = $1", item)
@@ -1118,35 +1749,49 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 	switch d.driver {
 	case MySQL:
 		if overwrite {
-			builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, `comment`) VALUES ")
+			builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id) VALUES ")
 		} else {
-			builder.WriteString("INSERT IGNORE INTO feedback(feedback_type, user_id, item_id, time_stamp, `comment`) VALUES ")
+			builder.WriteString("INSERT IGNORE INTO feedback(feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id) VALUES ")
 		}
 	case ClickHouse:
-		builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, `comment`, version) VALUES ")
+		builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id, version) VALUES ")
 	case Postgres:
-		builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, comment) VALUES ")
+		builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id) VALUES ")
+	case SQLite:
+		if overwrite {
+			builder.WriteString("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id) VALUES ")
+		} else {
+			builder.WriteString("INSERT OR IGNORE INTO feedback(feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id) VALUES ")
+		}
 	}
 	var args []interface{}
 	for _, f := range feedback {
 		if users.Has(f.UserId) && items.Has(f.ItemId) {
+			// context is written explicitly since JSON columns have no default in MySQL
+			if f.Context == nil {
+				f.Context = []string{}
+			}
+			context, err := json.Marshal(f.Context)
+			if err != nil {
+				return errors.Trace(err)
+			}
 			if len(args) > 0 {
 				builder.WriteString(",")
 			}
 			switch d.driver {
-			case MySQL:
-				builder.WriteString("(?,?,?,?,?)")
+			case MySQL, SQLite:
+				builder.WriteString("(?,?,?,?,?,?,?,?)")
 			case ClickHouse:
 				if overwrite {
-					builder.WriteString("(?,?,?,?,?,NOW())")
+					builder.WriteString("(?,?,?,?,?,?,?,?,NOW())")
 				} else {
-					builder.WriteString("(?,?,?,?,?,0)")
+					builder.WriteString("(?,?,?,?,?,?,?,?,0)")
 				}
 			case Postgres:
-				builder.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d)",
-					len(args)+1, len(args)+2, len(args)+3, len(args)+4, len(args)+5))
+				builder.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
+					len(args)+1, len(args)+2, len(args)+3, len(args)+4, len(args)+5, len(args)+6, len(args)+7, len(args)+8))
 			}
-			args = append(args, f.FeedbackType, f.UserId, f.ItemId, f.Timestamp, f.Comment)
+			args = append(args, f.FeedbackType, f.UserId, f.ItemId, f.Timestamp, f.Comment, f.Value, string(context), f.RequestId)
 		}
 	}
 	if len(args) == 0 {
@@ -1155,9 +1800,9 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 	if overwrite {
 		switch d.driver {
 		case MySQL:
-			builder.WriteString(" ON DUPLICATE KEY UPDATE time_stamp = VALUES(time_stamp), `comment` = VALUES(`comment`)")
-		case Postgres:
-			builder.WriteString(" ON CONFLICT (feedback_type, user_id, item_id) DO UPDATE SET time_stamp = EXCLUDED.time_stamp, comment = EXCLUDED.comment")
+			builder.WriteString(" ON DUPLICATE KEY UPDATE time_stamp = VALUES(time_stamp), `comment` = VALUES(`comment`), value = VALUES(value), context = VALUES(context), request_id = VALUES(request_id)")
+		case Postgres, SQLite:
+			builder.WriteString(" ON CONFLICT (feedback_type, user_id, item_id) DO UPDATE SET time_stamp = EXCLUDED.time_stamp, comment = EXCLUDED.comment, value = EXCLUDED.value, context = EXCLUDED.context, request_id = EXCLUDED.request_id")
 		}
 	} else if d.driver == Postgres {
 		builder.WriteString(" ON CONFLICT (feedback_type, user_id, item_id) DO NOTHING")
@@ -1183,16 +1828,18 @@ func (d *SQLDatabase) GetFeedback(cursor string, n int, timeLimit *time.Time, fe
 	var builder strings.Builder
 	switch d.driver {
 	case MySQL, ClickHouse:
-		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE time_stamp <= NOW() AND (feedback_type, user_id, item_id) >= (?,?,?)")
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id FROM feedback WHERE time_stamp <= NOW() AND (feedback_type, user_id, item_id) >= (?,?,?)")
 	case Postgres:
-		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment FROM feedback WHERE time_stamp <= NOW() AND (feedback_type, user_id, item_id) >= ($1,$2,$3)")
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id FROM feedback WHERE time_stamp <= NOW() AND (feedback_type, user_id, item_id) >= ($1,$2,$3)")
+	case SQLite:
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id FROM feedback WHERE julianday(time_stamp) <= julianday('now') AND (feedback_type, user_id, item_id) >= (?,?,?)")
 	}
 	args := []interface{}{cursorKey.FeedbackType, cursorKey.UserId, cursorKey.ItemId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
 		for i, feedbackType := range feedbackTypes {
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				builder.WriteString("?")
 			case Postgres:
 				builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
@@ -1210,11 +1857,13 @@ func (d *SQLDatabase) GetFeedback(cursor string, n int, timeLimit *time.Time, fe
 			builder.WriteString(" AND time_stamp >= ?")
 		case Postgres:
 			builder.WriteString(fmt.Sprintf(" AND time_stamp >= $%d", len(args)+1))
+		case SQLite:
+			builder.WriteString(" AND julianday(time_stamp) >= julianday(?)")
 		}
 		args = append(args, *timeLimit)
 	}
 	switch d.driver {
-	case MySQL, ClickHouse:
+	case MySQL, ClickHouse, SQLite:
 		builder.WriteString(" ORDER BY feedback_type, user_id, item_id LIMIT ?")
 	case Postgres:
 		builder.WriteString(fmt.Sprintf(" ORDER BY feedback_type, user_id, item_id LIMIT $%d", len(args)+1))
@@ -1228,7 +1877,11 @@ func (d *SQLDatabase) GetFeedback(cursor string, n int, timeLimit *time.Time, fe
 	defer result.Close()
 	for result.Next() {
 		var feedback Feedback
-		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+		var context string
+		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment, &feedback.Value, &context, &feedback.RequestId); err != nil {
+			return "", nil, errors.Trace(err)
+		}
+		if err = decodeContext(context, &feedback.Context); err != nil {
 			return "", nil, errors.Trace(err)
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -1257,16 +1910,18 @@ func (d *SQLDatabase) GetFeedbackStream(batchSize int, timeLimit *time.Time, fee
 		var builder strings.Builder
 		switch d.driver {
 		case MySQL, ClickHouse:
-			builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE time_stamp <= NOW()")
+			builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id FROM feedback WHERE time_stamp <= NOW()")
 		case Postgres:
-			builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment FROM feedback WHERE time_stamp <= NOW()")
+			builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id FROM feedback WHERE time_stamp <= NOW()")
+		case SQLite:
+			builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id FROM feedback WHERE julianday(time_stamp) <= julianday('now')")
 		}
 		var args []interface{}
 		if len(feedbackTypes) > 0 {
 			builder.WriteString(" AND feedback_type IN (")
 			for i, feedbackType := range feedbackTypes {
 				switch d.driver {
-				case MySQL, ClickHouse:
+				case MySQL, ClickHouse, SQLite:
 					builder.WriteString("?")
 				case Postgres:
 					builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
@@ -1284,6 +1939,8 @@ func (d *SQLDatabase) GetFeedbackStream(batchSize int, timeLimit *time.Time, fee
 				builder.WriteString(" AND time_stamp >= ?")
 			case Postgres:
 				builder.WriteString(fmt.Sprintf(" AND time_stamp >= $%d", len(args)+1))
+			case SQLite:
+				builder.WriteString(" AND julianday(time_stamp) >= julianday(?)")
 			}
 			args = append(args, *timeLimit)
 		}
@@ -1297,7 +1954,12 @@ func (d *SQLDatabase) GetFeedbackStream(batchSize int, timeLimit *time.Time, fee
 		defer result.Close()
 		for result.Next() {
 			var feedback Feedback
-			if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+			var context string
+			if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment, &feedback.Value, &context, &feedback.RequestId); err != nil {
+				errChan <- errors.Trace(err)
+				return
+			}
+			if err = decodeContext(context, &feedback.Context); err != nil {
 				errChan <- errors.Trace(err)
 				return
 			}
@@ -1322,17 +1984,17 @@ func (d *SQLDatabase) GetUserItemFeedback(userId, itemId string, feedbackTypes .
 	var err error
 	var builder strings.Builder
 	switch d.driver {
-	case MySQL, ClickHouse:
-		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE user_id = ? AND item_id = ?")
+	case MySQL, ClickHouse, SQLite:
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment`, value, context, request_id FROM feedback WHERE user_id = ? AND item_id = ?")
 	case Postgres:
-		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment FROM feedback WHERE user_id = $1 AND item_id = $2")
+		builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, comment, value, context, request_id FROM feedback WHERE user_id = $1 AND item_id = $2")
 	}
 	args := []interface{}{userId, itemId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
 		for i, feedbackType := range feedbackTypes {
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				builder.WriteString("?")
 			case Postgres:
 				builder.WriteString(fmt.Sprintf("$%d", i+3))
@@ -1352,7 +2014,11 @@ func (d *SQLDatabase) GetUserItemFeedback(userId, itemId string, feedbackTypes .
 	defer result.Close()
 	for result.Next() {
 		var feedback Feedback
-		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+		var context string
+		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment, &feedback.Value, &context, &feedback.RequestId); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = decodeContext(context, &feedback.Context); err != nil {
 			return nil, errors.Trace(err)
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -1368,7 +2034,7 @@ func (d *SQLDatabase) DeleteUserItemFeedback(userId, itemId string, feedbackType
 	var err error
 	var builder strings.Builder
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		builder.WriteString("DELETE FROM feedback WHERE user_id = ? AND item_id = ?")
 	case Postgres:
 		builder.WriteString("DELETE FROM feedback WHERE user_id = $1 AND item_id = $2")
@@ -1380,7 +2046,7 @@ func (d *SQLDatabase) DeleteUserItemFeedback(userId, itemId string, feedbackType
 		builder.WriteString(" AND feedback_type IN (")
 		for i, feedbackType := range feedbackTypes {
 			switch d.driver {
-			case MySQL, ClickHouse:
+			case MySQL, ClickHouse, SQLite:
 				builder.WriteString("?")
 			case Postgres:
 				builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
@@ -1416,6 +2082,8 @@ func (d *SQLDatabase) GetClickThroughRate(date time.Time, positiveTypes, readTyp
 		builder.WriteString("SELECT IF(isFinite(AVG(user_ctr)),AVG(user_ctr),0) FROM (")
 	case Postgres:
 		builder.WriteString("SELECT COALESCE(AVG(user_ctr),0) FROM (")
+	case SQLite:
+		builder.WriteString("SELECT IFNULL(AVG(user_ctr),0) FROM (")
 	}
 	var args []interface{}
 	// Get click-through rates
@@ -1426,52 +2094,59 @@ func (d *SQLDatabase) GetClickThroughRate(date time.Time, positiveTypes, readTyp
 		builder.WriteString("SELECT SUM(notEmpty(positive_feedback.user_id)) / SUM(notEmpty(read_feedback.user_id)) AS user_ctr FROM (")
 	case Postgres:
 		builder.WriteString("SELECT COUNT(positive_feedback.user_id) :: DOUBLE PRECISION / COUNT(read_feedback.user_id) :: DOUBLE PRECISION AS user_ctr FROM (")
+	case SQLite:
+		builder.WriteString("SELECT CAST(COUNT(positive_feedback.user_id) AS DOUBLE) / COUNT(read_feedback.user_id) AS user_ctr FROM (")
 	}
-	// Get positive feedback
+	// SQLite doesn't support RIGHT JOIN, so read feedback is placed at the left side of LEFT JOIN.
+	leftName, leftTypes, rightName, rightTypes, join := "positive_feedback", positiveTypes, "read_feedback", readTypes, "RIGHT JOIN"
+	if d.driver == SQLite {
+		leftName, leftTypes, rightName, rightTypes, join = rightName, rightTypes, leftName, leftTypes, "LEFT JOIN"
+	}
+	// Get left feedback
 	switch d.driver {
-	case MySQL, ClickHouse:
+	case MySQL, ClickHouse, SQLite:
 		builder.WriteString("SELECT DISTINCT user_id, item_id FROM feedback WHERE DATE(time_stamp) = DATE(?) AND feedback_type IN (")
 	case Postgres:
 		builder.WriteString(fmt.Sprintf("SELECT DISTINCT user_id, item_id FROM feedback WHERE DATE(time_stamp) = DATE($%d) AND feedback_type IN (", len(args)+1))
 	}
 	args = append(args, date)
-	for i, positiveType := range positiveTypes {
+	for i, leftType := range leftTypes {
 		if i > 0 {
 			builder.WriteString(",")
 		}
 		switch d.driver {
-		case MySQL, ClickHouse:
+		case MySQL, ClickHouse, SQLite:
 			builder.WriteString("?")
 		case Postgres:
 			builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
 		}
-		args = append(args, positiveType)
+		args = append(args, leftType)
 	}
-	builder.WriteString(")) AS positive_feedback RIGHT JOIN (")
-	// Get read feedback
+	builder.WriteString(fmt.Sprintf(")) AS %s %s (", leftName, join))
+	// Get right feedback
 	switch d.driver {
-	case MySQL, ClickHouse:
+	case MySQL, ClickHouse, SQLite:
 		builder.WriteString("SELECT DISTINCT user_id, item_id FROM feedback WHERE DATE(time_stamp) = DATE(?) AND feedback_type IN (")
 	case Postgres:
 		builder.WriteString(fmt.Sprintf("SELECT DISTINCT user_id, item_id FROM feedback WHERE DATE(time_stamp) = DATE($%d) AND feedback_type IN (", len(args)+1))
 	}
 	args = append(args, date)
-	for i, readType := range readTypes {
+	for i, rightType := range rightTypes {
 		if i > 0 {
 			builder.WriteString(",")
 		}
 		switch d.driver {
-		case MySQL, ClickHouse:
+		case MySQL, ClickHouse, SQLite:
 			builder.WriteString("?")
 		case Postgres:
 			builder.WriteString(fmt.Sprintf("$%d", len(args)+1))
 		}
-		args = append(args, readType)
+		args = append(args, rightType)
 	}
-	builder.WriteString(")) AS read_feedback ON positive_feedback.user_id = read_feedback.user_id AND positive_feedback.item_id = read_feedback.item_id GROUP BY read_feedback.user_id ")
+	builder.WriteString(")) AS " + rightName + " ON positive_feedback.user_id = read_feedback.user_id AND positive_feedback.item_id = read_feedback.item_id GROUP BY read_feedback.user_id ")
 	// users must have at least one positive feedback
 	switch d.driver {
-	case MySQL:
+	case MySQL, SQLite:
 		builder.WriteString("HAVING COUNT(positive_feedback.user_id) > 0) AS user_ctr")
 	case ClickHouse:
 		builder.WriteString("HAVING SUM(notEmpty(positive_feedback.user_id)) > 0) AS user_ctr")
@@ -18,6 +18,7 @@ import (
 	"database/sql"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -58,6 +59,31 @@ func (db *testSQLDatabase) Close(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// testMigrateFeedback checks that columns added later are added to the feedback table created by previous versions.
+func testMigrateFeedback(t *testing.T, db *testSQLDatabase, oldSchema string) {
+	client := db.GetComm(t)
+	_, err := client.Exec("DROP TABLE feedback")
+	assert.NoError(t, err)
+	_, err = client.Exec(oldSchema)
+	assert.NoError(t, err)
+	_, err = client.Exec("INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, comment) " +
+		"VALUES ('read', '0', '0', '2000-01-01 00:00:00', '')")
+	assert.NoError(t, err)
+	// add columns to the existing table
+	err = db.Init()
+	assert.NoError(t, err)
+	var value float64
+	var context, requestId string
+	err = client.QueryRow("SELECT value, context, request_id FROM feedback").Scan(&value, &context, &requestId)
+	assert.NoError(t, err)
+	assert.Zero(t, value)
+	assert.JSONEq(t, "[]", context)
+	assert.Empty(t, requestId)
+	// migration is idempotent
+	err = db.Init()
+	assert.NoError(t, err)
+}
+
 func newTestMySQLDatabase(t *testing.T, dbName string) *testSQLDatabase {
 	database := new(testSQLDatabase)
 	var err error
@@ -123,6 +149,18 @@ func TestMySQL_Measurements(t *testing.T) {
 	testMeasurements(t, db.Database)
 }
 
+func TestMySQL_Impressions(t *testing.T) {
+	db := newTestMySQLDatabase(t, "TestMySQL_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestMySQL_Rules(t *testing.T) {
+	db := newTestMySQLDatabase(t, "TestMySQL_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
 func TestMySQL_TimeLimit(t *testing.T) {
 	db := newTestMySQLDatabase(t, "TestMySQL_TimeLimit")
 	defer db.Close(t)
@@ -135,6 +173,19 @@ func TestMySQL_GetClickThroughRate(t *testing.T) {
 	testGetClickThroughRate(t, db.Database)
 }
 
+func TestMySQL_MigrateFeedback(t *testing.T) {
+	db := newTestMySQLDatabase(t, "TestMySQL_MigrateFeedback")
+	defer db.Close(t)
+	testMigrateFeedback(t, db, "CREATE TABLE feedback ("+
+		"feedback_type varchar(256) NOT NULL,"+
+		"user_id varchar(256) NOT NULL,"+
+		"item_id varchar(256) NOT NULL,"+
+		"time_stamp datetime NOT NULL,"+
+		"comment TEXT NOT NULL,"+
+		"PRIMARY KEY(feedback_type, user_id, item_id)"+
+		")  ENGINE=InnoDB")
+}
+
 func newTestPostgresDatabase(t *testing.T, dbName string) *testSQLDatabase {
 	database := new(testSQLDatabase)
 	var err error
@@ -200,6 +251,18 @@ func TestPostgres_Measurements(t *testing.T) {
 	testMeasurements(t, db.Database)
 }
 
+func TestPostgres_Impressions(t *testing.T) {
+	db := newTestPostgresDatabase(t, "TestPostgres_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestPostgres_Rules(t *testing.T) {
+	db := newTestPostgresDatabase(t, "TestPostgres_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
 func TestPostgres_TimeLimit(t *testing.T) {
 	db := newTestPostgresDatabase(t, "TestPostgres_TimeLimit")
 	defer db.Close(t)
@@ -212,6 +275,19 @@ func TestPostgres_GetClickThroughRate(t *testing.T) {
 	testGetClickThroughRate(t, db.Database)
 }
 
+func TestPostgres_MigrateFeedback(t *testing.T) {
+	db := newTestPostgresDatabase(t, "TestPostgres_MigrateFeedback")
+	defer db.Close(t)
+	testMigrateFeedback(t, db, "CREATE TABLE feedback ("+
+		"feedback_type varchar(256) NOT NULL,"+
+		"user_id varchar(256) NOT NULL,"+
+		"item_id varchar(256) NOT NULL,"+
+		"time_stamp timestamptz NOT NULL DEFAULT '0001-01-01',"+
+		"comment TEXT NOT NULL DEFAULT '',"+
+		"PRIMARY KEY(feedback_type, user_id, item_id)"+
+		")")
+}
+
 func newTestClickHouseDatabase(t *testing.T, dbName string) *testSQLDatabase {
 	database := new(testSQLDatabase)
 	var err error
@@ -277,6 +353,18 @@ func TestClickHouse_Measurements(t *testing.T) {
 	testMeasurements(t, db.Database)
 }
 
+func TestClickHouse_Impressions(t *testing.T) {
+	db := newTestClickHouseDatabase(t, "TestClickHouse_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestClickHouse_Rules(t *testing.T) {
+	db := newTestClickHouseDatabase(t, "TestClickHouse_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
 func TestClickHouse_TimeLimit(t *testing.T) {
 	db := newTestClickHouseDatabase(t, "TestClickHouse_TimeLimit")
 	defer db.Close(t)
@@ -288,3 +376,112 @@ func TestClickHouse_GetClickThroughRate(t *testing.T) {
 	defer db.Close(t)
 	testGetClickThroughRate(t, db.Database)
 }
+
+func TestClickHouse_MigrateFeedback(t *testing.T) {
+	db := newTestClickHouseDatabase(t, "TestClickHouse_MigrateFeedback")
+	defer db.Close(t)
+	testMigrateFeedback(t, db, "CREATE TABLE feedback ("+
+		"feedback_type String,"+
+		"user_id String,"+
+		"item_id String,"+
+		"time_stamp Datetime,"+
+		"comment String,"+
+		"version DateTime"+
+		") ENGINE = ReplacingMergeTree(version) ORDER BY (feedback_type, user_id, item_id)")
+}
+
+func newTestSQLiteDatabase(t *testing.T, dbName string) *testSQLDatabase {
+	database := new(testSQLDatabase)
+	// create database
+	path := filepath.Join(os.TempDir(), "gorse_"+dbName+".db")
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.RemoveAll(path + suffix)
+		assert.NoError(t, err)
+	}
+	var err error
+	database.Database, err = Open(sqlitePrefix + path)
+	assert.NoError(t, err)
+	// create schema
+	err = database.Init()
+	assert.NoError(t, err)
+	return database
+}
+
+func TestSQLite_Users(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Users")
+	defer db.Close(t)
+	testUsers(t, db.Database)
+}
+
+func TestSQLite_Feedback(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Feedback")
+	defer db.Close(t)
+	testFeedback(t, db.Database)
+}
+
+func TestSQLite_Item(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Item")
+	defer db.Close(t)
+	testItems(t, db.Database)
+}
+
+func TestSQLite_DeleteUser(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_DeleteUser")
+	defer db.Close(t)
+	testDeleteUser(t, db.Database)
+}
+
+func TestSQLite_DeleteItem(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_DeleteItem")
+	defer db.Close(t)
+	testDeleteItem(t, db.Database)
+}
+
+func TestSQLite_DeleteFeedback(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_DeleteFeedback")
+	defer db.Close(t)
+	testDeleteFeedback(t, db.Database)
+}
+
+func TestSQLite_Measurements(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Measurements")
+	defer db.Close(t)
+	testMeasurements(t, db.Database)
+}
+
+func TestSQLite_Impressions(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestSQLite_Rules(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
+func TestSQLite_TimeLimit(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_TimeLimit")
+	defer db.Close(t)
+	testTimeLimit(t, db.Database)
+}
+
+func TestSQLite_GetClickThroughRate(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_GetClickThroughRate")
+	defer db.Close(t)
+	testGetClickThroughRate(t, db.Database)
+}
+
+func TestSQLite_MigrateFeedback(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_MigrateFeedback")
+	defer db.Close(t)
+	testMigrateFeedback(t, db, "CREATE TABLE feedback ("+
+		"feedback_type varchar(256) NOT NULL,"+
+		"user_id varchar(256) NOT NULL,"+
+		"item_id varchar(256) NOT NULL,"+
+		"time_stamp datetime NOT NULL DEFAULT '0001-01-01',"+
+		"comment TEXT NOT NULL DEFAULT '',"+
+		"PRIMARY KEY(feedback_type, user_id, item_id)"+
+		")")
+}
@@ -45,6 +45,11 @@ var (
 		Subsystem: "worker",
 		Name:      "user_based_recommend_seconds",
 	})
+	SubscribeRecommendSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gorse",
+		Subsystem: "worker",
+		Name:      "subscribe_recommend_seconds",
+	})
 	LoadLatestRecommendCacheSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "gorse",
 		Subsystem: "worker",
@@ -78,6 +78,10 @@ type Worker struct {
 	currentClickModelVersion int64
 	clickModel               click.FactorizationMachine
 
+	// items pulled by the last full round, reused while draining the refresh queue
+	itemCache      ItemCache
+	itemCategories []string
+
 	// peers
 	peers []string
 	me    string
@@ -109,6 +113,15 @@ func NewWorker(masterHost string, masterPort int, httpHost string, httpPort, job
 	}
 }
 
+// Shutdown closes the cache store so that the in-memory cache store writes its snapshot.
+func (w *Worker) Shutdown() {
+	if w.cacheClient != nil {
+		if err := w.cacheClient.Close(); err != nil {
+			base.Logger().Error("failed to close cache store", zap.Error(err))
+		}
+	}
+}
+
 // Sync this worker to the master.
 func (w *Worker) Sync() {
 	defer base.CheckPanic()
@@ -152,10 +165,18 @@ func (w *Worker) Sync() {
 		// connect to cache store
 		if w.cachePath != w.cfg.Database.CacheStore {
 			base.Logger().Info("connect cache store", zap.String("database", w.cfg.Database.CacheStore))
-			if w.cacheClient, err = cache.Open(w.cfg.Database.CacheStore); err != nil {
+			var cacheClient cache.Database
+			if cacheClient, err = cache.Open(w.cfg.Database.CacheStore); err != nil {
 				base.Logger().Error("failed to connect cache store", zap.Error(err))
 				goto sleep
 			}
+			// release previous cache store
+			if w.cacheClient != nil {
+				if err = w.cacheClient.Close(); err != nil {
+					base.Logger().Error("failed to close cache store", zap.Error(err))
+				}
+			}
+			w.cacheClient = cacheClient
 			w.cachePath = w.cfg.Database.CacheStore
 		}
 
@@ -308,10 +329,82 @@ func (w *Worker) Serve() {
 			loop()
 		case <-w.pulledChan:
 			loop()
+		case <-time.After(time.Duration(w.cfg.Recommend.RefreshQueuePeriod) * time.Second):
+			// drain refresh queue between full rounds
+			if w.cfg.Recommend.EnableRefreshQueue {
+				if err := w.refreshQueuedUsers(w.peers, w.me); err != nil {
+					base.Logger().Error("failed to refresh queued users", zap.Error(err))
+				}
+			}
 		}
 	}
 }
 
+// refreshQueuedUsers pops users belonging to this worker from the refresh queue and regenerates their offline
+// recommendation. Users with more new feedback are refreshed first. Users are removed from the queue only after their
+// recommendation is regenerated, so that they are retried if recommendation fails.
+func (w *Worker) refreshQueuedUsers(peers []string, me string) error {
+	queued, err := w.cacheClient.GetSorted(cache.RefreshUsers, 0, -1)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+	// locate me
+	if !funk.ContainsString(peers, me) {
+		return errors.New("current node isn't in worker nodes")
+	}
+	// create consistent hash ring
+	c := consistent.New()
+	for _, peer := range peers {
+		c.Add(peer)
+	}
+	// load users belonging to this worker, unknown users are removed from the queue
+	var users []data.User
+	var members []cache.Scored
+	for _, member := range queued {
+		p, err := c.Get(member.Id)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if p != me {
+			continue
+		}
+		user, err := w.dataClient.GetUser(member.Id)
+		if errors.IsNotFound(err) {
+			if err = w.cacheClient.RemSortedIfScore(cache.RefreshUsers, member.Id, member.Score); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		} else if err != nil {
+			return errors.Trace(err)
+		}
+		users = append(users, user)
+		members = append(members, member)
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	// reuse items of the last full round
+	if w.itemCache == nil {
+		if w.itemCache, w.itemCategories, err = w.pullItems(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	base.Logger().Info("refresh queued users", zap.Int("n_users", len(users)))
+	if err = w.recommend(users, w.itemCache, w.itemCategories, ""); err != nil {
+		return errors.Trace(err)
+	}
+	// pop users, users enqueued again while refreshing are kept for next drain
+	for _, member := range members {
+		if err = w.cacheClient.RemSortedIfScore(cache.RefreshUsers, member.Id, member.Score); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
 // Recommend items to users. The workflow of recommendation is:
 // 1. Skip inactive users.
 // 2. Load historical items.
@@ -329,7 +422,6 @@ func (w *Worker) Recommend(users []data.User) {
 		zap.Int("cache_size", w.cfg.Database.CacheSize))
 
 	// progress tracker
-	completed := make(chan struct{}, 1000)
 	taskName := fmt.Sprintf("Generate offline recommendation [%s]", w.workerName)
 	if w.masterClient != nil {
 		if _, err := w.masterClient.StartTask(context.Background(),
@@ -344,6 +436,35 @@ func (w *Worker) Recommend(users []data.User) {
 		base.Logger().Error("failed to pull items", zap.Error(err))
 		return
 	}
+	w.itemCache, w.itemCategories = itemCache, itemCategories
+
+	// recommendation
+	startTime := time.Now()
+	if err = w.recommend(users, itemCache, itemCategories, taskName); err != nil {
+		base.Logger().Error("failed to continue offline recommendation", zap.Error(err))
+		return
+	}
+	if w.masterClient != nil {
+		if _, err := w.masterClient.FinishTask(context.Background(),
+			&protocol.FinishTaskRequest{Name: taskName}); err != nil {
+			base.Logger().Error("failed to report finish task", zap.Error(err))
+		}
+	}
+	base.Logger().Info("complete ranking recommendation",
+		zap.String("used_time", time.Since(startTime).String()))
+}
+
+// recommend generates offline recommendation for users from pulled items. Progress is reported to the master as the
+// task if the task name is not empty.
+func (w *Worker) recommend(users []data.User, itemCache ItemCache, itemCategories []string, taskName string) error {
+	var err error
+	completed := make(chan struct{}, 1000)
+
+	// build subscription index
+	var subscribeIndex map[string][]string
+	if w.cfg.Recommend.EnableSubscribeRecommend {
+		subscribeIndex = buildSubscribeIndex(itemCache)
+	}
 
 	// build ranking index
 	if w.rankingModel != nil && w.rankingIndex == nil && w.cfg.Recommend.EnableColIndex {
@@ -384,7 +505,7 @@ func (w *Worker) Recommend(users []data.User) {
 				throughput := completedCount - previousCount
 				previousCount = completedCount
 				if throughput > 0 {
-					if w.masterClient != nil {
+					if w.masterClient != nil && taskName != "" {
 						if _, err := w.masterClient.UpdateTask(context.Background(),
 							&protocol.UpdateTaskRequest{Name: taskName, Done: int64(completedCount)}); err != nil {
 							base.Logger().Error("failed to report update task", zap.Error(err))
@@ -399,7 +520,6 @@ func (w *Worker) Recommend(users []data.User) {
 		}
 	}()
 	// recommendation
-	startTime := time.Now()
 	userFeedbackCache := NewFeedbackCache(w.dataClient, w.cfg.Database.PositiveFeedbackType...)
 	err = base.Parallel(len(users), w.jobs, func(workerId, jobId int) error {
 		defer func() {
@@ -433,12 +553,25 @@ func (w *Worker) Recommend(users []data.User) {
 			}
 		}
 
+		// apply arms of experiments
+		strategy := w.cfg.Recommend.GetRecommendStrategy(userId)
+
 		// create candidates container
 		candidates := make(map[string][][]string)
 		candidates[""] = make([][]string, 0)
 		for _, category := range itemCategories {
 			candidates[category] = make([][]string, 0)
 		}
+		// the source of an item is the first recommender producing it
+		sources := make(map[string]string)
+		addCandidates := func(category, source string, items []string) {
+			candidates[category] = append(candidates[category], items)
+			for _, itemId := range items {
+				if _, exist := sources[itemId]; !exist {
+					sources[itemId] = source
+				}
+			}
+		}
 
 		// Recommender #1: collaborative filtering.
 		if w.cfg.Recommend.EnableColRecommend && w.rankingModel != nil {
@@ -456,7 +589,7 @@ func (w *Worker) Recommend(users []data.User) {
 					return errors.Trace(err)
 				}
 				for category, items := range recommend {
-					candidates[category] = append(candidates[category], items)
+					addCandidates(category, "collaborative", items)
 				}
 				CollaborativeRecommendSeconds.Observe(usedTime.Seconds())
 			} else if !w.rankingModel.IsUserPredictable(userIndex) {
@@ -492,7 +625,7 @@ func (w *Worker) Recommend(users []data.User) {
 					filter.Push(id, score)
 				}
 				ids, _ := filter.PopAll()
-				candidates[category] = append(candidates[category], ids)
+				addCandidates(category, "item_based", ids)
 			}
 			ItemBasedRecommendSeconds.Observe(time.Since(localStartTime).Seconds())
 		}
@@ -536,12 +669,27 @@ func (w *Worker) Recommend(users []data.User) {
 			}
 			for category, filter := range filters {
 				ids, _ := filter.PopAll()
-				candidates[category] = append(candidates[category], ids)
+				addCandidates(category, "user_based", ids)
 			}
 			UserBasedRecommendSeconds.Observe(time.Since(localStartTime).Seconds())
 		}
 
-		// Recommender #4: latest items.
+		// Recommender #4: subscribed items.
+		if w.cfg.Recommend.EnableSubscribeRecommend {
+			localStartTime := time.Now()
+			recommend, err := w.subscribeRecommend(userId, user.Subscribe, itemCategories, excludeSet, itemCache, subscribeIndex)
+			if err != nil {
+				base.Logger().Error("failed to recommend subscribed items",
+					zap.String("user_id", userId), zap.Error(err))
+				return errors.Trace(err)
+			}
+			for category, items := range recommend {
+				addCandidates(category, "subscribe", items)
+			}
+			SubscribeRecommendSeconds.Observe(time.Since(localStartTime).Seconds())
+		}
+
+		// Recommender #5: latest items.
 		if w.cfg.Recommend.EnableLatestRecommend {
 			localStartTime := time.Now()
 			for _, category := range append([]string{""}, itemCategories...) {
@@ -556,12 +704,12 @@ func (w *Worker) Recommend(users []data.User) {
 						recommend = append(recommend, latestItem.Id)
 					}
 				}
-				candidates[category] = append(candidates[category], recommend)
+				addCandidates(category, "latest", recommend)
 			}
 			LoadLatestRecommendCacheSeconds.Observe(time.Since(localStartTime).Seconds())
 		}
 
-		// Recommender #5: popular items.
+		// Recommender #6: popular items.
 		if w.cfg.Recommend.EnablePopularRecommend {
 			localStartTime := time.Now()
 			for _, category := range append([]string{""}, itemCategories...) {
@@ -576,7 +724,7 @@ func (w *Worker) Recommend(users []data.User) {
 						recommend = append(recommend, popularItem.Id)
 					}
 				}
-				candidates[category] = append(candidates[category], recommend)
+				addCandidates(category, "popular", recommend)
 			}
 			LoadPopularRecommendCacheSeconds.Observe(time.Since(localStartTime).Seconds())
 		}
@@ -587,7 +735,7 @@ func (w *Worker) Recommend(users []data.User) {
 		// 3. Otherwise, merge all recommenders' results randomly.
 		results := make(map[string][]cache.Scored)
 		for category, catCandidates := range candidates {
-			if w.cfg.Recommend.EnableClickThroughPrediction && w.clickModel != nil {
+			if strategy.EnableClickThroughPrediction && w.clickModel != nil {
 				results[category], err = w.rankByClickTroughRate(user, catCandidates, itemCache)
 				if err != nil {
 					base.Logger().Error("failed to rank items", zap.Error(err))
@@ -603,19 +751,38 @@ func (w *Worker) Recommend(users []data.User) {
 			} else {
 				results[category] = mergeAndShuffle(catCandidates)
 			}
+			// boost subscribed items
+			if w.cfg.Recommend.SubscribeBoost != 0 && len(user.Subscribe) > 0 {
+				results[category] = boostSubscribed(results[category], user.Subscribe, w.cfg.Recommend.SubscribeBoost, itemCache)
+			}
 		}
 
 		// replacement
 		if w.cfg.Recommend.EnableReplacement {
-			if results, err = w.replacement(results, user, feedbacks, itemCache); err != nil {
+			if results, err = w.replacement(results, user, feedbacks, itemCache, strategy); err != nil {
 				base.Logger().Error("failed to replace items", zap.Error(err))
 				return errors.Trace(err)
 			}
+			for _, result := range results {
+				for _, item := range result {
+					if _, exist := sources[item.Id]; !exist {
+						sources[item.Id] = "replacement"
+					}
+				}
+			}
+		}
+
+		// diversify
+		if w.cfg.Recommend.EnableDiversity {
+			for category, result := range results {
+				results[category] = diversify(result, itemCache, &w.cfg.Recommend)
+			}
 		}
 
 		// explore latest and popular
+		resultSources := make(map[string]string)
 		for category, result := range results {
-			results[category], err = w.exploreRecommend(result, excludeSet, category)
+			results[category], err = w.exploreRecommend(result, excludeSet, category, strategy.ExploreRecommend, sources)
 			if err != nil {
 				base.Logger().Error("failed to explore latest and popular items", zap.Error(err))
 				return errors.Trace(err)
@@ -625,6 +792,20 @@ func (w *Worker) Recommend(users []data.User) {
 				base.Logger().Error("failed to cache recommendation", zap.Error(err))
 				return errors.Trace(err)
 			}
+			for _, item := range results[category] {
+				if source, exist := sources[item.Id]; exist {
+					resultSources[item.Id] = source
+				}
+			}
+		}
+		// sources of recommended items are stored next to the recommendation
+		sourcesJSON, err := json.Marshal(resultSources)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = w.cacheClient.SetString(cache.OfflineRecommendSources, userId, string(sourcesJSON)); err != nil {
+			base.Logger().Error("failed to cache sources of recommendation", zap.Error(err))
+			return errors.Trace(err)
 		}
 		if err = w.cacheClient.SetTime(cache.LastUpdateUserRecommendTime, userId, time.Now()); err != nil {
 			base.Logger().Error("failed to cache recommendation time", zap.Error(err))
@@ -640,18 +821,7 @@ func (w *Worker) Recommend(users []data.User) {
 		return nil
 	})
 	close(completed)
-	if err != nil {
-		base.Logger().Error("failed to continue offline recommendation", zap.Error(err))
-		return
-	}
-	if w.masterClient != nil {
-		if _, err := w.masterClient.FinishTask(context.Background(),
-			&protocol.FinishTaskRequest{Name: taskName}); err != nil {
-			base.Logger().Error("failed to report finish task", zap.Error(err))
-		}
-	}
-	base.Logger().Info("complete ranking recommendation",
-		zap.String("used_time", time.Since(startTime).String()))
+	return errors.Trace(err)
 }
 
 func (w *Worker) collaborativeRecommendBruteForce(userId string, itemCategories []string, excludeSet *strset.Set, itemCache ItemCache) (map[string][]string, time.Duration, error) {
@@ -712,6 +882,95 @@ func (w *Worker) collaborativeRecommendHNSW(rankingIndex *search.HNSW, userId st
 	return recommend, time.Since(localStartTime), nil
 }
 
+// subscribeRecommend recommends the latest items matching subscriptions of a user.
+func (w *Worker) subscribeRecommend(userId string, subscribe, itemCategories []string, excludeSet *strset.Set, itemCache ItemCache, subscribeIndex map[string][]string) (map[string][]string, error) {
+	filters := make(map[string]*heap.TopKStringFilter)
+	filters[""] = heap.NewTopKStringFilter(w.cfg.Database.CacheSize)
+	for _, category := range itemCategories {
+		filters[category] = heap.NewTopKStringFilter(w.cfg.Database.CacheSize)
+	}
+	memo := strset.New()
+	for _, subscription := range subscribe {
+		for _, itemId := range subscribeIndex[subscription] {
+			if !memo.Has(itemId) && !excludeSet.Has(itemId) && itemCache.IsAvailable(itemId) {
+				memo.Add(itemId)
+				timestamp := float32(itemCache[itemId].Timestamp.Unix())
+				filters[""].Push(itemId, timestamp)
+				for _, category := range itemCache[itemId].Categories {
+					filters[category].Push(itemId, timestamp)
+				}
+			}
+		}
+	}
+	// save result
+	recommend := make(map[string][]string)
+	for category, filter := range filters {
+		items, scores := filter.PopAll()
+		recommend[category] = items
+		if err := w.cacheClient.SetCategoryScores(cache.SubscribeItems, userId, category, cache.CreateScoredItems(items, scores)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return recommend, nil
+}
+
+// buildSubscribeIndex maps categories and labels to items.
+func buildSubscribeIndex(itemCache ItemCache) map[string][]string {
+	index := make(map[string][]string)
+	for itemId, item := range itemCache {
+		if item.IsHidden {
+			continue
+		}
+		for _, subscription := range strset.New(append(item.Categories, item.Labels...)...).List() {
+			index[subscription] = append(index[subscription], itemId)
+		}
+	}
+	return index
+}
+
+// isSubscribed checks whether categories or labels of an item match subscriptions.
+func isSubscribed(item data.Item, subscribe *strset.Set) bool {
+	for _, category := range item.Categories {
+		if subscribe.Has(category) {
+			return true
+		}
+	}
+	for _, label := range item.Labels {
+		if subscribe.Has(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// boostSubscribed adds boost to scores of subscribed items and sorts items again.
+func boostSubscribed(items []cache.Scored, subscribe []string, boost float32, itemCache ItemCache) []cache.Scored {
+	subscribeSet := strset.New(subscribe...)
+	for i := range items {
+		if item, exist := itemCache[items[i].Id]; exist && isSubscribed(item, subscribeSet) {
+			items[i].Score += boost
+		}
+	}
+	cache.SortScores(items)
+	return items
+}
+
+// diversify re-ranks items by maximal marginal relevance with caps on labels.
+func diversify(items []cache.Scored, itemCache ItemCache, cfg *config.RecommendConfig) []cache.Scored {
+	labels := make([][]string, len(items))
+	categories := make([][]string, len(items))
+	for i, item := range items {
+		labels[i] = itemCache[item.Id].Labels
+		categories[i] = itemCache[item.Id].Categories
+	}
+	order := base.Diversify(cache.GetScores(items), labels, categories, cfg.DiversityLambda, cfg.DiversityWindow, cfg.DiversityCaps)
+	diversified := make([]cache.Scored, len(items))
+	for i, j := range order {
+		diversified[i] = items[j]
+	}
+	return diversified
+}
+
 func (w *Worker) rankByCollaborativeFiltering(userId string, candidates [][]string) ([]cache.Scored, error) {
 	// concat candidates
 	memo := strset.New()
@@ -759,12 +1018,14 @@ func (w *Worker) rankByClickTroughRate(user data.User, candidates [][]string, it
 			base.Logger().Warn("item doesn't exists in database", zap.String("item_id", itemId))
 		}
 	}
-	// rank by CTR
+	// rank by CTR, context labels are derived from the time of recommendation
 	topItems := make([]cache.Scored, 0, len(items))
+	userAttributes := user.GetAttributes(w.cfg.Database.UserAttributes)
+	ctxLabels := click.TimeContextLabels(time.Now())
 	for _, item := range items {
 		topItems = append(topItems, cache.Scored{
 			Id:    item.ItemId,
-			Score: w.clickModel.Predict(user.UserId, item.ItemId, user.Labels, item.Labels),
+			Score: w.clickModel.Predict(user.UserId, item.ItemId, user.Labels, item.Labels, userAttributes, ctxLabels),
 		})
 	}
 	cache.SortScores(topItems)
@@ -799,7 +1060,8 @@ func mergeAndShuffle(candidates [][]string) []cache.Scored {
 	return recommend
 }
 
-func (w *Worker) exploreRecommend(exploitRecommend []cache.Scored, excludeSet *strset.Set, category string) ([]cache.Scored, error) {
+func (w *Worker) exploreRecommend(exploitRecommend []cache.Scored, excludeSet *strset.Set, category string, exploreRatios map[string]float64,
+	sources map[string]string) ([]cache.Scored, error) {
 	var localExcludeSet *strset.Set
 	if w.cfg.Recommend.EnableReplacement {
 		localExcludeSet = strset.New()
@@ -808,11 +1070,11 @@ func (w *Worker) exploreRecommend(exploitRecommend []cache.Scored, excludeSet *s
 	}
 	// create thresholds
 	explorePopularThreshold := 0.0
-	if threshold, exist := w.cfg.Recommend.GetExploreRecommend("popular"); exist {
+	if threshold, exist := exploreRatios["popular"]; exist {
 		explorePopularThreshold = threshold
 	}
 	exploreLatestThreshold := explorePopularThreshold
-	if threshold, exist := w.cfg.Recommend.GetExploreRecommend("latest"); exist {
+	if threshold, exist := exploreRatios["latest"]; exist {
 		exploreLatestThreshold += threshold
 	}
 	// load popular items
@@ -830,11 +1092,12 @@ func (w *Worker) exploreRecommend(exploitRecommend []cache.Scored, excludeSet *s
 	for range exploitRecommend {
 		dice := rand.Float64()
 		var recommendItem cache.Scored
+		var source string
 		if dice < explorePopularThreshold && len(popularItems) > 0 {
-			recommendItem = popularItems[0]
+			recommendItem, source = popularItems[0], "popular"
 			popularItems = popularItems[1:]
 		} else if dice < exploreLatestThreshold && len(latestItems) > 0 {
-			recommendItem = latestItems[0]
+			recommendItem, source = latestItems[0], "latest"
 			latestItems = latestItems[1:]
 		} else if len(exploitRecommend) > 0 {
 			recommendItem = exploitRecommend[0]
@@ -845,6 +1108,10 @@ func (w *Worker) exploreRecommend(exploitRecommend []cache.Scored, excludeSet *s
 		if !localExcludeSet.Has(recommendItem.Id) {
 			localExcludeSet.Add(recommendItem.Id)
 			exploreRecommend = append(exploreRecommend, recommendItem)
+			// explored items are sourced from popular or latest items unless recommended by exploitation
+			if _, exist := sources[recommendItem.Id]; !exist && source != "" {
+				sources[recommendItem.Id] = source
+			}
 		}
 	}
 	return exploreRecommend, nil
@@ -981,7 +1248,7 @@ func (w *Worker) pullUsers(peers []string, me string) ([]data.User, error) {
 }
 
 // replacement inserts historical items back to recommendation.
-func (w *Worker) replacement(recommend map[string][]cache.Scored, user data.User, feedbacks []data.Feedback, itemCache ItemCache) (map[string][]cache.Scored, error) {
+func (w *Worker) replacement(recommend map[string][]cache.Scored, user data.User, feedbacks []data.Feedback, itemCache ItemCache, strategy *config.RecommendStrategy) (map[string][]cache.Scored, error) {
 	upperBounds := make(map[string]float32)
 	lowerBounds := make(map[string]float32)
 	newRecommend := make(map[string][]cache.Scored)
@@ -1018,8 +1285,9 @@ func (w *Worker) replacement(recommend map[string][]cache.Scored, user data.User
 			// 2. If collaborative filtering model is available, use it.
 			// 3. Otherwise, give a random score.
 			var score float32
-			if w.cfg.Recommend.EnableClickThroughPrediction && w.clickModel != nil {
-				score = w.clickModel.Predict(user.UserId, itemId, user.Labels, item.Labels)
+			if strategy.EnableClickThroughPrediction && w.clickModel != nil {
+				score = w.clickModel.Predict(user.UserId, itemId, user.Labels, item.Labels,
+					user.GetAttributes(w.cfg.Database.UserAttributes), click.TimeContextLabels(time.Now()))
 			} else if w.rankingModel != nil && w.rankingModel.IsUserPredictable(w.rankingModel.GetUserIndex().ToNumber(user.UserId)) {
 				score = w.rankingModel.Predict(user.UserId, itemId)
 			} else {
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/bits-and-blooms/bitset"
+	"github.com/juju/errors"
 	"github.com/scylladb/go-set/strset"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/base"
@@ -65,6 +66,95 @@ func TestPullUsers(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestRefreshQueuedUsers(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.cfg.Recommend.EnableColRecommend = false
+	w.cfg.Recommend.EnableLatestRecommend = true
+	// insert latest items
+	err := w.cacheClient.SetSorted(cache.LatestItems, []cache.Scored{{"10", 10}, {"9", 9}})
+	assert.NoError(t, err)
+	err = w.dataClient.BatchInsertItems([]data.Item{{ItemId: "10"}, {ItemId: "9"}})
+	assert.NoError(t, err)
+	// insert users and queue
+	err = w.dataClient.BatchInsertUsers([]data.User{{UserId: "1"}, {UserId: "2"}, {UserId: "3"}})
+	assert.NoError(t, err)
+	err = w.cacheClient.SetSorted(cache.RefreshUsers, []cache.Scored{{"1", 1}, {"2", 2}, {"3", 3}, {"100", 1}})
+	assert.NoError(t, err)
+	// refresh users belonging to this worker
+	err = w.refreshQueuedUsers([]string{"a", "b", "c"}, "b")
+	assert.NoError(t, err)
+	queued, err := w.cacheClient.GetSorted(cache.RefreshUsers, 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Scored{{"2", 2}, {"100", 1}}, queued)
+	recommends, err := w.cacheClient.GetScores(cache.OfflineRecommend, "1", 0, -1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10", "9"}, cache.RemoveScores(recommends))
+	recommends, err = w.cacheClient.GetScores(cache.OfflineRecommend, "2", 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, recommends)
+	// items of the last round are reused
+	err = w.dataClient.BatchInsertItems([]data.Item{{ItemId: "11"}})
+	assert.NoError(t, err)
+	err = w.cacheClient.SetSorted(cache.LatestItems, []cache.Scored{{"11", 11}, {"10", 10}, {"9", 9}})
+	assert.NoError(t, err)
+	err = w.cacheClient.IncrSorted(cache.RefreshUsers, "1")
+	assert.NoError(t, err)
+	err = w.refreshQueuedUsers([]string{"a", "b", "c"}, "b")
+	assert.NoError(t, err)
+	recommends, err = w.cacheClient.GetScores(cache.OfflineRecommend, "1", 0, -1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10", "9"}, cache.RemoveScores(recommends))
+	// users enqueued again while draining are kept
+	w.cacheClient = &enqueueWhileDraining{Database: w.cacheClient, userId: "1"}
+	err = w.cacheClient.IncrSorted(cache.RefreshUsers, "1")
+	assert.NoError(t, err)
+	err = w.refreshQueuedUsers([]string{"a", "b", "c"}, "b")
+	assert.NoError(t, err)
+	score, err := w.cacheClient.GetSortedScore(cache.RefreshUsers, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, float32(2), score)
+	// users are kept if recommendation fails
+	w.cacheClient = &failOfflineRecommend{Database: w.cacheClient.(*enqueueWhileDraining).Database}
+	err = w.cacheClient.SetTime(cache.LastModifyUserTime, "1", time.Now())
+	assert.NoError(t, err)
+	err = w.refreshQueuedUsers([]string{"a", "b", "c"}, "b")
+	assert.Error(t, err)
+	score, err = w.cacheClient.GetSortedScore(cache.RefreshUsers, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, float32(2), score)
+	// unknown worker
+	err = w.refreshQueuedUsers([]string{"a", "b", "c"}, "d")
+	assert.Error(t, err)
+}
+
+// enqueueWhileDraining enqueues a user again after the refresh queue is read.
+type enqueueWhileDraining struct {
+	cache.Database
+	userId string
+}
+
+func (db *enqueueWhileDraining) GetSorted(key string, begin, end int) ([]cache.Scored, error) {
+	scores, err := db.Database.GetSorted(key, begin, end)
+	if err != nil || key != cache.RefreshUsers {
+		return scores, err
+	}
+	return scores, db.Database.IncrSorted(key, db.userId)
+}
+
+// failOfflineRecommend fails to save offline recommendation.
+type failOfflineRecommend struct {
+	cache.Database
+}
+
+func (db *failOfflineRecommend) SetCategoryScores(prefix, name, category string, items []cache.Scored) error {
+	if prefix == cache.OfflineRecommend {
+		return errors.New("failed to save offline recommendation")
+	}
+	return db.Database.SetCategoryScores(prefix, name, category, items)
+}
+
 func TestCheckRecommendCacheTimeout(t *testing.T) {
 	// create mock worker
 	w := newMockWorker(t)
@@ -494,6 +584,79 @@ func TestRecommend_Latest(t *testing.T) {
 	recommends, err = w.cacheClient.GetCategoryScores(cache.OfflineRecommend, "0", "*", 0, -1)
 	assert.NoError(t, err)
 	assert.Equal(t, []cache.Scored{{"20", 20}, {"19", 19}, {"18", 18}}, recommends)
+	// sources of recommended items
+	sources, err := w.cacheClient.GetString(cache.OfflineRecommendSources, "0")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"10":"latest","9":"latest","8":"latest","20":"latest","19":"latest","18":"latest"}`, sources)
+}
+
+func TestRecommend_Subscribe(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.cfg.Recommend.EnableColRecommend = false
+	w.cfg.Recommend.EnableSubscribeRecommend = true
+	w.cfg.Recommend.SubscribeBoost = 10
+	// insert items
+	err := w.dataClient.BatchInsertItems([]data.Item{
+		{ItemId: "1", Labels: []string{"a"}, Timestamp: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ItemId: "2", Categories: []string{"a", "*"}, Timestamp: time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ItemId: "3", Labels: []string{"b"}, Timestamp: time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ItemId: "4", Labels: []string{"a"}, IsHidden: true, Timestamp: time.Date(2004, 1, 1, 0, 0, 0, 0, time.UTC)},
+	})
+	assert.NoError(t, err)
+	w.rankingModel = newMockMatrixFactorizationForRecommend(1, 10)
+	w.Recommend([]data.User{{UserId: "0", Subscribe: []string{"a"}}})
+	// subscribed items are sorted by timestamp
+	subscribed, err := w.cacheClient.GetScores(cache.SubscribeItems, "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, cache.RemoveScores(subscribed))
+	subscribed, err = w.cacheClient.GetCategoryScores(cache.SubscribeItems, "0", "*", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, cache.RemoveScores(subscribed))
+	// subscribed items are boosted
+	recommends, err := w.cacheClient.GetScores(cache.OfflineRecommend, "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Scored{{"2", 12}, {"1", 11}}, recommends)
+}
+
+func TestBoostSubscribed(t *testing.T) {
+	itemCache := ItemCache{
+		"1": {ItemId: "1", Labels: []string{"a"}},
+		"2": {ItemId: "2", Categories: []string{"b"}},
+		"3": {ItemId: "3", Labels: []string{"c"}},
+	}
+	scores := boostSubscribed([]cache.Scored{{"3", 3}, {"2", 2}, {"1", 1}}, []string{"a", "b"}, 5, itemCache)
+	assert.Equal(t, []cache.Scored{{"2", 7}, {"1", 6}, {"3", 3}}, scores)
+}
+
+func TestRecommend_Diversity(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.cfg.Recommend.EnableColRecommend = false
+	w.cfg.Recommend.EnableLatestRecommend = true
+	w.cfg.Recommend.EnableDiversity = true
+	w.cfg.Recommend.DiversityLambda = 1
+	w.cfg.Recommend.DiversityWindow = 3
+	w.cfg.Recommend.DiversityCaps = map[string]int{"author:": 2}
+	// insert latest items
+	err := w.cacheClient.SetSorted(cache.LatestItems, []cache.Scored{{"10", 10}, {"9", 9}, {"8", 8}, {"7", 7}})
+	assert.NoError(t, err)
+	// insert items
+	err = w.dataClient.BatchInsertItems([]data.Item{
+		{ItemId: "10", Labels: []string{"author:x"}},
+		{ItemId: "9", Labels: []string{"author:x"}},
+		{ItemId: "8", Labels: []string{"author:x"}},
+		{ItemId: "7", Labels: []string{"author:y"}},
+	})
+	assert.NoError(t, err)
+	w.rankingModel = newMockMatrixFactorizationForRecommend(1, 10)
+	w.Recommend([]data.User{{UserId: "0"}})
+	// at most 2 items of an author in the first 3 positions
+	recommends, err := w.cacheClient.GetScores(cache.OfflineRecommend, "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.Scored{{"10", 10}, {"9", 9}, {"7", 7}, {"8", 8}}, recommends)
 }
 
 func TestRecommend_ColdStart(t *testing.T) {
@@ -558,13 +721,15 @@ func TestExploreRecommend(t *testing.T) {
 	err = w.cacheClient.SetSorted(cache.LatestItems, []cache.Scored{{"latest", 0}})
 	assert.NoError(t, err)
 
+	sources := make(map[string]string)
 	recommend, err := w.exploreRecommend(cache.CreateScoredItems(
 		[]string{"1", "2", "3", "4", "5", "6", "7", "8"},
-		[]float32{0, 0, 0, 0, 0, 0, 0, 0}), strset.New(), "")
+		[]float32{0, 0, 0, 0, 0, 0, 0, 0}), strset.New(), "", w.cfg.Recommend.ExploreRecommend, sources)
 	assert.NoError(t, err)
 	items := cache.RemoveScores(recommend)
 	assert.Contains(t, items, "latest")
 	assert.Contains(t, items, "popular")
+	assert.Equal(t, map[string]string{"latest": "latest", "popular": "popular"}, sources)
 	assert.Equal(t, 8, len(recommend))
 }
 
@@ -733,7 +898,11 @@ func (m mockFactorizationMachine) Invalid() bool {
 	panic("implement me")
 }
 
-func (m mockFactorizationMachine) Predict(_, itemId string, _, _ []string) float32 {
+func (m mockFactorizationMachine) Predict(_, itemId string, _, _, _, ctxLabels []string) float32 {
+	// context labels are derived from the time of recommendation
+	if len(ctxLabels) == 0 {
+		panic("context labels are missing")
+	}
 	score, err := strconv.Atoi(itemId)
 	if err != nil {
 		panic(err)